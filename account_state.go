@@ -0,0 +1,551 @@
+package banexg
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/banbox/banexg/errs"
+	"github.com/banbox/banexg/log"
+	"github.com/banbox/banexg/utils"
+	"github.com/sasha-s/go-deadlock"
+	"go.uber.org/zap"
+)
+
+const (
+	DriftBalance  = "balance"
+	DriftPosition = "position"
+)
+
+var (
+	rewatchMinWait = time.Second // first wait before watching again after the chan closed
+	rewatchMaxWait = time.Minute
+)
+
+/*
+AccountDrift
+difference between the local state (from websocket) and REST found in reconciliation
+对账时发现的本地状态（来自websocket）与REST结果的差异
+*/
+type AccountDrift struct {
+	Account    string
+	MarketType string
+	Kind       string  // DriftBalance / DriftPosition
+	Key        string  // currency code for balance, symbol|side for position
+	Local      float64 // total of asset or contracts of position from local state
+	Remote     float64 // value from REST
+}
+
+/*
+AccountState
+keep Account.MarBalances and Account.MarPositions current from WatchBalance/WatchPositions,
+reconcile them against FetchBalance/FetchPositions periodically and after websocket reconnects.
+Incremental websocket updates are merged, so it works the same for all adapters.
+通过WatchBalance/WatchPositions保持Account.MarBalances和Account.MarPositions最新，
+并定期及websocket重连后与FetchBalance/FetchPositions对账。websocket增量更新会被合并，各交易所行为一致
+*/
+type AccountState struct {
+	Exg         BanExchange
+	Account     string
+	MarketTypes []string      // market types to watch, use exchange MarketType if empty
+	SyncIntv    time.Duration // interval to reconcile with REST, 0 to only sync after reconnects
+	Tolerance   float64       // relative tolerance when comparing values
+	// OnDrift is called with drifts found in reconciliation, log warnings if nil
+	OnDrift func(drifts []*AccountDrift)
+
+	acc       *Account
+	updates   map[string]int64 // marketType: last update timestamp
+	lock      deadlock.Mutex
+	syncLock  deadlock.Mutex
+	outs      []interface{} // chans of WatchBalance/WatchPositions, released by Stop
+	delReCon  func()        // remove the callback of AddAfterWsReCon
+	syncChan  chan struct{}
+	stopChan  chan struct{}
+	isStopped bool
+}
+
+/*
+NewAccountState
+create state manager for account, the default account is used if account is empty. Call Start to run.
+为账户创建状态管理器，account为空时使用默认账户。调用Start启动
+*/
+func NewAccountState(exg BanExchange, account string, marketTypes ...string) *AccountState {
+	if account == "" {
+		account = exg.GetExg().DefAccName
+	}
+	if len(marketTypes) == 0 {
+		marketTypes = []string{exg.GetExg().MarketType}
+	}
+	return &AccountState{
+		Exg:         exg,
+		Account:     account,
+		MarketTypes: marketTypes,
+		SyncIntv:    time.Minute,
+		Tolerance:   1e-6,
+		updates:     make(map[string]int64),
+		syncChan:    make(chan struct{}, 1),
+		stopChan:    make(chan struct{}),
+	}
+}
+
+/*
+Start watch balances (and positions for contract markets), then reconcile by REST.
+If any watch fails, the state is stopped and watches already started are released.
+监听余额（合约市场还有仓位），然后通过REST对账。任一监听失败时停止并释放已启动的监听
+*/
+func (s *AccountState) Start() *errs.Error {
+	acc, err := s.Exg.GetAccount(s.Account)
+	if err != nil {
+		return err
+	}
+	s.acc = acc
+	s.Account = acc.Name
+	if err = s.watchAll(); err != nil {
+		s.Stop()
+		return err
+	}
+	delReCon := s.Exg.AddAfterWsReCon(func(client *WsClient) {
+		if client.AccName == s.Account {
+			s.TriggerSync()
+		}
+	})
+	s.lock.Lock()
+	s.delReCon = delReCon
+	s.lock.Unlock()
+	_, err = s.Sync()
+	go s.loopSync()
+	return err
+}
+
+func (s *AccountState) watchAll() *errs.Error {
+	for _, marketType := range s.MarketTypes {
+		balOut, err := s.Exg.WatchBalance(s.params(marketType))
+		if err != nil {
+			return err
+		}
+		if !s.addOut(nil, balOut) {
+			return errs.NewMsg(errs.CodeRunTime, "AccountState stopped")
+		}
+		go s.consumeBalance(marketType, balOut)
+		if !s.Exg.IsContract(marketType) {
+			continue
+		}
+		posOut, err := s.Exg.WatchPositions(s.params(marketType))
+		if err != nil {
+			return err
+		}
+		if !s.addOut(nil, posOut) {
+			return errs.NewMsg(errs.CodeRunTime, "AccountState stopped")
+		}
+		go s.consumePositions(marketType, posOut)
+	}
+	return nil
+}
+
+/*
+Stop stop all goroutines, release chans of WatchBalance/WatchPositions and remove the reconnect callback
+停止所有协程，释放WatchBalance/WatchPositions的通道并移除重连回调
+*/
+func (s *AccountState) Stop() {
+	s.lock.Lock()
+	if s.isStopped {
+		s.lock.Unlock()
+		return
+	}
+	s.isStopped = true
+	close(s.stopChan)
+	outs, delReCon := s.outs, s.delReCon
+	s.outs, s.delReCon = nil, nil
+	s.lock.Unlock()
+	if delReCon != nil {
+		delReCon()
+	}
+	for _, out := range outs {
+		s.Exg.GetExg().ReleaseWsOut(out)
+	}
+}
+
+// addOut save out in place of old (nil to append), it's released at once and false is returned if stopped
+func (s *AccountState) addOut(old, out interface{}) bool {
+	s.lock.Lock()
+	stopped := s.isStopped
+	if !stopped {
+		found := false
+		if old != nil {
+			for i, item := range s.outs {
+				if item == old {
+					s.outs[i], found = out, true
+					break
+				}
+			}
+		}
+		if !found {
+			s.outs = append(s.outs, out)
+		}
+	}
+	s.lock.Unlock()
+	if stopped {
+		s.Exg.GetExg().ReleaseWsOut(out)
+	}
+	return !stopped
+}
+
+// TriggerSync request an asynchronous REST reconciliation
+func (s *AccountState) TriggerSync() {
+	select {
+	case s.syncChan <- struct{}{}:
+	default:
+	}
+}
+
+func (s *AccountState) params(marketType string) map[string]interface{} {
+	return map[string]interface{}{ParamAccount: s.Account, ParamMarket: marketType}
+}
+
+func (s *AccountState) loopSync() {
+	var tick <-chan time.Time
+	if s.SyncIntv > 0 {
+		ticker := time.NewTicker(s.SyncIntv)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-tick:
+		case <-s.syncChan:
+		}
+		if _, err := s.Sync(); err != nil {
+			log.Warn("account state sync fail", zap.String("acc", s.Account), zap.String("err", err.Short()))
+		}
+	}
+}
+
+func (s *AccountState) consumeBalance(marketType string, out chan *Balances) {
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case bal, ok := <-out:
+			if ok {
+				s.OnBalance(marketType, bal)
+				continue
+			}
+		}
+		// websocket closed, watch again and fill the gap by REST
+		log.Warn("account state: balance chan closed, rewatch", zap.String("acc", s.Account))
+		old := out
+		out = rewatch(s.stopChan, "balance/"+s.Account, func() (chan *Balances, *errs.Error) {
+			return s.Exg.WatchBalance(s.params(marketType))
+		})
+		if out == nil || !s.addOut(old, out) {
+			return
+		}
+		s.TriggerSync()
+	}
+}
+
+func (s *AccountState) consumePositions(marketType string, out chan []*Position) {
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case items, ok := <-out:
+			if ok {
+				s.OnPositions(marketType, items)
+				continue
+			}
+		}
+		log.Warn("account state: positions chan closed, rewatch", zap.String("acc", s.Account))
+		old := out
+		out = rewatch(s.stopChan, "positions/"+s.Account, func() (chan []*Position, *errs.Error) {
+			return s.Exg.WatchPositions(s.params(marketType))
+		})
+		if out == nil || !s.addOut(old, out) {
+			return
+		}
+		s.TriggerSync()
+	}
+}
+
+/*
+rewatch call watch with exponential backoff until it succeeds, return nil if stop is closed
+以指数退避调用watch直到成功，stop关闭时返回nil
+*/
+func rewatch[T any](stop chan struct{}, name string, watch func() (chan T, *errs.Error)) chan T {
+	wait := rewatchMinWait
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(wait):
+		}
+		out, err := watch()
+		if err == nil {
+			return out
+		}
+		log.Warn("rewatch fail", zap.String("name", name), zap.Duration("wait", wait), zap.String("err", err.Short()))
+		wait = min(wait*2, rewatchMaxWait)
+	}
+}
+
+/*
+OnBalance merge balances from websocket, assets not in bal are kept
+合并websocket推送的余额，bal中不存在的资产保持不变
+*/
+func (s *AccountState) OnBalance(marketType string, bal *Balances) {
+	if bal == nil || s.acc == nil {
+		return
+	}
+	s.acc.LockBalance.Lock()
+	s.acc.MarBalances[marketType] = mergeBalances(s.acc.MarBalances[marketType], bal)
+	s.acc.LockBalance.Unlock()
+	s.setUpdate(marketType)
+}
+
+/*
+OnPositions merge positions from websocket, positions with zero contracts are removed
+合并websocket推送的仓位，数量为0的仓位被移除
+*/
+func (s *AccountState) OnPositions(marketType string, items []*Position) {
+	if s.acc == nil {
+		return
+	}
+	s.acc.LockPos.Lock()
+	s.acc.MarPositions[marketType] = mergePositions(s.acc.MarPositions[marketType], items)
+	s.acc.LockPos.Unlock()
+	s.setUpdate(marketType)
+}
+
+func (s *AccountState) setUpdate(marketType string) {
+	s.lock.Lock()
+	s.updates[marketType] = s.Exg.MilliSeconds()
+	s.lock.Unlock()
+}
+
+/*
+Sync fetch balances and positions by REST, replace the local state and return drifts found
+通过REST获取余额和仓位，替换本地状态，并返回发现的差异
+*/
+func (s *AccountState) Sync() ([]*AccountDrift, *errs.Error) {
+	if s.acc == nil {
+		return nil, errs.NewMsg(errs.CodeRunTime, "AccountState not started")
+	}
+	s.syncLock.Lock()
+	defer s.syncLock.Unlock()
+	var drifts []*AccountDrift
+	var lastErr *errs.Error
+	for _, marketType := range s.MarketTypes {
+		bal, err := s.Exg.FetchBalance(s.params(marketType))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		s.acc.LockBalance.Lock()
+		drifts = append(drifts, s.diffBalances(marketType, s.acc.MarBalances[marketType], bal)...)
+		s.acc.MarBalances[marketType] = bal
+		s.acc.LockBalance.Unlock()
+		if s.Exg.IsContract(marketType) {
+			positions, err := s.Exg.FetchPositions(nil, s.params(marketType))
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			positions = mergePositions(nil, positions)
+			s.acc.LockPos.Lock()
+			drifts = append(drifts, s.diffPositions(marketType, s.acc.MarPositions[marketType], positions)...)
+			s.acc.MarPositions[marketType] = positions
+			s.acc.LockPos.Unlock()
+		}
+		s.setUpdate(marketType)
+	}
+	if len(drifts) > 0 {
+		if s.OnDrift != nil {
+			s.OnDrift(drifts)
+		} else {
+			for _, d := range drifts {
+				log.Warn("account state drift", zap.String("acc", d.Account), zap.String("market", d.MarketType),
+					zap.String("kind", d.Kind), zap.String("key", d.Key), zap.Float64("local", d.Local),
+					zap.Float64("remote", d.Remote))
+			}
+		}
+	}
+	return drifts, lastErr
+}
+
+func (s *AccountState) isDrift(local, remote float64) bool {
+	diff := math.Abs(local - remote)
+	return diff > 1e-12 && diff > s.Tolerance*math.Max(math.Abs(local), math.Abs(remote))
+}
+
+func (s *AccountState) diffBalances(marketType string, local, remote *Balances) []*AccountDrift {
+	if local == nil {
+		// no local state yet
+		return nil
+	}
+	totals := make(map[string][2]float64)
+	for code, a := range local.Assets {
+		totals[code] = [2]float64{a.Total, 0}
+	}
+	for code, a := range remote.Assets {
+		item := totals[code]
+		item[1] = a.Total
+		totals[code] = item
+	}
+	var res []*AccountDrift
+	for code, item := range totals {
+		if s.isDrift(item[0], item[1]) {
+			res = append(res, &AccountDrift{Account: s.Account, MarketType: marketType, Kind: DriftBalance,
+				Key: code, Local: item[0], Remote: item[1]})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Key < res[j].Key })
+	return res
+}
+
+func (s *AccountState) diffPositions(marketType string, local, remote []*Position) []*AccountDrift {
+	if local == nil {
+		return nil
+	}
+	sizes := make(map[string][2]float64)
+	for _, p := range local {
+		sizes[posStateKey(p)] = [2]float64{p.Contracts, 0}
+	}
+	for _, p := range remote {
+		key := posStateKey(p)
+		item := sizes[key]
+		item[1] = p.Contracts
+		sizes[key] = item
+	}
+	var res []*AccountDrift
+	for key, item := range sizes {
+		if s.isDrift(item[0], item[1]) {
+			res = append(res, &AccountDrift{Account: s.Account, MarketType: marketType, Kind: DriftPosition,
+				Key: key, Local: item[0], Remote: item[1]})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Key < res[j].Key })
+	return res
+}
+
+// Balances return a copy of balances of marketType, nil if not loaded
+func (s *AccountState) Balances(marketType string) *Balances {
+	if s.acc == nil {
+		return nil
+	}
+	s.acc.LockBalance.Lock()
+	defer s.acc.LockBalance.Unlock()
+	bal := s.acc.MarBalances[marketType]
+	if bal == nil {
+		return nil
+	}
+	res := mergeBalances(nil, bal)
+	if len(bal.IsolatedAssets) > 0 {
+		res.IsolatedAssets = make(map[string]map[string]*Asset, len(bal.IsolatedAssets))
+		for symbol, items := range bal.IsolatedAssets {
+			assets := make(map[string]*Asset, len(items))
+			for code, a := range items {
+				item := *a
+				assets[code] = &item
+			}
+			res.IsolatedAssets[symbol] = assets
+		}
+	}
+	return res
+}
+
+// Asset return a copy of asset of marketType, nil if not exist
+func (s *AccountState) Asset(marketType, code string) *Asset {
+	if s.acc == nil {
+		return nil
+	}
+	s.acc.LockBalance.Lock()
+	defer s.acc.LockBalance.Unlock()
+	if bal := s.acc.MarBalances[marketType]; bal != nil {
+		if a, ok := bal.Assets[code]; ok {
+			res := *a
+			return &res
+		}
+	}
+	return nil
+}
+
+// Positions return copies of positions of marketType, all symbols if symbol is empty
+func (s *AccountState) Positions(marketType, symbol string) []*Position {
+	if s.acc == nil {
+		return nil
+	}
+	s.acc.LockPos.Lock()
+	defer s.acc.LockPos.Unlock()
+	var res []*Position
+	for _, p := range s.acc.MarPositions[marketType] {
+		if symbol == "" || p.Symbol == symbol {
+			item := *p
+			res = append(res, &item)
+		}
+	}
+	return res
+}
+
+// LastUpdate return the 13 digits timestamp of the latest websocket or REST update of marketType
+func (s *AccountState) LastUpdate(marketType string) int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.updates[marketType]
+}
+
+func posStateKey(p *Position) string {
+	return p.Symbol + "|" + p.Side
+}
+
+// mergeBalances return a new Balances with assets of old overridden by inc
+func mergeBalances(old, inc *Balances) *Balances {
+	res := &Balances{
+		TimeStamp:      inc.TimeStamp,
+		Assets:         make(map[string]*Asset, len(inc.Assets)),
+		IsolatedAssets: inc.IsolatedAssets,
+		Info:           inc.Info,
+	}
+	if old != nil {
+		for code, a := range old.Assets {
+			res.Assets[code] = a
+		}
+		if res.IsolatedAssets == nil {
+			res.IsolatedAssets = old.IsolatedAssets
+		}
+		res.TimeStamp = max(res.TimeStamp, old.TimeStamp)
+	}
+	for code, a := range inc.Assets {
+		item := *a
+		res.Assets[code] = &item
+	}
+	return res.Init()
+}
+
+// mergePositions return a new list with positions of old overridden by inc, empty positions are removed
+func mergePositions(old, inc []*Position) []*Position {
+	res := make([]*Position, 0, len(old)+len(inc))
+	index := make(map[string]int)
+	for _, list := range [][]*Position{old, inc} {
+		for _, p := range list {
+			if p == nil {
+				continue
+			}
+			key := posStateKey(p)
+			if i, ok := index[key]; ok {
+				res[i] = p
+			} else {
+				index[key] = len(res)
+				res = append(res, p)
+			}
+		}
+	}
+	valid := res[:0]
+	for _, p := range res {
+		if !utils.EqualNearly(p.Contracts, 0) {
+			valid = append(valid, p)
+		}
+	}
+	return valid
+}
@@ -0,0 +1,237 @@
+package banexg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/banbox/banexg/errs"
+	"github.com/sasha-s/go-deadlock"
+)
+
+type stateExg struct {
+	*Exchange
+	balOut    chan *Balances
+	posOut    chan []*Position
+	balance   *Balances
+	positions []*Position
+	balFails  int // number of WatchBalance calls to fail
+	balCalls  int
+	lock      deadlock.Mutex
+}
+
+func (e *stateExg) WatchBalance(params map[string]interface{}) (chan *Balances, *errs.Error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.balCalls += 1
+	if e.balFails > 0 {
+		e.balFails -= 1
+		return nil, errs.NewMsg(errs.CodeNetFail, "watch fail")
+	}
+	return e.balOut, nil
+}
+
+func (e *stateExg) WatchPositions(params map[string]interface{}) (chan []*Position, *errs.Error) {
+	return e.posOut, nil
+}
+
+func (e *stateExg) FetchBalance(params map[string]interface{}) (*Balances, *errs.Error) {
+	return e.balance, nil
+}
+
+func (e *stateExg) FetchPositions(symbols []string, params map[string]interface{}) ([]*Position, *errs.Error) {
+	return e.positions, nil
+}
+
+func newTestBalances(totals map[string]float64) *Balances {
+	res := &Balances{TimeStamp: 1, Assets: map[string]*Asset{}}
+	for code, val := range totals {
+		res.Assets[code] = &Asset{Code: code, Free: val, Total: val}
+	}
+	return res.Init()
+}
+
+func TestAccountState(t *testing.T) {
+	acc := &Account{
+		Name:         "acc",
+		MarPositions: map[string][]*Position{},
+		MarBalances:  map[string]*Balances{},
+		LockPos:      &deadlock.Mutex{},
+		LockBalance:  &deadlock.Mutex{},
+	}
+	exg := &stateExg{
+		Exchange: &Exchange{ExgInfo: &ExgInfo{ID: "test", MarketType: MarketLinear},
+			Accounts: map[string]*Account{"acc": acc}},
+		balOut:    make(chan *Balances, 5),
+		posOut:    make(chan []*Position, 5),
+		balance:   newTestBalances(map[string]float64{"USDT": 100, "BTC": 1}),
+		positions: []*Position{{Symbol: "BTC/USDT:USDT", Side: PosSideLong, Contracts: 2}},
+	}
+	state := NewAccountState(exg, "")
+	state.SyncIntv = 0
+	var drifts []*AccountDrift
+	state.OnDrift = func(items []*AccountDrift) {
+		drifts = append(drifts, items...)
+	}
+	if err := state.Start(); err != nil {
+		t.Fatalf("start fail: %v", err)
+	}
+	defer state.Stop()
+	if len(drifts) != 0 {
+		t.Fatalf("first sync should not report drift: %v", drifts)
+	}
+	if a := state.Asset(MarketLinear, "USDT"); a == nil || a.Total != 100 {
+		t.Fatalf("unexpected asset: %+v", a)
+	}
+
+	// incremental websocket updates are merged
+	exg.balOut <- newTestBalances(map[string]float64{"USDT": 90})
+	exg.posOut <- []*Position{{Symbol: "ETH/USDT:USDT", Side: PosSideShort, Contracts: 3}}
+	exg.posOut <- []*Position{{Symbol: "BTC/USDT:USDT", Side: PosSideLong, Contracts: 0}}
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if pos := state.Positions(MarketLinear, ""); len(pos) == 1 && pos[0].Symbol == "ETH/USDT:USDT" {
+			break
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+	bal := state.Balances(MarketLinear)
+	if bal.Total["USDT"] != 90 || bal.Total["BTC"] != 1 {
+		t.Fatalf("unexpected merged balances: %v", bal.Total)
+	}
+	pos := state.Positions(MarketLinear, "")
+	if len(pos) != 1 || pos[0].Contracts != 3 {
+		t.Fatalf("unexpected merged positions: %+v", pos)
+	}
+	pos[0].Contracts = 10
+	if state.Positions(MarketLinear, "ETH/USDT:USDT")[0].Contracts != 3 {
+		t.Fatalf("snapshot should be a copy")
+	}
+
+	// REST is the source of truth, differences are reported
+	exg.balance = newTestBalances(map[string]float64{"USDT": 95, "BTC": 1})
+	exg.positions = []*Position{{Symbol: "ETH/USDT:USDT", Side: PosSideShort, Contracts: 3}}
+	res, err := state.Sync()
+	if err != nil {
+		t.Fatalf("sync fail: %v", err)
+	}
+	if len(res) != 1 || res[0].Kind != DriftBalance || res[0].Key != "USDT" || res[0].Local != 90 || res[0].Remote != 95 {
+		t.Fatalf("unexpected drifts: %+v", res)
+	}
+	if a := state.Asset(MarketLinear, "USDT"); a.Total != 95 {
+		t.Fatalf("state should be replaced by REST, got %v", a.Total)
+	}
+}
+
+func TestAccountStateRewatch(t *testing.T) {
+	oldMin := rewatchMinWait
+	rewatchMinWait = time.Millisecond * 5
+	defer func() { rewatchMinWait = oldMin }()
+	acc := &Account{
+		Name:         "acc",
+		MarPositions: map[string][]*Position{},
+		MarBalances:  map[string]*Balances{},
+		LockPos:      &deadlock.Mutex{},
+		LockBalance:  &deadlock.Mutex{},
+	}
+	exg := &stateExg{
+		Exchange: &Exchange{ExgInfo: &ExgInfo{ID: "test", MarketType: MarketSpot},
+			Accounts: map[string]*Account{"acc": acc}},
+		balOut:  make(chan *Balances, 5),
+		balance: newTestBalances(map[string]float64{"USDT": 100}),
+	}
+	state := NewAccountState(exg, "")
+	state.SyncIntv = 0
+	if err := state.Start(); err != nil {
+		t.Fatalf("start fail: %v", err)
+	}
+	defer state.Stop()
+	// chan closed by reconnect, the first rewatch fails
+	oldOut := exg.balOut
+	exg.lock.Lock()
+	exg.balOut = make(chan *Balances, 5)
+	exg.balFails = 1
+	exg.lock.Unlock()
+	// REST sync after rewatch agrees with the websocket update
+	exg.balance = newTestBalances(map[string]float64{"USDT": 80})
+	newOut := exg.balOut
+	close(oldOut)
+	newOut <- newTestBalances(map[string]float64{"USDT": 80})
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if a := state.Asset(MarketSpot, "USDT"); len(newOut) == 0 && a != nil && a.Total == 80 {
+			break
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+	if len(newOut) > 0 {
+		t.Fatalf("new chan should be consumed after rewatch")
+	}
+	if a := state.Asset(MarketSpot, "USDT"); a == nil || a.Total != 80 {
+		t.Fatalf("update after rewatch should be applied, got %+v", a)
+	}
+	exg.lock.Lock()
+	calls := exg.balCalls
+	exg.lock.Unlock()
+	if calls != 3 {
+		t.Fatalf("expect watch, failed rewatch and rewatch, got %d calls", calls)
+	}
+}
+
+// stateWsExg create real out chans for watches, WatchPositions fails if posFail
+type stateWsExg struct {
+	*stateExg
+	posFail bool
+}
+
+func (e *stateWsExg) WatchBalance(params map[string]interface{}) (chan *Balances, *errs.Error) {
+	create := func(cap int) chan *Balances { return make(chan *Balances, cap) }
+	return GetWsOutChan(e.Exchange, "balance", create, params, "account"), nil
+}
+
+func (e *stateWsExg) WatchPositions(params map[string]interface{}) (chan []*Position, *errs.Error) {
+	if e.posFail {
+		return nil, errs.NewMsg(errs.CodeNetFail, "watch fail")
+	}
+	create := func(cap int) chan []*Position { return make(chan []*Position, cap) }
+	return GetWsOutChan(e.Exchange, "positions", create, params, "account"), nil
+}
+
+func TestAccountStateStop(t *testing.T) {
+	newExg := func(posFail bool) *stateWsExg {
+		acc := &Account{
+			Name:         "acc",
+			MarPositions: map[string][]*Position{},
+			MarBalances:  map[string]*Balances{},
+			LockPos:      &deadlock.Mutex{},
+			LockBalance:  &deadlock.Mutex{},
+		}
+		return &stateWsExg{stateExg: &stateExg{
+			Exchange: &Exchange{ExgInfo: &ExgInfo{ID: "test", MarketType: MarketLinear},
+				Accounts: map[string]*Account{"acc": acc}, WsOutChans: map[string][]*WsHandle{},
+				WsChanRefs: map[string]map[string]int{}},
+			balance: newTestBalances(map[string]float64{"USDT": 100}),
+		}, posFail: posFail}
+	}
+	exg := newExg(false)
+	state := NewAccountState(exg, "")
+	state.SyncIntv = 0
+	if err := state.Start(); err != nil {
+		t.Fatalf("start fail: %v", err)
+	}
+	if len(exg.WsOutChans) != 2 || len(exg.afterWsReCons) != 1 {
+		t.Fatalf("expect 2 watches and 1 callback, got %d %d", len(exg.WsOutChans), len(exg.afterWsReCons))
+	}
+	state.Stop()
+	if len(exg.WsOutChans) != 0 || len(exg.WsChanRefs) != 0 || len(exg.afterWsReCons) != 0 {
+		t.Fatalf("watches or callback left after Stop: %v %v %d", exg.WsOutChans, exg.WsChanRefs, len(exg.afterWsReCons))
+	}
+	// the balance watch is rolled back when watching positions fails
+	exg = newExg(true)
+	state = NewAccountState(exg, "")
+	if err := state.Start(); err == nil {
+		t.Fatalf("start should fail")
+	}
+	if len(exg.WsOutChans) != 0 || len(exg.afterWsReCons) != 0 {
+		t.Fatalf("watches or callback left after failed Start: %v %d", exg.WsOutChans, len(exg.afterWsReCons))
+	}
+}
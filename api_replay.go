@@ -0,0 +1,254 @@
+package banexg
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/banbox/banexg/errs"
+	"github.com/banbox/banexg/log"
+	"go.uber.org/zap"
+)
+
+/*
+ApiLog
+A recorded REST round trip. Request headers are not saved to avoid leaking api keys.
+一次记录的REST请求和响应。不保存请求头，避免泄露api key
+*/
+type ApiLog struct {
+	Key     string      `json:"key"` // method path?canonical params
+	TimeMS  int64       `json:"timeMS"`
+	AccName string      `json:"accName,omitempty"`
+	Url     string      `json:"url"`
+	Method  string      `json:"method"`
+	Body    string      `json:"body,omitempty"`
+	Status  int         `json:"status"`
+	Headers http.Header `json:"headers,omitempty"`
+	Content string      `json:"content"`
+	ErrCode int         `json:"errCode,omitempty"`
+	ErrMsg  string      `json:"errMsg,omitempty"`
+}
+
+/*
+GetApiLogKey
+return the record key for a REST request: endpoint and canonical(sorted) params.
+Client order ids generated by NewClientOrderID are excluded, as they differ on every run.
+返回REST请求的记录键：端点+规范化(排序)的参数。NewClientOrderID生成的客户端订单ID每次运行都不同，不计入
+*/
+func GetApiLogKey(api *Entry, params map[string]interface{}) string {
+	keys := make([]string, 0, len(params))
+	for k, v := range params {
+		if text, ok := v.(string); ok && isAutoClientOrderID(text) {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(api.Method)
+	b.WriteString(" ")
+	b.WriteString(api.Path)
+	for i, k := range keys {
+		if i == 0 {
+			b.WriteString("?")
+		} else {
+			b.WriteString("&")
+		}
+		b.WriteString(k)
+		b.WriteString("=")
+		val, err := json.Marshal(params[k])
+		if err != nil {
+			b.WriteString(fmt.Sprintf("%v", params[k]))
+		} else {
+			b.WriteString(string(val))
+		}
+	}
+	return b.String()
+}
+
+// isAutoClientOrderID whether id is generated by NewClientOrderID 是否为NewClientOrderID生成的ID
+func isAutoClientOrderID(id string) bool {
+	if len(id) != 32 || !strings.HasPrefix(id, "bx") {
+		return false
+	}
+	_, err := hex.DecodeString(id[2:])
+	return err == nil
+}
+
+/*
+SetApiDump
+Record all REST requests and responses to the specified file; pass empty path to stop.
+Records are appended to an existing file as a new gzip stream, which is read by SetApiReplay too.
+API cache is neither read nor written while dumping, so that the session can be fully replayed.
+将所有REST请求和响应记录到指定文件；传入空路径停止记录。文件已存在时作为新的gzip流追加，SetApiReplay同样会读取。
+记录期间不读写API缓存，以便完整重放
+*/
+func (e *Exchange) SetApiDump(path string) *errs.Error {
+	e.apiLock.Lock()
+	defer e.apiLock.Unlock()
+	if path == "" {
+		if e.ApiEncoder != nil {
+			e.ApiEncoder = nil
+			err_ := e.ApiWriter.Close()
+			if err_ != nil {
+				log.Error("write api dump fail", zap.Error(err_))
+			}
+			e.ApiWriter = nil
+			err_ = e.ApiFile.Close()
+			if err_ != nil {
+				log.Error("close api dump file fail", zap.Error(err_))
+			}
+			e.ApiFile = nil
+		}
+		return nil
+	}
+	if e.ApiReplays != nil {
+		return errs.NewMsg(errs.CodeRunTime, "cannot dump api in replay mode")
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errs.New(errs.CodeIOWriteFail, err)
+	}
+	e.ApiFile = file
+	e.ApiWriter = gzip.NewWriter(file)
+	e.ApiEncoder = gob.NewEncoder(e.ApiWriter)
+	return nil
+}
+
+/*
+SetApiReplay
+Load REST records from the specified file, RequestApi will serve recorded responses
+without network access. Requests not recorded fail with CodeNetDisable. pass empty path to stop.
+从指定文件加载REST记录，RequestApi将返回记录的响应而不访问网络。未记录的请求返回CodeNetDisable错误
+*/
+func (e *Exchange) SetApiReplay(path string) *errs.Error {
+	e.apiLock.Lock()
+	defer e.apiLock.Unlock()
+	if path == "" {
+		e.ApiReplays = nil
+		return nil
+	}
+	if e.ApiEncoder != nil {
+		return errs.NewMsg(errs.CodeRunTime, "cannot set api replay in dump mode !")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return errs.New(errs.CodeIOReadFail, err)
+	}
+	defer file.Close()
+	// each SetApiDump appends a gzip stream with its own gob types, decode them one by one
+	// 每次SetApiDump追加一个带独立gob类型的gzip流，逐个解码
+	input := bufio.NewReader(file)
+	reader, err := gzip.NewReader(input)
+	if err != nil {
+		return errs.New(errs.CodeIOReadFail, err)
+	}
+	defer reader.Close()
+	replays := make(map[string][]*ApiLog)
+	for {
+		reader.Multistream(false)
+		decoder := gob.NewDecoder(reader)
+		for {
+			var item ApiLog
+			if err_ := decoder.Decode(&item); err_ != nil {
+				if err_ == io.EOF {
+					break
+				}
+				return errs.New(errs.CodeIOReadFail, err_)
+			}
+			replays[item.Key] = append(replays[item.Key], &item)
+		}
+		if err = reader.Reset(input); err == io.EOF {
+			break
+		} else if err != nil {
+			return errs.New(errs.CodeIOReadFail, err)
+		}
+	}
+	e.ApiReplays = replays
+	return nil
+}
+
+/*
+IsApiReplay return whether RequestApi serve responses from records
+*/
+func (e *Exchange) IsApiReplay() bool {
+	e.apiLock.Lock()
+	res := e.ApiReplays != nil
+	e.apiLock.Unlock()
+	return res
+}
+
+// apiRecordState return whether REST responses are replayed or dumped 返回REST响应是否正在回放或录制
+func (e *Exchange) apiRecordState() (replay, dump bool) {
+	e.apiLock.Lock()
+	replay, dump = e.ApiReplays != nil, e.ApiEncoder != nil
+	e.apiLock.Unlock()
+	return
+}
+
+func (e *Exchange) dumpApi(key string, req *HttpReq, res *HttpRes) {
+	e.apiLock.Lock()
+	defer e.apiLock.Unlock()
+	if e.ApiEncoder == nil {
+		return
+	}
+	item := &ApiLog{
+		Key:     key,
+		TimeMS:  e.MilliSeconds(),
+		AccName: res.AccName,
+		Url:     req.Url,
+		Method:  req.Method,
+		Body:    req.Body,
+		Status:  res.Status,
+		Headers: res.Headers,
+		Content: res.Content,
+	}
+	if res.Error != nil {
+		item.ErrCode = res.Error.Code
+		item.ErrMsg = res.Error.Message()
+	}
+	if err := e.ApiEncoder.Encode(item); err != nil {
+		log.Error("dump api fail", zap.String("key", key), zap.Error(err))
+	}
+}
+
+/*
+replayApi
+Pop the next recorded response for key. The last record is kept and returned repeatedly.
+弹出key对应的下一个记录的响应。最后一条记录会保留，重复返回
+*/
+func (e *Exchange) replayApi(key string, api *Entry) *HttpRes {
+	e.apiLock.Lock()
+	items := e.ApiReplays[key]
+	var item *ApiLog
+	if len(items) > 0 {
+		item = items[0]
+		if len(items) > 1 {
+			e.ApiReplays[key] = items[1:]
+		}
+	}
+	e.apiLock.Unlock()
+	if item == nil {
+		err := errs.NewMsg(errs.CodeNetDisable, "no api record for %v, fail: %v", e.Name, key)
+		return &HttpRes{Url: api.Url, Error: err}
+	}
+	res := &HttpRes{
+		AccName: item.AccName,
+		Url:     item.Url,
+		Status:  item.Status,
+		Headers: item.Headers,
+		Content: item.Content,
+	}
+	if item.ErrCode != 0 {
+		res.Error = errs.NewMsg(item.ErrCode, "%s", item.ErrMsg)
+	}
+	return res
+}
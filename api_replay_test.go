@@ -0,0 +1,144 @@
+package banexg
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/banbox/banexg/errs"
+)
+
+func TestApiDumpReplay(t *testing.T) {
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits += 1
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(r.URL.RawQuery))
+	}))
+	path := filepath.Join(t.TempDir(), "api.gz")
+	e := newInterceptExg(srv.URL)
+	e.Sign = func(api *Entry, params map[string]interface{}) *HttpReq {
+		url := srv.URL + "/" + api.Path
+		if sym, ok := params["symbol"]; ok {
+			url += "?symbol=" + sym.(string)
+		}
+		return &HttpReq{Url: url, Method: api.Method, Headers: http.Header{}}
+	}
+	e.Apis = map[string]*Entry{
+		"ticker":  {Path: "ticker", Method: "GET", RawHost: "api-replay.test"},
+		"missing": {Path: "missing", Method: "GET", RawHost: "api-replay.test"},
+	}
+	if err := e.SetApiDump(path); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, sym := range []string{"BTC", "ETH"} {
+		res := e.RequestApiRetryAdv(ctx, "ticker", map[string]interface{}{"symbol": sym}, 0, false, false)
+		if res.Error != nil || res.Content != "symbol="+sym {
+			t.Fatalf("live request fail: %#v", res)
+		}
+	}
+	res := e.RequestApiRetryAdv(ctx, "missing", nil, 0, false, false)
+	if res.Error == nil || res.Error.Code != errs.CodeDataNotFound {
+		t.Fatalf("expect not found, got %v", res.Error)
+	}
+	if err := e.SetApiDump(""); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+	liveHits := hits
+
+	e.NetDisable = true
+	if err := e.SetApiReplay(path); err != nil {
+		t.Fatal(err)
+	}
+	res = e.RequestApiRetryAdv(ctx, "ticker", map[string]interface{}{"symbol": "ETH"}, 0, false, false)
+	if res.Error != nil || res.Content != "symbol=ETH" {
+		t.Fatalf("replay fail: %#v", res)
+	}
+	res = e.RequestApiRetryAdv(ctx, "missing", nil, 0, false, false)
+	if res.Error == nil || res.Error.Code != errs.CodeDataNotFound || res.Status != http.StatusNotFound {
+		t.Fatalf("replay error fail: %#v", res)
+	}
+	res = e.RequestApiRetryAdv(ctx, "ticker", map[string]interface{}{"symbol": "SOL"}, 0, false, false)
+	if res.Error == nil || res.Error.Code != errs.CodeNetDisable {
+		t.Fatalf("unrecorded request should fail with NetDisable, got %v", res.Error)
+	}
+	if hits != liveHits {
+		t.Fatalf("replay should not access network")
+	}
+}
+
+func TestGetApiLogKeyCanonical(t *testing.T) {
+	api := &Entry{Path: "order", Method: "POST"}
+	a := GetApiLogKey(api, map[string]interface{}{"b": 1, "a": "x", "c": []string{"1"}})
+	b := GetApiLogKey(api, map[string]interface{}{"c": []string{"1"}, "a": "x", "b": 1})
+	if a != b || a != `POST order?a="x"&b=1&c=["1"]` {
+		t.Fatalf("unexpected key: %s %s", a, b)
+	}
+	// generated client order ids differ on every run
+	a = GetApiLogKey(api, map[string]interface{}{"a": "x", "newClientOrderId": NewClientOrderID()})
+	b = GetApiLogKey(api, map[string]interface{}{"a": "x", "newClientOrderId": NewClientOrderID()})
+	if a != b || a != `POST order?a="x"` {
+		t.Fatalf("auto client order id should be excluded: %s %s", a, b)
+	}
+	a = GetApiLogKey(api, map[string]interface{}{"a": "x", "newClientOrderId": "my-order"})
+	if a != `POST order?a="x"&newClientOrderId="my-order"` {
+		t.Fatalf("user client order id should be kept: %s", a)
+	}
+}
+
+func TestApiReplayAppend(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.RawQuery))
+	}))
+	defer srv.Close()
+	path := filepath.Join(t.TempDir(), "api.gz")
+	e := newInterceptExg(srv.URL)
+	e.Sign = func(api *Entry, params map[string]interface{}) *HttpReq {
+		return &HttpReq{Url: srv.URL + "/" + api.Path + "?symbol=" + params["symbol"].(string), Method: api.Method,
+			Headers: http.Header{}}
+	}
+	e.Apis = map[string]*Entry{"ticker": {Path: "ticker", Method: "GET", RawHost: "api-replay.test"}}
+	ctx := context.Background()
+	// two dump sessions append to the same file
+	for _, sym := range []string{"BTC", "ETH"} {
+		if err := e.SetApiDump(path); err != nil {
+			t.Fatal(err)
+		}
+		res := e.RequestApiRetryAdv(ctx, "ticker", map[string]interface{}{"symbol": sym}, 0, false, false)
+		if res.Error != nil {
+			t.Fatalf("live request fail: %v", res.Error)
+		}
+		if err := e.SetApiDump(""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.SetApiReplay(path); err != nil {
+		t.Fatal(err)
+	}
+	for _, sym := range []string{"BTC", "ETH"} {
+		if items := e.ApiReplays[GetApiLogKey(e.Apis["ticker"], map[string]interface{}{"symbol": sym})]; len(items) != 1 ||
+			items[0].Content != "symbol="+sym {
+			t.Fatalf("records of %s not loaded: %v", sym, items)
+		}
+	}
+	_ = e.SetApiReplay("")
+	// a corrupted file is reported instead of loading part of it
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(path, data[:len(data)-10], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.SetApiReplay(path); err == nil || err.Code != errs.CodeIOReadFail {
+		t.Fatalf("expect read fail for corrupted file, got %v", err)
+	}
+}
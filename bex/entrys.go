@@ -5,24 +5,127 @@ import (
 	"github.com/banbox/banexg/binance"
 	"github.com/banbox/banexg/bybit"
 	"github.com/banbox/banexg/china"
+	"github.com/banbox/banexg/composite"
 	"github.com/banbox/banexg/errs"
 	"github.com/banbox/banexg/okx"
+	"github.com/banbox/banexg/paper"
+	"github.com/banbox/banexg/resample"
 	"github.com/banbox/banexg/utils"
 )
 
 func init() {
 	newExgs = map[string]FuncNewExchange{
-		"binance": binance.NewExchange,
-		"bybit":   WrapNew(bybit.New),
-		"china":   china.NewExchange,
-		"okx":     okx.NewExchange,
+		"binance":   binance.NewExchange,
+		"bybit":     WrapNew(bybit.New),
+		"china":     china.NewExchange,
+		"okx":       okx.NewExchange,
+		"paper":     newPaper,
+		"backtest":  newBacktest,
+		"composite": newComposite,
 	}
 }
 
+/*
+New
+create exchange by name, wrapped by resample.Wrap if resample.OptEnable is true
+根据名称创建交易所，resample.OptEnable为true时使用resample.Wrap包装
+*/
 func New(name string, options map[string]interface{}) (banexg.BanExchange, *errs.Error) {
 	fn, ok := newExgs[name]
 	if !ok {
 		return nil, errs.NewMsg(errs.CodeBadExgName, "invalid exg name: %s", name)
 	}
-	return fn(utils.SafeParams(options))
+	args := utils.SafeParams(options)
+	wrap := utils.PopMapVal(args, resample.OptEnable, false)
+	exg, err := fn(args)
+	if err != nil || !wrap {
+		return exg, err
+	}
+	return resample.Wrap(exg), nil
+}
+
+/*
+newPaper
+create paper trading exchange, market data is from the exchange named by paper.OptExchange
+创建模拟交易所，行情来自paper.OptExchange指定的交易所
+*/
+func newPaper(options map[string]interface{}) (banexg.BanExchange, *errs.Error) {
+	exg, err := newWrapped(options)
+	if err != nil {
+		return nil, err
+	}
+	res, err := paper.New(exg, options)
+	if err != nil {
+		_ = exg.Close()
+		return nil, err
+	}
+	return res, nil
+}
+
+/*
+newBacktest
+create backtest exchange, markets and fees are from the exchange named by paper.OptExchange
+创建回测交易所，市场和费率来自paper.OptExchange指定的交易所
+*/
+func newBacktest(options map[string]interface{}) (banexg.BanExchange, *errs.Error) {
+	exg, err := newWrapped(options)
+	if err != nil {
+		return nil, err
+	}
+	res, err := paper.NewBacktest(exg, options)
+	if err != nil {
+		_ = exg.Close()
+		return nil, err
+	}
+	return res, nil
+}
+
+func newWrapped(options map[string]interface{}) (banexg.BanExchange, *errs.Error) {
+	name := utils.PopMapVal(options, paper.OptExchange, "")
+	if _, ok := newExgs[name]; !ok || name == "paper" || name == "backtest" {
+		return nil, errs.NewMsg(errs.CodeParamRequired, "option %s should be a real exchange, got: %s",
+			paper.OptExchange, name)
+	}
+	return New(name, options)
+}
+
+/*
+newComposite
+create composite exchange from composite.OptExchanges: exchange name: options of the exchange
+根据composite.OptExchanges创建组合交易所：交易所名称:该交易所的选项
+*/
+func newComposite(options map[string]interface{}) (banexg.BanExchange, *errs.Error) {
+	items := utils.GetMapVal(options, composite.OptExchanges, map[string]interface{}{})
+	if len(items) == 0 {
+		return nil, errs.NewMsg(errs.CodeParamRequired, "option %s is required", composite.OptExchanges)
+	}
+	exgs := make(map[string]banexg.BanExchange)
+	closeAll := func() {
+		for _, exg := range exgs {
+			_ = exg.Close()
+		}
+	}
+	for name, val := range items {
+		args, ok := val.(map[string]interface{})
+		if !ok && val != nil {
+			closeAll()
+			return nil, errs.NewMsg(errs.CodeParamInvalid, "options of %s should be map, got: %T", name, val)
+		}
+		if name == "composite" {
+			closeAll()
+			return nil, errs.NewMsg(errs.CodeParamInvalid, "nested composite exchange is not supported")
+		}
+		exg, err := New(name, args)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		exgs[name] = exg
+	}
+	res, err := composite.New(exgs, utils.GetMapVal(options, composite.OptDefault, ""))
+	if err != nil {
+		closeAll()
+		return nil, err
+	}
+	return res, nil
 }
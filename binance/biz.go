@@ -495,7 +495,7 @@ func makeFetchMarkets(e *Binance) banexg.FuncFetchMarkets {
 	}
 }
 
-func parseOptionOHLCV(rsp *banexg.HttpRes) ([]*banexg.Kline, *errs.Error) {
+func parseOptionOHLCV(rsp *banexg.HttpRes, dec bool) ([]*banexg.Kline, *errs.Error) {
 	var klines = make([]*BnbOptionKline, 0)
 	err := utils.UnmarshalString(rsp.Content, &klines, utils.JsonNumDefault)
 	if err != nil {
@@ -518,11 +518,14 @@ func parseOptionOHLCV(rsp *banexg.HttpRes) ([]*banexg.Kline, *errs.Error) {
 			Volume:    volume,
 			BuyVolume: takerVolume,
 		}
+		if dec {
+			res[i].SetDec(bar.Open, bar.High, bar.Low, bar.Close, bar.Amount, "", bar.TakerAmount)
+		}
 	}
 	return res, nil
 }
 
-func parseBnbOHLCV(rsp *banexg.HttpRes, volIndex, buyVolIndex int) ([]*banexg.Kline, *errs.Error) {
+func parseBnbOHLCV(rsp *banexg.HttpRes, volIndex, buyVolIndex int, dec bool) ([]*banexg.Kline, *errs.Error) {
 	var klines = make([][]interface{}, 0)
 	err := utils.UnmarshalString(rsp.Content, &klines, utils.JsonNumAuto)
 	if err != nil {
@@ -561,6 +564,9 @@ func parseBnbOHLCV(rsp *banexg.HttpRes, volIndex, buyVolIndex int) ([]*banexg.Kl
 			BuyVolume: buyVolume,
 			TradeNum:  tradeNum,
 		}
+		if dec {
+			res[i].SetDec(openStr, highStr, lowStr, closeStr, volStr, quoteStr, buyVolStr)
+		}
 	}
 	return res, nil
 }
@@ -650,13 +656,13 @@ func (e *Binance) FetchOHLCV(symbol, timeframe string, since int64, limit int, p
 		return nil, rsp.Error
 	}
 	if market.Option {
-		return parseOptionOHLCV(rsp)
+		return parseOptionOHLCV(rsp, e.DecimalMode)
 	} else {
 		volIndex, buyVolIdx := 5, 9
 		if market.Inverse {
 			volIndex, buyVolIdx = 7, 10
 		}
-		return parseBnbOHLCV(rsp, volIndex, buyVolIdx)
+		return parseBnbOHLCV(rsp, volIndex, buyVolIdx, e.DecimalMode)
 	}
 }
 
@@ -1328,7 +1334,7 @@ func makeCheckWsTimeout(e *Binance) func() {
 		loopIntv := time.Duration(e.WsTimeout) * time.Millisecond / 3
 		for {
 			time.Sleep(loopIntv)
-			for _, client := range e.WSClients {
+			for _, client := range e.GetWsClients() {
 				if client.AccName != "" {
 					// 跳过订阅账户数据推送（因不是定期稳定推送）
 					// Skip the data push for subscription account data (as it is not regularly and stably pushed).
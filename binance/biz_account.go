@@ -14,7 +14,6 @@ func (e *Binance) WatchAccountConfig(params map[string]interface{}) (chan *banex
 	args := utils.SafeParams(params)
 	chanKey := client.Prefix("accConfig")
 	create := func(cap int) chan *banexg.AccountConfig { return make(chan *banexg.AccountConfig, cap) }
-	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, args)
-	e.AddWsChanRefs(chanKey, "account")
+	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, args, "account")
 	return out, nil
 }
@@ -75,15 +75,15 @@ func (e *Binance) FetchBalance(params map[string]interface{}) (*banexg.Balances,
 	}
 	switch method {
 	case MethodPrivateGetAccount:
-		return parseSpotBalances(getCurrCode, rsp)
+		return parseSpotBalances(getCurrCode, rsp, e.DecimalMode)
 	case MethodSapiGetMarginAccount:
-		return parseMarginCrossBalances(getCurrCode, rsp)
+		return parseMarginCrossBalances(getCurrCode, rsp, e.DecimalMode)
 	case MethodSapiGetMarginIsolatedAccount:
 		return parseMarginIsolatedBalances(e, rsp)
 	case MethodFapiPrivateV2GetAccount:
-		return parseLinearBalances(getCurrCode, rsp)
+		return parseLinearBalances(getCurrCode, rsp, e.DecimalMode)
 	case MethodDapiPrivateGetAccount:
-		return parseInverseBalances(getCurrCode, rsp)
+		return parseInverseBalances(getCurrCode, rsp, e.DecimalMode)
 	case MethodSapiPostAssetGetFundingAsset:
 		return parseFundingBalances(e, rsp)
 	default:
@@ -296,6 +296,9 @@ func parseAccPosition(e *Binance, rsp *banexg.HttpRes, marketType string) ([]*ba
 			continue
 		}
 		pos.Info = info
+		if e.DecimalMode {
+			futPos.setPosDec(pos, p.GetNotional())
+		}
 		result = append(result, pos)
 	}
 	return result, nil
@@ -394,6 +397,31 @@ func (p *InversePosition) GetNotional() string {
 	return p.NotionalValue
 }
 
+// raw keys of binance positionRisk for exact values
+var posDecKeys = banexg.DecKeys{
+	"Contracts":        {"positionAmt"},
+	"EntryPrice":       {"entryPrice"},
+	"MarkPrice":        {"markPrice"},
+	"Notional":         {"notional", "notionalValue"},
+	"UnrealizedPnl":    {"unRealizedProfit"},
+	"LiquidationPrice": {"liquidationPrice"},
+	"InitialMargin":    {"initialMargin"},
+	"MaintMargin":      {"maintMargin"},
+}
+
+/*
+setPosDec set exact values from account position, liquidationPrice is calculated and kept as float
+*/
+func (p *FuturePosition) setPosDec(pos *banexg.Position, notional string) {
+	pos.SetDec(nil)
+	pos.Dec.Contracts = banexg.DecStr(p.PositionAmt, pos.Contracts).Abs()
+	pos.Dec.EntryPrice = banexg.DecStr(p.EntryPrice, pos.EntryPrice)
+	pos.Dec.UnrealizedPnl = banexg.DecStr(p.UnRealizedProfit, pos.UnrealizedPnl)
+	pos.Dec.InitialMargin = banexg.DecStr(p.InitialMargin, pos.InitialMargin)
+	pos.Dec.MaintMargin = banexg.DecStr(p.MaintMargin, pos.MaintMargin)
+	pos.Dec.Notional = banexg.DecStr(notional, pos.Notional).Abs()
+}
+
 func parsePositionRisk[T IBnbPosRisk](e *Binance, rsp *banexg.HttpRes) ([]*banexg.Position, *errs.Error) {
 	var data = make([]T, 0)
 	// fmt.Println(rsp.Content)
@@ -410,6 +438,9 @@ func parsePositionRisk[T IBnbPosRisk](e *Binance, rsp *banexg.HttpRes) ([]*banex
 		if pos == nil {
 			continue
 		}
+		if e.DecimalMode {
+			pos.SetDec(posDecKeys)
+		}
 		result = append(result, pos)
 	}
 	return result, nil
@@ -581,7 +612,7 @@ func unmarshalBalance(content string, data interface{}) (*banexg.Balances, *errs
 	return &result, nil
 }
 
-func parseSpotBalances(getCurrCode func(string) string, rsp *banexg.HttpRes) (*banexg.Balances, *errs.Error) {
+func parseSpotBalances(getCurrCode func(string) string, rsp *banexg.HttpRes, dec bool) (*banexg.Balances, *errs.Error) {
 	var data = SpotAccount{}
 	result, err := unmarshalBalance(rsp.Content, &data)
 	if err != nil {
@@ -593,12 +624,15 @@ func parseSpotBalances(getCurrCode func(string) string, rsp *banexg.HttpRes) (*b
 		if asset.IsEmpty() {
 			continue
 		}
+		if dec {
+			item.setAssetDec(asset)
+		}
 		result.Assets[asset.Code] = asset
 	}
 	return result.Init(), nil
 }
 
-func parseMarginCrossBalances(getCurrCode func(string) string, rsp *banexg.HttpRes) (*banexg.Balances, *errs.Error) {
+func parseMarginCrossBalances(getCurrCode func(string) string, rsp *banexg.HttpRes, dec bool) (*banexg.Balances, *errs.Error) {
 	var data = MarginCrossBalances{}
 	result, err := unmarshalBalance(rsp.Content, &data)
 	if err != nil {
@@ -609,6 +643,9 @@ func parseMarginCrossBalances(getCurrCode func(string) string, rsp *banexg.HttpR
 		if asset.IsEmpty() {
 			continue
 		}
+		if dec {
+			item.setAssetDec(asset)
+		}
 		result.Assets[asset.Code] = asset
 	}
 	return result.Init(), nil
@@ -634,6 +671,9 @@ func parseMarginIsolatedBalances(e *Binance, rsp *banexg.HttpRes) (*banexg.Balan
 			if asset.IsEmpty() {
 				continue
 			}
+			if e.DecimalMode {
+				item.BaseAsset.setAssetDec(asset)
+			}
 			itemRes[asset.Code] = asset
 		}
 		if item.QuoteAsset != nil {
@@ -641,6 +681,9 @@ func parseMarginIsolatedBalances(e *Binance, rsp *banexg.HttpRes) (*banexg.Balan
 			if asset.IsEmpty() {
 				continue
 			}
+			if e.DecimalMode {
+				item.QuoteAsset.setAssetDec(asset)
+			}
 			itemRes[asset.Code] = asset
 		}
 		result.IsolatedAssets[symbol] = itemRes
@@ -648,7 +691,7 @@ func parseMarginIsolatedBalances(e *Binance, rsp *banexg.HttpRes) (*banexg.Balan
 	return result.Init(), nil
 }
 
-func parseLinearBalances(getCurrCode func(string) string, rsp *banexg.HttpRes) (*banexg.Balances, *errs.Error) {
+func parseLinearBalances(getCurrCode func(string) string, rsp *banexg.HttpRes, dec bool) (*banexg.Balances, *errs.Error) {
 	var data = LinearBalances{}
 	result, err := unmarshalBalance(rsp.Content, &data)
 	if err != nil {
@@ -659,12 +702,15 @@ func parseLinearBalances(getCurrCode func(string) string, rsp *banexg.HttpRes) (
 		if asset.IsEmpty() {
 			continue
 		}
+		if dec {
+			item.setAssetDec(asset)
+		}
 		result.Assets[asset.Code] = asset
 	}
 	return result.Init(), nil
 }
 
-func parseInverseBalances(getCurrCode func(string) string, rsp *banexg.HttpRes) (*banexg.Balances, *errs.Error) {
+func parseInverseBalances(getCurrCode func(string) string, rsp *banexg.HttpRes, dec bool) (*banexg.Balances, *errs.Error) {
 	var data = InverseBalances{}
 	result, err := unmarshalBalance(rsp.Content, &data)
 	if err != nil {
@@ -675,6 +721,9 @@ func parseInverseBalances(getCurrCode func(string) string, rsp *banexg.HttpRes)
 		if asset.IsEmpty() {
 			continue
 		}
+		if dec {
+			item.setAssetDec(asset)
+		}
 		result.Assets[asset.Code] = asset
 	}
 	return result.Init(), nil
@@ -704,6 +753,12 @@ func parseFundingBalances(e *Binance, rsp *banexg.HttpRes) (*banexg.Balances, *e
 		if asset.IsEmpty() {
 			continue
 		}
+		if e.DecimalMode {
+			usedDec := banexg.DecStr(item.Freeze, freeze).Add(banexg.DecStr(item.Withdrawing, withdraw)).
+				Add(banexg.DecStr(item.Locked, lock))
+			freeDec := banexg.DecStr(item.Free, free)
+			asset.Dec = &banexg.AssetDec{Free: freeDec, Used: usedDec, Total: freeDec.Add(usedDec)}
+		}
 		result.Assets[code] = &asset
 	}
 	return result.Init(), nil
@@ -738,3 +793,24 @@ func (a *FutureAsset) ToStdAsset(getCurrCode func(string) string) *banexg.Asset
 		UPol:  uPol,
 	}
 }
+
+func (a SpotAsset) setAssetDec(asset *banexg.Asset) {
+	free := banexg.DecStr(a.Free, asset.Free)
+	lock := banexg.DecStr(a.Locked, asset.Used)
+	asset.Dec = &banexg.AssetDec{
+		Free:  free,
+		Used:  lock,
+		Total: free.Add(lock),
+		Debt:  banexg.DecStr(a.Borrowed, 0).Add(banexg.DecStr(a.Interest, 0)),
+	}
+}
+
+func (a *FutureAsset) setAssetDec(asset *banexg.Asset) {
+	used := banexg.DecStr(a.MaintMargin, asset.Used)
+	asset.Dec = &banexg.AssetDec{
+		Free:  banexg.DecStr(a.WalletBalance, 0).Sub(used),
+		Used:  used,
+		Total: banexg.DecStr(a.MarginBalance, asset.Total),
+		UPol:  banexg.DecStr(a.UnrealizedProfit, asset.UPol),
+	}
+}
@@ -23,7 +23,9 @@ func (e *Binance) FetchOrder(symbol, orderId string, params map[string]interface
 		return e.fetchAlgoOrder(orderId, clientOrderId, args)
 	}
 	args["symbol"] = market.ID
-	args["orderId"] = orderId
+	if orderId != "" {
+		args["orderId"] = orderId
+	}
 	marginMode := utils.PopMapVal(args, banexg.ParamMarginMode, "")
 	method := MethodPrivateGetOrder
 	if market.Option {
@@ -56,15 +58,15 @@ func (e *Binance) FetchOrder(symbol, orderId string, params map[string]interface
 	}
 	switch method {
 	case MethodPrivateGetOrder:
-		return parseOrder[*SpotOrder](mapSymbol, rsp)
+		return parseOrder[*SpotOrder](e, mapSymbol, rsp)
 	case MethodEapiPrivateGetOrder:
-		return parseOrder[*OptionOrder](mapSymbol, rsp)
+		return parseOrder[*OptionOrder](e, mapSymbol, rsp)
 	case MethodFapiPrivateGetOrder:
-		return parseOrder[*FutureOrder](mapSymbol, rsp)
+		return parseOrder[*FutureOrder](e, mapSymbol, rsp)
 	case MethodDapiPrivateGetOrder:
-		return parseOrder[*InverseOrder](mapSymbol, rsp)
+		return parseOrder[*InverseOrder](e, mapSymbol, rsp)
 	case MethodSapiGetMarginOrder:
-		return parseOrder[*MarginOrder](mapSymbol, rsp)
+		return parseOrder[*MarginOrder](e, mapSymbol, rsp)
 	default:
 		return nil, errs.NewMsg(errs.CodeNotSupport, "not support order method %s", method)
 	}
@@ -172,15 +174,15 @@ func (e *Binance) doFetchOrders(args map[string]interface{}, method string, mark
 	}
 	switch method {
 	case MethodPrivateGetAllOrders:
-		return parseOrders[*SpotOrder](mapSymbol, rsp)
+		return parseOrders[*SpotOrder](e, mapSymbol, rsp)
 	case MethodEapiPrivateGetHistoryOrders:
-		return parseOrders[*OptionOrder](mapSymbol, rsp)
+		return parseOrders[*OptionOrder](e, mapSymbol, rsp)
 	case MethodFapiPrivateGetAllOrders:
-		return parseOrders[*FutureOrder](mapSymbol, rsp)
+		return parseOrders[*FutureOrder](e, mapSymbol, rsp)
 	case MethodDapiPrivateGetAllOrders:
-		return parseOrders[*InverseOrder](mapSymbol, rsp)
+		return parseOrders[*InverseOrder](e, mapSymbol, rsp)
 	case MethodSapiGetMarginAllOrders:
-		return parseOrders[*MarginOrder](mapSymbol, rsp)
+		return parseOrders[*MarginOrder](e, mapSymbol, rsp)
 	default:
 		return nil, errs.NewMsg(errs.CodeNotSupport, "not support order method %s", method)
 	}
@@ -269,15 +271,15 @@ func (e *Binance) FetchOpenOrders(symbol string, since int64, limit int, params
 	}
 	switch method {
 	case MethodPrivateGetOpenOrders:
-		return parseOrders[*SpotOrder](mapSymbol, rsp)
+		return parseOrders[*SpotOrder](e, mapSymbol, rsp)
 	case MethodEapiPrivateGetOpenOrders:
-		return parseOrders[*OptionOrder](mapSymbol, rsp)
+		return parseOrders[*OptionOrder](e, mapSymbol, rsp)
 	case MethodFapiPrivateGetOpenOrders:
-		return parseOrders[*FutureOrder](mapSymbol, rsp)
+		return parseOrders[*FutureOrder](e, mapSymbol, rsp)
 	case MethodDapiPrivateGetOpenOrders:
-		return parseOrders[*InverseOrder](mapSymbol, rsp)
+		return parseOrders[*InverseOrder](e, mapSymbol, rsp)
 	case MethodSapiGetMarginOpenOrders:
-		return parseOrders[*MarginOrder](mapSymbol, rsp)
+		return parseOrders[*MarginOrder](e, mapSymbol, rsp)
 	default:
 		return nil, errs.NewMsg(errs.CodeNotSupport, "not support order method %s", method)
 	}
@@ -345,20 +347,46 @@ func (e *Binance) EditOrder(symbol, orderId, side string, amount, price float64,
 	tryNum := e.GetRetryNum("EditOrder", 1)
 	rsp := e.RequestApiRetry(context.Background(), method, args, tryNum)
 	if rsp.Error != nil {
-		return nil, rsp.Error
+		return e.reconcileOrder("EditOrder", symbol, orderId, clientOrderId, params, rsp.Error,
+			banexg.OrderEdited(amount, price))
 	}
 	var mapSymbol = func(mid string) string {
 		return market.Symbol
 	}
 	if method == MethodFapiPrivatePutOrder {
-		return parseOrder[*FutureOrder](mapSymbol, rsp)
+		return parseOrder[*FutureOrder](e, mapSymbol, rsp)
 	} else if method == MethodDapiPrivatePutOrder {
-		return parseOrder[*InverseOrder](mapSymbol, rsp)
+		return parseOrder[*InverseOrder](e, mapSymbol, rsp)
 	} else {
 		return nil, errs.NewMsg(errs.CodeRunTime, "invalid method for EditOrder: %s", method)
 	}
 }
 
+/*
+reconcileOrder
+query the real order state by orderId or clientOrderId, after a trading request failed with unknown outcome.
+applied is passed to banexg.ReconcileOrder
+交易请求结果未知时，通过订单ID或客户端订单ID查询订单真实状态
+*/
+func (e *Binance) reconcileOrder(action, symbol, orderId, clientOrderId string, params map[string]interface{}, reqErr *errs.Error,
+	applied func(*banexg.Order) bool) (*banexg.Order, *errs.Error) {
+	if orderId == "" && clientOrderId == "" {
+		return nil, reqErr
+	}
+	return e.ReconcileOrder(action, reqErr, func() (*banexg.Order, *errs.Error) {
+		args := map[string]interface{}{}
+		for _, key := range []string{banexg.ParamAccount, banexg.ParamMarginMode, banexg.ParamAlgoOrder} {
+			if val, ok := params[key]; ok {
+				args[key] = val
+			}
+		}
+		if clientOrderId != "" {
+			args[banexg.ParamClientOrderId] = clientOrderId
+		}
+		return e.FetchOrder(symbol, orderId, args)
+	}, applied)
+}
+
 /*
 CancelOrder
 cancels an open order
@@ -410,24 +438,24 @@ func (e *Binance) CancelOrder(id string, symbol string, params map[string]interf
 	tryNum := e.GetRetryNum("CancelOrder", 1)
 	rsp := e.RequestApiRetry(context.Background(), method, args, tryNum)
 	if rsp.Error != nil {
-		return nil, rsp.Error
+		return e.reconcileOrder("CancelOrder", symbol, id, clientOrderId, params, rsp.Error, banexg.OrderCanceled)
 	}
 	var mapSymbol = func(mid string) string {
 		return market.Symbol
 	}
 	if method == MethodFapiPrivateDeleteOrder {
-		return parseOrder[*FutureOrder](mapSymbol, rsp)
+		return parseOrder[*FutureOrder](e, mapSymbol, rsp)
 	} else if method == MethodDapiPrivateDeleteOrder {
-		return parseOrder[*InverseOrder](mapSymbol, rsp)
+		return parseOrder[*InverseOrder](e, mapSymbol, rsp)
 	} else if method == MethodEapiPrivateDeleteOrder {
-		return parseOrder[*OptionOrder](mapSymbol, rsp)
+		return parseOrder[*OptionOrder](e, mapSymbol, rsp)
 	} else {
 		// spot margin sor
-		return parseOrder[*SpotOrder](mapSymbol, rsp)
+		return parseOrder[*SpotOrder](e, mapSymbol, rsp)
 	}
 }
 
-func parseOrders[T IBnbOrder](mapSymbol func(string) string, rsp *banexg.HttpRes) ([]*banexg.Order, *errs.Error) {
+func parseOrders[T IBnbOrder](e *Binance, mapSymbol func(string) string, rsp *banexg.HttpRes) ([]*banexg.Order, *errs.Error) {
 	var data = make([]T, 0)
 	rawList, err := utils.UnmarshalStringMapArr(rsp.Content, &data)
 	if err != nil {
@@ -436,20 +464,37 @@ func parseOrders[T IBnbOrder](mapSymbol func(string) string, rsp *banexg.HttpRes
 	var result = make([]*banexg.Order, len(data))
 	for i, item := range data {
 		result[i] = item.ToStdOrder(mapSymbol, rawList[i])
+		if e.DecimalMode {
+			result[i].SetDec(orderDecKeys)
+		}
 	}
 	return result, nil
 }
 
-func parseOrder[T IBnbOrder](mapSymbol func(string) string, rsp *banexg.HttpRes) (*banexg.Order, *errs.Error) {
+func parseOrder[T IBnbOrder](e *Binance, mapSymbol func(string) string, rsp *banexg.HttpRes) (*banexg.Order, *errs.Error) {
 	var data = new(T)
 	raw, err := utils.UnmarshalStringMap(rsp.Content, &data)
 	if err != nil {
 		return nil, errs.New(errs.CodeUnmarshalFail, err)
 	}
 	result := (*data).ToStdOrder(mapSymbol, raw)
+	if e.DecimalMode {
+		result.SetDec(orderDecKeys)
+	}
 	return result, nil
 }
 
+// raw keys of binance orders for exact values
+var orderDecKeys = banexg.DecKeys{
+	"Price":        {"price"},
+	"Average":      {"avgPrice"},
+	"Amount":       {"origQty", "quantity"},
+	"Filled":       {"executedQty"},
+	"TriggerPrice": {"stopPrice", "triggerPrice"},
+	"Cost":         {"cummulativeQuoteQty", "cumQuote", "cumBase"},
+	"FeeCost":      {"fee"},
+}
+
 var orderStateMap = map[string]string{
 	OdStatusNew:             banexg.OdStatusOpen,
 	OdStatusAccept:          banexg.OdStatusOpen,
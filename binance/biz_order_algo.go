@@ -50,7 +50,7 @@ func (e *Binance) createAlgoOrder(market *banexg.Market, args map[string]interfa
 	var mapSymbol = func(mid string) string {
 		return market.Symbol
 	}
-	return parseOrder[*AlgoOrder](mapSymbol, rsp)
+	return parseOrder[*AlgoOrder](e, mapSymbol, rsp)
 }
 
 func (e *Binance) fetchAlgoOrder(id, clientOrderId string, args map[string]interface{}) (*banexg.Order, *errs.Error) {
@@ -71,7 +71,7 @@ func (e *Binance) fetchAlgoOrder(id, clientOrderId string, args map[string]inter
 		market := e.GetMarketById(mid, banexg.MarketLinear)
 		return market.Symbol
 	}
-	return parseOrder[*AlgoOrder](mapSymbol, rsp)
+	return parseOrder[*AlgoOrder](e, mapSymbol, rsp)
 }
 
 func (e *Binance) fetchAlgoOrders(args map[string]interface{}, market *banexg.Market) ([]*banexg.Order, *errs.Error) {
@@ -83,7 +83,7 @@ func (e *Binance) fetchAlgoOrders(args map[string]interface{}, market *banexg.Ma
 	var mapSymbol = func(mid string) string {
 		return market.Symbol
 	}
-	return parseOrders[*AlgoOrder](mapSymbol, rsp)
+	return parseOrders[*AlgoOrder](e, mapSymbol, rsp)
 }
 
 func (e *Binance) fetchAlgoOpenOrders(args map[string]interface{}, market *banexg.Market) ([]*banexg.Order, *errs.Error) {
@@ -111,7 +111,7 @@ func (e *Binance) fetchAlgoOpenOrders(args map[string]interface{}, market *banex
 			return market.Symbol
 		}
 	}
-	return parseOrders[*AlgoOrder](mapSymbol, rsp)
+	return parseOrders[*AlgoOrder](e, mapSymbol, rsp)
 }
 
 func (e *Binance) cancelAlgoOrder(id string, clientOrderId string, market *banexg.Market) (*banexg.Order, *errs.Error) {
@@ -32,7 +32,23 @@ func normalizeContractTriggerOrderType(market *banexg.Market, odType string) str
 }
 
 /*
-CreateOrder 提交订单到交易所
+CreateOrder 提交订单到交易所，params中的Param*参数转为OrderRequest后调用CreateOrderReq
+*/
+func (e *Binance) CreateOrder(symbol, odType, side string, amount float64, price float64, params map[string]interface{}) (*banexg.Order, *errs.Error) {
+	return e.CreateOrderReq(banexg.NewOrderRequest(symbol, odType, side, amount, price, params))
+}
+
+// orderExtraKeys keys accepted in OrderRequest.Extra, besides typed fields 除类型化字段外，Extra中接受的键
+var orderExtraKeys = map[string]bool{
+	banexg.ParamSor: true, banexg.ParamTest: true, banexg.ParamRetry: true, banexg.ParamBrokerId: true,
+	banexg.ParamWorkingType: true, banexg.ParamPriceMatch: true, banexg.ParamPriceProtect: true,
+	"icebergQty": true, "newOrderRespType": true, "strategyId": true, "strategyType": true,
+	"sideEffectType": true, "autoRepayAtCancel": true, "pegPriceType": true, "pegOffsetValue": true,
+	"pegOffsetType": true,
+}
+
+/*
+CreateOrderReq 提交订单到交易所
 
 :see: https://binance-docs.github.io/apidocs/spot/en/#new-order-trade
 
@@ -47,23 +63,36 @@ CreateOrder 提交订单到交易所
 	:param str side: 'buy' or 'sell'
 	:param float amount: how much of currency you want to trade in units of base currency
 	:param float [price]: the price at which the order is to be fullfilled, in units of the quote currency, ignored in market orders
-	:param dict [params]: extra parameters specific to the exchange API endpoint
-	:param str [params.marginMode]: 'cross' or 'isolated', for spot margin trading
-	:param boolean [params.sor]: *spot only* whether to use SOR(Smart Order Routing) or not, default is False
-	:param boolean [params.test]: *spot only* whether to use the test endpoint or not, default is False
+	:param str [req.MarginMode]: 'cross' or 'isolated', for spot margin trading
+	:param boolean [req.Extra.sor]: *spot only* whether to use SOR(Smart Order Routing) or not, default is False
+	:param boolean [req.Extra.test]: *spot only* whether to use the test endpoint or not, default is False
 	:returns dict: an `order structure <https://docs.ccxt.com/#/?id=order-structure>`
 */
-func (e *Binance) CreateOrder(symbol, odType, side string, amount float64, price float64, params map[string]interface{}) (*banexg.Order, *errs.Error) {
+func (e *Binance) CreateOrderReq(req *banexg.OrderRequest) (*banexg.Order, *errs.Error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	params, err := req.ExtraArgs(e.ID, orderExtraKeys)
+	if err != nil {
+		return nil, err
+	}
+	symbol, odType, side, amount, price := req.Symbol, req.Type, req.Side, req.Amount, req.Price
 	args, market, err := e.LoadArgsMarket(symbol, params)
 	if err != nil {
 		return nil, err
 	}
 	odType = normalizeContractTriggerOrderType(market, odType)
-	marginMode := utils.PopMapVal(args, banexg.ParamMarginMode, "")
+	marginMode := req.MarginMode
 	sor := utils.PopMapVal(args, banexg.ParamSor, false)
-	clientOrderId := utils.PopMapVal(args, banexg.ParamClientOrderId, "")
-	postOnly := utils.PopMapVal(args, banexg.ParamPostOnly, false)
-	timeInForce := utils.GetMapVal(args, banexg.ParamTimeInForce, "")
+	test := utils.PopMapVal(args, banexg.ParamTest, false)
+	brokerId := utils.PopMapVal(args, banexg.ParamBrokerId, "")
+	tryNum := utils.PopMapVal(args, banexg.ParamRetry, -1)
+	clientOrderId := req.ClientOrderID
+	postOnly := req.PostOnly
+	timeInForce := req.TimeInForce
+	if timeInForce == "" && req.GoodTillDate > 0 {
+		timeInForce = banexg.TimeInForceGTD
+	}
 	if postOnly || timeInForce == banexg.TimeInForcePO || odType == banexg.OdTypeLimitMaker {
 		if timeInForce == banexg.TimeInForceIOC || timeInForce == banexg.TimeInForceFOK {
 			return nil, errs.NewMsg(errs.CodeParamInvalid, "postOnly orders cannot have timeInForce: %s", timeInForce)
@@ -76,29 +105,48 @@ func (e *Binance) CreateOrder(symbol, odType, side string, amount float64, price
 		if postOnly {
 			odType = banexg.OdTypeLimitMaker
 		}
-	} else if odType == banexg.OdTypeLimitMaker {
-		// 币安仅现货支持limit_maker
-		odType = banexg.OdTypeLimit
+	} else if postOnly {
+		// 币安仅现货支持limit_maker，合约使用GTX
+		if odType == banexg.OdTypeLimitMaker {
+			odType = banexg.OdTypeLimit
+		}
 		timeInForce = banexg.TimeInForceGTX
 	}
 	isMarket := odType == banexg.OdTypeMarket
 	isLimit := odType == banexg.OdTypeLimit
-	triggerPrice := utils.PopMapVal(args, banexg.ParamTriggerPrice, float64(0))
-	stopLossPrice := utils.PopMapVal(args, banexg.ParamStopLossPrice, float64(0))
+	stopLossPrice := req.StopLossPrice
 	if stopLossPrice == 0 {
-		stopLossPrice = triggerPrice
+		stopLossPrice = req.TriggerPrice
 	}
-	takeProfitPrice := utils.PopMapVal(args, banexg.ParamTakeProfitPrice, float64(0))
-	trailingDelta := utils.PopMapVal(args, banexg.ParamTrailingDelta, 0)
+	takeProfitPrice := req.TakeProfitPrice
+	// trailingDelta of binance spot is integer BIPS
+	trailingDelta := int(req.TrailingDelta)
 	isStopLoss := stopLossPrice != float64(0) || trailingDelta != 0
 	isTakeProfit := takeProfitPrice != float64(0)
 	args["symbol"] = market.ID
 	args["side"] = strings.ToUpper(side)
 	if market.Type == banexg.MarketMargin || marginMode != "" {
-		reduceOnly := utils.PopMapVal(args, banexg.ParamReduceOnly, false)
-		if reduceOnly {
+		if req.ReduceOnly {
 			args["sideEffectType"] = "AUTO_REPAY"
 		}
+	} else if market.Contract {
+		if req.ReduceOnly {
+			args["reduceOnly"] = true
+		}
+		if req.ClosePosition {
+			args["closePosition"] = true
+		}
+		if req.PositionSide != "" {
+			args["positionSide"] = strings.ToUpper(req.PositionSide)
+		}
+		if req.GoodTillDate > 0 {
+			args["goodTillDate"] = req.GoodTillDate
+		}
+	} else if trailingDelta != 0 {
+		args["trailingDelta"] = trailingDelta
+	}
+	if req.STPMode != "" {
+		args["selfTradePreventionMode"] = req.STPMode
 	}
 	stopPrice := float64(0)
 	if isStopLoss {
@@ -132,7 +180,6 @@ func (e *Binance) CreateOrder(symbol, odType, side string, amount float64, price
 		args["isIsolated"] = true
 	}
 	if clientOrderId == "" {
-		brokerId := utils.GetMapVal(params, banexg.ParamBrokerId, "")
 		clientOrderId = brokerId + utils.UUID(22)
 	}
 	args["newClientOrderId"] = clientOrderId
@@ -177,7 +224,7 @@ func (e *Binance) CreateOrder(symbol, odType, side string, amount float64, price
 	if odType == banexg.OdTypeMarket {
 		quantityRequired = true
 		if market.Spot {
-			cost := utils.PopMapVal(args, banexg.ParamCost, 0.0)
+			cost := req.Cost
 			if cost == 0 && price != 0 {
 				cost = amount * price
 			}
@@ -213,21 +260,18 @@ func (e *Binance) CreateOrder(symbol, odType, side string, amount float64, price
 		stopPriceRequired = true
 		priceRequired = true
 	} else if odType == banexg.OdTypeStopMarket || odType == banexg.OdTypeTakeProfitMarket {
-		closePosition := utils.GetMapVal(args, banexg.ParamClosePosition, false)
-		if !closePosition {
+		if !req.ClosePosition {
 			quantityRequired = true
 		}
 		stopPriceRequired = true
 	} else if odType == banexg.OdTypeTrailingStopMarket {
 		quantityRequired = true
-		callBackRate := utils.GetMapVal(args, banexg.ParamCallbackRate, 0.0)
-		if callBackRate == 0 {
+		if req.CallbackRate == 0 {
 			return nil, errs.NewMsg(errs.CodeParamRequired, "createOrder require callbackRate for %s order", odType)
 		}
-		args["callbackRate"] = callBackRate
-		activationPrice := utils.GetMapVal(args, banexg.ParamActivationPrice, 0.0)
-		if activationPrice > 0 {
-			args["activationPrice"] = activationPrice
+		args["callbackRate"] = req.CallbackRate
+		if req.ActivationPrice > 0 {
+			args["activationPrice"] = req.ActivationPrice
 		}
 	}
 	if quantityRequired {
@@ -247,10 +291,10 @@ func (e *Binance) CreateOrder(symbol, odType, side string, amount float64, price
 		}
 		args["price"] = priceStr
 	}
-	if timeInForceRequired {
-		if timeInForce == "" {
-			timeInForce = e.TimeInForce
-		}
+	if timeInForceRequired && timeInForce == "" {
+		timeInForce = e.TimeInForce
+	}
+	if timeInForce != "" {
 		args["timeInForce"] = timeInForce
 	}
 	if stopPriceRequired {
@@ -270,7 +314,7 @@ func (e *Binance) CreateOrder(symbol, odType, side string, amount float64, price
 		}
 	}
 	if timeInForce == banexg.TimeInForcePO {
-		delete(args, banexg.ParamTimeInForce)
+		delete(args, "timeInForce")
 	}
 	method := MethodPrivatePostOrder
 	if sor {
@@ -284,13 +328,14 @@ func (e *Binance) CreateOrder(symbol, odType, side string, amount float64, price
 	} else if market.Option {
 		method = MethodEapiPrivatePostOrder
 	}
-	if market.Spot || market.Type == banexg.MarketMargin {
-		test := utils.GetMapVal(args, banexg.ParamTest, false)
-		if test {
-			method += "Test"
-		}
+	if test && (market.Spot || market.Type == banexg.MarketMargin) {
+		method += "Test"
+	}
+	// keep args needed by FetchOrder when the result is unknown 保存结果未知时查询订单所需的参数
+	recArgs := utils.SafeParams(params)
+	if marginMode != "" {
+		recArgs[banexg.ParamMarginMode] = marginMode
 	}
-	tryNum := utils.PopMapVal(params, banexg.ParamRetry, -1)
 	if tryNum < 0 {
 		tryNum = e.GetRetryNum("CreateOrder", 3)
 	}
@@ -299,25 +344,33 @@ func (e *Binance) CreateOrder(symbol, odType, side string, amount float64, price
 		if odType == banexg.OdTypeStop || odType == banexg.OdTypeStopMarket ||
 			odType == banexg.OdTypeTakeProfit || odType == banexg.OdTypeTakeProfitMarket ||
 			odType == banexg.OdTypeTrailingStopMarket {
-			return e.createAlgoOrder(market, args, tryNum)
+			res, err := e.createAlgoOrder(market, args, tryNum)
+			if err != nil {
+				recArgs[banexg.ParamAlgoOrder] = true
+				return e.reconcileOrder("CreateOrder", symbol, "", clientOrderId, recArgs, err, nil)
+			}
+			return res, nil
 		}
 	}
 
 	rsp := e.RequestApiRetry(context.Background(), method, args, tryNum)
 	if rsp.Error != nil {
-		return nil, rsp.Error
+		if strings.HasSuffix(method, "Test") {
+			return nil, rsp.Error
+		}
+		return e.reconcileOrder("CreateOrder", symbol, "", clientOrderId, recArgs, rsp.Error, nil)
 	}
 	var mapSymbol = func(mid string) string {
 		return market.Symbol
 	}
 	if method == MethodFapiPrivatePostOrder {
-		return parseOrder[*FutureOrder](mapSymbol, rsp)
+		return parseOrder[*FutureOrder](e, mapSymbol, rsp)
 	} else if method == MethodDapiPrivatePostOrder {
-		return parseOrder[*InverseOrder](mapSymbol, rsp)
+		return parseOrder[*InverseOrder](e, mapSymbol, rsp)
 	} else if method == MethodEapiPrivatePostOrder {
-		return parseOrder[*OptionOrder](mapSymbol, rsp)
+		return parseOrder[*OptionOrder](e, mapSymbol, rsp)
 	} else {
 		// spot margin sor
-		return parseOrder[*SpotOrder](mapSymbol, rsp)
+		return parseOrder[*SpotOrder](e, mapSymbol, rsp)
 	}
 }
@@ -1,8 +1,12 @@
 package binance
 
 import (
+	"context"
 	"fmt"
+	"net/url"
+
 	"github.com/banbox/banexg"
+	"github.com/banbox/banexg/errs"
 	"github.com/banbox/banexg/log"
 	"github.com/banbox/banexg/utils"
 	"github.com/banbox/bntp"
@@ -145,3 +149,70 @@ func TestCalcelOrder(t *testing.T) {
 	resStr, _ := utils.MarshalString(res)
 	log.Info("cancel order", zap.String("res", resStr))
 }
+
+// newOrderReqBinance return binance with a linear market, requests are answered by fn without network
+func newOrderReqBinance(t *testing.T, fn func(api *banexg.Entry, args url.Values)) *Binance {
+	exg, err := New(map[string]interface{}{
+		banexg.OptApiKey:    "key",
+		banexg.OptApiSecret: "secret",
+	})
+	if err != nil {
+		t.Fatalf("new binance: %v", err)
+	}
+	market := &banexg.Market{ID: "BTCUSDT", Symbol: "BTC/USDT:USDT", Type: banexg.MarketLinear, Linear: true,
+		Contract: true, Info: map[string]interface{}{"orderTypes": []string{"LIMIT", "MARKET"}},
+		Precision: &banexg.Precision{Price: 0.1, Amount: 0.001,
+			ModePrice: banexg.PrecModeTickSize, ModeAmount: banexg.PrecModeTickSize}}
+	exg.Markets = banexg.MarketMap{market.Symbol: market}
+	exg.MarketsById = banexg.MarketArrMap{market.ID: {market}}
+	exg.Use(func(next banexg.RoundTrip) banexg.RoundTrip {
+		return func(ctx context.Context, api *banexg.Entry, req *banexg.HttpReq) *banexg.HttpRes {
+			args, _ := url.ParseQuery(req.Body)
+			fn(api, args)
+			body := `{"orderId":1,"symbol":"BTCUSDT","status":"NEW","clientOrderId":"` + args.Get("newClientOrderId") +
+				`","price":"100","origQty":"1","type":"LIMIT","side":"BUY","updateTime":1700000000000}`
+			return &banexg.HttpRes{Url: req.Url, AccName: req.AccName, Status: 200, Content: body}
+		}
+	})
+	return exg
+}
+
+func TestCreateOrderReqNative(t *testing.T) {
+	var got url.Values
+	exg := newOrderReqBinance(t, func(api *banexg.Entry, args url.Values) {
+		if api.Path != "order" {
+			t.Fatalf("unexpected api: %s", api.Path)
+		}
+		got = args
+	})
+	req := &banexg.OrderRequest{Symbol: "BTC/USDT:USDT", Type: banexg.OdTypeLimit, Side: banexg.OdSideBuy,
+		Amount: 1, Price: 100, PositionSide: banexg.PosSideLong, GoodTillDate: 1700000000000, ReduceOnly: true,
+		ClientOrderID: "cid1", STPMode: "EXPIRE_MAKER", Extra: map[string]interface{}{banexg.ParamPriceMatch: "QUEUE"}}
+	if _, err := exg.CreateOrderReq(req); err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	want := map[string]string{"symbol": "BTCUSDT", "side": "BUY", "type": "LIMIT", "timeInForce": "GTD",
+		"goodTillDate": "1700000000000", "positionSide": "LONG", "reduceOnly": "true", "newClientOrderId": "cid1",
+		"selfTradePreventionMode": "EXPIRE_MAKER", "priceMatch": "QUEUE", "quantity": "1", "price": "100"}
+	for k, v := range want {
+		if got.Get(k) != v {
+			t.Fatalf("%s = %q, want %q, args: %v", k, got.Get(k), v, got)
+		}
+	}
+	req.Extra = map[string]interface{}{"priceMach": "QUEUE"}
+	if _, err := exg.CreateOrderReq(req); err == nil || err.Code != errs.CodeParamInvalid {
+		t.Fatalf("unknown extra key should be rejected, got %v", err)
+	}
+	// map api converts loosely and passes unknown keys as before
+	got = nil
+	_, err := exg.CreateOrder("BTC/USDT:USDT", banexg.OdTypeLimit, banexg.OdSideBuy, 1, 100, map[string]interface{}{
+		banexg.ParamPostOnly: "true",
+		"priceMach":          "QUEUE",
+	})
+	if err != nil {
+		t.Fatalf("create order by map: %v", err)
+	}
+	if got.Get("timeInForce") != banexg.TimeInForceGTX || got.Get("priceMach") != "QUEUE" {
+		t.Fatalf("unexpected args: %v", got)
+	}
+}
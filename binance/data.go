@@ -23,6 +23,15 @@ const (
 	WssApi            = "ws"
 )
 
+var (
+	// binance uses common timeframes directly, the map lists supported intervals
+	timeFrameMap = map[string]string{
+		"1s": "1s", "1m": "1m", "3m": "3m", "5m": "5m", "15m": "15m", "30m": "30m",
+		"1h": "1h", "2h": "2h", "4h": "4h", "6h": "6h", "8h": "8h", "12h": "12h",
+		"1d": "1d", "3d": "3d", "1w": "1w", "1M": "1M",
+	}
+)
+
 const (
 	OdStatusNew             = "NEW"
 	OdStatusPartiallyFilled = "PARTIALLY_FILLED"
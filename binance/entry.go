@@ -12,9 +12,11 @@ func New(Options map[string]interface{}) (*Binance, *errs.Error) {
 				ID:        "binance",
 				Name:      "Binance",
 				Countries: []string{"JP", "MT"},
+				KlinePage: 1000,
 			},
-			RateLimit: 50,
-			Options:   Options,
+			RateLimit:  50,
+			Options:    Options,
+			TimeFrames: timeFrameMap,
 			Hosts: &banexg.ExgHosts{
 				Test: map[string]string{
 					HostDApiPublic:       "https://testnet.binancefuture.com/dapi/v1",
@@ -13,7 +13,6 @@ import (
 	"github.com/banbox/banexg/errs"
 	"github.com/banbox/banexg/log"
 	"github.com/banbox/banexg/utils"
-	"github.com/banbox/bntp"
 	"go.uber.org/zap"
 )
 
@@ -235,7 +234,7 @@ func (e *Binance) keepAliveListenKey(acc *banexg.Account, params map[string]inte
 		delete(acc.Data, lastTimeKey)
 		acc.LockData.Unlock()
 		clientKey := acc.Name + "@" + e.GetHost(marketType) + "/" + listenKey
-		if client, ok := e.WSClients[clientKey]; ok {
+		if client, ok := e.GetWsClientByKey(clientKey); ok {
 			conns, lock := client.LockConns()
 			connList := utils.ValsOfMap(conns)
 			lock.Unlock()
@@ -340,8 +339,7 @@ func (e *Binance) WatchBalance(params map[string]interface{}) (chan *banexg.Bala
 	args := utils.SafeParams(params)
 	chanKey := client.Prefix("balance")
 	create := func(cap int) chan *banexg.Balances { return make(chan *banexg.Balances, cap) }
-	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, args)
-	e.AddWsChanRefs(chanKey, "account")
+	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, args, "account")
 	out <- balances
 	return out, nil
 }
@@ -365,8 +363,7 @@ func (e *Binance) WatchPositions(params map[string]interface{}) (chan []*banexg.
 	args := utils.SafeParams(params)
 	chanKey := client.Prefix("positions")
 	create := func(cap int) chan []*banexg.Position { return make(chan []*banexg.Position, cap) }
-	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, args)
-	e.AddWsChanRefs(chanKey, "account")
+	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, args, "account")
 	out <- positions
 	return out, nil
 }
@@ -379,25 +376,20 @@ watches historical candlestick data containing the open, high, low, and close pr
 :returns int[][]: A list of candles ordered, open, high, low, close, volume
 */
 func (e *Binance) WatchOHLCVs(jobs [][2]string, params map[string]interface{}) (chan *banexg.PairTFKline, *errs.Error) {
-	chanKey, symbols, args, err := e.prepareOHLCVSub(true, jobs, params)
+	chanKey, refKeys, args, err := e.prepareOHLCVSub(true, jobs, params)
 	if err != nil {
 		return nil, err
 	}
 
 	create := func(cap int) chan *banexg.PairTFKline { return make(chan *banexg.PairTFKline, cap) }
-	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, args)
-	e.AddWsChanRefs(chanKey, symbols...)
+	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, args, refKeys...)
 	e.DumpWS("WatchOHLCVs", jobs)
 	return out, nil
 }
 
 func (e *Binance) UnWatchOHLCVs(jobs [][2]string, params map[string]interface{}) *errs.Error {
-	chanKey, symbols, _, err := e.prepareOHLCVSub(false, jobs, params)
-	if err != nil {
-		return err
-	}
-	e.DelWsChanRefs(chanKey, symbols...)
-	return nil
+	_, _, _, err := e.prepareOHLCVSub(false, jobs, params)
+	return err
 }
 
 func (e *Binance) WatchMarkPrices(symbols []string, params map[string]interface{}) (chan map[string]float64, *errs.Error) {
@@ -406,19 +398,14 @@ func (e *Binance) WatchMarkPrices(symbols []string, params map[string]interface{
 		return nil, err
 	}
 	create := func(cap int) chan map[string]float64 { return make(chan map[string]float64, cap) }
-	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, args)
-	e.AddWsChanRefs(chanKey, "markPrice")
+	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, args, markPriceRefs(symbols)...)
 	e.DumpWS("WatchMarkPrices", symbols)
 	return out, nil
 }
 
 func (e *Binance) UnWatchMarkPrices(symbols []string, params map[string]interface{}) *errs.Error {
-	chanKey, _, err := e.prepareMarkPrices(false, symbols, params)
-	if err != nil {
-		return err
-	}
-	e.DelWsChanRefs(chanKey, "markPrice")
-	return nil
+	_, _, err := e.prepareMarkPrices(false, symbols, params)
+	return err
 }
 
 func (e *Binance) prepareMarkPrices(isSub bool, symbols []string, params map[string]interface{}) (string, map[string]interface{}, *errs.Error) {
@@ -435,6 +422,15 @@ func (e *Binance) prepareMarkPrices(isSub bool, symbols []string, params map[str
 	if err != nil {
 		return "", nil, err
 	}
+	chanKey := client.Prefix(msgHash)
+	if !isSub {
+		refKeys := markPriceRefs(symbols)
+		free := e.ReleaseWsRefs(chanKey, args, refKeys...)
+		if len(free) == 0 {
+			return chanKey, args, nil
+		}
+		symbols = banexg.PickFreeRefs(symbols, refKeys, free)
+	}
 	intv := utils.PopMapVal(args, banexg.ParamInterval, "")
 	if intv != "" {
 		if intv != "1s" {
@@ -451,10 +447,17 @@ func (e *Binance) prepareMarkPrices(isSub bool, symbols []string, params map[str
 	if err != nil {
 		return "", nil, err
 	}
-	chanKey := client.Prefix(msgHash)
 	return chanKey, args, nil
 }
 
+// markPriceRefs ref keys of WatchMarkPrices, WsRefAll for the stream of all markets
+func markPriceRefs(symbols []string) []string {
+	if len(symbols) == 0 {
+		return []string{banexg.WsRefAll}
+	}
+	return symbols
+}
+
 func (e *Binance) handleMarkPrices(client *banexg.WsClient, msgList []map[string]string, isArray bool) {
 	//evtTime, _ := utils.SafeMapVal(msgList[0], "E", int64(0))
 	//e.KeyTimeStamps["markPrices"] = evtTime
@@ -495,7 +498,7 @@ func (e *Binance) handleMarkPrices(client *banexg.WsClient, msgList []map[string
 		marketId = strings.Split(marketId, "-")[0]
 		subsKey = marketId + "@markPrice"
 	}
-	client.SetSubsKeyStamp(subsKey, bntp.UTCStamp())
+	client.SetSubsKeyStamp(subsKey, e.MilliSeconds())
 	chanKey := client.Prefix(client.MarketType + "@markPrice")
 	banexg.WriteOutChan(e.Exchange, chanKey, res, true)
 }
@@ -507,7 +510,7 @@ func (e *Binance) handleTrade(client *banexg.WsClient, msg map[string]string) {
 	var chanKey = client.Prefix(client.MarketType + "@" + event)
 	marketId, _ := utils.SafeMapVal(msg, "s", "")
 	var symbol = e.SafeSymbol(marketId, "", client.MarketType)
-	client.SetSubsKeyStamp(strings.ToLower(marketId)+"@"+event, bntp.UTCStamp())
+	client.SetSubsKeyStamp(strings.ToLower(marketId)+"@"+event, e.MilliSeconds())
 	var tradeId string
 	if isAggTrade {
 		tradeId, _ = utils.SafeMapVal(msg, "a", "")
@@ -581,7 +584,7 @@ func (e *Binance) handleOHLCV(client *banexg.WsClient, msg map[string]string) {
 	} else if k.PairSymbol != "" {
 		marketId = k.PairSymbol
 	}
-	client.SetSubsKeyStamp(strings.ToLower(marketId)+"@"+event, bntp.UTCStamp())
+	client.SetSubsKeyStamp(strings.ToLower(marketId)+"@"+event, e.MilliSeconds())
 	o, _ := strconv.ParseFloat(k.Open, 64)
 	c, _ := strconv.ParseFloat(k.Close, 64)
 	h, _ := strconv.ParseFloat(k.High, 64)
@@ -621,6 +624,19 @@ func (e *Binance) prepareOHLCVSub(isSub bool, jobs [][2]string, params map[strin
 	if err != nil {
 		return "", nil, nil, err
 	}
+	chanKey := client.Prefix(msgHash)
+	refKeys := make([]string, 0, len(jobs))
+	for _, k := range jobs {
+		refKeys = append(refKeys, k[0]+"@"+k[1])
+	}
+	if !isSub {
+		// only unsubscribe jobs not used by other watches 只取消未被其他订阅使用的任务
+		free := e.ReleaseWsRefs(chanKey, args, refKeys...)
+		if len(free) == 0 {
+			return chanKey, refKeys, args, nil
+		}
+		jobs = banexg.PickFreeRefs(jobs, refKeys, free)
+	}
 
 	symbols := make([]string, 0, len(jobs))
 	for _, k := range jobs {
@@ -637,8 +653,7 @@ func (e *Binance) prepareOHLCVSub(isSub bool, jobs [][2]string, params map[strin
 	if err != nil {
 		return "", nil, nil, err
 	}
-	chanKey := client.Prefix(msgHash)
-	return chanKey, symbols, args, nil
+	return chanKey, refKeys, args, nil
 }
 
 func (e *Binance) handleTickers(client *banexg.WsClient, msgList []map[string]string) {
@@ -1,13 +1,11 @@
 package binance
 
 import (
-	"errors"
 	"fmt"
 	"github.com/banbox/banexg"
 	"github.com/banbox/banexg/errs"
 	"github.com/banbox/banexg/log"
 	"github.com/banbox/banexg/utils"
-	"github.com/banbox/bntp"
 	"go.uber.org/zap"
 	"strconv"
 	"strings"
@@ -163,19 +161,14 @@ func (e *Binance) WatchOrderBooks(symbols []string, limit int, params map[string
 		# 9. Receiving an event that removes a price level that is not in your local order book can happen and is normal.
 	*/
 	create := func(cap int) chan *banexg.OrderBook { return make(chan *banexg.OrderBook, cap) }
-	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, args)
-	e.AddWsChanRefs(chanKey, symbols...)
+	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, args, symbols...)
 	e.DumpWS("WatchOrderBooks", symbols)
 	return out, nil
 }
 
 func (e *Binance) UnWatchOrderBooks(symbols []string, params map[string]interface{}) *errs.Error {
-	chanKey, _, err := e.prepareBookArgs(false, 0, symbols, params)
-	if err != nil {
-		return err
-	}
-	e.DelWsChanRefs(chanKey, symbols...)
-	return nil
+	_, _, err := e.prepareBookArgs(false, 0, symbols, params)
+	return err
 }
 
 func (e *Binance) getExgWsParams(offset int, symbols []string, cvt func(m *banexg.Market, i int) string) ([]string, *errs.Error) {
@@ -211,6 +204,14 @@ func (e *Binance) prepareBookArgs(isSub bool, limit int, symbols []string, param
 	if err != nil {
 		return "", nil, err
 	}
+	chanKey := client.Prefix(msgHash)
+	if !isSub {
+		// only unsubscribe symbols not used by other watches 只取消未被其他订阅使用的品种
+		symbols = e.ReleaseWsRefs(chanKey, args, symbols...)
+		if len(symbols) == 0 {
+			return chanKey, args, nil
+		}
+	}
 	watchRate, ok := e.WsIntvs["WatchOrderBooks"]
 	if !ok {
 		watchRate = 100
@@ -257,7 +258,6 @@ func (e *Binance) prepareBookArgs(isSub bool, limit int, symbols []string, param
 		}
 		lock.Unlock()
 	}
-	chanKey := client.Prefix(msgHash)
 	return chanKey, args, err
 }
 
@@ -268,20 +268,14 @@ func (e *Binance) WatchTrades(symbols []string, params map[string]interface{}) (
 	}
 
 	create := func(cap int) chan *banexg.Trade { return make(chan *banexg.Trade, cap) }
-	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, args)
-	e.AddWsChanRefs(chanKey, symbols...)
+	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, args, symbols...)
 	e.DumpWS("WatchTrades", symbols)
 	return out, nil
 }
 
 func (e *Binance) UnWatchTrades(symbols []string, params map[string]interface{}) *errs.Error {
-	chanKey, _, err := e.prepareWatchTrades(false, symbols, params)
-
-	if err != nil {
-		return err
-	}
-	e.DelWsChanRefs(chanKey, symbols...)
-	return nil
+	_, _, err := e.prepareWatchTrades(false, symbols, params)
+	return err
 }
 
 func (e *Binance) prepareWatchTrades(isSub bool, symbols []string, params map[string]interface{}) (string, map[string]interface{}, *errs.Error) {
@@ -298,6 +292,13 @@ func (e *Binance) prepareWatchTrades(isSub bool, symbols []string, params map[st
 	if err != nil {
 		return "", nil, err
 	}
+	chanKey := client.Prefix(msgHash)
+	if !isSub {
+		symbols = e.ReleaseWsRefs(chanKey, args, symbols...)
+		if len(symbols) == 0 {
+			return chanKey, args, nil
+		}
+	}
 
 	err = e.WriteWSMsg(client, 0, isSub, symbols, func(m *banexg.Market, _ int) string {
 		return fmt.Sprintf("%s@%s", m.LowercaseID, name)
@@ -305,7 +306,6 @@ func (e *Binance) prepareWatchTrades(isSub bool, symbols []string, params map[st
 	if err != nil {
 		return "", nil, err
 	}
-	chanKey := client.Prefix(msgHash)
 	return chanKey, args, nil
 }
 
@@ -338,8 +338,7 @@ func (e *Binance) WatchMyTrades(params map[string]interface{}) (chan *banexg.MyT
 	args := utils.SafeParams(params)
 	chanKey := client.Prefix("mytrades")
 	create := func(cap int) chan *banexg.MyTrade { return make(chan *banexg.MyTrade, cap) }
-	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, args)
-	e.AddWsChanRefs(chanKey, "account")
+	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, args, "account")
 	return out, nil
 }
 
@@ -363,7 +362,7 @@ func (e *Binance) handleOrderBook(client *banexg.WsClient, msg map[string]string
 		#     }
 	*/
 	marketId, _ := msg["s"]
-	client.SetSubsKeyStamp(strings.ToLower(marketId)+"@depth", bntp.UTCStamp())
+	client.SetSubsKeyStamp(strings.ToLower(marketId)+"@depth", e.MilliSeconds())
 	market := e.GetMarketById(marketId, client.MarketType)
 	urlZap := zap.String("url", client.URL)
 	if market == nil {
@@ -412,7 +411,6 @@ func (e *Binance) handleOrderBook(client *banexg.WsClient, msg map[string]string
 	refresh := func() {
 		err := e.fetchOrderBookSnapshot(client, symbol, chanKey, book.Limit)
 		if err != nil {
-			e.DelWsChanRefs(chanKey, symbol)
 			log.Error("fetch od book from rest fail", zap.String("code", symbol), zap.Error(err))
 			err = e.UnWatchOrderBooks([]string{symbol}, nil)
 			if err != nil {
@@ -429,61 +427,57 @@ func (e *Binance) handleOrderBook(client *banexg.WsClient, msg map[string]string
 		}
 		return
 	}
-	var zero = int64(0)
-	U, _ := utils.SafeMapVal(msg, "U", zero) // 上次推送至今新增的第一个id，应恰好等于上一次u+1
-	u, _ := utils.SafeMapVal(msg, "u", zero) // 上次推送至今新增的最后一个id
-	pu, _ := utils.SafeMapVal(msg, "pu", zero)
-	var err_ error
-	if pu == 0 {
-		// spot
-		// 4. Drop any event where u is <= lastUpdateId in the snapshot
-		if u > nonce {
-			timestamp, _ := utils.SafeMapVal(msg, "timestamp", zero)
-			valid := false
-			if timestamp == 0 {
-				// 5. The first processed event should have U <= lastUpdateId+1 AND u >= lastUpdateId+1
-				valid = U-1 <= nonce && u-1 >= nonce
-			} else {
-				// 6. While listening to the stream, each new event's U should be equal to the previous event's u+1.
-				valid = U-1 == nonce
-			}
-			if valid {
-				e.applyDepthMsg(msg, book)
-				if nonce < book.Nonce {
-					banexg.WriteOutChan(e.Exchange, chanKey, book, true)
-				}
-			} else {
-				err_ = errors.New("out of date")
-			}
-		}
-	} else {
-		// contract
-		// 4. Drop any event where u is < lastUpdateId in the snapshot
-		if u >= nonce {
-			// 5. The first processed event should have U <= lastUpdateId AND u >= lastUpdateId
-			// 6. While listening to the stream, each new event's pu should be equal to the previous event's u, otherwise initialize the process from step 3
-			if U <= nonce || pu == nonce {
-				e.applyDepthMsg(msg, book)
-				if nonce < book.Nonce {
-					banexg.WriteOutChan(e.Exchange, chanKey, book, true)
-				}
-			} else {
-				err_ = errors.New("out of date")
-			}
-		}
+	// spot: U should be u+1 of last event; contract: pu should be u of last event.
+	// the first event after snapshot overlaps it, stale events are dropped. see BookDelta.ApplyDelta
+	// 现货：U应为上次u+1；合约：pu应为上次的u。快照后第一个事件与快照重叠，过期事件被忽略
+	delta := e.depthDelta(msg)
+	ok, reason := book.ApplyDelta(delta)
+	if ok && nonce < book.Nonce {
+		banexg.WriteOutChan(e.Exchange, chanKey, book, true)
 	}
-	if err_ != nil {
+	if reason != "" {
 		// order book is out of date, refresh from rest-api
-		log.Warn("ws order book out-of-date, refresh", urlZap, zap.String("code", symbol),
-			zap.Int64("cur", nonce), zap.Int64("latest", u))
+		e.BookResync(symbol, reason, urlZap, zap.Int64("cur", nonce), zap.Int64("latest", delta.LastID))
 		book.Reset()
 		book.Cache = append(book.Cache, msg)
 		go refresh()
 	}
 }
 
-func (e *Binance) applyDepthMsg(msg map[string]string, book *banexg.OrderBook) {
-	e.applyDepthMsgBy(msg, book, false, "a", "b", "u", "E")
+// depthDelta parse an incremental depth event of ws 解析ws增量深度事件
+func (e *Binance) depthDelta(msg map[string]string) *banexg.BookDelta {
+	var zero = int64(0)
+	res := &banexg.BookDelta{
+		Asks: parseDepthSide(msg, "a"),
+		Bids: parseDepthSide(msg, "b"),
+	}
+	res.FirstID, _ = utils.SafeMapVal(msg, "U", zero) // 上次推送至今新增的第一个id
+	res.LastID, _ = utils.SafeMapVal(msg, "u", zero)  // 上次推送至今新增的最后一个id
+	res.PrevID, _ = utils.SafeMapVal(msg, "pu", zero) // 上次推送的u，仅合约
+	res.TimeStamp, _ = utils.SafeMapVal(msg, "E", zero)
+	if res.TimeStamp == 0 {
+		res.TimeStamp = e.MilliSeconds()
+	}
+	return res
+}
+
+func parseDepthSide(msg map[string]string, key string) [][2]float64 {
+	text, ok := msg[key]
+	if !ok {
+		log.Error("depth side not found in ws depth", zap.String("key", key))
+		return nil
+	}
+	var arr = make([][2]string, 0)
+	if err := utils.UnmarshalString(text, &arr, utils.JsonNumDefault); err != nil {
+		log.Error("unmarshal ws depth side fail", zap.Error(err))
+		return nil
+	}
+	res := make([][2]float64, len(arr))
+	for i, row := range arr {
+		res[i][0], _ = strconv.ParseFloat(row[0], 64)
+		res[i][1], _ = strconv.ParseFloat(row[1], 64)
+	}
+	return res
 }
 
 func (e *Binance) applyDepthMsgBy(msg map[string]string, book *banexg.OrderBook, replace bool, a, b, u, t string) {
@@ -514,7 +508,7 @@ func (e *Binance) applyDepthMsgBy(msg map[string]string, book *banexg.OrderBook,
 func (e *Binance) fetchOrderBookSnapshot(client *banexg.WsClient, symbol, chanKey string, limit int) *errs.Error {
 	// 3. Get a depth snapshot from https://www.binance.com/api/v1/depth?symbol=BNBBTC&limit=1000 .
 	// default 100, max 1000, valid limits 5, 10, 20, 50, 100, 500, 1000
-	if e.WsDecoder != nil {
+	if e.IsReplay() {
 		// skip request odBook shot in replay mode
 		return nil
 	}
@@ -544,33 +538,9 @@ func (e *Binance) applyOdBookSnapshot(marketType, symbol, chanKey string, book *
 	} else {
 		e.OrderBooks[symbol] = book
 	}
-	if len(cache) > 0 {
-		var zero = int64(0)
-		for _, msg := range cache {
-			U, _ := utils.SafeMapVal(msg, "U", zero)
-			u, _ := utils.SafeMapVal(msg, "u", zero)
-			pu, _ := utils.SafeMapVal(msg, "pu", zero)
-			nonce := book.Nonce
-			if e.IsContract(marketType) {
-				//4. Drop any event where u is < lastUpdateId in the snapshot
-				if u < nonce {
-					continue
-				}
-				// 5. The first processed event should have U <= lastUpdateId AND u >= lastUpdateId
-				if U <= nonce && u >= nonce || pu == nonce {
-					e.applyDepthMsg(msg, book)
-				}
-			} else {
-				// 4. Drop any event where u is <= lastUpdateId in the snapshot
-				if u <= nonce {
-					continue
-				}
-				// 5. The first processed event should have U <= lastUpdateId+1 AND u >= lastUpdateId+1
-				if U-1 <= nonce && u-1 >= nonce {
-					e.applyDepthMsg(msg, book)
-				}
-			}
-		}
+	for _, msg := range cache {
+		// stale or out of order events are skipped 过期或不连续的事件被跳过
+		book.ApplyDelta(e.depthDelta(msg))
 	}
 	e.OdBookLock.Unlock()
 	banexg.WriteOutChan(e.Exchange, chanKey, book, true)
@@ -200,12 +200,14 @@ mainFor:
 		panic("no book received")
 	}
 	_, _ = writer.WriteString(fmt.Sprintf("---------- %v ----------\n", book.TimeStamp))
-	for i, price := range book.Asks.Price {
-		size := book.Asks.Size[i]
+	askPrices, askSizes := book.Asks.Levels(0)
+	for i, price := range askPrices {
+		size := askSizes[i]
 		_, _ = writer.WriteString(fmt.Sprintf("ask: %.3f %.6f\n", price, price*size))
 	}
-	for i, price := range book.Bids.Price {
-		size := book.Bids.Size[i]
+	bidPrices, bidSizes := book.Bids.Levels(0)
+	for i, price := range bidPrices {
+		size := bidSizes[i]
 		_, _ = writer.WriteString(fmt.Sprintf("bid: %.3f %.6f\n", price, price*size))
 	}
 	_, _ = writer.WriteString("\n")
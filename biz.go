@@ -2,9 +2,7 @@ package banexg
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
-	"encoding/gob"
 	"fmt"
 	"io"
 	"maps"
@@ -12,8 +10,6 @@ import (
 	"math/rand"
 	"net/http"
 	"net/url"
-	"os"
-	"reflect"
 	"sort"
 	"strconv"
 	"strings"
@@ -140,6 +136,13 @@ func (e *Exchange) Init() *errs.Error {
 	for k, v := range retries {
 		e.Retries[k] = v
 	}
+	e.initCacheStore()
+	utils.SetFieldBy(&e.Metrics, e.Options, OptMetrics, nil)
+	utils.SetFieldBy(&e.Clock, e.Options, OptClock, nil)
+	e.DecimalMode = utils.GetMapVal(e.Options, OptDecimal, false)
+	if cfg := utils.GetMapVal(e.Options, OptCircuitBreaker, (*CircuitConfig)(nil)); cfg != nil {
+		e.Breaker = NewCircuitBreaker(cfg)
+	}
 	// 更新api缓存时间
 	apiCaches := utils.GetMapVal(e.Options, OptApiCaches, map[string]int{})
 	var failCaches []string
@@ -157,7 +160,17 @@ func (e *Exchange) Init() *errs.Error {
 	if err != nil {
 		return err
 	}
-	err = e.SetReplay(utils.GetMapVal(e.Options, OptReplayPath, ""))
+	replayStart := utils.GetMapVal(e.Options, OptReplayStart, int64(0))
+	replayEnd := utils.GetMapVal(e.Options, OptReplayEnd, int64(0))
+	err = e.SetReplay(utils.GetMapVal(e.Options, OptReplayPath, ""), replayStart, replayEnd)
+	if err != nil {
+		return err
+	}
+	err = e.SetApiDump(utils.GetMapVal(e.Options, OptApiDumpPath, ""))
+	if err != nil {
+		return err
+	}
+	err = e.SetApiReplay(utils.GetMapVal(e.Options, OptApiReplayPath, ""))
 	if err != nil {
 		return err
 	}
@@ -182,8 +195,8 @@ func (e *Exchange) Init() *errs.Error {
 	e.CurrenciesById = map[string]*Currency{}
 	e.CurrenciesByCode = map[string]*Currency{}
 	e.WSClients = map[string]*WsClient{}
-	e.WsOutChans = map[string]interface{}{}
-	e.WsChanRefs = map[string]map[string]struct{}{}
+	e.WsOutChans = map[string][]*WsHandle{}
+	e.WsChanRefs = map[string]map[string]int{}
 	e.OrderBooks = map[string]*OrderBook{}
 	e.MarkPrices = map[string]map[string]float64{}
 	e.KeyTimeStamps = map[string]int64{}
@@ -794,6 +807,10 @@ func (e *Exchange) CreateOrder(symbol, odType, side string, amount float64, pric
 	return nil, errs.NewMsg(errs.CodeNotImplement, "method not implement")
 }
 
+func (e *Exchange) CreateOrderReq(req *OrderRequest) (*Order, *errs.Error) {
+	return nil, errs.NewMsg(errs.CodeNotImplement, "method not implement")
+}
+
 func (e *Exchange) EditOrder(symbol, orderId, side string, amount, price float64, params map[string]interface{}) (*Order, *errs.Error) {
 	return nil, errs.NewMsg(errs.CodeNotImplement, "method not implement")
 }
@@ -883,83 +900,88 @@ func (e *Exchange) WatchAccountConfig(params map[string]interface{}) (chan *Acco
 	return nil, errs.NewMsg(errs.CodeNotImplement, "method not implement")
 }
 
-func (e *Exchange) CloseWsFile() {
-	if e.WsFile != nil {
-		err_ := e.WsFile.Close()
-		if err_ != nil {
-			log.Error("close ws file fail", zap.Error(err_))
-		}
-		e.WsFile = nil
-	}
-}
-
+/*
+SetDump
+record websocket messages to a versioned dump file, append if it exists; pass empty path to stop
+将websocket消息记录到版本化的文件，文件已存在时追加；传入空路径停止记录
+*/
 func (e *Exchange) SetDump(path string) *errs.Error {
 	if path == "" {
-		if e.WsEncoder != nil {
-			if len(e.WsCache) > 0 {
-				err_ := e.WsEncoder.Encode(e.WsCache)
-				if err_ != nil {
-					log.Error("dump ws cache fail", zap.Error(err_))
-				}
+		if e.WsDumper != nil {
+			e.wsCacheLock.Lock()
+			err := e.WsDumper.Write(e.WsCache)
+			if err != nil {
+				log.Error("dump ws cache fail", zap.Error(err))
 			}
-			e.WsEncoder = nil
-			err_ := e.WsWriter.Close()
-			if err_ != nil {
-				log.Error("write ws cache fail", zap.Error(err_))
+			e.WsCache = nil
+			err = e.WsDumper.Close()
+			if err != nil {
+				log.Error("close ws dump fail", zap.Error(err))
 			}
-			e.WsWriter = nil
-			e.CloseWsFile()
+			e.WsDumper = nil
+			e.wsCacheLock.Unlock()
 		}
 		return nil
 	}
-	if e.WsDecoder != nil {
+	if e.WsReplayer != nil {
 		return errs.NewMsg(errs.CodeRunTime, "cannot dump in replay mode")
 	}
 	// dump websocket messages for replay later
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	dumper, err := CreateWsDump(path, &WsDumpHeader{Exchange: e.ID, MarketType: e.MarketType, CreateMS: e.MilliSeconds()})
 	if err != nil {
-		return errs.New(errs.CodeIOWriteFail, err)
+		return err
 	}
-	e.WsFile = file
 	e.WsCache = nil
-	e.WsWriter = gzip.NewWriter(file)
-	e.WsEncoder = gob.NewEncoder(e.WsWriter)
+	e.WsDumper = dumper
 	return nil
 }
 
-func (e *Exchange) SetReplay(path string) *errs.Error {
+/*
+SetReplay
+replay websocket messages between fromMS and toMS (0 means no limit) from a dump file,
+both versioned and legacy gob dumps are supported; pass empty path to stop
+从录制文件回放fromMS到toMS（0表示不限）之间的websocket消息，支持版本化和旧版gob文件；传入空路径停止
+*/
+func (e *Exchange) SetReplay(path string, fromMS, toMS int64) *errs.Error {
 	if path == "" {
-		if e.WsDecoder != nil {
-			e.WsDecoder = nil
-			err := e.WsReader.Close()
-			if err != nil {
-				return errs.New(errs.CodeIOReadFail, err)
+		if e.WsReplayer != nil {
+			err := e.WsReplayer.Close()
+			e.WsReplayer = nil
+			if _, ok := e.Clock.(*ReplayClock); ok {
+				e.Clock = e.clockBak
+				e.clockBak = nil
 			}
-			e.WsReader = nil
-			e.CloseWsFile()
+			e.WsCache = nil
+			e.WsNextMS = 0
+			return err
 		}
 		return nil
 	}
 	// replay ws message with dumped file
-	if e.WsEncoder != nil {
+	if e.WsDumper != nil {
 		return errs.NewMsg(errs.CodeRunTime, "cannot set replay in dump mode !")
 	}
-	file, err := os.Open(path)
+	reader, err := OpenWsDump(path, fromMS, toMS)
 	if err != nil {
-		return errs.New(errs.CodeIOReadFail, err)
+		return err
 	}
-	e.WsFile = file
 	e.WsCache = nil
-	e.WsReader, err = gzip.NewReader(file)
-	if err != nil {
-		return errs.New(errs.CodeIOReadFail, err)
+	e.WsNextMS = 0
+	e.WsReplayer = reader
+	if _, ok := e.Clock.(*ReplayClock); !ok {
+		e.clockBak = e.Clock
+		e.Clock = &ReplayClock{}
 	}
-	e.WsDecoder = gob.NewDecoder(e.WsReader)
 	return nil
 }
 
+// IsReplay whether websocket messages are replayed from file 是否正在从文件回放websocket消息
+func (e *Exchange) IsReplay() bool {
+	return e.WsReplayer != nil
+}
+
 func (e *Exchange) DumpWS(name string, data interface{}) {
-	if e.WsEncoder == nil || data == nil {
+	if e.WsDumper == nil || data == nil {
 		return
 	}
 	dataStr, err_ := utils.MarshalString(data)
@@ -969,7 +991,7 @@ func (e *Exchange) DumpWS(name string, data interface{}) {
 	}
 	item := &WsLog{
 		Name:    name,
-		TimeMS:  bntp.UTCStamp(),
+		TimeMS:  e.MilliSeconds(),
 		Content: dataStr,
 	}
 	e.WsCache = append(e.WsCache, item)
@@ -979,7 +1001,10 @@ func (e *Exchange) DumpWS(name string, data interface{}) {
 		go func() {
 			e.wsCacheLock.Lock()
 			defer e.wsCacheLock.Unlock()
-			err := e.WsEncoder.Encode(rows)
+			if e.WsDumper == nil {
+				return
+			}
+			err := e.WsDumper.Write(rows)
 			if err != nil {
 				log.Error("dump ws cache fail", zap.Error(err))
 			}
@@ -990,11 +1015,15 @@ func (e *Exchange) DumpWS(name string, data interface{}) {
 func (e *Exchange) GetReplayTo() int64 {
 	if e.WsNextMS == 0 {
 		if len(e.WsCache) == 0 {
-			e.WsCache = make([]*WsLog, 0, e.WsBatchSize)
-			if err := e.WsDecoder.Decode(&e.WsCache); err != nil {
+			rows, err := e.WsReplayer.Read()
+			if err != nil {
+				log.Error("read ws dump fail", zap.Error(err))
+			}
+			if len(rows) == 0 {
 				e.WsNextMS = math.MaxInt64
 				return e.WsNextMS
 			}
+			e.WsCache = rows
 		}
 		if len(e.WsCache) > 0 {
 			e.WsNextMS = e.WsCache[0].TimeMS
@@ -1012,7 +1041,7 @@ func (e *Exchange) ReplayOne() *errs.Error {
 	item := e.WsCache[0]
 	e.WsCache = e.WsCache[1:]
 	e.WsNextMS = 0
-	e.WsReplayTo = item.TimeMS
+	e.setReplayTo(item.TimeMS)
 	handle, ok := e.WsReplayFn[item.Name]
 	if !ok {
 		log.Warn("no ws replay handle found", zap.String("for", item.Name), zap.String("exg", e.Name))
@@ -1021,8 +1050,16 @@ func (e *Exchange) ReplayOne() *errs.Error {
 	return handle(item)
 }
 
+// setReplayTo record time of the replaying message and advance the replay clock
+func (e *Exchange) setReplayTo(timeMS int64) {
+	e.WsReplayTo = timeMS
+	if clock, ok := e.Clock.(*ReplayClock); ok {
+		clock.Advance(timeMS)
+	}
+}
+
 func (e *Exchange) ReplayAll() *errs.Error {
-	if e.WsFile == nil {
+	if e.WsReplayer == nil {
 		return errs.NewMsg(errs.CodeRunTime, "Replay not initialized")
 	}
 	var counts = make(map[string]int)
@@ -1031,7 +1068,7 @@ func (e *Exchange) ReplayAll() *errs.Error {
 		for _, item := range e.WsCache {
 			oldNum, _ := counts[item.Name]
 			counts[item.Name] = oldNum + 1
-			e.WsReplayTo = item.TimeMS
+			e.setReplayTo(item.TimeMS)
 			handle, ok := e.WsReplayFn[item.Name]
 			if !ok {
 				bads[item.Name] = true
@@ -1046,11 +1083,16 @@ func (e *Exchange) ReplayAll() *errs.Error {
 			fails := utils.KeysOfMap(bads)
 			log.Warn("no ws replay handle found", zap.Strings("for", fails), zap.String("exg", e.Name))
 		}
-		e.WsCache = make([]*WsLog, 0, e.WsBatchSize)
-		if err_ := e.WsDecoder.Decode(&e.WsCache); err_ != nil {
+		rows, err := e.WsReplayer.Read()
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
 			// read done
+			e.WsCache = nil
 			break
 		}
+		e.WsCache = rows
 	}
 	log.Debug("replay counts", zap.Any("r", counts))
 	return nil
@@ -1060,6 +1102,35 @@ func (e *Exchange) SetOnWsChan(cb FuncOnWsChan) {
 	e.OnWsChan = cb
 }
 
+func (e *Exchange) AddAfterWsReCon(cb FuncAfterWsReCon) func() {
+	e.lockReCon.Lock()
+	e.reConID += 1
+	id := e.reConID
+	e.afterWsReCons = append(e.afterWsReCons, afterWsReCon{id: id, cb: cb})
+	e.lockReCon.Unlock()
+	return func() {
+		e.lockReCon.Lock()
+		// copy on write, fireAfterWsReCon may be iterating the old slice
+		items := make([]afterWsReCon, 0, len(e.afterWsReCons))
+		for _, item := range e.afterWsReCons {
+			if item.id != id {
+				items = append(items, item)
+			}
+		}
+		e.afterWsReCons = items
+		e.lockReCon.Unlock()
+	}
+}
+
+func (e *Exchange) fireAfterWsReCon(client *WsClient) {
+	e.lockReCon.Lock()
+	items := e.afterWsReCons
+	e.lockReCon.Unlock()
+	for _, item := range items {
+		item.cb(client)
+	}
+}
+
 func (e *Exchange) CalculateFee(symbol, odType, side string, amount float64, price float64, isMaker bool,
 	params map[string]interface{}) (*Fee, *errs.Error) {
 	if odType == OdTypeMarket && isMaker {
@@ -1119,9 +1190,17 @@ func (e *Exchange) CalculateFee(symbol, odType, side string, amount float64, pri
 	costQuote = costQuote.Mul(decimal.NewFromFloat(feeRate))
 	costVal, _ := cost.Float64()
 	costQuoteVal, _ := costQuote.Float64()
-	return &Fee{
-		isMaker, currency, costVal, costQuoteVal, feeRate,
-	}, nil
+	res := &Fee{
+		IsMaker:   isMaker,
+		Currency:  currency,
+		Cost:      costVal,
+		QuoteCost: costQuoteVal,
+		Rate:      feeRate,
+	}
+	if e.DecimalMode {
+		res.Dec = &FeeDec{Cost: cost, Rate: decimal.NewFromFloat(feeRate)}
+	}
+	return res, nil
 }
 
 /*
@@ -1154,9 +1233,14 @@ func (e *Exchange) IsContract(marketType string) bool {
 		marketType == MarketLinear || marketType == MarketInverse
 }
 
+/*
+MilliSeconds
+current 13 digit timestamp from Clock, which follows replayed messages after SetReplay
+从Clock获取当前13位时间戳，SetReplay后跟随回放消息的时间
+*/
 func (e *Exchange) MilliSeconds() int64 {
-	if e.WsDecoder != nil {
-		return e.WsReplayTo
+	if e.Clock != nil {
+		return e.Clock.Now()
 	}
 	return bntp.UTCStamp()
 }
@@ -1205,16 +1289,27 @@ Concurrency control: Same host, default concurrent 3 times at the same time
 并发控制：同一个host，默认同时并发3
 */
 func (e *Exchange) RequestApi(ctx context.Context, cacheKey string, api *Entry, params map[string]interface{}, cache, debug bool) *HttpRes {
+	var logKey string
+	if replay, dump := e.apiRecordState(); replay || dump {
+		logKey = GetApiLogKey(api, params)
+		if replay {
+			return e.replayApi(logKey, api)
+		}
+	}
 	if e.NetDisable {
 		err := errs.NewMsg(errs.CodeNetDisable, fmt.Sprintf("net disabled for %v, fail: %v", e.Name, api.Url))
 		return &HttpRes{Error: err}
 	}
 	// Traffic control, block if concurrency is full
 	// 流量控制，如果并发已满则阻塞
+	hook := e.metrics()
 	sem := GetHostFlowChan(api.RawHost)
+	changeHostQueue(api.RawHost, 1, hook)
 	select {
 	case sem <- struct{}{}:
+		changeHostQueue(api.RawHost, -1, hook)
 	case <-ctx.Done():
+		changeHostQueue(api.RawHost, -1, hook)
 		return requestContextError(ctx)
 	}
 	defer func() {
@@ -1224,6 +1319,9 @@ func (e *Exchange) RequestApi(ctx context.Context, cacheKey string, api *Entry,
 	// 检查是否出现429或418需要等待
 	waitMS := GetHostRetryWait(api.RawHost, true)
 	if waitMS > 0 {
+		if hook != nil {
+			hook.OnRateLimitWait(api.RawHost, time.Millisecond*time.Duration(waitMS))
+		}
 		if err := waitRequestContext(ctx, time.Millisecond*time.Duration(waitMS)); err != nil {
 			return requestContextError(ctx)
 		}
@@ -1234,6 +1332,9 @@ func (e *Exchange) RequestApi(ctx context.Context, cacheKey string, api *Entry,
 		cost := e.CalcRateLimiterCost(api, params)
 		sleepMS := int64(math.Round(float64(e.RateLimit) * cost))
 		if elapsed < sleepMS {
+			if hook != nil {
+				hook.OnRateLimitWait(api.RawHost, time.Duration(sleepMS-elapsed)*time.Millisecond)
+			}
 			if err := waitRequestContext(ctx, time.Duration(sleepMS-elapsed)*time.Millisecond); err != nil {
 				e.rateM.Unlock()
 				return requestContextError(ctx)
@@ -1243,6 +1344,63 @@ func (e *Exchange) RequestApi(ctx context.Context, cacheKey string, api *Entry,
 		e.rateM.Unlock()
 	}
 	sign := e.Sign(api, params)
+	roundTrip := func(ctx context.Context, api *Entry, req *HttpReq) *HttpRes {
+		return e.doRoundTrip(ctx, api, req, debug)
+	}
+	e.lockIntercept.Lock()
+	interceptors := e.Interceptors
+	e.lockIntercept.Unlock()
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		roundTrip = interceptors[i](roundTrip)
+	}
+	startAt := time.Now()
+	result := roundTrip(ctx, api, sign)
+	if result == nil {
+		result = &HttpRes{Url: sign.Url, AccName: sign.AccName,
+			Error: errs.NewMsg(errs.CodeRunTime, "interceptor returns nil response")}
+	}
+	if hook != nil {
+		errCode := 0
+		if result.Error != nil {
+			errCode = result.Error.Code
+		}
+		hook.OnRequest(e.ID, api.Path, result.Status, errCode, time.Since(startAt))
+	}
+	if logKey != "" {
+		e.dumpApi(logKey, sign, result)
+	}
+	if result.Error == nil && result.Status < 400 && cache && api.CacheSecs > 0 {
+		if sign.Private {
+			log.Warn("cache private api result is not recommend:" + sign.Url)
+		}
+		result.CacheKey = cacheKey
+		e.cacheApiRes(api, result)
+	}
+	return result
+}
+
+/*
+Use
+append interceptors to the http middleware chain of RequestApi, safe to call while requests are running.
+The request is already signed before the chain: headers can be added, but changing Url or Body invalidates the signature.
+向RequestApi的http中间件链追加拦截器，可在请求进行中并发调用。
+请求在进入中间件链之前已签名：可添加请求头，但修改Url或Body会使签名失效。
+*/
+func (e *Exchange) Use(items ...Interceptor) {
+	e.lockIntercept.Lock()
+	// copy on write, RequestApi may be iterating the old slice
+	chain := make([]Interceptor, 0, len(e.Interceptors)+len(items))
+	chain = append(chain, e.Interceptors...)
+	e.Interceptors = append(chain, items...)
+	e.lockIntercept.Unlock()
+}
+
+/*
+doRoundTrip
+The innermost RoundTrip: send the signed request by HttpClient and map http errors
+最内层的RoundTrip：通过HttpClient发送已签名的请求，并映射http错误
+*/
+func (e *Exchange) doRoundTrip(ctx context.Context, api *Entry, sign *HttpReq, debug bool) *HttpRes {
 	if sign.Error != nil {
 		return &HttpRes{AccName: sign.AccName, Error: sign.Error}
 	}
@@ -1260,6 +1418,9 @@ func (e *Exchange) RequestApi(ctx context.Context, cacheKey string, api *Entry,
 	}
 	req = req.WithContext(ctx)
 	req.Header = sign.Headers
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
 	e.setReqHeaders(&req.Header)
 
 	if debug || e.DebugAPI {
@@ -1271,8 +1432,7 @@ func (e *Exchange) RequestApi(ctx context.Context, cacheKey string, api *Entry,
 		return &HttpRes{Url: sign.Url, AccName: sign.AccName, Error: errs.New(errs.CodeNetFail, err)}
 	}
 	defer rsp.Body.Close()
-	var result = HttpRes{Url: sign.Url, AccName: sign.AccName, Status: rsp.StatusCode, Headers: rsp.Header,
-		CacheKey: cacheKey}
+	var result = HttpRes{Url: sign.Url, AccName: sign.AccName, Status: rsp.StatusCode, Headers: rsp.Header}
 	rspData, err := io.ReadAll(rsp.Body)
 	if err != nil {
 		result.Error = errs.New(errs.CodeNetFail, err)
@@ -1306,11 +1466,6 @@ func (e *Exchange) RequestApi(ctx context.Context, cacheKey string, api *Entry,
 			result.Error.Data = waitSecs
 			SetHostRetryWait(api.RawHost, waitSecs*1000)
 		}
-	} else if cache && api.CacheSecs > 0 {
-		if sign.Private {
-			log.Warn("cache private api result is not recommend:" + sign.Url)
-		}
-		e.cacheApiRes(api, &result)
 	}
 	return &result
 }
@@ -1362,7 +1517,7 @@ func (e *Exchange) cacheApiRes(api *Entry, res *HttpRes) {
 	if err_ != nil {
 		log.Error("cache api rsp fail", zap.String("url", res.Url), zap.Error(err_))
 	} else {
-		err2 := utils.WriteCacheFile(res.CacheKey, cacheText, api.CacheSecs)
+		err2 := e.getCacheStore().Set(res.CacheKey, cacheText, api.CacheSecs)
 		if err2 != nil {
 			log.Error("write api rsp cache fail", zap.String("url", res.Url), zap.Error(err2))
 		}
@@ -1378,9 +1533,14 @@ func (e *Exchange) RequestApiRetryAdv(ctx context.Context, endpoint string, para
 	debug := utils.PopMapVal(params, ParamDebug, false)
 	// 检查是否有缓存
 	var cacheKey string
+	replay, dump := e.apiRecordState()
+	if replay || dump {
+		// api cache is skipped to record/replay the whole session
+		readCache, writeCache = false, false
+	}
 	if readCache && api.CacheSecs > 0 {
 		cacheKey = e.GetCacheKey(endpoint, params)
-		cacheText, err := utils.ReadCacheFile(cacheKey)
+		cacheText, err := e.getCacheStore().Get(cacheKey)
 		if err != nil && (!(err.Code == errs.CodeExpired && e.NetDisable)) {
 			if debug || e.DebugAPI {
 				log.Debug("read api cache fail", zap.String("url", api.Path), zap.String("err", err.Short()))
@@ -1407,7 +1567,7 @@ func (e *Exchange) RequestApiRetryAdv(ctx context.Context, endpoint string, para
 		}
 		api.RawHost = parsed.Host
 	}
-	if e.NetDisable {
+	if e.NetDisable && !replay {
 		err := errs.NewMsg(errs.CodeNetDisable, fmt.Sprintf("net disabled for %v, fail: %v", e.Name, api.Url))
 		return &HttpRes{Error: err}
 	}
@@ -1415,6 +1575,9 @@ func (e *Exchange) RequestApiRetryAdv(ctx context.Context, endpoint string, para
 	var rsp *HttpRes
 	var sleep = 0
 	for i := 0; i < tryNum; i++ {
+		if sleep > 0 && replay {
+			sleep = 0
+		}
 		if sleep > 0 {
 			if err := waitRequestContext(ctx, time.Second*time.Duration(sleep)); err != nil {
 				rsp = requestContextError(ctx)
@@ -1422,7 +1585,17 @@ func (e *Exchange) RequestApiRetryAdv(ctx context.Context, endpoint string, para
 			}
 			sleep = 0
 		}
+		if e.Breaker != nil {
+			if err := e.Breaker.Allow(api); err != nil {
+				// fail fast, don't retry while circuit is open
+				rsp = &HttpRes{Url: api.Url, Error: err}
+				break
+			}
+		}
 		rsp = e.RequestApi(ctx, cacheKey, api, params, writeCache, debug)
+		if e.Breaker != nil {
+			e.Breaker.Record(api, circuitErr(api, rsp))
+		}
 		if rsp.Error != nil {
 			if rsp.Error.Code == errs.CodeNetFail {
 				// 网络错误等待3s重试
@@ -1780,28 +1953,38 @@ func (e *Exchange) Close() *errs.Error {
 		e.MarketsWait = nil
 	}
 	e.lockOutChan.Lock()
-	for key, chanQ := range e.WsOutChans {
-		chVal := reflect.ValueOf(chanQ)
-		if chVal.Kind() == reflect.Chan {
-			chVal.Close()
+	for key, handles := range e.WsOutChans {
+		for _, h := range handles {
+			h.close()
 		}
 		delete(e.WsOutChans, key)
 	}
+	e.lockWsRef.Lock()
+	e.WsChanRefs = map[string]map[string]int{}
+	e.lockWsRef.Unlock()
 	e.lockOutChan.Unlock()
-	for _, client := range e.WSClients {
+	e.stopSubsStale()
+	e.lockWsClients.Lock()
+	clients := e.WSClients
+	e.WSClients = map[string]*WsClient{}
+	e.lockWsClients.Unlock()
+	for _, client := range clients {
 		client.Close()
 	}
-	e.WSClients = map[string]*WsClient{}
 	err := e.SetDump("")
 	if err != nil {
 		return err
 	}
 	e.WsCache = nil
-	err = e.SetReplay("")
+	err = e.SetReplay("", 0, 0)
 	if err != nil {
 		return err
 	}
-	return nil
+	err = e.SetApiDump("")
+	if err != nil {
+		return err
+	}
+	return e.SetApiReplay("")
 }
 
 func makeCalcRateLimiterCost(e *Exchange) FuncCalcRateLimiterCost {
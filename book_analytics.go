@@ -0,0 +1,216 @@
+package banexg
+
+import (
+	"github.com/banbox/banexg/errs"
+)
+
+/*
+DepthPoint
+one point of cumulative depth curve, Amount and Cost are summed from the best level to Price
+累计深度曲线上的一个点，Amount和Cost为从最优档累计到Price的数量和报价币金额
+*/
+type DepthPoint struct {
+	Price  float64 `json:"price"`
+	Amount float64 `json:"amount"`
+	Cost   float64 `json:"cost"`
+}
+
+/*
+BookFill
+result of simulating a market order against the order book
+模拟市价单在订单簿上成交的结果
+*/
+type BookFill struct {
+	Side     string        `json:"side"`
+	Amount   float64       `json:"amount"`   // requested amount 请求数量
+	Filled   float64       `json:"filled"`   // amount filled by visible levels 可见档位可成交数量
+	Cost     float64       `json:"cost"`     // quote cost of filled part 成交金额(报价币)
+	Average  float64       `json:"average"`  // average fill price 成交均价
+	Impact   float64       `json:"impact"`   // relative change from best price to average 均价相对最优价的变化率
+	Fills    []*DepthPoint `json:"fills"`    // amount&cost filled on each level 每档成交数量和金额
+	Fee      *Fee          `json:"fee"`      // taker fee, set by Exchange.SimulateMarketFill 吃单手续费
+	Complete bool          `json:"complete"` // whether Amount is fully filled 是否全部成交
+}
+
+// takerSide return book side consumed by a taker order of given side
+func (b *OrderBook) takerSide(side string) *OdBookSide {
+	if side == OdSideBuy {
+		return b.Asks
+	}
+	return b.Bids
+}
+
+/*
+MidPrice
+average of best bid and best ask, 0 if any side is empty
+最优买卖价的平均值，任一侧为空时返回0
+*/
+func (b *OrderBook) MidPrice() float64 {
+	bid, _ := b.Bids.Level(0)
+	ask, _ := b.Asks.Level(0)
+	if bid == 0 || ask == 0 {
+		return 0
+	}
+	return (bid + ask) / 2
+}
+
+/*
+MicroPrice
+size weighted mid price of the top level: (bid*askSize + ask*bidSize) / (bidSize + askSize).
+It leans to the side with less liquidity, which is more likely to be consumed first.
+最优档按数量加权的中间价，偏向流动性较少（更易被吃掉）的一侧
+*/
+func (b *OrderBook) MicroPrice() float64 {
+	bid, bidSize := b.Bids.Level(0)
+	ask, askSize := b.Asks.Level(0)
+	if bid == 0 || ask == 0 {
+		return 0
+	}
+	if bidSize+askSize == 0 {
+		return (bid + ask) / 2
+	}
+	return (bid*askSize + ask*bidSize) / (bidSize + askSize)
+}
+
+/*
+Imbalance
+(bidVol - askVol) / (bidVol + askVol) of top n levels, in [-1, 1]; positive means more bids. n<=0 means all levels
+前n档的买卖量失衡度，范围[-1, 1]，正数表示买盘更多；n<=0表示所有档位
+*/
+func (b *OrderBook) Imbalance(n int) float64 {
+	_, bidSizes := b.Bids.Levels(n)
+	_, askSizes := b.Asks.Levels(n)
+	bidVol, askVol := float64(0), float64(0)
+	for _, v := range bidSizes {
+		bidVol += v
+	}
+	for _, v := range askSizes {
+		askVol += v
+	}
+	if bidVol+askVol == 0 {
+		return 0
+	}
+	return (bidVol - askVol) / (bidVol + askVol)
+}
+
+/*
+DepthCurve
+cumulative depth of top n levels of book side (OdSideBuy for bids, same as AvgPrice), costs are in quote.
+contractSize is the value of one contract in base, 0 is treated as 1.
+盘口一侧前n档的累计深度（OdSideBuy表示买盘，与AvgPrice一致），金额为报价币。contractSize为单份合约的基础币数量，0视为1
+*/
+func (b *OrderBook) DepthCurve(side string, n int, contractSize float64) []*DepthPoint {
+	book := b.Asks
+	if side == OdSideBuy {
+		book = b.Bids
+	}
+	if contractSize == 0 {
+		contractSize = 1
+	}
+	prices, sizes := book.Levels(n)
+	res := make([]*DepthPoint, len(prices))
+	amount, cost := float64(0), float64(0)
+	for i, price := range prices {
+		amount += sizes[i]
+		cost += price * sizes[i] * contractSize
+		res[i] = &DepthPoint{Price: price, Amount: amount, Cost: cost}
+	}
+	return res
+}
+
+/*
+PriceImpact
+simulate a taker order of side spending the quote notional, return the average price and
+relative change from best price. filled is the rate of notional filled by visible levels.
+模拟side方向吃单花费notional报价币，返回成交均价、相对最优价的变化率，以及可见档位的成交比例
+*/
+func (b *OrderBook) PriceImpact(side string, notional, contractSize float64) (float64, float64, float64) {
+	if contractSize == 0 {
+		contractSize = 1
+	}
+	prices, sizes := b.takerSide(side).Levels(0)
+	if len(prices) == 0 || notional <= 0 {
+		return 0, 0, 0
+	}
+	amount, cost := float64(0), float64(0)
+	for i, price := range prices {
+		lvCost := price * sizes[i] * contractSize
+		if cost+lvCost >= notional {
+			amount += (notional - cost) / price / contractSize
+			cost = notional
+			break
+		}
+		amount += sizes[i]
+		cost += lvCost
+	}
+	avg := cost / amount / contractSize
+	return avg, impactRate(prices[0], avg), cost / notional
+}
+
+func impactRate(best, avg float64) float64 {
+	if best == 0 {
+		return 0
+	}
+	rate := (avg - best) / best
+	if rate < 0 {
+		return -rate
+	}
+	return rate
+}
+
+/*
+SimulateMarketFill
+simulate a market order of side and amount (in base or contracts) against visible levels, fee is not calculated.
+Use Exchange.SimulateMarketFill for contract size and taker fee of the market.
+在可见档位上模拟side方向数量为amount（基础币或合约张数）的市价单，不计算手续费。
+需要合约乘数和吃单手续费时使用Exchange.SimulateMarketFill
+*/
+func (b *OrderBook) SimulateMarketFill(side string, amount float64) *BookFill {
+	return b.simulateFill(side, amount, 1)
+}
+
+func (b *OrderBook) simulateFill(side string, amount, contractSize float64) *BookFill {
+	res := &BookFill{Side: side, Amount: amount, Fills: make([]*DepthPoint, 0)}
+	prices, sizes := b.takerSide(side).Levels(0)
+	for i, price := range prices {
+		if res.Filled >= amount {
+			break
+		}
+		size := min(sizes[i], amount-res.Filled)
+		cost := price * size * contractSize
+		res.Fills = append(res.Fills, &DepthPoint{Price: price, Amount: size, Cost: cost})
+		res.Filled += size
+		res.Cost += cost
+	}
+	res.Complete = amount > 0 && res.Filled >= amount
+	if res.Filled > 0 {
+		res.Average = res.Cost / res.Filled / contractSize
+		res.Impact = impactRate(prices[0], res.Average)
+	}
+	return res
+}
+
+/*
+SimulateMarketFill
+simulate a market order on the book of a symbol, using contract size and taker fee of the market
+按市场的合约乘数和吃单费率，在订单簿上模拟市价单成交
+*/
+func (e *Exchange) SimulateMarketFill(book *OrderBook, side string, amount float64) (*BookFill, *errs.Error) {
+	market, err := e.GetMarket(book.Symbol)
+	if err != nil {
+		return nil, err
+	}
+	contractSize := market.ContractSize
+	if market.Spot || contractSize == 0 {
+		contractSize = 1
+	}
+	res := book.simulateFill(side, amount, contractSize)
+	if res.Filled == 0 {
+		return res, nil
+	}
+	res.Fee, err = e.CalculateFee(book.Symbol, OdTypeMarket, side, res.Filled*contractSize, res.Average, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,99 @@
+package banexg
+
+import (
+	"testing"
+
+	"github.com/banbox/banexg/utils"
+)
+
+func newAnalyticsBook() *OrderBook {
+	return &OrderBook{
+		Symbol: "BTC/USDT:USDT",
+		Asks:   NewOdBookSide(false, 10, [][2]float64{{101, 1}, {102, 2}, {104, 4}}),
+		Bids:   NewOdBookSide(true, 10, [][2]float64{{100, 3}, {99, 1}}),
+	}
+}
+
+func TestOrderBookPrices(t *testing.T) {
+	book := newAnalyticsBook()
+	if mid := book.MidPrice(); mid != 100.5 {
+		t.Errorf("mid price: %v", mid)
+	}
+	// (100*1 + 101*3) / 4
+	if micro := book.MicroPrice(); !utils.EqualNearly(micro, 100.75) {
+		t.Errorf("micro price: %v", micro)
+	}
+	// top1: (3-1)/4, all: (4-7)/11
+	if v := book.Imbalance(1); !utils.EqualNearly(v, 0.5) {
+		t.Errorf("imbalance top1: %v", v)
+	}
+	if v := book.Imbalance(0); !utils.EqualNearly(v, -3.0/11) {
+		t.Errorf("imbalance all: %v", v)
+	}
+	empty := &OrderBook{Asks: NewOdBookSide(false, 10, nil), Bids: NewOdBookSide(true, 10, nil)}
+	if empty.MidPrice() != 0 || empty.MicroPrice() != 0 || empty.Imbalance(5) != 0 {
+		t.Errorf("empty book should return zeros")
+	}
+}
+
+func TestOrderBookDepthCurve(t *testing.T) {
+	book := newAnalyticsBook()
+	curve := book.DepthCurve(OdSideSell, 2, 0.1)
+	if len(curve) != 2 {
+		t.Fatalf("curve len: %d", len(curve))
+	}
+	if curve[1].Price != 102 || curve[1].Amount != 3 || !utils.EqualNearly(curve[1].Cost, 30.5) {
+		t.Errorf("unexpected curve point: %+v", curve[1])
+	}
+	if curve = book.DepthCurve(OdSideBuy, 0, 0); len(curve) != 2 || curve[1].Cost != 399 {
+		t.Errorf("unexpected bid curve: %+v", curve)
+	}
+}
+
+func TestOrderBookPriceImpact(t *testing.T) {
+	book := newAnalyticsBook()
+	// 101 + 204 = 305 for 3 units, average 305/3
+	avg, impact, filled := book.PriceImpact(OdSideBuy, 305, 1)
+	if !utils.EqualNearly(avg, 305.0/3) || !utils.EqualNearly(impact, (305.0/3-101)/101) || filled != 1 {
+		t.Errorf("buy impact: %v %v %v", avg, impact, filled)
+	}
+	// contract size 10: first level is worth 3000
+	avg, _, filled = book.PriceImpact(OdSideSell, 1500, 10)
+	if avg != 100 || filled != 1 {
+		t.Errorf("sell impact: %v %v", avg, filled)
+	}
+	_, _, filled = book.PriceImpact(OdSideSell, 10000, 1)
+	if !utils.EqualNearly(filled, 0.0399) {
+		t.Errorf("partial fill rate: %v", filled)
+	}
+}
+
+func TestSimulateMarketFill(t *testing.T) {
+	book := newAnalyticsBook()
+	res := book.SimulateMarketFill(OdSideBuy, 2)
+	if !res.Complete || len(res.Fills) != 2 || res.Fills[1].Amount != 1 || res.Cost != 203 {
+		t.Fatalf("unexpected fill: %+v", res)
+	}
+	if res.Average != 101.5 || res.Fee != nil {
+		t.Errorf("unexpected average %v fee %v", res.Average, res.Fee)
+	}
+	res = book.SimulateMarketFill(OdSideSell, 5)
+	if res.Complete || res.Filled != 4 {
+		t.Errorf("expect partial fill, got %+v", res)
+	}
+
+	exg := &Exchange{ExgInfo: &ExgInfo{Markets: map[string]*Market{
+		book.Symbol: {ID: "BTCUSDT", Symbol: book.Symbol, Base: "BTC", Quote: "USDT", Settle: "USDT",
+			Linear: true, Contract: true, ContractSize: 0.01, Taker: 0.0005},
+	}}}
+	res, err := exg.SimulateMarketFill(book, OdSideBuy, 2)
+	if err != nil {
+		t.Fatalf("simulate fail: %v", err)
+	}
+	if !utils.EqualNearly(res.Cost, 2.03) || !utils.EqualNearly(res.Average, 101.5) {
+		t.Errorf("unexpected contract fill: %+v", res)
+	}
+	if res.Fee == nil || !utils.EqualNearly(res.Fee.QuoteCost, 2.03*0.0005) {
+		t.Errorf("unexpected fee: %+v", res.Fee)
+	}
+}
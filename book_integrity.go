@@ -0,0 +1,142 @@
+package banexg
+
+import (
+	"hash/crc32"
+	"strconv"
+	"strings"
+
+	"github.com/banbox/banexg/log"
+	"go.uber.org/zap"
+)
+
+const (
+	BookResyncGap      = "gap"
+	BookResyncChecksum = "checksum"
+)
+
+/*
+BookDelta
+an incremental order book update with optional sequence ids and checksum.
+Zero ids are treated as unknown and skipped by continuity check.
+一次增量订单簿更新，可附带序列号和校验和。为0的序列号视为未提供，不检查连续性
+*/
+type BookDelta struct {
+	Asks [][2]float64
+	Bids [][2]float64
+	// AskTexts/BidTexts are the raw price/size strings of Asks/Bids (same index), used by Checksum, optional
+	// Asks/Bids的原始价格/数量字符串（下标相同），用于Checksum，可选
+	AskTexts  [][2]string
+	BidTexts  [][2]string
+	FirstID   int64 // first update id in this delta, should be Nonce+1 本次更新的第一个id，应等于Nonce+1
+	PrevID    int64 // update id this delta builds on, should equal Nonce 本次更新基于的上一个id，应等于Nonce
+	LastID    int64 // update id after applying, saved to Nonce 应用后的最新id，保存到Nonce
+	TimeStamp int64
+	// CheckDepth is the number of levels covered by Checksum, 0 means no checksum
+	// Checksum覆盖的档位数，0表示无校验和
+	CheckDepth int
+	Checksum   int32
+}
+
+/*
+ApplyDelta
+verify the delta continues from Nonce, apply it, then verify checksum.
+The delta continues if PrevID equals Nonce, or if it covers the next id (FirstID <= next <= LastID), which is how
+the first delta after a binance snapshot overlaps it. next is Nonce with PrevID (binance futures), else Nonce+1.
+ok is false with empty reason when the book is waiting for a snapshot or the delta is older than the book,
+and the delta is dropped; otherwise a non-empty reason means the book is broken and should be resynced.
+校验增量是否与Nonce连续，应用后再校验checksum。PrevID等于Nonce，或增量覆盖下一个id（FirstID <= next <= LastID）时视为连续，
+币安快照后的第一个增量即如此。有PrevID时（币安合约）next为Nonce，否则为Nonce+1。
+ok为false且reason为空表示订单簿正在等待快照或增量早于订单簿，已忽略此更新；reason非空表示订单簿已失效需重新同步
+*/
+func (b *OrderBook) ApplyDelta(d *BookDelta) (bool, string) {
+	if d.PrevID != 0 || d.FirstID != 0 {
+		if b.Nonce == 0 {
+			return false, ""
+		}
+		if d.PrevID == 0 || d.PrevID != b.Nonce {
+			if d.FirstID == 0 {
+				return false, BookResyncGap
+			}
+			next := b.Nonce + 1
+			if d.PrevID != 0 {
+				next = b.Nonce
+			}
+			if d.LastID != 0 && d.LastID < next {
+				// already included in the book
+				return false, ""
+			}
+			if d.FirstID > next {
+				return false, BookResyncGap
+			}
+		}
+	}
+	if len(d.Asks) > 0 {
+		b.Asks.update(d.Asks, d.AskTexts)
+	}
+	if len(d.Bids) > 0 {
+		b.Bids.update(d.Bids, d.BidTexts)
+	}
+	if d.LastID != 0 {
+		b.Nonce = d.LastID
+	}
+	if d.TimeStamp != 0 {
+		b.TimeStamp = d.TimeStamp
+	}
+	if d.CheckDepth > 0 && b.Checksum(d.CheckDepth) != d.Checksum {
+		return false, BookResyncChecksum
+	}
+	return true, ""
+}
+
+/*
+Checksum
+crc32 (IEEE) of the top depth levels, formatted as bid1Price:bid1Size:ask1Price:ask1Size:bid2Price...
+a level missing on one side is skipped. This is the layout used by OKX.
+The raw strings from BookDelta texts are used when present, as OKX keeps trailing zeros like "0.10".
+前depth档的crc32校验和，格式为 买1价:买1量:卖1价:卖1量:买2价...，某侧档位不足时跳过（OKX使用此格式）。
+优先使用BookDelta中的原始字符串，因OKX保留"0.10"这样的末尾0
+*/
+func (b *OrderBook) Checksum(depth int) int32 {
+	b.Asks.Lock.RLock()
+	b.Bids.Lock.RLock()
+	parts := make([]string, 0, depth*4)
+	bid, ask := b.Bids.first(), b.Asks.first()
+	for i := 0; i < depth && (bid != nil || ask != nil); i++ {
+		if bid != nil {
+			parts = bid.appendTexts(parts)
+			bid = bid.next[0]
+		}
+		if ask != nil {
+			parts = ask.appendTexts(parts)
+			ask = ask.next[0]
+		}
+	}
+	b.Bids.Lock.RUnlock()
+	b.Asks.Lock.RUnlock()
+	return int32(crc32.ChecksumIEEE([]byte(strings.Join(parts, ":"))))
+}
+
+// appendTexts append raw price and size strings of level, formatted from numbers if missing
+func (lvl *bookLevel) appendTexts(parts []string) []string {
+	if lvl.text[0] != "" && lvl.text[1] != "" {
+		return append(parts, lvl.text[0], lvl.text[1])
+	}
+	return append(parts, fmtBookNum(lvl.price), fmtBookNum(lvl.size))
+}
+
+func fmtBookNum(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+/*
+BookResync
+log and report a book_resync event, called by exchanges before re-fetching the snapshot of a broken order book
+记录并上报book_resync事件，交易所在订单簿失效、重新获取快照前调用
+*/
+func (e *Exchange) BookResync(symbol, reason string, fields ...zap.Field) {
+	fields = append(fields, zap.String("exg", e.ID), zap.String("symbol", symbol), zap.String("reason", reason))
+	log.Warn("book_resync", fields...)
+	if hook := e.metrics(); hook != nil {
+		hook.OnBookResync(e.ID, symbol, reason)
+	}
+}
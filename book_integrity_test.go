@@ -0,0 +1,84 @@
+package banexg
+
+import (
+	"hash/crc32"
+	"testing"
+)
+
+func newTestBook(nonce int64) *OrderBook {
+	return &OrderBook{
+		Symbol: "BTC/USDT",
+		Nonce:  nonce,
+		Asks:   NewOdBookSide(false, 10, [][2]float64{{101, 1}, {102, 2}}),
+		Bids:   NewOdBookSide(true, 10, [][2]float64{{100, 1.5}}),
+	}
+}
+
+func TestOrderBookChecksum(t *testing.T) {
+	book := newTestBook(1)
+	want := int32(crc32.ChecksumIEEE([]byte("100:1.5:101:1:102:2")))
+	if got := book.Checksum(25); got != want {
+		t.Fatalf("checksum mismatch: got %d want %d", got, want)
+	}
+	want = int32(crc32.ChecksumIEEE([]byte("100:1.5:101:1")))
+	if got := book.Checksum(1); got != want {
+		t.Fatalf("depth 1 checksum mismatch: got %d want %d", got, want)
+	}
+}
+
+func TestOrderBookApplyDelta(t *testing.T) {
+	cases := []struct {
+		name   string
+		nonce  int64
+		delta  BookDelta
+		ok     bool
+		reason string
+		nonce2 int64
+	}{
+		{"no ids", 5, BookDelta{Bids: [][2]float64{{100, 2}}}, true, "", 5},
+		{"prev match", 5, BookDelta{PrevID: 5, LastID: 8}, true, "", 8},
+		{"prev gap", 5, BookDelta{PrevID: 6, LastID: 8}, false, BookResyncGap, 5},
+		{"first match", 5, BookDelta{FirstID: 6, LastID: 7}, true, "", 7},
+		{"first gap", 5, BookDelta{FirstID: 7, LastID: 7}, false, BookResyncGap, 5},
+		{"stale", 5, BookDelta{FirstID: 5, LastID: 5}, false, "", 5},
+		{"overlap", 5, BookDelta{FirstID: 3, LastID: 8}, true, "", 8},
+		{"prev overlap", 5, BookDelta{FirstID: 4, PrevID: 3, LastID: 8}, true, "", 8},
+		{"prev stale", 5, BookDelta{FirstID: 2, PrevID: 1, LastID: 4}, false, "", 5},
+		{"prev first gap", 5, BookDelta{FirstID: 6, PrevID: 4, LastID: 8}, false, BookResyncGap, 5},
+		{"await snapshot", 0, BookDelta{PrevID: 3, LastID: 4}, false, "", 0},
+	}
+	for _, c := range cases {
+		book := newTestBook(c.nonce)
+		ok, reason := book.ApplyDelta(&c.delta)
+		if ok != c.ok || reason != c.reason || book.Nonce != c.nonce2 {
+			t.Errorf("%s: got (%v, %q, %d) want (%v, %q, %d)", c.name, ok, reason, book.Nonce,
+				c.ok, c.reason, c.nonce2)
+		}
+	}
+	book := newTestBook(5)
+	delta := &BookDelta{PrevID: 5, LastID: 6, Asks: [][2]float64{{101, 0}}, CheckDepth: 25}
+	delta.Checksum = int32(crc32.ChecksumIEEE([]byte("100:1.5:102:2")))
+	if ok, reason := book.ApplyDelta(delta); !ok || reason != "" {
+		t.Fatalf("checksum should match, got %v %q", ok, reason)
+	}
+	delta = &BookDelta{PrevID: 6, LastID: 7, Bids: [][2]float64{{99, 1}}, CheckDepth: 25, Checksum: 1}
+	if ok, reason := book.ApplyDelta(delta); ok || reason != BookResyncChecksum {
+		t.Fatalf("expect checksum mismatch, got %v %q", ok, reason)
+	}
+}
+
+func TestOrderBookChecksumTexts(t *testing.T) {
+	book := newTestBook(5)
+	delta := &BookDelta{PrevID: 5, LastID: 6, Bids: [][2]float64{{100, 1.5}}, BidTexts: [][2]string{{"100.0", "1.50"}},
+		CheckDepth: 25}
+	delta.Checksum = int32(crc32.ChecksumIEEE([]byte("100.0:1.50:101:1:102:2")))
+	if ok, reason := book.ApplyDelta(delta); !ok || reason != "" {
+		t.Fatalf("raw strings should be used, got %v %q", ok, reason)
+	}
+	// texts are dropped once the size changes without them
+	book.Bids.Update([][2]float64{{100, 2}})
+	want := int32(crc32.ChecksumIEEE([]byte("100:2:101:1:102:2")))
+	if got := book.Checksum(25); got != want {
+		t.Fatalf("stale texts should be ignored")
+	}
+}
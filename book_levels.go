@@ -0,0 +1,167 @@
+package banexg
+
+import (
+	"sync"
+)
+
+// bookMaxHeight max tower height of skiplist, with p=1/4 it's enough for 4^12 levels 跳表最大层数
+const bookMaxHeight = 12
+
+/*
+bookLevel
+one price level of OdBookSide, a skiplist node. Nodes are pooled, as levels are added and removed on most deltas.
+text is the raw price/size strings from exchange, empty if not provided.
+OdBookSide的一个价格档位，即跳表节点。档位增删频繁，节点通过对象池复用。text为交易所原始价格/数量字符串，未提供时为空
+*/
+type bookLevel struct {
+	price float64
+	size  float64
+	text  [2]string
+	next  []*bookLevel
+}
+
+var bookLevelPool = sync.Pool{
+	New: func() interface{} {
+		return &bookLevel{next: make([]*bookLevel, 0, bookMaxHeight)}
+	},
+}
+
+func newBookLevel(price, size float64, text [2]string, height int) *bookLevel {
+	lvl := bookLevelPool.Get().(*bookLevel)
+	lvl.price, lvl.size, lvl.text = price, size, text
+	lvl.next = lvl.next[:height]
+	return lvl
+}
+
+func releaseBookLevel(lvl *bookLevel) {
+	clear(lvl.next)
+	lvl.next = lvl.next[:0]
+	lvl.text = [2]string{}
+	bookLevelPool.Put(lvl)
+}
+
+// before whether price a is better than b on this side 价格a在本侧是否优于b
+func (obs *OdBookSide) before(a, b float64) bool {
+	if obs.IsBuy {
+		return a > b
+	}
+	return a < b
+}
+
+func (obs *OdBookSide) randHeight() int {
+	if obs.seed == 0 {
+		obs.seed = 0x9E3779B97F4A7C15
+	}
+	// xorshift64
+	obs.seed ^= obs.seed << 13
+	obs.seed ^= obs.seed >> 7
+	obs.seed ^= obs.seed << 17
+	h, r := 1, obs.seed
+	for h < bookMaxHeight && r&3 == 0 {
+		h++
+		r >>= 2
+	}
+	return h
+}
+
+// first return the best level, nil if empty; should be called with Lock held
+func (obs *OdBookSide) first() *bookLevel {
+	if len(obs.head.next) == 0 {
+		return nil
+	}
+	return obs.head.next[0]
+}
+
+// set update size of price, size<=0 removes it; should be called with Lock held
+func (obs *OdBookSide) set(price, size float64, text [2]string) {
+	if obs.head.next == nil {
+		obs.head.next = make([]*bookLevel, bookMaxHeight)
+	}
+	x := &obs.head
+	for l := obs.height - 1; l >= 0; l-- {
+		for n := x.next[l]; n != nil && obs.before(n.price, price); n = x.next[l] {
+			x = n
+		}
+		obs.path[l] = x
+	}
+	n := x.next[0]
+	if n != nil && n.price == price {
+		if size > 0 {
+			n.size, n.text = size, text
+			return
+		}
+		for l, next := range n.next {
+			obs.path[l].next[l] = next
+		}
+		obs.count--
+		releaseBookLevel(n)
+		obs.shrink()
+		return
+	}
+	if size <= 0 {
+		return
+	}
+	h := obs.randHeight()
+	for ; obs.height < h; obs.height++ {
+		obs.path[obs.height] = &obs.head
+	}
+	n = newBookLevel(price, size, text, h)
+	for l := 0; l < h; l++ {
+		n.next[l] = obs.path[l].next[l]
+		obs.path[l].next[l] = n
+	}
+	obs.count++
+}
+
+// trim remove worst levels beyond depth; should be called with Lock held
+func (obs *OdBookSide) trim(depth int) {
+	if depth <= 0 {
+		obs.clear()
+		return
+	}
+	for obs.count > depth {
+		// find predecessors of the last level on each height 查找最后一档在各层的前驱
+		x := &obs.head
+		for l := obs.height - 1; l >= 0; l-- {
+			for n := x.next[l]; n != nil && n.next[0] != nil; n = x.next[l] {
+				x = n
+			}
+			obs.path[l] = x
+		}
+		last := obs.path[0].next[0]
+		for l := range last.next {
+			obs.path[l].next[l] = nil
+		}
+		obs.count--
+		releaseBookLevel(last)
+	}
+	obs.shrink()
+}
+
+func (obs *OdBookSide) shrink() {
+	for obs.height > 0 && obs.head.next[obs.height-1] == nil {
+		obs.height--
+	}
+}
+
+// clear release all levels; should be called with Lock held
+func (obs *OdBookSide) clear() {
+	for n := obs.first(); n != nil; {
+		next := n.next[0]
+		releaseBookLevel(n)
+		n = next
+	}
+	clear(obs.head.next)
+	clear(obs.path[:])
+	obs.height, obs.count = 0, 0
+}
+
+// load replace all levels; should be called with Lock held
+func (obs *OdBookSide) load(prices, sizes []float64) {
+	obs.clear()
+	for i, price := range prices {
+		if i < len(sizes) {
+			obs.set(price, sizes[i], [2]string{})
+		}
+	}
+}
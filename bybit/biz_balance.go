@@ -7,6 +7,7 @@ import (
 	"github.com/banbox/banexg"
 	"github.com/banbox/banexg/errs"
 	"github.com/banbox/banexg/utils"
+	"github.com/shopspring/decimal"
 )
 
 func (e *Bybit) FetchBalance(params map[string]interface{}) (*banexg.Balances, *errs.Error) {
@@ -83,6 +84,9 @@ func parseBybitBalance(e *Bybit, bal *WalletBalance, info map[string]interface{}
 			Debt:  debt,
 			UPol:  upl,
 		}
+		if e.DecimalMode {
+			setBybitAssetDec(asset, &item)
+		}
 		if asset.IsEmpty() && !keepZero {
 			continue
 		}
@@ -91,6 +95,31 @@ func parseBybitBalance(e *Bybit, bal *WalletBalance, info map[string]interface{}
 	return res.Init()
 }
 
+// setBybitAssetDec calculate exact values of asset in the same way as parseBybitBalance
+func setBybitAssetDec(asset *banexg.Asset, item *WalletBalanceCoin) {
+	baseBal := banexg.DecStr(item.WalletBalance, 0).Sub(banexg.DecStr(item.SpotBorrow, 0))
+	total := baseBal
+	if item.Equity != "" {
+		total = banexg.DecStr(item.Equity, 0)
+	}
+	used := banexg.DecStr(item.Locked, 0).Add(banexg.DecStr(item.TotalOrderIM, 0)).
+		Add(banexg.DecStr(item.TotalPositionIM, 0))
+	free := baseBal.Sub(used)
+	if free.IsNegative() {
+		free = decimal.Zero
+	}
+	if total.IsZero() && free.Add(used).IsPositive() {
+		total = free.Add(used)
+	}
+	asset.Dec = &banexg.AssetDec{
+		Free:  free,
+		Used:  used,
+		Total: total,
+		Debt:  banexg.DecStr(item.BorrowAmount, 0),
+		UPol:  banexg.DecStr(item.UnrealisedPnl, 0),
+	}
+}
+
 func (e *Bybit) FetchPositions(symbols []string, params map[string]interface{}) ([]*banexg.Position, *errs.Error) {
 	return e.fetchPositions(symbols, params)
 }
@@ -276,9 +305,26 @@ func parseBybitPosition(e *Bybit, item *PositionInfo, info map[string]interface{
 		pos.InitialMarginPct = initMargin / notional
 		pos.MaintMarginPct = maintMargin / notional
 	}
+	if e.DecimalMode {
+		pos.SetDec(posDecKeys)
+		pos.Dec.Notional = pos.Dec.Notional.Abs()
+		pos.Dec.Collateral = pos.Dec.InitialMargin.Add(pos.Dec.UnrealizedPnl)
+	}
 	return pos
 }
 
+// raw keys of bybit positions for exact values, collateral is calculated
+var posDecKeys = banexg.DecKeys{
+	"Contracts":        {"size"},
+	"EntryPrice":       {"avgPrice"},
+	"MarkPrice":        {"markPrice"},
+	"Notional":         {"positionValue"},
+	"InitialMargin":    {"positionIM"},
+	"MaintMargin":      {"positionMM"},
+	"UnrealizedPnl":    {"unrealisedPnl"},
+	"LiquidationPrice": {"liqPrice"},
+}
+
 func bybitPositionMarginMode(info map[string]interface{}) string {
 	mode := strings.ToUpper(strings.TrimSpace(utils.GetMapVal(info, "marginMode", "")))
 	switch mode {
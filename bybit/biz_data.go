@@ -69,7 +69,7 @@ func (e *Bybit) FetchOHLCV(symbol, timeframe string, since int64, limit int, par
 	if rsp.Error != nil {
 		return nil, rsp.Error
 	}
-	return parseBybitOHLCV(rsp.Result.List), nil
+	return parseBybitOHLCV(rsp.Result.List, e.DecimalMode), nil
 }
 
 const maxFundRateBatch = 200
@@ -291,7 +291,7 @@ func parseBybitOrderBook(market *banexg.Market, ob *orderBookSnapshot, limit int
 	}
 }
 
-func parseBybitOHLCV(rows [][]string) []*banexg.Kline {
+func parseBybitOHLCV(rows [][]string, dec bool) []*banexg.Kline {
 	if len(rows) == 0 {
 		return nil
 	}
@@ -313,7 +313,7 @@ func parseBybitOHLCV(rows [][]string) []*banexg.Kline {
 		if len(row) > 6 {
 			info = parseBybitNum(row[6])
 		}
-		res = append(res, &banexg.Kline{
+		kline := &banexg.Kline{
 			Time:   stamp,
 			Open:   open,
 			High:   high,
@@ -321,7 +321,18 @@ func parseBybitOHLCV(rows [][]string) []*banexg.Kline {
 			Close:  closeP,
 			Volume: vol,
 			Quote:  info,
-		})
+		}
+		if dec {
+			var volText, quoteText string
+			if len(row) > 5 {
+				volText = row[5]
+			}
+			if len(row) > 6 {
+				quoteText = row[6]
+			}
+			kline.SetDec(row[1], row[2], row[3], row[4], volText, quoteText, "")
+		}
+		res = append(res, kline)
 	}
 	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
 		res[i], res[j] = res[j], res[i]
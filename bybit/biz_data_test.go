@@ -37,13 +37,23 @@ func TestParseBybitOHLCV(t *testing.T) {
 		{"2", "2", "3", "1", "2.5", "20", "200"},
 		{"1", "1", "2", "0.5", "1.5", "10", "100"},
 	}
-	out := parseBybitOHLCV(rows)
+	out := parseBybitOHLCV(rows, false)
 	if len(out) != 3 {
 		t.Fatalf("expected 3 rows, got %d", len(out))
 	}
 	if out[0].Time != 1 || out[1].Time != 2 || out[2].Time != 3 {
 		t.Fatalf("expected ascending times, got %d,%d,%d", out[0].Time, out[1].Time, out[2].Time)
 	}
+	if out[0].Dec != nil {
+		t.Fatalf("Dec should be nil when decimal mode is off")
+	}
+	out = parseBybitOHLCV([][]string{{"1", "0.1", "0.3", "0.1", "0.2", "10.000000001", "1.1"}}, true)
+	if len(out) != 1 || out[0].Dec == nil {
+		t.Fatalf("expected kline with Dec")
+	}
+	if out[0].Dec.High.String() != "0.3" || out[0].Dec.Volume.String() != "10.000000001" {
+		t.Fatalf("unexpected Dec: %+v", out[0].Dec)
+	}
 }
 
 func TestBybitFundingIntervalMS(t *testing.T) {
@@ -378,7 +388,7 @@ func TestFetchOrderBookParams(t *testing.T) {
 	if book == nil || book.Limit != 999 {
 		t.Fatalf("unexpected orderbook limit: %+v", book)
 	}
-	if len(book.Asks.Price) == 0 || len(book.Bids.Price) == 0 {
+	if book.Asks.Len() == 0 || book.Bids.Len() == 0 {
 		t.Fatal("expected non-empty orderbook sides")
 	}
 }
@@ -276,14 +276,14 @@ func TestParseBybitOrderBook(t *testing.T) {
 	if book.Symbol != "BTC/USDT" {
 		t.Fatalf("unexpected symbol: %s", book.Symbol)
 	}
-	if len(book.Asks.Price) != 2 || len(book.Bids.Price) != 2 {
-		t.Fatalf("unexpected depth: asks=%d bids=%d", len(book.Asks.Price), len(book.Bids.Price))
+	if book.Asks.Len() != 2 || book.Bids.Len() != 2 {
+		t.Fatalf("unexpected depth: asks=%d bids=%d", book.Asks.Len(), book.Bids.Len())
 	}
-	if book.Asks.Price[0] != 10 {
-		t.Fatalf("asks not sorted ascending: %v", book.Asks.Price)
+	if book.Asks.Prices()[0] != 10 {
+		t.Fatalf("asks not sorted ascending: %v", book.Asks.Prices())
 	}
-	if book.Bids.Price[0] != 10 {
-		t.Fatalf("bids not sorted descending: %v", book.Bids.Price)
+	if book.Bids.Prices()[0] != 10 {
+		t.Fatalf("bids not sorted descending: %v", book.Bids.Prices())
 	}
 }
 
@@ -1980,7 +1980,7 @@ func requireBybitOrderBookNonEmpty(t *testing.T, book *banexg.OrderBook) {
 	if book == nil || book.Asks == nil || book.Bids == nil {
 		t.Fatal("expected orderbook data")
 	}
-	if len(book.Asks.Price) == 0 || len(book.Bids.Price) == 0 {
+	if book.Asks.Len() == 0 || book.Bids.Len() == 0 {
 		t.Fatal("orderbook has empty sides")
 	}
 }
@@ -2067,7 +2067,7 @@ func bybitFetchOrderBookByType(t *testing.T, marketType string, limit int) (*ban
 			lastErr = err
 			continue
 		}
-		if book != nil && len(book.Asks.Price) > 0 && len(book.Bids.Price) > 0 {
+		if book != nil && book.Asks.Len() > 0 && book.Bids.Len() > 0 {
 			if book.Symbol != m.Symbol {
 				t.Fatalf("unexpected orderbook symbol: got %s want %s", book.Symbol, m.Symbol)
 			}
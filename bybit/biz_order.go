@@ -33,48 +33,19 @@ func bybitPositionIdx(posSide string) (int, bool) {
 	}
 }
 
-// ensureBybitPositionIdx applies positionSide -> positionIdx mapping (if any) and
-// sets Bybit default positionIdx=0 (one-way) when missing.
-func ensureBybitPositionIdx(args map[string]interface{}) *errs.Error {
-	if args == nil {
-		return nil
-	}
-	// Map positionSide -> positionIdx for hedge mode; default is one-way mode (positionIdx=0).
-	if err := applyBybitPositionIdx(args); err != nil {
-		return err
-	}
-	if _, ok := args["positionIdx"]; !ok {
-		args["positionIdx"] = 0
-	}
-	return nil
-}
-
-// applyBybitPositionIdx maps banexg.ParamPositionSide into Bybit's positionIdx when positionIdx is not provided.
-// Bybit V5 uses positionIdx: 0(one-way), 1(hedge buy/long), 2(hedge sell/short).
-func applyBybitPositionIdx(args map[string]interface{}) *errs.Error {
-	if args == nil {
-		return nil
-	}
-	// If user already sets positionIdx explicitly, keep it and drop positionSide to avoid ambiguity.
+// ensureBybitPositionIdx maps posSide into Bybit's positionIdx when positionIdx is not provided,
+// Bybit V5 uses positionIdx: 0(one-way, default), 1(hedge buy/long), 2(hedge sell/short).
+// auto is true when positionIdx is derived from a hedge posSide.
+func ensureBybitPositionIdx(args map[string]interface{}, posSide string) (bool, *errs.Error) {
 	if _, ok := args["positionIdx"]; ok {
-		utils.PopMapVal(args, banexg.ParamPositionSide, "")
-		return nil
-	}
-	raw, ok := args[banexg.ParamPositionSide]
-	if !ok {
-		return nil
-	}
-	delete(args, banexg.ParamPositionSide)
-	posSide, ok := raw.(string)
-	if !ok {
-		return errs.NewMsg(errs.CodeParamInvalid, "positionSide must be a string")
+		return false, nil
 	}
 	idx, ok := bybitPositionIdx(posSide)
 	if !ok {
-		return errs.NewMsg(errs.CodeParamInvalid, "invalid positionSide: %s", posSide)
+		return false, errs.NewMsg(errs.CodeParamInvalid, "invalid positionSide: %s", posSide)
 	}
 	args["positionIdx"] = idx
-	return nil
+	return idx != 0, nil
 }
 
 func bybitPositionModeMismatch(err *errs.Error) bool {
@@ -570,7 +541,7 @@ func parseBybitOrder(e *Bybit, item *OrderInfo, info map[string]interface{}, mar
 	if filled > 0 {
 		lastTrade = lastUpdate
 	}
-	return &banexg.Order{
+	res := &banexg.Order{
 		Info:                info,
 		ID:                  item.OrderId,
 		ClientOrderID:       item.OrderLinkId,
@@ -597,6 +568,24 @@ func parseBybitOrder(e *Bybit, item *OrderInfo, info map[string]interface{}, mar
 		ReduceOnly:          item.ReduceOnly,
 		Fee:                 fee,
 	}
+	if e != nil && e.DecimalMode {
+		res.SetDec(orderDecKeys)
+	}
+	return res
+}
+
+// raw keys of bybit orders for exact values, fee may come from cumFeeDetail so it's derived
+var orderDecKeys = banexg.DecKeys{
+	"Price":           {"price"},
+	"Average":         {"avgPrice"},
+	"Amount":          {"qty"},
+	"Filled":          {"cumExecQty"},
+	"Remaining":       {"leavesQty"},
+	"TriggerPrice":    {"triggerPrice"},
+	"StopPrice":       {"triggerPrice"},
+	"TakeProfitPrice": {"takeProfit"},
+	"StopLossPrice":   {"stopLoss"},
+	"Cost":            {"cumExecValue"},
 }
 
 func parseBybitOrders(e *Bybit, items []map[string]interface{}, marketType string, symbol string) ([]*banexg.Order, *errs.Error) {
@@ -774,30 +763,27 @@ func applyBybitTimeRange(args map[string]interface{}, since int64) {
 	}
 }
 
-func (e *Bybit) createBybitTradingStop(symbol, side string, amount, price float64, market *banexg.Market, args map[string]interface{}) (*banexg.Order, *errs.Error) {
+func (e *Bybit) createBybitTradingStop(req *banexg.OrderRequest, market *banexg.Market, args map[string]interface{}) (*banexg.Order, *errs.Error) {
 	if market == nil {
 		return nil, errs.NewMsg(errs.CodeParamRequired, "symbol is required")
 	}
 	if !(market.Linear || market.Inverse) {
 		return nil, errs.NewMsg(errs.CodeParamInvalid, "trailing stop only supports linear/inverse market")
 	}
-	if err := ensureBybitPositionIdx(args); err != nil {
+	if _, err := ensureBybitPositionIdx(args, req.PositionSide); err != nil {
 		return nil, err
 	}
 	if tpslMode := utils.GetMapVal(args, "tpslMode", ""); tpslMode == "" {
 		args["tpslMode"] = "Full"
 	}
-	trailingDelta := utils.PopMapVal(args, banexg.ParamTrailingDelta, 0.0)
-	activationPrice := utils.PopMapVal(args, banexg.ParamActivationPrice, 0.0)
-	callbackRate := utils.PopMapVal(args, banexg.ParamCallbackRate, 0.0)
-	if callbackRate != 0 {
+	if req.CallbackRate != 0 {
 		return nil, errs.NewMsg(errs.CodeParamInvalid, "callbackRate not supported for bybit trailing stop")
 	}
-	if trailingDelta > 0 {
-		args["trailingStop"] = trailingDelta
+	if req.TrailingDelta > 0 {
+		args["trailingStop"] = req.TrailingDelta
 	}
-	if activationPrice > 0 {
-		args["activePrice"] = activationPrice
+	if req.ActivationPrice > 0 {
+		args["activePrice"] = req.ActivationPrice
 	}
 	if err := popAndSetBybitPriceArgs(e, market, args, false,
 		bybitPriceParam{param: "trailingStop", key: "trailingStop"},
@@ -815,11 +801,11 @@ func (e *Bybit) createBybitTradingStop(symbol, side string, amount, price float6
 	}
 	return &banexg.Order{
 		ID:        "",
-		Symbol:    symbol,
+		Symbol:    req.Symbol,
 		Type:      banexg.OdTypeTrailingStopMarket,
-		Side:      side,
-		Amount:    amount,
-		Price:     price,
+		Side:      req.Side,
+		Amount:    req.Amount,
+		Price:     req.Price,
 		Status:    banexg.OdStatusOpen,
 		Timestamp: e.MilliSeconds(),
 		Info:      res.Result,
@@ -827,6 +813,36 @@ func (e *Bybit) createBybitTradingStop(symbol, side string, amount, price float6
 }
 
 func (e *Bybit) CreateOrder(symbol, odType, side string, amount, price float64, params map[string]interface{}) (*banexg.Order, *errs.Error) {
+	return e.CreateOrderReq(banexg.NewOrderRequest(symbol, odType, side, amount, price, params))
+}
+
+// orderExtraKeys native bybit keys accepted in OrderRequest.Extra, sent as is
+var orderExtraKeys = map[string]bool{
+	"orderLinkId": true, "positionIdx": true, "smpType": true, "marketUnit": true, "isLeverage": true,
+	"orderFilter": true, "triggerDirection": true, "triggerBy": true, "tpTriggerBy": true, "slTriggerBy": true,
+	"tpslMode": true, "takeProfit": true, "stopLoss": true, "tpLimitPrice": true, "slLimitPrice": true,
+	"tpOrderType": true, "slOrderType": true, "bboSideType": true, "bboLevel": true, "closeOnTrigger": true,
+	"mmp": true, "orderIv": true, "slippageTolerance": true, "slippageToleranceType": true,
+	"trailingStop": true, "activePrice": true,
+}
+
+/*
+CreateOrderReq
+map OrderRequest to bybit order args. Bybit has no GTD orders, GTX is mapped to PostOnly.
+将OrderRequest转为bybit下单参数。Bybit不支持GTD，GTX映射为PostOnly
+*/
+func (e *Bybit) CreateOrderReq(req *banexg.OrderRequest) (*banexg.Order, *errs.Error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if req.GoodTillDate > 0 || req.TimeInForce == banexg.TimeInForceGTD {
+		return nil, errs.NewMsg(errs.CodeNotSupport, "bybit not support GTD orders")
+	}
+	params, err := req.ExtraArgs(e.ID, orderExtraKeys)
+	if err != nil {
+		return nil, err
+	}
+	symbol, odType, side, amount, price := req.Symbol, req.Type, req.Side, req.Amount, req.Price
 	args, market, _, _, err := e.loadBybitOrderArgs(symbol, params)
 	if err != nil {
 		return nil, err
@@ -834,24 +850,18 @@ func (e *Bybit) CreateOrder(symbol, odType, side string, amount, price float64,
 	if market == nil {
 		return nil, errs.NewMsg(errs.CodeParamRequired, "symbol is required")
 	}
-	hasTrailing := hasAnyBybitArgs(args,
-		banexg.ParamTrailingDelta,
-		banexg.ParamActivationPrice,
-		banexg.ParamCallbackRate,
-		"trailingStop",
-		"activePrice",
-	)
+	hasTrailing := req.TrailingDelta != 0 || req.ActivationPrice != 0 || req.CallbackRate != 0 ||
+		hasAnyBybitArgs(args, "trailingStop", "activePrice")
 	if hasTrailing {
 		if odType != banexg.OdTypeTrailingStopMarket {
 			return nil, errs.NewMsg(errs.CodeParamInvalid, "trailing stop params only supported for trailing stop orders")
 		}
-		return e.createBybitTradingStop(symbol, side, amount, price, market, args)
+		return e.createBybitTradingStop(req, market, args)
 	}
 	if odType == banexg.OdTypeTrailingStopMarket {
-		return e.createBybitTradingStop(symbol, side, amount, price, market, args)
+		return e.createBybitTradingStop(req, market, args)
 	}
-	closePosition := utils.PopMapVal(args, banexg.ParamClosePosition, false)
-	reduceOnly := utils.PopMapVal(args, banexg.ParamReduceOnly, false)
+	closePosition, reduceOnly := req.ClosePosition, req.ReduceOnly
 	if closePosition {
 		if !(market.Linear || market.Inverse) {
 			return nil, errs.NewMsg(errs.CodeParamInvalid, "closePosition only valid for linear/inverse markets")
@@ -870,21 +880,26 @@ func (e *Bybit) CreateOrder(symbol, odType, side string, amount, price float64,
 		return nil, err
 	}
 	args["side"] = bySide
-	applyBybitClientOrderID(args)
-	applyBybitSmpType(args)
-	if market.Option {
-		orderLinkId := utils.GetMapVal(args, "orderLinkId", "")
-		if strings.TrimSpace(orderLinkId) == "" {
-			return nil, errs.NewMsg(errs.CodeParamRequired, "orderLinkId required for option orders")
+	if req.STPMode != "" {
+		if _, ok := args["smpType"]; !ok {
+			args["smpType"] = req.STPMode
 		}
 	}
+	orderLinkId := req.ClientOrderID
+	if orderLinkId == "" {
+		orderLinkId = utils.GetMapVal(args, "orderLinkId", "")
+	}
+	if strings.TrimSpace(orderLinkId) == "" {
+		// always send orderLinkId (required for option), so the order can be reconciled when the result is unknown
+		orderLinkId = banexg.NewClientOrderID()
+	}
+	args["orderLinkId"] = orderLinkId
 	autoPositionIdx := false
 	if market.Contract {
-		_, explicitPositionIdx := args["positionIdx"]
-		if err := ensureBybitPositionIdx(args); err != nil {
+		autoPositionIdx, err = ensureBybitPositionIdx(args, req.PositionSide)
+		if err != nil {
 			return nil, err
 		}
-		autoPositionIdx = !explicitPositionIdx && args["positionIdx"] != 0
 	}
 	orderType := bybitOrderTypeFrom(odType, price)
 	args["orderType"] = orderType
@@ -894,8 +909,8 @@ func (e *Bybit) CreateOrder(symbol, odType, side string, amount, price float64,
 	if err := validateBybitOrderExtraArgs(market, orderType, args); err != nil {
 		return nil, err
 	}
-	tif := utils.PopMapVal(args, banexg.ParamTimeInForce, "")
-	postOnly := utils.PopMapVal(args, banexg.ParamPostOnly, false)
+	tif := req.TimeInForce
+	postOnly := req.PostOnly || tif == banexg.TimeInForceGTX
 	if postOnly && orderType == "Market" {
 		return nil, errs.NewMsg(errs.CodeParamInvalid, "postOnly not allowed for market order")
 	}
@@ -905,9 +920,9 @@ func (e *Bybit) CreateOrder(symbol, odType, side string, amount, price float64,
 	if tif != "" {
 		args["timeInForce"] = normalizeBybitTimeInForce(tif)
 	}
-	triggerPrice := utils.PopMapVal(args, banexg.ParamTriggerPrice, float64(0))
-	attachedStopLoss := utils.PopMapVal(args, banexg.ParamStopLossPrice, float64(0))
-	attachedTakeProfit := utils.PopMapVal(args, banexg.ParamTakeProfitPrice, float64(0))
+	triggerPrice := req.TriggerPrice
+	attachedStopLoss := req.StopLossPrice
+	attachedTakeProfit := req.TakeProfitPrice
 	isStopOdType := isBybitStopOrderType(odType)
 
 	// Bybit creates conditional orders via triggerPrice (see Bybit V5 create-order docs).
@@ -972,14 +987,14 @@ func (e *Bybit) CreateOrder(symbol, odType, side string, amount, price float64,
 		}
 	}
 	if market.Spot || market.Type == banexg.MarketMargin {
-		if market.Type == banexg.MarketMargin || utils.PopMapVal(args, banexg.ParamMarginMode, "") != "" {
+		if market.Type == banexg.MarketMargin || req.MarginMode != "" {
 			args["isLeverage"] = 1
 		}
 	}
 	if forceClose {
 		args["qty"] = "0"
 	} else if orderType == "Market" && market.Spot {
-		cost := utils.PopMapVal(args, banexg.ParamCost, 0.0)
+		cost := req.Cost
 		if cost <= 0 && amount <= 0 {
 			return nil, errs.NewMsg(errs.CodeParamRequired, "amount or cost required for market order")
 		}
@@ -1026,7 +1041,7 @@ func (e *Bybit) CreateOrder(symbol, odType, side string, amount, price float64,
 		res = requestRetry[OrderResult](e, MethodPrivatePostV5OrderCreate, args, tryNum)
 	}
 	if res.Error != nil {
-		return nil, res.Error
+		return e.reconcileOrder("CreateOrder", symbol, "", orderLinkId, params, res.Error, nil)
 	}
 	return &banexg.Order{
 		ID:            res.Result.OrderId,
@@ -1049,15 +1064,18 @@ func (e *Bybit) EditOrder(symbol, orderId, side string, amount, price float64, p
 	if market == nil {
 		return nil, errs.NewMsg(errs.CodeParamRequired, "symbol is required")
 	}
+	linkId := utils.GetMapVal(args, banexg.ParamClientOrderId, "")
 	if err := setBybitOrderID(args, orderId); err != nil {
 		return nil, err
 	}
+	newAmt, newPrice := float64(0), float64(0)
 	if amount > 0 {
 		precAmt, err := e.PrecAmount(market, amount)
 		if err != nil {
 			return nil, err
 		}
 		args["qty"] = strconv.FormatFloat(precAmt, 'f', -1, 64)
+		newAmt = precAmt
 	}
 	if price > 0 {
 		precPrice, err := e.PrecPrice(market, price)
@@ -1065,6 +1083,7 @@ func (e *Bybit) EditOrder(symbol, orderId, side string, amount, price float64, p
 			return nil, err
 		}
 		args["price"] = strconv.FormatFloat(precPrice, 'f', -1, 64)
+		newPrice = precPrice
 	}
 	if err := popAndSetBybitPriceArgs(e, market, args, true,
 		bybitPriceParam{param: banexg.ParamTriggerPrice, key: "triggerPrice"},
@@ -1084,7 +1103,8 @@ func (e *Bybit) EditOrder(symbol, orderId, side string, amount, price float64, p
 	tryNum := e.GetRetryNum("EditOrder", 1)
 	res := requestRetry[OrderResult](e, MethodPrivatePostV5OrderAmend, args, tryNum)
 	if res.Error != nil {
-		return nil, res.Error
+		return e.reconcileOrder("EditOrder", symbol, orderId, linkId, params, res.Error,
+			banexg.OrderEdited(newAmt, newPrice))
 	}
 	return &banexg.Order{
 		ID:            res.Result.OrderId,
@@ -1106,13 +1126,14 @@ func (e *Bybit) CancelOrder(id string, symbol string, params map[string]interfac
 	if market == nil {
 		return nil, errs.NewMsg(errs.CodeParamRequired, "symbol is required")
 	}
+	linkId := utils.GetMapVal(args, banexg.ParamClientOrderId, "")
 	if err := setBybitOrderID(args, id); err != nil {
 		return nil, err
 	}
 	tryNum := e.GetRetryNum("CancelOrder", 1)
 	res := requestRetry[OrderResult](e, MethodPrivatePostV5OrderCancel, args, tryNum)
 	if res.Error != nil {
-		return nil, res.Error
+		return e.reconcileOrder("CancelOrder", symbol, id, linkId, params, res.Error, banexg.OrderCanceled)
 	}
 	return &banexg.Order{
 		ID:            res.Result.OrderId,
@@ -1123,6 +1144,29 @@ func (e *Bybit) CancelOrder(id string, symbol string, params map[string]interfac
 	}, nil
 }
 
+/*
+reconcileOrder
+query the real order state by orderId or orderLinkId, after a trading request failed with unknown outcome.
+applied is passed to banexg.ReconcileOrder
+交易请求结果未知时，通过订单ID或orderLinkId查询订单真实状态
+*/
+func (e *Bybit) reconcileOrder(action, symbol, orderId, linkId string, params map[string]interface{}, reqErr *errs.Error,
+	applied func(*banexg.Order) bool) (*banexg.Order, *errs.Error) {
+	if orderId == "" && linkId == "" {
+		return nil, reqErr
+	}
+	return e.ReconcileOrder(action, reqErr, func() (*banexg.Order, *errs.Error) {
+		args := map[string]interface{}{}
+		if val, ok := params[banexg.ParamAccount]; ok {
+			args[banexg.ParamAccount] = val
+		}
+		if orderId == "" {
+			args[banexg.ParamClientOrderId] = linkId
+		}
+		return e.FetchOrder(symbol, orderId, args)
+	}, applied)
+}
+
 func (e *Bybit) FetchOrder(symbol, id string, params map[string]interface{}) (*banexg.Order, *errs.Error) {
 	args, market, marketType, _, err := e.loadBybitOrderArgs(symbol, params)
 	if err != nil {
@@ -1286,6 +1286,54 @@ func TestFetchOrderFallbackHistory(t *testing.T) {
 	}
 }
 
+func TestCreateOrderReconcileUnknown(t *testing.T) {
+	exg := newBybitWithMarket("BTCUSDT", "BTC/USDT:USDT", banexg.MarketLinear)
+	ensureBybitMarketPrecision(exg, "BTC/USDT:USDT")
+	oldIntv := banexg.ReconcileIntv
+	banexg.ReconcileIntv = 0
+	t.Cleanup(func() { banexg.ReconcileIntv = oldIntv })
+	created := true
+	linkId := ""
+	queries := 0
+	setBybitTestRequest(t, func(_ context.Context, endpoint string, params map[string]interface{}, _ int, _ bool, _ bool) *banexg.HttpRes {
+		switch endpoint {
+		case MethodPrivatePostV5OrderCreate:
+			linkId, _ = params["orderLinkId"].(string)
+			return &banexg.HttpRes{Status: 502, Error: errs.NewMsg(errs.CodeExecutionUnknown, "bad gateway")}
+		case MethodPrivateGetV5OrderRealtime, MethodPrivateGetV5OrderHistory:
+			if params["orderLinkId"] != linkId {
+				t.Fatalf("expected query by orderLinkId %s, got %v", linkId, params["orderLinkId"])
+			}
+			queries += 1
+			list := ""
+			if created && endpoint == MethodPrivateGetV5OrderRealtime {
+				list = `{"orderId":"order-1","orderLinkId":"` + linkId + `","symbol":"BTCUSDT","side":"Buy","orderType":"Limit","orderStatus":"New","timeInForce":"GTC","price":"100","qty":"1","cumExecQty":"0","leavesQty":"1","createdTime":"1700000000000","updatedTime":"1700000000000"}`
+			}
+			content := `{"retCode":0,"retMsg":"OK","result":{"list":[` + list + `],"nextPageCursor":""},"retExtInfo":{},"time":1700000000000}`
+			return &banexg.HttpRes{Status: 200, Content: content}
+		default:
+			t.Fatalf("unexpected endpoint: %s", endpoint)
+		}
+		return nil
+	})
+	od, err := exg.CreateOrder("BTC/USDT:USDT", banexg.OdTypeLimit, banexg.OdSideBuy, 1, 100, nil)
+	if err != nil {
+		t.Fatalf("expected reconciled order, got %v", err)
+	}
+	if od.ID != "order-1" || od.ClientOrderID != linkId || od.Status != banexg.OdStatusOpen {
+		t.Fatalf("unexpected order: %+v", od)
+	}
+	created = false
+	queries = 0
+	_, err = exg.CreateOrder("BTC/USDT:USDT", banexg.OdTypeLimit, banexg.OdSideBuy, 1, 100, nil)
+	if err == nil || err.Code != errs.CodeExecutionUnknown {
+		t.Fatalf("expected unknown outcome after not found, got %v", err)
+	}
+	if queries != 6 {
+		t.Fatalf("expected 3 reconcile queries on realtime and history, got %d", queries)
+	}
+}
+
 func TestCreateOrderRequiresPriceForLimit(t *testing.T) {
 	exg := newBybitWithMarket("BTCUSDT", "BTC/USDT", banexg.MarketSpot)
 	ensureBybitMarketPrecision(exg, "BTC/USDT")
@@ -1295,6 +1343,40 @@ func TestCreateOrderRequiresPriceForLimit(t *testing.T) {
 	}
 }
 
+func TestCreateOrderReqNative(t *testing.T) {
+	exg := newBybitWithMarket("BTCUSDT", "BTC/USDT:USDT", banexg.MarketLinear)
+	ensureBybitMarketPrecision(exg, "BTC/USDT:USDT")
+	setBybitTestRequestWithEndpoint(t, MethodPrivatePostV5OrderCreate, func(params map[string]interface{}) *banexg.HttpRes {
+		if params["timeInForce"] != "PostOnly" || params["orderLinkId"] != "link-1" || params["positionIdx"] != 1 ||
+			params["smpType"] != "CancelMaker" || params["tpslMode"] != "Partial" {
+			t.Fatalf("unexpected params: %v", params)
+		}
+		for _, key := range []string{banexg.ParamPositionSide, banexg.ParamClientOrderId} {
+			if _, ok := params[key]; ok {
+				t.Fatalf("%s should not be sent: %v", key, params)
+			}
+		}
+		body := `{"retCode":0,"retMsg":"OK","result":{"orderId":"order-1","orderLinkId":"link-1"},"retExtInfo":{},"time":1700000000000}`
+		return &banexg.HttpRes{Status: 200, Content: body}
+	})
+	req := &banexg.OrderRequest{Symbol: "BTC/USDT:USDT", Type: banexg.OdTypeLimit, Side: banexg.OdSideBuy,
+		Amount: 1, Price: 100, TimeInForce: banexg.TimeInForceGTX, PositionSide: banexg.PosSideLong,
+		ClientOrderID: "link-1", STPMode: "CancelMaker", Extra: map[string]interface{}{"tpslMode": "Partial"}}
+	if _, err := exg.CreateOrderReq(req); err != nil {
+		t.Fatalf("CreateOrderReq failed: %v", err)
+	}
+	req.Extra = map[string]interface{}{"reduce_only": true}
+	if _, err := exg.CreateOrderReq(req); err == nil || err.Code != errs.CodeParamInvalid {
+		t.Fatalf("unknown extra key should be rejected, got %v", err)
+	}
+	req.Extra = nil
+	req.TimeInForce = banexg.TimeInForceGTD
+	req.GoodTillDate = 1700000000000
+	if _, err := exg.CreateOrderReq(req); err == nil || err.Code != errs.CodeNotSupport {
+		t.Fatalf("GTD should not be supported, got %v", err)
+	}
+}
+
 func TestSetBybitOrderID(t *testing.T) {
 	args := map[string]interface{}{banexg.ParamClientOrderId: "link-1"}
 	if err := setBybitOrderID(args, ""); err != nil {
@@ -1425,12 +1507,23 @@ func TestValidateBybitTimeWindow(t *testing.T) {
 	}
 }
 
-func TestCreateOrderOptionRequiresOrderLinkId(t *testing.T) {
+func TestCreateOrderOptionAutoOrderLinkId(t *testing.T) {
 	exg := newBybitWithMarket("BTC-30DEC22-18000-C", "BTC/USDT:USDT-30DEC22-18000-C", banexg.MarketOption)
 	ensureBybitMarketPrecision(exg, "BTC/USDT:USDT-30DEC22-18000-C")
-	_, err := exg.CreateOrder("BTC/USDT:USDT-30DEC22-18000-C", banexg.OdTypeLimit, banexg.OdSideBuy, 1, 100, nil)
-	if err == nil || err.Code != errs.CodeParamRequired {
-		t.Fatalf("expected orderLinkId required error, got %v", err)
+	setBybitTestRequestWithEndpoint(t, MethodPrivatePostV5OrderCreate, func(params map[string]interface{}) *banexg.HttpRes {
+		linkId, _ := params["orderLinkId"].(string)
+		if len(linkId) != 32 {
+			t.Fatalf("expected generated orderLinkId, got %v", params["orderLinkId"])
+		}
+		body := `{"retCode":0,"retMsg":"OK","result":{"orderId":"order-opt-1","orderLinkId":"` + linkId + `"},"retExtInfo":{},"time":1700000000000}`
+		return &banexg.HttpRes{Status: 200, Content: body}
+	})
+	od, err := exg.CreateOrder("BTC/USDT:USDT-30DEC22-18000-C", banexg.OdTypeLimit, banexg.OdSideBuy, 1, 100, nil)
+	if err != nil {
+		t.Fatalf("CreateOrder option failed: %v", err)
+	}
+	if len(od.ClientOrderID) != 32 {
+		t.Fatalf("unexpected clientOrderId: %v", od.ClientOrderID)
 	}
 }
 
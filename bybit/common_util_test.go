@@ -2,10 +2,8 @@ package bybit
 
 import (
 	"context"
-	"encoding/gob"
 	"encoding/json"
 	"net/http"
-	"strings"
 	"testing"
 	"time"
 
@@ -459,7 +457,7 @@ func TestFetchV5ListAllError(t *testing.T) {
 // ---- ws_replay_test.go ----
 func TestBybitReplayHandlesPublic(t *testing.T) {
 	exg, _ := newBybitWsTest(t, "BTCUSDT", "BTC/USDT", banexg.MarketSpot)
-	exg.WsDecoder = gob.NewDecoder(strings.NewReader(""))
+	exg.WsReplayer = &banexg.WsDumpReader{}
 	exg.regReplayHandles()
 	seedMarket(exg, "BTCUSDT", "BTC/USDT:USDT", banexg.MarketLinear)
 	if exg.WsReplayFn == nil {
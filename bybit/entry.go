@@ -24,6 +24,8 @@ func New(Options map[string]interface{}) (*Bybit, *errs.Error) {
 				ID:        "bybit",
 				Name:      "Bybit",
 				Countries: []string{"VG"},
+				KlinePage: 1000,
+				KlineBack: true, // latest klines in range are returned
 			},
 			RateLimit:  20,
 			Options:    Options,
@@ -9,7 +9,6 @@ import (
 	"github.com/banbox/banexg/errs"
 	"github.com/banbox/banexg/log"
 	"github.com/banbox/banexg/utils"
-	"github.com/banbox/bntp"
 	"go.uber.org/zap"
 )
 
@@ -49,8 +48,7 @@ func (e *Bybit) WatchOrderBooks(symbols []string, limit int, params map[string]i
 	}
 	chanKey := client.Prefix("orderbook")
 	create := func(cap int) chan *banexg.OrderBook { return make(chan *banexg.OrderBook, cap) }
-	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, args)
-	e.AddWsChanRefs(chanKey, symbols...)
+	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, args, symbols...)
 	e.DumpWS("WatchOrderBooks", symbols)
 	return out, nil
 }
@@ -64,6 +62,11 @@ func (e *Bybit) UnWatchOrderBooks(symbols []string, params map[string]interface{
 	if err != nil {
 		return err
 	}
+	chanKey := client.Prefix("orderbook")
+	symbols = e.ReleaseWsRefs(chanKey, args, symbols...)
+	if len(symbols) == 0 {
+		return nil
+	}
 	keys := make([]string, 0, len(symbols))
 	limits, lock := client.LockOdBookLimits()
 	for _, sym := range symbols {
@@ -80,12 +83,7 @@ func (e *Bybit) UnWatchOrderBooks(symbols []string, params map[string]interface{
 		keys = append(keys, fmt.Sprintf("orderbook.%d.%s", depth, market.ID))
 	}
 	lock.Unlock()
-	if err := e.writeWsTopics(client, 0, false, keys); err != nil {
-		return err
-	}
-	chanKey := client.Prefix("orderbook")
-	e.DelWsChanRefs(chanKey, symbols...)
-	return nil
+	return e.writeWsTopics(client, 0, false, keys)
 }
 
 func (e *Bybit) WatchTrades(symbols []string, params map[string]interface{}) (chan *banexg.Trade, *errs.Error) {
@@ -224,21 +222,59 @@ func (e *Bybit) handleWsOrderBook(client *banexg.WsClient, base *wsBaseMsg) {
 		market = e.SafeMarket(data.Symbol, "", client.MarketType)
 	}
 	action := normalizeBybitWsOrderBookAction(base.Type, &data)
-	book := applyBybitWsOrderBook(e, market, &data, action, depth)
+	book, reason := applyBybitWsOrderBook(e, market, &data, action, depth)
+	if reason != "" {
+		e.resyncOrderBook(client, market.Symbol, base.Topic, reason, zap.Int64("latest", data.Update))
+	}
 	if book == nil {
 		return
 	}
-	client.SetSubsKeyStamp(base.Topic, bntp.UTCStamp())
+	client.SetSubsKeyStamp(base.Topic, e.MilliSeconds())
 	chanKey := client.Prefix("orderbook")
 	banexg.WriteOutChan(e.Exchange, chanKey, book, true)
 }
 
+/*
+resyncOrderBook
+reset a broken order book and resubscribe the topic, bybit pushes a new snapshot after subscribed
+重置失效的订单簿并重新订阅，bybit订阅后会推送新快照
+*/
+func (e *Bybit) resyncOrderBook(client *banexg.WsClient, symbol, topic, reason string, fields ...zap.Field) {
+	e.OdBookLock.Lock()
+	book, ok := e.OrderBooks[symbol]
+	e.OdBookLock.Unlock()
+	if !ok {
+		return
+	}
+	e.BookResync(symbol, reason, append(fields, zap.Int64("cur", book.Nonce))...)
+	book.Reset()
+	if e.IsReplay() {
+		// skip resubscribe in replay mode
+		return
+	}
+	go func() {
+		err := e.fetchOrderBookSnapshot(client, topic)
+		if err != nil {
+			log.Error("resubscribe bybit order book fail", zap.String("code", symbol), zap.Error(err))
+		}
+	}()
+}
+
+// fetchOrderBookSnapshot resubscribe order book topic to receive a full snapshot
+func (e *Bybit) fetchOrderBookSnapshot(client *banexg.WsClient, topic string) *errs.Error {
+	keys := []string{topic}
+	if err := e.writeWsTopics(client, 0, false, keys); err != nil {
+		return err
+	}
+	return e.writeWsTopics(client, 0, true, keys)
+}
+
 func (e *Bybit) handleWsTrades(client *banexg.WsClient, base *wsBaseMsg) {
 	items, ok := decodeBybitWsList(base.Data, "bybit ws trade decode fail")
 	if !ok {
 		return
 	}
-	client.SetSubsKeyStamp(base.Topic, bntp.UTCStamp())
+	client.SetSubsKeyStamp(base.Topic, e.MilliSeconds())
 	chanKey := client.Prefix("trades")
 	for _, item := range items {
 		trade := parseBybitWsTradeItem(e, item, client.MarketType)
@@ -260,7 +296,7 @@ func (e *Bybit) handleWsOHLCV(client *banexg.WsClient, base *wsBaseMsg) {
 	}
 	tf := bybitTimeFrameFromInterval(interval)
 	symbol := bybitSafeSymbol(e, symbolID, client.MarketType)
-	client.SetSubsKeyStamp(base.Topic, bntp.UTCStamp())
+	client.SetSubsKeyStamp(base.Topic, e.MilliSeconds())
 	chanKey := client.Prefix("kline")
 	for _, item := range items {
 		kline := parseBybitWsKlineItem(item)
@@ -310,7 +346,7 @@ func (e *Bybit) handleWsTickers(client *banexg.WsClient, base *wsBaseMsg) {
 	maps.Copy(data, res)
 	e.MarkPriceLock.Unlock()
 	if len(res) > 0 {
-		client.SetSubsKeyStamp(base.Topic, bntp.UTCStamp())
+		client.SetSubsKeyStamp(base.Topic, e.MilliSeconds())
 		chanKey := client.Prefix("markPrice")
 		banexg.WriteOutChan(e.Exchange, chanKey, res, true)
 	}
@@ -340,7 +376,7 @@ func (e *Bybit) handleWsWallet(client *banexg.WsClient, base *wsBaseMsg) {
 		acc.MarBalances[client.MarketType] = balances
 		acc.LockBalance.Unlock()
 	}
-	client.SetSubsKeyStamp(base.Topic, bntp.UTCStamp())
+	client.SetSubsKeyStamp(base.Topic, e.MilliSeconds())
 	chanKey := client.Prefix("balance")
 	banexg.WriteOutChan(e.Exchange, chanKey, balances, true)
 }
@@ -380,7 +416,7 @@ func (e *Bybit) handleWsPositions(client *banexg.WsClient, base *wsBaseMsg) {
 		acc.MarPositions[client.MarketType] = positions
 		acc.LockPos.Unlock()
 	}
-	client.SetSubsKeyStamp(base.Topic, bntp.UTCStamp())
+	client.SetSubsKeyStamp(base.Topic, e.MilliSeconds())
 	if len(positions) > 0 {
 		chanKey := client.Prefix("positions")
 		banexg.WriteOutChan(e.Exchange, chanKey, positions, true)
@@ -413,7 +449,7 @@ func (e *Bybit) handleWsExecutions(client *banexg.WsClient, base *wsBaseMsg) {
 	if len(trades) == 0 {
 		return
 	}
-	client.SetSubsKeyStamp(base.Topic, bntp.UTCStamp())
+	client.SetSubsKeyStamp(base.Topic, e.MilliSeconds())
 	chanKey := client.Prefix("mytrades")
 	for _, trade := range trades {
 		banexg.WriteOutChan(e.Exchange, chanKey, trade, true)
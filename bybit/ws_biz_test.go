@@ -584,7 +584,7 @@ func bybitWaitWsOrderBook(t *testing.T, ch <-chan *banexg.OrderBook, wantSymbol
 			if book == nil || book.Symbol != wantSymbol {
 				continue
 			}
-			if book.Asks == nil || book.Bids == nil || len(book.Asks.Price) == 0 || len(book.Bids.Price) == 0 {
+			if book.Asks == nil || book.Bids == nil || book.Asks.Len() == 0 || book.Bids.Len() == 0 {
 				continue
 			}
 			return book
@@ -846,7 +846,7 @@ func TestApi_WatchOrderBooks_Spot_MultiSymbol(t *testing.T) {
 			if _, exists := want[book.Symbol]; !exists {
 				continue
 			}
-			if book.Asks == nil || book.Bids == nil || len(book.Asks.Price) == 0 || len(book.Bids.Price) == 0 {
+			if book.Asks == nil || book.Bids == nil || book.Asks.Len() == 0 || book.Bids.Len() == 0 {
 				continue
 			}
 			if book.Limit != 50 {
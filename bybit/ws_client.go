@@ -384,8 +384,7 @@ func watchBybitWsPublicSymbols[T any](
 		return nil, err
 	}
 	chanKey := client.Prefix(chanPrefix)
-	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, args)
-	e.AddWsChanRefs(chanKey, refKeys...)
+	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, args, refKeys...)
 	e.DumpWS(dumpName, symbols)
 	return out, nil
 }
@@ -401,16 +400,16 @@ func (e *Bybit) unwatchWsPublicSymbols(
 	if err != nil {
 		return err
 	}
+	free := e.ReleaseWsRefs(client.Prefix(chanPrefix), args, refKeys...)
+	symbols = banexg.PickFreeRefs(symbols, refKeys, free)
+	if len(symbols) == 0 {
+		return nil
+	}
 	keys, err := topicFn(e, symbols)
 	if err != nil {
 		return err
 	}
-	if err := e.writeWsTopics(client, 0, false, keys); err != nil {
-		return err
-	}
-	chanKey := client.Prefix(chanPrefix)
-	e.DelWsChanRefs(chanKey, refKeys...)
-	return nil
+	return e.writeWsTopics(client, 0, false, keys)
 }
 
 func watchBybitWsPublicJobs[T any](
@@ -435,8 +434,7 @@ func watchBybitWsPublicJobs[T any](
 		return nil, err
 	}
 	chanKey := client.Prefix(chanPrefix)
-	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, args)
-	e.AddWsChanRefs(chanKey, refKeys...)
+	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, args, refKeys...)
 	e.DumpWS(dumpName, jobs)
 	return out, nil
 }
@@ -456,12 +454,11 @@ func (e *Bybit) unwatchWsPublicJobs(
 	if err != nil {
 		return err
 	}
-	if err := e.writeWsTopics(client, 0, false, keys); err != nil {
-		return err
+	free := e.ReleaseWsRefs(client.Prefix(chanPrefix), args, refKeys...)
+	if len(free) == 0 {
+		return nil
 	}
-	chanKey := client.Prefix(chanPrefix)
-	e.DelWsChanRefs(chanKey, refKeys...)
-	return nil
+	return e.writeWsTopics(client, 0, false, banexg.PickFreeRefs(keys, refKeys, free))
 }
 
 func bybitWsPrivatePositionTopic(args map[string]interface{}, opName string) (string, *errs.Error) {
@@ -498,8 +495,7 @@ func watchBybitWsPrivateTopic[T any](
 		return nil, nil, err
 	}
 	chanKey := client.Prefix(chanPrefix)
-	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, args)
-	e.AddWsChanRefs(chanKey, refKeys...)
+	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, args, refKeys...)
 	e.DumpWS(dumpName, dumpData)
 	return client, out, nil
 }
@@ -517,7 +513,7 @@ func makeCheckWsTimeout(e *Bybit) func() {
 		pingInterval := time.Second * 20
 		for {
 			time.Sleep(pingInterval)
-			for _, client := range e.WSClients {
+			for _, client := range e.GetWsClients() {
 				conns, lock := client.LockConns()
 				for _, conn := range conns {
 					if err := client.Write(conn, map[string]interface{}{"op": "ping"}, nil); err != nil {
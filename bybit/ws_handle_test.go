@@ -1,6 +1,7 @@
 package bybit
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/banbox/banexg"
@@ -51,11 +52,11 @@ func TestHandleWsOrderBookSnapshotDelta(t *testing.T) {
 	}
 	exg.handleWsOrderBook(client, &wsBaseMsg{Topic: topic, Type: "snapshot", Data: mustJSON(t, snapshot)})
 	book := readChan(t, out)
-	if book.Symbol != "BTC/USDT" || len(book.Bids.Price) != 1 || len(book.Asks.Price) != 1 {
+	if book.Symbol != "BTC/USDT" || book.Bids.Len() != 1 || book.Asks.Len() != 1 {
 		t.Fatalf("unexpected snapshot book: %+v", book)
 	}
-	if book.Bids.Size[0] != 1 || book.Asks.Size[0] != 2 {
-		t.Fatalf("unexpected snapshot sizes: bids=%v asks=%v", book.Bids.Size, book.Asks.Size)
+	if book.Bids.Sizes()[0] != 1 || book.Asks.Sizes()[0] != 2 {
+		t.Fatalf("unexpected snapshot sizes: bids=%v asks=%v", book.Bids.Sizes(), book.Asks.Sizes())
 	}
 
 	delta := orderBookSnapshot{
@@ -70,8 +71,8 @@ func TestHandleWsOrderBookSnapshotDelta(t *testing.T) {
 	if book2.Nonce != 2 || book2.TimeStamp != 1700000001000 {
 		t.Fatalf("unexpected delta stamps: nonce=%d ts=%d", book2.Nonce, book2.TimeStamp)
 	}
-	if book2.Bids.Size[0] != 3 || book2.Asks.Size[0] != 4 {
-		t.Fatalf("unexpected delta sizes: bids=%v asks=%v", book2.Bids.Size, book2.Asks.Size)
+	if book2.Bids.Sizes()[0] != 3 || book2.Asks.Sizes()[0] != 4 {
+		t.Fatalf("unexpected delta sizes: bids=%v asks=%v", book2.Bids.Sizes(), book2.Asks.Sizes())
 	}
 
 	reset := orderBookSnapshot{
@@ -83,14 +84,49 @@ func TestHandleWsOrderBookSnapshotDelta(t *testing.T) {
 	}
 	exg.handleWsOrderBook(client, &wsBaseMsg{Topic: topic, Type: "delta", Data: mustJSON(t, reset)})
 	book3 := readChan(t, out)
-	if len(book3.Asks.Price) != 0 {
+	if book3.Asks.Len() != 0 {
 		t.Fatalf("expected snapshot reset to clear asks, got: %+v", book3.Asks)
 	}
-	if len(book3.Bids.Price) != 1 || book3.Bids.Price[0] != 102 {
+	if book3.Bids.Len() != 1 || book3.Bids.Prices()[0] != 102 {
 		t.Fatalf("unexpected reset bids: %+v", book3.Bids)
 	}
 }
 
+func TestHandleWsOrderBookGapResync(t *testing.T) {
+	exg, client := newBybitWsTest(t, "BTCUSDT", "BTC/USDT", banexg.MarketSpot)
+	metrics := banexg.NewPromMetrics()
+	exg.Metrics = metrics
+	topic := "orderbook.50.BTCUSDT"
+	client.SubscribeKeys[topic] = 0
+	out := wsOutChan[*banexg.OrderBook](exg, client, "orderbook")
+	send := func(tp string, u int64, bid string) {
+		data := orderBookSnapshot{Symbol: "BTCUSDT", Bids: [][]string{{bid, "1"}}, Ts: 1700000000000 + u, Update: u}
+		exg.handleWsOrderBook(client, &wsBaseMsg{Topic: topic, Type: tp, Data: mustJSON(t, data)})
+	}
+	send("snapshot", 1, "100")
+	readChan(t, out)
+	send("delta", 2, "101")
+	if book := readChan(t, out); book.Nonce != 2 {
+		t.Fatalf("unexpected nonce: %d", book.Nonce)
+	}
+	// u=4 skips u=3, book is reset and following deltas are dropped until a new snapshot
+	send("delta", 4, "102")
+	send("delta", 5, "103")
+	select {
+	case book := <-out:
+		t.Fatalf("expect no output after gap, got nonce %d", book.Nonce)
+	default:
+	}
+	if !strings.Contains(metrics.Text(), `banexg_book_resyncs_total{exg="bybit",symbol="BTC/USDT",reason="gap"} 1`) {
+		t.Fatalf("book_resync not reported:\n%s", metrics.Text())
+	}
+	send("snapshot", 10, "104")
+	book := readChan(t, out)
+	if book.Nonce != 10 || book.Bids.Len() != 1 || book.Bids.Prices()[0] != 104 {
+		t.Fatalf("unexpected resynced book: nonce=%d bids=%v", book.Nonce, book.Bids.Prices())
+	}
+}
+
 func TestHandleWsTrades(t *testing.T) {
 	exg, client := newBybitWsTest(t, "BTCUSDT", "BTC/USDT", banexg.MarketSpot)
 	topic := "publicTrade.BTCUSDT"
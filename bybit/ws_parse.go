@@ -152,8 +152,9 @@ func bybitTimeFrameFromInterval(interval string) string {
 	if interval == "" {
 		return interval
 	}
+	// prefer unified timeframe like 1d over the alias D 优先返回统一周期如1d，而非别名D
 	for tf, itv := range timeFrameMap {
-		if itv == interval {
+		if itv == interval && tf != itv {
 			return tf
 		}
 	}
@@ -264,8 +265,9 @@ func bybitWsKlineTopics(e *Bybit, jobs [][2]string) ([]string, []string, *errs.E
 			return nil, nil, errs.NewMsg(errs.CodeInvalidTimeFrame, "invalid timeframe: %s", timeframe)
 		}
 		keys = append(keys, fmt.Sprintf("kline.%s.%s", tf, market.ID))
-		// Use the resolved Bybit interval as the ref-key, so timeframe aliases like 1d/D unwatch correctly.
-		refKeys = append(refKeys, symbol+"@"+tf)
+		// Use the unified timeframe of the resolved interval as the ref-key, so aliases like 1d/D unwatch correctly,
+		// and klines are routed by the same symbol@timeframe as PairTFKline.
+		refKeys = append(refKeys, symbol+"@"+bybitTimeFrameFromInterval(tf))
 	}
 	return keys, refKeys, nil
 }
@@ -297,9 +299,10 @@ func fillBybitWsOrderBookTs(base *wsBaseMsg, data *orderBookSnapshot) {
 	}
 }
 
-func applyBybitWsOrderBook(e *Bybit, market *banexg.Market, data *orderBookSnapshot, action string, depth int) *banexg.OrderBook {
+// applyBybitWsOrderBook apply snapshot or delta to local book, a non-empty reason is returned if the book is broken
+func applyBybitWsOrderBook(e *Bybit, market *banexg.Market, data *orderBookSnapshot, action string, depth int) (*banexg.OrderBook, string) {
 	if data == nil || market == nil {
-		return nil
+		return nil, ""
 	}
 	asks := bybitParseBookSide(data.Asks)
 	bids := bybitParseBookSide(data.Bids)
@@ -318,18 +321,21 @@ func applyBybitWsOrderBook(e *Bybit, market *banexg.Market, data *orderBookSnaps
 		}
 		e.OrderBooks[symbol] = book
 		e.OdBookLock.Unlock()
-		return book
+		return book, ""
 	}
 	e.OdBookLock.Unlock()
-	if len(asks) > 0 {
-		book.Asks.Update(asks)
-	}
-	if len(bids) > 0 {
-		book.Bids.Update(bids)
-	}
-	book.TimeStamp = data.Ts
-	book.Nonce = data.Update
-	return book
+	// u of delta should be continuous: previous u + 1
+	applied, reason := book.ApplyDelta(&banexg.BookDelta{
+		Asks:      asks,
+		Bids:      bids,
+		FirstID:   data.Update,
+		LastID:    data.Update,
+		TimeStamp: data.Ts,
+	})
+	if !applied {
+		return nil, reason
+	}
+	return book, ""
 }
 
 func normalizeBybitWsOrderBookAction(action string, data *orderBookSnapshot) string {
@@ -69,14 +69,14 @@ func TestApplyBybitWsOrderBook(t *testing.T) {
 		Ts:     1700000000000,
 		Update: 10,
 	}
-	book := applyBybitWsOrderBook(exg, market, data, "snapshot", 50)
-	if book == nil {
+	book, reason := applyBybitWsOrderBook(exg, market, data, "snapshot", 50)
+	if book == nil || reason != "" {
 		t.Fatalf("unexpected nil orderbook")
 	}
-	if book.Bids == nil || len(book.Bids.Price) != 1 || book.Bids.Price[0] != 100 {
+	if book.Bids == nil || book.Bids.Len() != 1 || book.Bids.Prices()[0] != 100 {
 		t.Fatalf("unexpected bids: %+v", book.Bids)
 	}
-	if book.Asks == nil || len(book.Asks.Price) != 1 || book.Asks.Price[0] != 101 {
+	if book.Asks == nil || book.Asks.Len() != 1 || book.Asks.Prices()[0] != 101 {
 		t.Fatalf("unexpected asks: %+v", book.Asks)
 	}
 }
@@ -374,9 +374,8 @@ func TestBybitTimeFrameFromInterval(t *testing.T) {
 	if got := bybitTimeFrameFromInterval("240"); got != "4h" {
 		t.Fatalf("expected 4h, got %q", got)
 	}
-	got := bybitTimeFrameFromInterval("D")
-	if got != "D" && got != "1d" {
-		t.Fatalf("expected D or 1d, got %q", got)
+	if got := bybitTimeFrameFromInterval("D"); got != "1d" {
+		t.Fatalf("expected 1d, got %q", got)
 	}
 	if got := bybitTimeFrameFromInterval(""); got != "" {
 		t.Fatalf("expected empty interval to return empty, got %q", got)
@@ -394,7 +393,7 @@ func TestBybitWsKlineTopics(t *testing.T) {
 	if len(keys) != 1 || keys[0] != "kline.1.BTCUSDT" {
 		t.Fatalf("unexpected kline keys: %+v", keys)
 	}
-	if len(refKeys) != 1 || refKeys[0] != "BTC/USDT@1" {
+	if len(refKeys) != 1 || refKeys[0] != "BTC/USDT@1m" {
 		t.Fatalf("unexpected kline ref keys: %+v", refKeys)
 	}
 }
@@ -1,8 +1,6 @@
 package bybit
 
 import (
-	"encoding/gob"
-	"strings"
 	"testing"
 
 	"github.com/banbox/banexg"
@@ -16,7 +14,7 @@ func newBybitWsWatch(t *testing.T, marketID, symbol, marketType string) (*Bybit,
 		t.Fatalf("new bybit failed: %v", err)
 	}
 	seedMarketIfNeeded(exg, marketID, symbol, marketType)
-	exg.WsDecoder = gob.NewDecoder(strings.NewReader(""))
+	exg.WsReplayer = &banexg.WsDumpReader{}
 	exg.MarketType = marketType
 	client, err := exg.getWsPublicClient(marketType, "")
 	if err != nil {
@@ -110,3 +108,41 @@ func TestWatchMarkPricesSubscribeUnsubscribe(t *testing.T) {
 	}
 	assertSubKey(t, client, key, false)
 }
+
+func TestWatchTradesSharedHandles(t *testing.T) {
+	exg, client := newBybitWsWatch(t, "BTCUSDT", "BTC/USDT", banexg.MarketSpot)
+
+	out1, err := exg.WatchTrades([]string{"BTC/USDT"}, nil)
+	if err != nil {
+		t.Fatalf("WatchTrades failed: %v", err)
+	}
+	out2, err := exg.WatchTrades([]string{"BTC/USDT"}, nil)
+	if err != nil {
+		t.Fatalf("WatchTrades failed: %v", err)
+	}
+	if out1 == out2 {
+		t.Fatal("each watch should get its own chan")
+	}
+	key := "publicTrade.BTCUSDT"
+	chanKey := client.Prefix("trades")
+	banexg.WriteOutChan(exg.Exchange, chanKey, &banexg.Trade{Symbol: "BTC/USDT"}, true)
+	if len(out1) != 1 || len(out2) != 1 {
+		t.Fatalf("trade should fan out to both chans")
+	}
+
+	params := map[string]interface{}{banexg.ParamWatchChan: out1}
+	if err := exg.UnWatchTrades([]string{"BTC/USDT"}, params); err != nil {
+		t.Fatalf("UnWatchTrades failed: %v", err)
+	}
+	assertSubKey(t, client, key, true)
+	<-out1
+	if _, ok := <-out1; ok {
+		t.Fatal("released chan should be closed")
+	}
+
+	params = map[string]interface{}{banexg.ParamWatchChan: out2}
+	if err := exg.UnWatchTrades([]string{"BTC/USDT"}, params); err != nil {
+		t.Fatalf("UnWatchTrades failed: %v", err)
+	}
+	assertSubKey(t, client, key, false)
+}
@@ -0,0 +1,419 @@
+package banexg
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/banbox/banexg/errs"
+	"github.com/banbox/banexg/log"
+	"github.com/banbox/banexg/utils"
+	"github.com/sasha-s/go-deadlock"
+	"go.uber.org/zap"
+)
+
+/*
+CacheStore
+Backend for api responses cached by Entry.CacheSecs.
+Get should return the content with a CodeExpired error for expired items if it still has them,
+which allows reading stale cache when NetDisable is true.
+Entry.CacheSecs缓存的API响应存储后端。过期项如果仍存在，Get应返回内容和CodeExpired错误，以便NetDisable时读取旧缓存
+*/
+type CacheStore interface {
+	Get(key string) (string, *errs.Error)
+	Set(key, content string, expSecs int) *errs.Error
+	Delete(key string)
+}
+
+type CacheStats struct {
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Expired int64 `json:"expired"` // expired items, also counted in Misses
+	Writes  int64 `json:"writes"`
+}
+
+/*
+StatsCache
+wrap a CacheStore to count hits/misses
+*/
+type StatsCache struct {
+	CacheStore
+	hits    atomic.Int64
+	misses  atomic.Int64
+	expired atomic.Int64
+	writes  atomic.Int64
+}
+
+func NewStatsCache(store CacheStore) *StatsCache {
+	return &StatsCache{CacheStore: store}
+}
+
+func (c *StatsCache) Get(key string) (string, *errs.Error) {
+	content, err := c.CacheStore.Get(key)
+	if err == nil {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+		if err.Code == errs.CodeExpired {
+			c.expired.Add(1)
+		}
+	}
+	return content, err
+}
+
+func (c *StatsCache) Set(key, content string, expSecs int) *errs.Error {
+	c.writes.Add(1)
+	return c.CacheStore.Set(key, content, expSecs)
+}
+
+func (c *StatsCache) Stats() CacheStats {
+	return CacheStats{
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+		Expired: c.expired.Load(),
+		Writes:  c.writes.Load(),
+	}
+}
+
+func newExpiredErr(expireMS int64) *errs.Error {
+	expDate := time.UnixMilli(expireMS).Format("2006-01-02 15:04:05")
+	return errs.NewMsg(errs.CodeExpired, "expired at: %v", expDate)
+}
+
+func calcExpireMS(expSecs int) int64 {
+	if expSecs <= 0 {
+		return 0
+	}
+	return time.Now().UnixMilli() + int64(expSecs)*1000
+}
+
+/*
+MemCacheStore
+in-memory LRU cache store, items over MaxSize are evicted from the least recently used
+内存LRU缓存，超出MaxSize时淘汰最久未使用的项
+*/
+type MemCacheStore struct {
+	MaxSize int
+	items   map[string]*list.Element
+	order   *list.List // front is the most recently used
+	lock    deadlock.Mutex
+}
+
+type memCacheItem struct {
+	key      string
+	content  string
+	expireMS int64
+}
+
+func NewMemCacheStore(maxSize int) *MemCacheStore {
+	if maxSize <= 0 {
+		maxSize = 1000
+	}
+	return &MemCacheStore{
+		MaxSize: maxSize,
+		items:   make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (s *MemCacheStore) Get(key string) (string, *errs.Error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	elem, ok := s.items[key]
+	if !ok {
+		return "", errs.NewMsg(errs.CodeDataNotFound, "cache not found: %s", key)
+	}
+	s.order.MoveToFront(elem)
+	item := elem.Value.(*memCacheItem)
+	if item.expireMS > 0 && item.expireMS < time.Now().UnixMilli() {
+		return item.content, newExpiredErr(item.expireMS)
+	}
+	return item.content, nil
+}
+
+func (s *MemCacheStore) Set(key, content string, expSecs int) *errs.Error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	expireMS := calcExpireMS(expSecs)
+	if elem, ok := s.items[key]; ok {
+		item := elem.Value.(*memCacheItem)
+		item.content = content
+		item.expireMS = expireMS
+		s.order.MoveToFront(elem)
+		return nil
+	}
+	s.items[key] = s.order.PushFront(&memCacheItem{key: key, content: content, expireMS: expireMS})
+	for s.order.Len() > s.MaxSize {
+		last := s.order.Back()
+		s.order.Remove(last)
+		delete(s.items, last.Value.(*memCacheItem).key)
+	}
+	return nil
+}
+
+func (s *MemCacheStore) Delete(key string) {
+	s.lock.Lock()
+	if elem, ok := s.items[key]; ok {
+		s.order.Remove(elem)
+		delete(s.items, key)
+	}
+	s.lock.Unlock()
+}
+
+func (s *MemCacheStore) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.order.Len()
+}
+
+/*
+FileCacheStore
+one file per key under Dir, written atomically (temp file + rename).
+Expired files are swept every SweepSecs on Set, after kept for GraceSecs for NetDisable fallback.
+每个key一个文件，原子写入(临时文件+重命名)。Set时每隔SweepSecs清理一次过期超过GraceSecs的文件
+*/
+type FileCacheStore struct {
+	Dir       string
+	Prefix    string
+	SweepSecs int
+	GraceSecs int
+	lastSweep int64
+	lock      deadlock.Mutex
+}
+
+/*
+NewFileCacheStore
+dir defaults to utils.GetCacheDir()
+*/
+func NewFileCacheStore(dir string) (*FileCacheStore, *errs.Error) {
+	if dir == "" {
+		cacheDir, err := utils.GetCacheDir()
+		if err != nil {
+			return nil, errs.New(errs.CodeIOReadFail, err)
+		}
+		dir = cacheDir
+	}
+	return &FileCacheStore{
+		Dir:       dir,
+		Prefix:    "banexg_",
+		SweepSecs: 3600,
+		GraceSecs: 86400,
+	}, nil
+}
+
+func (s *FileCacheStore) path(key string) string {
+	return filepath.Join(s.Dir, s.Prefix+key)
+}
+
+func (s *FileCacheStore) Get(key string) (string, *errs.Error) {
+	data, err := os.ReadFile(s.path(key))
+	if err != nil {
+		return "", errs.New(errs.CodeIOReadFail, err)
+	}
+	expireMS, content, err2 := parseCacheFile(string(data))
+	if err2 != nil {
+		return "", err2
+	}
+	if expireMS > 0 && expireMS < time.Now().UnixMilli() {
+		return content, newExpiredErr(expireMS)
+	}
+	return content, nil
+}
+
+func parseCacheFile(fileText string) (int64, string, *errs.Error) {
+	sepIdx := strings.Index(fileText, "\n")
+	if sepIdx <= 0 {
+		return 0, "", errs.NewMsg(errs.CodeInvalidData, "newLineIdx should > 0, current: %v", sepIdx)
+	}
+	expireMS, err := strconv.ParseInt(fileText[:sepIdx], 10, 64)
+	if err != nil {
+		return 0, "", errs.New(errs.CodeInvalidData, err)
+	}
+	return expireMS, fileText[sepIdx+1:], nil
+}
+
+func (s *FileCacheStore) Set(key, content string, expSecs int) *errs.Error {
+	err := os.MkdirAll(s.Dir, 0755)
+	if err != nil {
+		return errs.New(errs.CodeIOWriteFail, err)
+	}
+	file, err := os.CreateTemp(s.Dir, s.Prefix+"tmp_*")
+	if err != nil {
+		return errs.New(errs.CodeIOWriteFail, err)
+	}
+	tmpPath := file.Name()
+	_, err = file.WriteString(fmt.Sprintf("%v\n%s", calcExpireMS(expSecs), content))
+	if err == nil {
+		err = file.Close()
+	} else {
+		_ = file.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, s.path(key))
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return errs.New(errs.CodeIOWriteFail, err)
+	}
+	s.trySweep()
+	return nil
+}
+
+func (s *FileCacheStore) Delete(key string) {
+	err := os.Remove(s.path(key))
+	if err != nil && !os.IsNotExist(err) {
+		log.Warn("delete cache file fail", zap.String("key", key), zap.Error(err))
+	}
+}
+
+func (s *FileCacheStore) trySweep() {
+	curMS := time.Now().UnixMilli()
+	s.lock.Lock()
+	if curMS-s.lastSweep < int64(s.SweepSecs)*1000 {
+		s.lock.Unlock()
+		return
+	}
+	s.lastSweep = curMS
+	s.lock.Unlock()
+	go func() {
+		num, err := s.Sweep()
+		if err != nil {
+			log.Warn("sweep cache files fail", zap.String("dir", s.Dir), zap.Error(err))
+		} else if num > 0 {
+			log.Debug("sweep cache files", zap.String("dir", s.Dir), zap.Int("num", num))
+		}
+	}()
+}
+
+/*
+Sweep
+remove files expired for more than GraceSecs, and temp files left by failed writes.
+files whose expire header can't be parsed are kept, as they may belong to other writers. return number of removed files
+删除过期超过GraceSecs的文件，以及写入失败残留的临时文件。无法解析过期时间的文件可能属于其他写入方，予以保留。返回删除的文件数
+*/
+func (s *FileCacheStore) Sweep() (int, *errs.Error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return 0, errs.New(errs.CodeIOReadFail, err)
+	}
+	tmpPrefix := s.Prefix + "tmp_"
+	stopMS := time.Now().UnixMilli() - int64(s.GraceSecs)*1000
+	removeNum := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, s.Prefix) {
+			continue
+		}
+		path := filepath.Join(s.Dir, name)
+		if strings.HasPrefix(name, tmpPrefix) {
+			info, err_ := entry.Info()
+			if err_ == nil && info.ModTime().UnixMilli() < stopMS {
+				if os.Remove(path) == nil {
+					removeNum += 1
+				}
+			}
+			continue
+		}
+		// the cache dir is shared with other writers, only remove files in our format
+		expireMS, err_ := readCacheExpire(path)
+		if err_ == nil && expireMS > 0 && expireMS < stopMS {
+			if os.Remove(path) == nil {
+				removeNum += 1
+			}
+		}
+	}
+	return removeNum, nil
+}
+
+func readCacheExpire(path string) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	buf := make([]byte, 24)
+	n, err := file.Read(buf)
+	if err != nil {
+		return 0, err
+	}
+	text := string(buf[:n])
+	sepIdx := strings.Index(text, "\n")
+	if sepIdx <= 0 {
+		return 0, fmt.Errorf("invalid cache file: %s", path)
+	}
+	return strconv.ParseInt(text[:sepIdx], 10, 64)
+}
+
+var (
+	defCacheStore     *StatsCache
+	defCacheStoreLock deadlock.Mutex
+)
+
+/*
+getDefCacheStore
+the file cache store under utils.GetCacheDir, shared by all exchanges
+*/
+func getDefCacheStore() *StatsCache {
+	defCacheStoreLock.Lock()
+	defer defCacheStoreLock.Unlock()
+	if defCacheStore == nil {
+		store, err := NewFileCacheStore("")
+		if err != nil {
+			log.Error("init file cache store fail, use memory", zap.Error(err))
+			defCacheStore = NewStatsCache(NewMemCacheStore(0))
+		} else {
+			defCacheStore = NewStatsCache(store)
+		}
+	}
+	return defCacheStore
+}
+
+func (e *Exchange) initCacheStore() {
+	switch val := e.Options[OptCacheStore].(type) {
+	case CacheStore:
+		e.SetCacheStore(val)
+	case string:
+		if val == CacheStoreMemory {
+			e.SetCacheStore(NewMemCacheStore(utils.GetMapVal(e.Options, OptCacheSize, 0)))
+		} else if val != "" && val != CacheStoreFile {
+			store, err := NewFileCacheStore(val)
+			if err != nil {
+				log.Error("init file cache store fail", zap.String("dir", val), zap.Error(err))
+			} else {
+				e.SetCacheStore(store)
+			}
+		}
+	}
+}
+
+/*
+SetCacheStore set the backend for api responses cache, nil to use the default file store
+*/
+func (e *Exchange) SetCacheStore(store CacheStore) {
+	if store == nil {
+		e.CacheStore = nil
+	} else if stats, ok := store.(*StatsCache); ok {
+		e.CacheStore = stats
+	} else {
+		e.CacheStore = NewStatsCache(store)
+	}
+}
+
+func (e *Exchange) getCacheStore() *StatsCache {
+	if e.CacheStore == nil {
+		return getDefCacheStore()
+	}
+	return e.CacheStore
+}
+
+/*
+GetCacheStats return hit/miss counts of the api cache store
+*/
+func (e *Exchange) GetCacheStats() CacheStats {
+	return e.getCacheStore().Stats()
+}
@@ -0,0 +1,100 @@
+package banexg
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/banbox/banexg/errs"
+)
+
+func TestMemCacheStoreLRU(t *testing.T) {
+	store := NewMemCacheStore(2)
+	_ = store.Set("a", "1", 60)
+	_ = store.Set("b", "2", 60)
+	if _, err := store.Get("a"); err != nil {
+		t.Fatal(err)
+	}
+	_ = store.Set("c", "3", 60)
+	if _, err := store.Get("b"); err == nil {
+		t.Fatalf("least recently used item should be evicted")
+	}
+	if val, err := store.Get("a"); err != nil || val != "1" {
+		t.Fatalf("recently used item lost: %v %v", val, err)
+	}
+	_ = store.Set("d", "4", -1)
+	store.items["d"].Value.(*memCacheItem).expireMS = time.Now().UnixMilli() - 1
+	val, err := store.Get("d")
+	if err == nil || err.Code != errs.CodeExpired || val != "4" {
+		t.Fatalf("expired item should return content with CodeExpired: %v %v", val, err)
+	}
+	if store.Len() != 2 {
+		t.Fatalf("store len: %v", store.Len())
+	}
+}
+
+func TestFileCacheStoreSweep(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileCacheStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.GraceSecs = 0
+	if err = store.Set("keep", "v1", 60); err != nil {
+		t.Fatal(err)
+	}
+	if val, err := store.Get("keep"); err != nil || val != "v1" {
+		t.Fatalf("read back fail: %v %v", val, err)
+	}
+	old := []byte("1000\nold")
+	if err_ := os.WriteFile(filepath.Join(dir, "banexg_old"), old, 0644); err_ != nil {
+		t.Fatal(err_)
+	}
+	other := filepath.Join(dir, "banexg_other.json")
+	if err_ := os.WriteFile(other, []byte(`{"a":1}`), 0644); err_ != nil {
+		t.Fatal(err_)
+	}
+	num, err := store.Sweep()
+	if err != nil || num != 1 {
+		t.Fatalf("sweep removed %v, err %v", num, err)
+	}
+	if _, err_ := os.Stat(other); err_ != nil {
+		t.Fatalf("file of other format should be kept: %v", err_)
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), "tmp_") || entry.Name() == "banexg_old" {
+			t.Fatalf("unexpected file left: %s", entry.Name())
+		}
+	}
+}
+
+func TestExchangeCacheStoreStats(t *testing.T) {
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits += 1
+		_, _ = w.Write([]byte("data"))
+	}))
+	defer srv.Close()
+	e := newInterceptExg(srv.URL)
+	e.Options = map[string]interface{}{OptCacheStore: CacheStoreMemory}
+	e.initCacheStore()
+	e.Apis = map[string]*Entry{
+		"markets": {Path: "markets", Method: "GET", RawHost: "cache-stats.test", CacheSecs: 60},
+	}
+	for i := 0; i < 3; i++ {
+		res := e.RequestApiRetryAdv(context.Background(), "markets", nil, 0, true, true)
+		if res.Error != nil || res.Content != "data" {
+			t.Fatalf("request fail: %#v", res)
+		}
+	}
+	stats := e.GetCacheStats()
+	if hits != 1 || stats.Hits != 2 || stats.Misses != 1 || stats.Writes != 1 {
+		t.Fatalf("unexpected stats: %+v, hits %v", stats, hits)
+	}
+}
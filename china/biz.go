@@ -388,6 +388,10 @@ func (e *China) FetchOpenOrders(symbol string, since int64, limit int, params ma
 }
 
 func (e *China) CreateOrder(symbol, odType, side string, amount, price float64, params map[string]interface{}) (*banexg.Order, *errs.Error) {
+	return e.CreateOrderReq(banexg.NewOrderRequest(symbol, odType, side, amount, price, params))
+}
+
+func (e *China) CreateOrderReq(req *banexg.OrderRequest) (*banexg.Order, *errs.Error) {
 	return nil, errs.NewMsg(errs.CodeNotImplement, "method not implement")
 }
 
@@ -0,0 +1,263 @@
+package banexg
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/banbox/banexg/errs"
+	"github.com/banbox/bntp"
+	"github.com/sasha-s/go-deadlock"
+)
+
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+var circuitStateNames = map[CircuitState]string{
+	CircuitClosed:   "closed",
+	CircuitOpen:     "open",
+	CircuitHalfOpen: "half-open",
+}
+
+func (s CircuitState) String() string {
+	if name, ok := circuitStateNames[s]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+/*
+CircuitConfig
+Config for circuit breaker. Circuits are kept for each host and each endpoint of host.
+熔断器配置。每个host和每个host下的接口分别维护一个熔断状态
+*/
+type CircuitConfig struct {
+	FailThreshold  int           // consecutive failures to open circuit, default 5
+	OpenWait       time.Duration // fail fast duration before probing, default 30s
+	HalfOpenProbes int           // concurrent probe requests in half-open state, default 1
+	// OnStateChange is called without lock when any circuit changes state. key is RawHost or "RawHost METHOD path"
+	OnStateChange func(key string, from, to CircuitState)
+}
+
+type circuit struct {
+	state  CircuitState
+	fails  int   // consecutive failures
+	openAt int64 // 13 digits timestamp when circuit opened
+	probes int   // probe requests in flight for half-open
+}
+
+type circuitChange struct {
+	key      string
+	from, to CircuitState
+}
+
+type CircuitBreaker struct {
+	Config CircuitConfig
+	items  map[string]*circuit
+	lock   deadlock.Mutex
+}
+
+func NewCircuitBreaker(cfg *CircuitConfig) *CircuitBreaker {
+	var res = &CircuitBreaker{items: make(map[string]*circuit)}
+	if cfg != nil {
+		res.Config = *cfg
+	}
+	if res.Config.FailThreshold <= 0 {
+		res.Config.FailThreshold = 5
+	}
+	if res.Config.OpenWait <= 0 {
+		res.Config.OpenWait = time.Second * 30
+	}
+	if res.Config.HalfOpenProbes <= 0 {
+		res.Config.HalfOpenProbes = 1
+	}
+	return res
+}
+
+func circuitKeys(api *Entry) []string {
+	return []string{api.RawHost, api.RawHost + " " + api.Method + " " + api.Path}
+}
+
+/*
+isCircuitFail
+whether the error indicates the host or endpoint is unhealthy. Business errors such as
+insufficient balance mean the server works fine, and are treated as success.
+*/
+func isCircuitFail(err *errs.Error) bool {
+	if err == nil {
+		return false
+	}
+	switch err.Code {
+	case errs.CodeNetFail, errs.CodeConnectFail, errs.CodeServerError, errs.CodeTimeout,
+		errs.CodeExecutionUnknown:
+		return true
+	}
+	return false
+}
+
+/*
+circuitErr
+error of rsp to record for the breaker. MapApiError of exchanges may map a 5xx response to a business error,
+so 5xx status is checked through mapHTTPError.
+用于熔断记录的错误。交易所的MapApiError可能将5xx响应映射为业务错误，故5xx状态码通过mapHTTPError判断
+*/
+func circuitErr(api *Entry, rsp *HttpRes) *errs.Error {
+	err := rsp.Error
+	if err != nil && rsp.Status >= http.StatusInternalServerError && !isCircuitFail(err) && !isCircuitNeutral(err) {
+		return mapHTTPError(api, rsp.Status)
+	}
+	return err
+}
+
+func isCircuitNeutral(err *errs.Error) bool {
+	return err != nil && (err.Code == errs.CodeCancel || err.Code == errs.CodeShutdown ||
+		err.Code == errs.CodeCircuitOpen)
+}
+
+/*
+State return the current state of circuit, key is RawHost or "RawHost METHOD path"
+*/
+func (b *CircuitBreaker) State(key string) CircuitState {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if c, ok := b.items[key]; ok {
+		if c.state == CircuitOpen && bntp.UTCStamp()-c.openAt >= b.Config.OpenWait.Milliseconds() {
+			return CircuitHalfOpen
+		}
+		return c.state
+	}
+	return CircuitClosed
+}
+
+/*
+Allow
+check whether the request can be sent. CodeCircuitOpen is returned if host or endpoint is open,
+and Data of the error is the milliseconds to wait. Circuits are changed only when all of them allow.
+检查是否允许发送请求，熔断时返回CodeCircuitOpen，Data为需等待毫秒数。仅当所有熔断都允许时才修改状态
+*/
+func (b *CircuitBreaker) Allow(api *Entry) *errs.Error {
+	keys := circuitKeys(api)
+	curMS := bntp.UTCStamp()
+	waitMS := b.Config.OpenWait.Milliseconds()
+	var changes []circuitChange
+	var err *errs.Error
+	b.lock.Lock()
+	var halfKeys []string
+	var halfs, probes []*circuit
+	for _, key := range keys {
+		c, ok := b.items[key]
+		if !ok {
+			continue
+		}
+		state, inFlight := c.state, c.probes
+		if state == CircuitOpen {
+			leftMS := c.openAt + waitMS - curMS
+			if leftMS > 0 {
+				err = errs.NewMsg(errs.CodeCircuitOpen, "circuit open for %s, retry after %d ms", key, leftMS)
+				err.Data = leftMS
+				break
+			}
+			state, inFlight = CircuitHalfOpen, 0
+			halfKeys = append(halfKeys, key)
+			halfs = append(halfs, c)
+		}
+		if state == CircuitHalfOpen {
+			if inFlight >= b.Config.HalfOpenProbes {
+				err = errs.NewMsg(errs.CodeCircuitOpen, "circuit half-open for %s, probing", key)
+				break
+			}
+			probes = append(probes, c)
+		}
+	}
+	if err == nil {
+		// change states and reserve probe slots only when all circuits allow
+		for i, c := range halfs {
+			c.state = CircuitHalfOpen
+			c.probes = 0
+			changes = append(changes, circuitChange{halfKeys[i], CircuitOpen, CircuitHalfOpen})
+		}
+		for _, c := range probes {
+			c.probes += 1
+		}
+	}
+	b.lock.Unlock()
+	b.fireChanges(changes)
+	return err
+}
+
+/*
+Record update circuits of host and endpoint with the result of a request
+根据请求结果更新host和接口的熔断状态
+*/
+func (b *CircuitBreaker) Record(api *Entry, err *errs.Error) {
+	if isCircuitNeutral(err) {
+		b.releaseProbes(api)
+		return
+	}
+	failed := isCircuitFail(err)
+	keys := circuitKeys(api)
+	curMS := bntp.UTCStamp()
+	var changes []circuitChange
+	b.lock.Lock()
+	for _, key := range keys {
+		c, ok := b.items[key]
+		if !ok {
+			if !failed {
+				continue
+			}
+			c = &circuit{}
+			b.items[key] = c
+		}
+		switch c.state {
+		case CircuitHalfOpen:
+			if c.probes > 0 {
+				c.probes -= 1
+			}
+			if failed {
+				c.state = CircuitOpen
+				c.openAt = curMS
+				changes = append(changes, circuitChange{key, CircuitHalfOpen, CircuitOpen})
+			} else {
+				c.state = CircuitClosed
+				c.fails = 0
+				changes = append(changes, circuitChange{key, CircuitHalfOpen, CircuitClosed})
+			}
+		case CircuitClosed:
+			if !failed {
+				c.fails = 0
+				continue
+			}
+			c.fails += 1
+			if c.fails >= b.Config.FailThreshold {
+				c.state = CircuitOpen
+				c.openAt = curMS
+				changes = append(changes, circuitChange{key, CircuitClosed, CircuitOpen})
+			}
+		}
+	}
+	b.lock.Unlock()
+	b.fireChanges(changes)
+}
+
+func (b *CircuitBreaker) releaseProbes(api *Entry) {
+	b.lock.Lock()
+	for _, key := range circuitKeys(api) {
+		if c, ok := b.items[key]; ok && c.state == CircuitHalfOpen && c.probes > 0 {
+			c.probes -= 1
+		}
+	}
+	b.lock.Unlock()
+}
+
+func (b *CircuitBreaker) fireChanges(changes []circuitChange) {
+	if b.Config.OnStateChange == nil {
+		return
+	}
+	for _, ch := range changes {
+		b.Config.OnStateChange(ch.key, ch.from, ch.to)
+	}
+}
@@ -0,0 +1,145 @@
+package banexg
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/banbox/banexg/errs"
+)
+
+func TestCircuitBreakerStates(t *testing.T) {
+	var changes []string
+	b := NewCircuitBreaker(&CircuitConfig{
+		FailThreshold: 2,
+		OpenWait:      time.Millisecond * 50,
+		OnStateChange: func(key string, from, to CircuitState) {
+			if key == "circuit.test" {
+				changes = append(changes, from.String()+">"+to.String())
+			}
+		},
+	})
+	api := &Entry{RawHost: "circuit.test", Method: "GET", Path: "ping"}
+	fail := errs.NewMsg(errs.CodeServerError, "down")
+	for i := 0; i < 2; i++ {
+		if err := b.Allow(api); err != nil {
+			t.Fatalf("closed circuit should allow: %v", err)
+		}
+		b.Record(api, fail)
+	}
+	if err := b.Allow(api); err == nil || err.Code != errs.CodeCircuitOpen {
+		t.Fatalf("open circuit should fail fast, got %v", err)
+	}
+	time.Sleep(time.Millisecond * 60)
+	if err := b.Allow(api); err != nil {
+		t.Fatalf("half-open should allow one probe: %v", err)
+	}
+	if err := b.Allow(api); err == nil || err.Code != errs.CodeCircuitOpen {
+		t.Fatalf("half-open should reject extra probe, got %v", err)
+	}
+	b.Record(api, fail)
+	if b.State("circuit.test") != CircuitOpen {
+		t.Fatalf("failed probe should reopen circuit")
+	}
+	time.Sleep(time.Millisecond * 60)
+	if err := b.Allow(api); err != nil {
+		t.Fatalf("half-open should allow probe: %v", err)
+	}
+	// business error means the server is reachable
+	b.Record(api, errs.NewMsg(errs.CodeInsufficientFunds, "no money"))
+	if b.State("circuit.test") != CircuitClosed {
+		t.Fatalf("success probe should close circuit")
+	}
+	want := []string{"closed>open", "open>half-open", "half-open>open", "open>half-open", "half-open>closed"}
+	if len(changes) != len(want) {
+		t.Fatalf("changes = %v", changes)
+	}
+	for i, v := range want {
+		if changes[i] != v {
+			t.Fatalf("changes = %v", changes)
+		}
+	}
+}
+
+func TestCircuitBreakerAllowAllKeys(t *testing.T) {
+	var changes []string
+	b := NewCircuitBreaker(&CircuitConfig{
+		FailThreshold: 1,
+		OpenWait:      time.Millisecond * 50,
+		OnStateChange: func(key string, from, to CircuitState) {
+			changes = append(changes, key+":"+from.String()+">"+to.String())
+		},
+	})
+	api := &Entry{RawHost: "circuit.test", Method: "GET", Path: "ping"}
+	host, endpoint := circuitKeys(api)[0], circuitKeys(api)[1]
+	curMS := time.Now().UnixMilli()
+	// host wait is over, but the endpoint is still open
+	b.items[host] = &circuit{state: CircuitOpen, openAt: curMS - 100}
+	b.items[endpoint] = &circuit{state: CircuitOpen, openAt: curMS + 1000}
+	if err := b.Allow(api); err == nil || err.Code != errs.CodeCircuitOpen {
+		t.Fatalf("open endpoint should fail fast, got %v", err)
+	}
+	if b.items[host].state != CircuitOpen || b.items[host].probes != 0 || len(changes) != 0 {
+		t.Fatalf("host circuit should be unchanged: %+v %v", b.items[host], changes)
+	}
+	// endpoint wait is over too, both move to half-open with a probe
+	b.items[endpoint].openAt = curMS - 100
+	if err := b.Allow(api); err != nil {
+		t.Fatalf("should allow a probe: %v", err)
+	}
+	if b.items[host].probes != 1 || b.items[endpoint].probes != 1 || len(changes) != 2 {
+		t.Fatalf("unexpected probes %+v %+v, changes %v", b.items[host], b.items[endpoint], changes)
+	}
+}
+
+func TestRequestApiRetryCircuitOpen(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	e := newInterceptExg(srv.URL)
+	e.Apis = map[string]*Entry{"ping": {Path: "ping", Method: "GET", RawHost: "circuit-retry.test"}}
+	e.Breaker = NewCircuitBreaker(&CircuitConfig{FailThreshold: 3, OpenWait: time.Minute})
+	for i := 0; i < 3; i++ {
+		res := e.RequestApiRetryAdv(context.Background(), "ping", nil, 0, false, false)
+		if res.Error == nil || res.Error.Code != errs.CodeServerError {
+			t.Fatalf("expect server error, got %v", res.Error)
+		}
+	}
+	res := e.RequestApiRetryAdv(context.Background(), "ping", nil, 3, false, false)
+	if res.Error == nil || res.Error.Code != errs.CodeCircuitOpen {
+		t.Fatalf("expect circuit open, got %v", res.Error)
+	}
+	if n := atomic.LoadInt32(&hits); n != 3 {
+		t.Fatalf("open circuit should not hit server, hits: %d", n)
+	}
+}
+
+func TestRequestApiCircuitMappedStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`{"code":-1001,"msg":"busy"}`))
+	}))
+	defer srv.Close()
+	e := newInterceptExg(srv.URL)
+	e.Apis = map[string]*Entry{"ping": {Path: "ping", Method: "GET", RawHost: "circuit-mapped.test"}}
+	e.Breaker = NewCircuitBreaker(&CircuitConfig{FailThreshold: 2, OpenWait: time.Minute})
+	// exchange mapper returns a business error for the 503 body
+	e.MapApiError = func(api *Entry, status int, content string) *errs.Error {
+		return errs.NewMsg(errs.CodeExchangeError, "busy")
+	}
+	for i := 0; i < 2; i++ {
+		res := e.RequestApiRetryAdv(context.Background(), "ping", nil, 0, false, false)
+		if res.Error == nil || res.Error.Code != errs.CodeExchangeError {
+			t.Fatalf("expect mapped error, got %v", res.Error)
+		}
+	}
+	if e.Breaker.State("circuit-mapped.test") != CircuitOpen {
+		t.Fatalf("5xx status should open circuit even if mapped to business error")
+	}
+}
@@ -0,0 +1,77 @@
+package banexg
+
+import (
+	"sync/atomic"
+
+	"github.com/banbox/bntp"
+)
+
+/*
+Clock
+source of the current 13 digit timestamp for an Exchange. Set Exchange.Clock (or OptClock) to control
+the time seen by staleness checks, subscription timeouts and strategies, e.g. in replay or tests.
+Exchange的当前13位毫秒时间戳来源。设置Exchange.Clock（或OptClock）可控制过期检查、订阅超时和策略看到的时间，用于回放或测试
+*/
+type Clock interface {
+	Now() int64
+}
+
+// WallClock the real time synced by bntp 由bntp校准的真实时间
+type WallClock struct{}
+
+func (WallClock) Now() int64 {
+	return bntp.UTCStamp()
+}
+
+/*
+FixedClock
+a manual clock only changed by Set or Add, safe for concurrent use
+只通过Set或Add改变的手动时钟，可并发使用
+*/
+type FixedClock struct {
+	ms atomic.Int64
+}
+
+func NewFixedClock(ms int64) *FixedClock {
+	c := &FixedClock{}
+	c.ms.Store(ms)
+	return c
+}
+
+func (c *FixedClock) Now() int64 {
+	return c.ms.Load()
+}
+
+func (c *FixedClock) Set(ms int64) {
+	c.ms.Store(ms)
+}
+
+// Add move the clock by ms and return the new time 将时钟移动ms毫秒并返回新时间
+func (c *FixedClock) Add(ms int64) int64 {
+	return c.ms.Add(ms)
+}
+
+/*
+ReplayClock
+a clock driven by replayed websocket messages, Now returns the time of the last replayed message.
+It's installed by SetReplay and advanced by ReplayOne/ReplayAll.
+由回放的websocket消息驱动的时钟，Now返回最后回放消息的时间。由SetReplay安装，ReplayOne/ReplayAll推进
+*/
+type ReplayClock struct {
+	ms atomic.Int64
+}
+
+func (c *ReplayClock) Now() int64 {
+	return c.ms.Load()
+}
+
+// Advance set the clock to ms, ignore if ms is older, so slightly shuffled messages don't move time backwards
+// 将时钟推进到ms，ms更早时忽略，避免轻微乱序的消息使时间倒退
+func (c *ReplayClock) Advance(ms int64) {
+	for {
+		old := c.ms.Load()
+		if ms <= old || c.ms.CompareAndSwap(old, ms) {
+			return
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package banexg
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/banbox/banexg/errs"
+)
+
+func TestReplayClock(t *testing.T) {
+	clock := &ReplayClock{}
+	clock.Advance(1000)
+	clock.Advance(900)
+	if clock.Now() != 1000 {
+		t.Fatalf("replay clock should not move backwards, got %d", clock.Now())
+	}
+	clock.Advance(1200)
+	if clock.Now() != 1200 {
+		t.Fatalf("expect 1200, got %d", clock.Now())
+	}
+	fixed := NewFixedClock(100)
+	if fixed.Add(50) != 150 || fixed.Now() != 150 {
+		t.Fatalf("fixed clock add fail: %d", fixed.Now())
+	}
+}
+
+func TestClockSubsTimeout(t *testing.T) {
+	clock := NewFixedClock(10000)
+	exg := &Exchange{ExgInfo: &ExgInfo{ID: "test"}, Clock: clock}
+	client := &WsClient{
+		Exg:           exg,
+		SubscribeKeys: map[string]int{"btcusdt@depth": 1},
+		SubsKeyStamps: map[string]int64{},
+		subsKeyMap:    map[string]string{},
+	}
+	client.SetSubsKeyStamp("btcusdt@depth", exg.MilliSeconds())
+	clock.Add(3000)
+	stats := client.GetConnSubStats(5000)
+	if len(stats[1].Timeouts) != 0 {
+		t.Fatalf("should not timeout: %v", stats[1].Timeouts)
+	}
+	clock.Add(3000)
+	stats = client.GetConnSubStats(5000)
+	if stats[1].Timeouts["btcusdt@depth"] != 6000 {
+		t.Fatalf("should timeout by 6000ms: %v", stats[1].Timeouts)
+	}
+}
+
+func TestReplayMilliSeconds(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ws.dump")
+	w, err := CreateWsDump(path, &WsDumpHeader{Exchange: "test"})
+	if err != nil {
+		t.Fatalf("create dump fail: %v", err)
+	}
+	_ = w.Write(makeWsLogs(0, 10))
+	_ = w.Close()
+
+	fixed := NewFixedClock(5)
+	exg := &Exchange{ExgInfo: &ExgInfo{ID: "test"}, Clock: fixed}
+	var stamps []int64
+	exg.WsReplayFn = map[string]func(item *WsLog) *errs.Error{
+		"wsMsg": func(item *WsLog) *errs.Error {
+			stamps = append(stamps, exg.MilliSeconds())
+			return nil
+		},
+	}
+	if err = exg.SetReplay(path, 0, 0); err != nil {
+		t.Fatalf("set replay fail: %v", err)
+	}
+	for exg.GetReplayTo() < 1050 {
+		if err = exg.ReplayOne(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(stamps) != 5 || stamps[0] != 1000 || stamps[4] != 1040 || exg.MilliSeconds() != 1040 {
+		t.Fatalf("MilliSeconds should follow replay: %v", stamps)
+	}
+	_ = exg.SetReplay("", 0, 0)
+	if exg.Clock != fixed || exg.MilliSeconds() != 5 {
+		t.Fatalf("clock should be restored after replay")
+	}
+}
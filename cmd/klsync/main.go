@@ -0,0 +1,68 @@
+/*
+klsync download klines into local kline store, resuming from the last stored kline.
+klsync下载K线到本地K线存储，从最后存储的K线继续。
+
+	go run ./cmd/klsync -exg binance -market linear -symbols BTC/USDT:USDT,ETH/USDT:USDT -tfs 1m,1h -start 2024-01-01 -dir ./klines
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/banbox/banexg"
+	"github.com/banbox/banexg/bex"
+	"github.com/banbox/banexg/klstore"
+)
+
+func main() {
+	exgName := flag.String("exg", "binance", "exchange name")
+	market := flag.String("market", banexg.MarketSpot, "market type: spot/linear/inverse")
+	symbols := flag.String("symbols", "", "comma separated symbols")
+	tfs := flag.String("tfs", "1m", "comma separated timeframes")
+	start := flag.String("start", "", "start date for empty store, 2006-01-02")
+	dir := flag.String("dir", "klines", "store directory")
+	flag.Parse()
+	if *symbols == "" {
+		fail("symbols is required")
+	}
+	var startMS int64
+	if *start != "" {
+		date, err := time.Parse("2006-01-02", *start)
+		if err != nil {
+			fail("invalid start: %v", err)
+		}
+		startMS = date.UnixMilli()
+	}
+	exg, err := bex.New(*exgName, map[string]interface{}{banexg.OptMarketType: *market})
+	if err != nil {
+		fail("create exchange fail: %v", err)
+	}
+	defer exg.Close()
+	if _, err = exg.LoadMarkets(false, nil); err != nil {
+		fail("load markets fail: %v", err)
+	}
+	store, err := klstore.Open(*dir)
+	if err != nil {
+		fail("open store fail: %v", err)
+	}
+	defer store.Close()
+	for _, symbol := range strings.Split(*symbols, ",") {
+		for _, tf := range strings.Split(*tfs, ",") {
+			num, err := store.Sync(exg, symbol, tf, startMS, nil)
+			if err != nil {
+				fmt.Printf("sync %s %s fail after %d klines: %v\n", symbol, tf, num, err)
+				continue
+			}
+			fmt.Printf("sync %s %s done, %d klines added\n", symbol, tf, num)
+		}
+	}
+}
+
+func fail(msg string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, msg+"\n", args...)
+	os.Exit(1)
+}
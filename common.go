@@ -118,8 +118,7 @@ func (b *OrderBook) SetSide(text string, isBuy, replace bool) {
 			sizes[i], _ = strconv.ParseFloat(row[1], 64)
 		}
 		side.Lock.Lock()
-		side.Price = prices
-		side.Size = sizes
+		side.load(prices, sizes)
 		side.Lock.Unlock()
 	} else {
 		var valArr = make([][2]float64, len(arr))
@@ -137,56 +136,99 @@ func NewOdBookSide(isBuy bool, depth int, deltas [][2]float64) *OdBookSide {
 	obs := &OdBookSide{
 		IsBuy: isBuy,
 		Depth: depth,
-		Price: make([]float64, 0, len(deltas)),
-		Size:  make([]float64, 0, len(deltas)),
 	}
 	obs.Update(deltas)
 	return obs
 }
 
 func (obs *OdBookSide) Update(deltas [][2]float64) {
-	obs.Lock.Lock()
-	for _, delta := range deltas {
-		obs.Set(delta[0], delta[1])
+	obs.update(deltas, nil)
+}
+
+// update apply deltas with optional raw strings (same index), then trim to Depth
+func (obs *OdBookSide) update(deltas [][2]float64, texts [][2]string) {
+	if len(texts) != len(deltas) {
+		texts = nil
 	}
-	for len(obs.Price) > obs.Depth {
-		obs.Size = obs.Size[:obs.Depth]
-		obs.Price = obs.Price[:obs.Depth]
+	obs.Lock.Lock()
+	for i, delta := range deltas {
+		var text [2]string
+		if texts != nil {
+			text = texts[i]
+		}
+		obs.set(delta[0], delta[1], text)
 	}
+	obs.trim(obs.Depth)
 	obs.Lock.Unlock()
 }
 
+/*
+Set
+update size of price, size<=0 removes the level. Should be called with Lock held; Depth is applied on next Update
+设置价格档位数量，size<=0删除该档。需在持有Lock时调用；Depth在下次Update时生效
+*/
 func (obs *OdBookSide) Set(price, size float64) {
-	oldLen := len(obs.Price)
-	prices := obs.Price
-	var index int
-	if obs.IsBuy {
-		// desc order
-		index = sort.Search(oldLen, func(i int) bool {
-			return prices[i] <= price
-		})
-	} else {
-		// asc order
-		index = sort.Search(oldLen, func(i int) bool {
-			return prices[i] >= price
-		})
-	}
-	if size > 0 {
-		if index < oldLen && prices[index] == price {
-			obs.Size[index] = size
-		} else {
-			obs.Price = append(prices, 0)
-			copy(obs.Price[index+1:], prices[index:])
-			obs.Price[index] = price
-
-			obs.Size = append(obs.Size, 0)
-			copy(obs.Size[index+1:], obs.Size[index:])
-			obs.Size[index] = size
-		}
-	} else if index < oldLen && prices[index] == price {
-		obs.Price = append(prices[:index], prices[index+1:]...)
-		obs.Size = append(obs.Size[:index], obs.Size[index+1:]...)
+	obs.set(price, size, [2]string{})
+}
+
+// Len return number of levels 档位数量
+func (obs *OdBookSide) Len() int {
+	obs.Lock.RLock()
+	defer obs.Lock.RUnlock()
+	return obs.count
+}
+
+// Levels return a copy of top n prices and sizes, n<=0 means all 返回前n档价格和数量的副本，n<=0表示全部
+func (obs *OdBookSide) Levels(n int) ([]float64, []float64) {
+	obs.Lock.RLock()
+	defer obs.Lock.RUnlock()
+	num := obs.count
+	if n > 0 && n < num {
+		num = n
+	}
+	prices := make([]float64, 0, num)
+	sizes := make([]float64, 0, num)
+	for lvl := obs.first(); lvl != nil && len(prices) < num; lvl = lvl.next[0] {
+		prices = append(prices, lvl.price)
+		sizes = append(sizes, lvl.size)
+	}
+	return prices, sizes
+}
+
+// Prices return a copy of all prices, bid: desc   ask: asc
+func (obs *OdBookSide) Prices() []float64 {
+	prices, _ := obs.Levels(0)
+	return prices
+}
+
+// Sizes return a copy of all sizes, same order as Prices
+func (obs *OdBookSide) Sizes() []float64 {
+	_, sizes := obs.Levels(0)
+	return sizes
+}
+
+type odBookSideJson struct {
+	IsBuy bool      `json:"is_buy"`
+	Price []float64 `json:"price"`
+	Size  []float64 `json:"size"`
+	Depth int       `json:"depth"`
+}
+
+func (obs *OdBookSide) MarshalJSON() ([]byte, error) {
+	prices, sizes := obs.Levels(0)
+	return utils.Marshal(&odBookSideJson{IsBuy: obs.IsBuy, Price: prices, Size: sizes, Depth: obs.Depth})
+}
+
+func (obs *OdBookSide) UnmarshalJSON(data []byte) error {
+	var res odBookSideJson
+	if err := utils.Unmarshal(data, &res, utils.JsonNumDefault); err != nil {
+		return err
 	}
+	obs.Lock.Lock()
+	obs.IsBuy, obs.Depth = res.IsBuy, res.Depth
+	obs.load(res.Price, res.Size)
+	obs.Lock.Unlock()
+	return nil
 }
 
 /*
@@ -197,23 +239,23 @@ func (obs *OdBookSide) SumVolTo(price float64) (float64, float64) {
 	if obs.IsBuy {
 		dirt = float64(-1)
 	}
-	if len(obs.Price) == 0 {
+	obs.Lock.RLock()
+	defer obs.Lock.RUnlock()
+	lvl := obs.first()
+	if lvl == nil {
 		return 0, 1
 	}
-	obs.Lock.Lock()
 	volSum := float64(0)
 	lastPrice := float64(0)
-	firstPrice := obs.Price[0]
-	for i, p := range obs.Price {
-		lastPrice = p
-		priceDiff := p - price
+	firstPrice := lvl.price
+	for ; lvl != nil; lvl = lvl.next[0] {
+		lastPrice = lvl.price
+		priceDiff := lvl.price - price
 		if priceDiff*dirt >= 0 {
-			obs.Lock.Unlock()
 			return volSum, 1
 		}
-		volSum += obs.Size[i]
+		volSum += lvl.size
 	}
-	obs.Lock.Unlock()
 	return volSum, math.Abs(lastPrice-firstPrice) / math.Abs(price-firstPrice)
 }
 
@@ -223,14 +265,15 @@ return price&size for given level (i is started from 0)
 */
 func (obs *OdBookSide) Level(i int) (float64, float64) {
 	var price, amount = float64(0), float64(0)
-	obs.Lock.Lock()
-	if len(obs.Price) > i {
-		price = obs.Price[i]
+	obs.Lock.RLock()
+	lvl := obs.first()
+	for ; lvl != nil && i > 0; i-- {
+		lvl = lvl.next[0]
 	}
-	if len(obs.Size) > i {
-		amount = obs.Size[i]
+	if lvl != nil {
+		price, amount = lvl.price, lvl.size
 	}
-	obs.Lock.Unlock()
+	obs.Lock.RUnlock()
 	return price, amount
 }
 
@@ -239,15 +282,13 @@ AvgPrice
 return average price, filled rate, change rate of first & last
 */
 func (obs *OdBookSide) AvgPrice(volume float64) (float64, float64, float64) {
-	obs.Lock.Lock()
-	prices, sizes := obs.Price, obs.Size
-	obs.Lock.Unlock()
+	obs.Lock.RLock()
+	defer obs.Lock.RUnlock()
 	volSum, lastPrice, cost := float64(0), float64(0), float64(0)
-	for i, price := range prices {
-		size := sizes[i]
-		volSum += size
-		lastPrice = price
-		cost += size * price
+	for lvl := obs.first(); lvl != nil; lvl = lvl.next[0] {
+		volSum += lvl.size
+		lastPrice = lvl.price
+		cost += lvl.size * lvl.price
 		if volSum >= volume {
 			break
 		}
@@ -255,7 +296,7 @@ func (obs *OdBookSide) AvgPrice(volume float64) (float64, float64, float64) {
 	if volSum == 0 {
 		return 0, 0, 0
 	}
-	price0 := prices[0]
+	price0 := obs.first().price
 	if volSum < volume {
 		lastPrice = price0 + (lastPrice-price0)*volume/volSum
 		chgRate := math.Abs(lastPrice-price0) / price0
@@ -290,10 +331,8 @@ func (b *OrderBook) Reset() {
 	b.Asks.Lock.Lock()
 	b.Bids.Lock.Lock()
 	b.Nonce = 0
-	b.Bids.Size = nil
-	b.Bids.Price = nil
-	b.Asks.Size = nil
-	b.Asks.Price = nil
+	b.Bids.clear()
+	b.Asks.clear()
 	b.Cache = nil
 	b.Bids.Lock.Unlock()
 	b.Asks.Lock.Unlock()
@@ -303,12 +342,12 @@ func (b *OrderBook) Update(book *OrderBook) {
 	b.TimeStamp = book.TimeStamp
 	b.Nonce = book.Nonce
 	b.Cache = nil
+	askPrices, askSizes := book.Asks.Levels(0)
+	bidPrices, bidSizes := book.Bids.Levels(0)
 	b.Asks.Lock.Lock()
 	b.Bids.Lock.Lock()
-	b.Asks.Price = book.Asks.Price
-	b.Asks.Size = book.Asks.Size
-	b.Bids.Price = book.Bids.Price
-	b.Bids.Size = book.Bids.Size
+	b.Asks.load(askPrices, askSizes)
+	b.Bids.load(bidPrices, bidSizes)
 	b.Bids.Lock.Unlock()
 	b.Asks.Lock.Unlock()
 }
@@ -470,6 +509,24 @@ func GetHostFlowChan(host string) chan struct{} {
 	return out
 }
 
+/*
+changeHostQueue
+update the number of requests waiting for the semaphore of host, and report to hook
+*/
+func changeHostQueue(host string, num int, hook MetricsHook) {
+	hostFlowLock.Lock()
+	depth := hostQueueNums[host] + num
+	if depth <= 0 {
+		delete(hostQueueNums, host)
+	} else {
+		hostQueueNums[host] = depth
+	}
+	hostFlowLock.Unlock()
+	if hook != nil {
+		hook.OnHostQueue(host, depth)
+	}
+}
+
 type BoolFmt int
 
 const (
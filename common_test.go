@@ -2,7 +2,11 @@ package banexg
 
 import (
 	"fmt"
+	"math/rand"
+	"slices"
 	"testing"
+
+	"github.com/banbox/banexg/utils"
 )
 
 func TestSliceInsert(t *testing.T) {
@@ -45,3 +49,154 @@ func TestOdBookSide(t *testing.T) {
 		t.Errorf("SumVolTo fail")
 	}
 }
+
+func TestOdBookSideUpdate(t *testing.T) {
+	for _, isBuy := range []bool{true, false} {
+		init, batches := genBookDeltas(300, 40, 200)
+		side := NewOdBookSide(isBuy, 300, init)
+		levels := make(map[float64]float64)
+		for _, d := range init {
+			levels[d[0]] = d[1]
+		}
+		for n, deltas := range batches {
+			side.Update(deltas)
+			for _, d := range deltas {
+				if d[1] > 0 {
+					levels[d[0]] = d[1]
+				} else {
+					delete(levels, d[0])
+				}
+			}
+			prices := make([]float64, 0, len(levels))
+			for p := range levels {
+				prices = append(prices, p)
+			}
+			slices.Sort(prices)
+			if isBuy {
+				slices.Reverse(prices)
+			}
+			if len(prices) > 300 {
+				for _, p := range prices[300:] {
+					delete(levels, p)
+				}
+				prices = prices[:300]
+			}
+			sizes := make([]float64, len(prices))
+			for i, p := range prices {
+				sizes[i] = levels[p]
+			}
+			if !slices.Equal(side.Prices(), prices) || !slices.Equal(side.Sizes(), sizes) {
+				t.Fatalf("isBuy=%v batch %d: levels mismatch", isBuy, n)
+			}
+		}
+	}
+}
+
+func TestOdBookSideJson(t *testing.T) {
+	side := NewOdBookSide(false, 10, [][2]float64{{102, 3}, {101, 2}, {103, 0}})
+	data, err := utils.Marshal(side)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"is_buy":false,"price":[101,102],"size":[2,3],"depth":10}` {
+		t.Fatalf("unexpected json: %s", data)
+	}
+	var res OdBookSide
+	if err = utils.Unmarshal(data, &res, utils.JsonNumDefault); err != nil {
+		t.Fatal(err)
+	}
+	res.Set(100, 1)
+	if !slices.Equal(res.Prices(), []float64{100, 101, 102}) || res.Depth != 10 || res.IsBuy {
+		t.Fatalf("unexpected side: %v", res.Prices())
+	}
+}
+
+// genBookDeltas generate batches of bid deltas clustered near the top of book, 15% of them are deletes
+func genBookDeltas(levels, batch, num int) ([][2]float64, [][][2]float64) {
+	rnd := rand.New(rand.NewSource(1))
+	const mid, tick = 10000.0, 0.1
+	init := make([][2]float64, levels)
+	for i := range init {
+		init[i] = [2]float64{mid - float64(i+1)*tick, 1 + rnd.Float64()*10}
+	}
+	res := make([][][2]float64, num)
+	for i := range res {
+		deltas := make([][2]float64, batch)
+		for j := range deltas {
+			idx := int(rnd.ExpFloat64()*float64(levels)/8) % (levels + levels/10)
+			size := 0.0
+			if rnd.Intn(100) >= 15 {
+				size = 1 + rnd.Float64()*10
+			}
+			deltas[j] = [2]float64{mid - float64(idx+1)*tick, size}
+		}
+		res[i] = deltas
+	}
+	return init, res
+}
+
+func BenchmarkOdBookSideUpdate(b *testing.B) {
+	for _, levels := range []int{200, 1000, 5000} {
+		for _, batch := range []int{1, 20, 200} {
+			b.Run(fmt.Sprintf("levels=%d/batch=%d", levels, batch), func(b *testing.B) {
+				init, batches := genBookDeltas(levels, batch, 1024)
+				side := NewOdBookSide(true, levels, init)
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					side.Update(batches[i%len(batches)])
+				}
+				b.ReportMetric(float64(b.N*batch)/b.Elapsed().Seconds(), "deltas/s")
+			})
+		}
+	}
+}
+
+// BenchmarkOdBookSideUpdateTexts same as levels=1000 above, with raw strings kept for checksum
+func BenchmarkOdBookSideUpdateTexts(b *testing.B) {
+	for _, batch := range []int{1, 20, 200} {
+		b.Run(fmt.Sprintf("batch=%d", batch), func(b *testing.B) {
+			init, batches := genBookDeltas(1000, batch, 1024)
+			texts := make([][][2]string, len(batches))
+			for i, deltas := range batches {
+				texts[i] = make([][2]string, len(deltas))
+				for j, d := range deltas {
+					texts[i][j] = [2]string{fmtBookNum(d[0]), fmtBookNum(d[1])}
+				}
+			}
+			side := NewOdBookSide(true, 1000, init)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				side.update(batches[i%len(batches)], texts[i%len(texts)])
+			}
+			b.ReportMetric(float64(b.N*batch)/b.Elapsed().Seconds(), "deltas/s")
+		})
+	}
+}
+
+func BenchmarkOdBookSideRead(b *testing.B) {
+	init, batches := genBookDeltas(1000, 20, 1024)
+	side := NewOdBookSide(true, 1000, init)
+	stop := make(chan struct{})
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+				side.Update(batches[i%len(batches)])
+			}
+		}
+	}()
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			side.Level(0)
+			side.AvgPrice(50)
+		}
+	})
+	b.StopTimer()
+	close(stop)
+}
@@ -0,0 +1,784 @@
+package composite
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/banbox/banexg"
+	"github.com/banbox/banexg/errs"
+	"github.com/banbox/banexg/utils"
+)
+
+// QualSymbol return exchange-qualified symbol, e.g. binance@BTC/USDT
+func QualSymbol(exgName, symbol string) string {
+	return exgName + SymbolSep + symbol
+}
+
+/*
+SplitSymbol
+split exchange-qualified symbol into exchange name and raw symbol, exgName is empty for raw symbol
+将带交易所前缀的symbol拆分为交易所名称和原始symbol，无前缀时exgName为空
+*/
+func SplitSymbol(symbol string) (string, string) {
+	if idx := strings.Index(symbol, SymbolSep); idx > 0 {
+		return symbol[:idx], symbol[idx+len(SymbolSep):]
+	}
+	return "", symbol
+}
+
+/*
+route
+find exchange for symbol or params[ParamExchange], fallback to default exchange.
+return exchange name, exchange, raw symbol, and params copy without ParamExchange
+根据symbol或params[ParamExchange]查找交易所，未指定时使用默认交易所
+*/
+func (c *Composite) route(symbol string, params map[string]interface{}) (string, banexg.BanExchange, string, map[string]interface{}, *errs.Error) {
+	args := utils.SafeParams(params)
+	name, raw := SplitSymbol(symbol)
+	paraName := utils.PopMapVal(args, ParamExchange, "")
+	if name == "" {
+		name = paraName
+	} else if paraName != "" && paraName != name {
+		return "", nil, "", nil, errs.NewMsg(errs.CodeParamInvalid, "exchange conflict: %s, %s", symbol, paraName)
+	}
+	if name == "" {
+		name = c.Default
+	}
+	exg, ok := c.Exgs[name]
+	if !ok {
+		return "", nil, "", nil, errs.NewMsg(errs.CodeParamInvalid, "unknown exchange: %s", name)
+	}
+	return name, exg, raw, args, nil
+}
+
+/*
+groupSymbols
+group symbols by exchange, raw symbols belong to params[ParamExchange] or default exchange.
+return exchange name: raw symbols, and params copy without ParamExchange
+按交易所分组symbol，无前缀的属于params[ParamExchange]或默认交易所
+*/
+func (c *Composite) groupSymbols(symbols []string, params map[string]interface{}) (map[string][]string, map[string]interface{}, *errs.Error) {
+	args := utils.SafeParams(params)
+	defName := utils.PopMapVal(args, ParamExchange, c.Default)
+	res := make(map[string][]string)
+	for _, symbol := range symbols {
+		name, raw := SplitSymbol(symbol)
+		if name == "" {
+			name = defName
+		}
+		if _, ok := c.Exgs[name]; !ok {
+			return nil, nil, errs.NewMsg(errs.CodeParamInvalid, "unknown exchange: %s", name)
+		}
+		res[name] = append(res[name], raw)
+	}
+	return res, args, nil
+}
+
+/*
+targets
+exchanges for calls without symbol: the group of symbols if not empty, or params[ParamExchange], or all exchanges
+无symbol调用的目标交易所：symbols非空时按分组；否则为params[ParamExchange]或全部交易所
+*/
+func (c *Composite) targets(symbols []string, params map[string]interface{}) ([]string, map[string][]string, map[string]interface{}, *errs.Error) {
+	if len(symbols) > 0 {
+		groups, args, err := c.groupSymbols(symbols, params)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		names := make([]string, 0, len(groups))
+		for name := range groups {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return names, groups, args, nil
+	}
+	args := utils.SafeParams(params)
+	name := utils.PopMapVal(args, ParamExchange, "")
+	if name == "" {
+		return c.Names, nil, args, nil
+	}
+	if _, ok := c.Exgs[name]; !ok {
+		return nil, nil, nil, errs.NewMsg(errs.CodeParamInvalid, "unknown exchange: %s", name)
+	}
+	return []string{name}, nil, args, nil
+}
+
+func qualOrder(name string, od *banexg.Order) *banexg.Order {
+	if od == nil {
+		return nil
+	}
+	res := *od
+	res.Symbol = QualSymbol(name, od.Symbol)
+	return &res
+}
+
+func qualOrders(name string, ods []*banexg.Order) []*banexg.Order {
+	res := make([]*banexg.Order, 0, len(ods))
+	for _, od := range ods {
+		res = append(res, qualOrder(name, od))
+	}
+	return res
+}
+
+func qualPositions(name string, items []*banexg.Position) []*banexg.Position {
+	res := make([]*banexg.Position, 0, len(items))
+	for _, p := range items {
+		pos := *p
+		pos.Symbol = QualSymbol(name, p.Symbol)
+		res = append(res, &pos)
+	}
+	return res
+}
+
+func qualMarket(name string, m *banexg.Market) *banexg.Market {
+	res := *m
+	res.Symbol = QualSymbol(name, m.Symbol)
+	return &res
+}
+
+/*
+LoadMarkets
+load markets of all exchanges, keys of result are exchange-qualified symbols
+加载所有交易所的市场，返回的键为带交易所前缀的symbol
+*/
+func (c *Composite) LoadMarkets(reload bool, params map[string]interface{}) (banexg.MarketMap, *errs.Error) {
+	names, _, args, err := c.targets(nil, params)
+	if err != nil {
+		return nil, err
+	}
+	res := make(banexg.MarketMap)
+	for _, name := range names {
+		markets, err := c.Exgs[name].LoadMarkets(reload, args)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range markets {
+			res[QualSymbol(name, m.Symbol)] = qualMarket(name, m)
+		}
+	}
+	return res, nil
+}
+
+func (c *Composite) GetCurMarkets() banexg.MarketMap {
+	res := make(banexg.MarketMap)
+	for _, name := range c.Names {
+		for _, m := range c.Exgs[name].GetCurMarkets() {
+			res[QualSymbol(name, m.Symbol)] = qualMarket(name, m)
+		}
+	}
+	return res
+}
+
+// GetMarket return a market copy with exchange-qualified symbol
+func (c *Composite) GetMarket(symbol string) (*banexg.Market, *errs.Error) {
+	name, exg, raw, _, err := c.route(symbol, nil)
+	if err != nil {
+		return nil, err
+	}
+	m, err := exg.GetMarket(raw)
+	if err != nil {
+		return nil, err
+	}
+	return qualMarket(name, m), nil
+}
+
+/*
+MapMarket
+map exchange id of market to a market copy with exchange-qualified symbol. rawID can be qualified as binance@BTCUSDT,
+otherwise the default exchange is used.
+根据交易所的市场ID返回带交易所前缀symbol的市场副本。rawID可带交易所前缀如binance@BTCUSDT，否则使用默认交易所
+*/
+func (c *Composite) MapMarket(rawID string, year int) (*banexg.Market, *errs.Error) {
+	name, exg, raw, _, err := c.route(rawID, nil)
+	if err != nil {
+		return nil, err
+	}
+	m, err := exg.MapMarket(raw, year)
+	if err != nil {
+		return nil, err
+	}
+	return qualMarket(name, m), nil
+}
+
+// GetMarketById same as MapMarket, return nil if not found 同MapMarket，未找到时返回nil
+func (c *Composite) GetMarketById(marketId, marketType string) *banexg.Market {
+	name, exg, raw, _, err := c.route(marketId, nil)
+	if err != nil {
+		return nil
+	}
+	getter, ok := exg.(interface {
+		GetMarketById(marketId, marketType string) *banexg.Market
+	})
+	if !ok {
+		return nil
+	}
+	m := getter.GetMarketById(raw, marketType)
+	if m == nil {
+		return nil
+	}
+	return qualMarket(name, m)
+}
+
+func (c *Composite) CheckSymbols(symbols ...string) ([]string, []string) {
+	valids := make([]string, 0, len(symbols))
+	fails := make([]string, 0)
+	for _, symbol := range symbols {
+		if _, err := c.GetMarket(symbol); err != nil {
+			fails = append(fails, symbol)
+		} else {
+			valids = append(valids, symbol)
+		}
+	}
+	return valids, fails
+}
+
+func (c *Composite) FetchTicker(symbol string, params map[string]interface{}) (*banexg.Ticker, *errs.Error) {
+	name, exg, raw, args, err := c.route(symbol, params)
+	if err != nil {
+		return nil, err
+	}
+	res, err := exg.FetchTicker(raw, args)
+	if err != nil {
+		return nil, err
+	}
+	item := *res
+	item.Symbol = QualSymbol(name, res.Symbol)
+	return &item, nil
+}
+
+/*
+FetchTickers
+fetch tickers grouped by exchange; all exchanges are requested when symbols is empty
+按交易所分组获取ticker；symbols为空时请求所有交易所
+*/
+func (c *Composite) FetchTickers(symbols []string, params map[string]interface{}) ([]*banexg.Ticker, *errs.Error) {
+	names, groups, args, err := c.targets(symbols, params)
+	if err != nil {
+		return nil, err
+	}
+	var res []*banexg.Ticker
+	for _, name := range names {
+		items, err := c.Exgs[name].FetchTickers(groups[name], args)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range items {
+			item := *t
+			item.Symbol = QualSymbol(name, t.Symbol)
+			res = append(res, &item)
+		}
+	}
+	return res, nil
+}
+
+func (c *Composite) FetchTickerPrice(symbol string, params map[string]interface{}) (map[string]float64, *errs.Error) {
+	var names []string
+	var args map[string]interface{}
+	var err *errs.Error
+	if symbol == "" {
+		names, _, args, err = c.targets(nil, params)
+	} else {
+		var name string
+		name, _, symbol, args, err = c.route(symbol, params)
+		names = []string{name}
+	}
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]float64)
+	for _, name := range names {
+		prices, err := c.Exgs[name].FetchTickerPrice(symbol, args)
+		if err != nil {
+			return nil, err
+		}
+		for key, price := range prices {
+			res[QualSymbol(name, key)] = price
+		}
+	}
+	return res, nil
+}
+
+func (c *Composite) FetchLastPrices(symbols []string, params map[string]interface{}) ([]*banexg.LastPrice, *errs.Error) {
+	names, groups, args, err := c.targets(symbols, params)
+	if err != nil {
+		return nil, err
+	}
+	var res []*banexg.LastPrice
+	for _, name := range names {
+		items, err := c.Exgs[name].FetchLastPrices(groups[name], args)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range items {
+			item := *p
+			item.Symbol = QualSymbol(name, p.Symbol)
+			res = append(res, &item)
+		}
+	}
+	return res, nil
+}
+
+func (c *Composite) FetchOHLCV(symbol, timeframe string, since int64, limit int, params map[string]interface{}) ([]*banexg.Kline, *errs.Error) {
+	_, exg, raw, args, err := c.route(symbol, params)
+	if err != nil {
+		return nil, err
+	}
+	return exg.FetchOHLCV(raw, timeframe, since, limit, args)
+}
+
+func (c *Composite) FetchOrderBook(symbol string, limit int, params map[string]interface{}) (*banexg.OrderBook, *errs.Error) {
+	name, exg, raw, args, err := c.route(symbol, params)
+	if err != nil {
+		return nil, err
+	}
+	book, err := exg.FetchOrderBook(raw, limit, args)
+	if err != nil {
+		return nil, err
+	}
+	return qualBook(name, book), nil
+}
+
+func (c *Composite) FetchFundingRate(symbol string, params map[string]interface{}) (*banexg.FundingRateCur, *errs.Error) {
+	name, exg, raw, args, err := c.route(symbol, params)
+	if err != nil {
+		return nil, err
+	}
+	res, err := exg.FetchFundingRate(raw, args)
+	if err != nil {
+		return nil, err
+	}
+	item := *res
+	item.Symbol = QualSymbol(name, res.Symbol)
+	return &item, nil
+}
+
+func (c *Composite) FetchFundingRates(symbols []string, params map[string]interface{}) ([]*banexg.FundingRateCur, *errs.Error) {
+	names, groups, args, err := c.targets(symbols, params)
+	if err != nil {
+		return nil, err
+	}
+	var res []*banexg.FundingRateCur
+	for _, name := range names {
+		items, err := c.Exgs[name].FetchFundingRates(groups[name], args)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range items {
+			item := *r
+			item.Symbol = QualSymbol(name, r.Symbol)
+			res = append(res, &item)
+		}
+	}
+	return res, nil
+}
+
+func (c *Composite) FetchFundingRateHistory(symbol string, since int64, limit int, params map[string]interface{}) ([]*banexg.FundingRate, *errs.Error) {
+	name, exg, raw, args, err := c.route(symbol, params)
+	if err != nil {
+		return nil, err
+	}
+	items, err := exg.FetchFundingRateHistory(raw, since, limit, args)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*banexg.FundingRate, 0, len(items))
+	for _, r := range items {
+		item := *r
+		item.Symbol = QualSymbol(name, r.Symbol)
+		res = append(res, &item)
+	}
+	return res, nil
+}
+
+func (c *Composite) FetchOrder(symbol, id string, params map[string]interface{}) (*banexg.Order, *errs.Error) {
+	name, exg, raw, args, err := c.route(symbol, params)
+	if err != nil {
+		return nil, err
+	}
+	od, err := exg.FetchOrder(raw, id, args)
+	if err != nil {
+		return nil, err
+	}
+	return qualOrder(name, od), nil
+}
+
+func (c *Composite) FetchOrders(symbol string, since int64, limit int, params map[string]interface{}) ([]*banexg.Order, *errs.Error) {
+	name, exg, raw, args, err := c.route(symbol, params)
+	if err != nil {
+		return nil, err
+	}
+	ods, err := exg.FetchOrders(raw, since, limit, args)
+	if err != nil {
+		return nil, err
+	}
+	return qualOrders(name, ods), nil
+}
+
+/*
+FetchOpenOrders
+open orders of all exchanges are merged when symbol is empty and no params[ParamExchange]
+symbol为空且未指定params[ParamExchange]时合并所有交易所的挂单
+*/
+func (c *Composite) FetchOpenOrders(symbol string, since int64, limit int, params map[string]interface{}) ([]*banexg.Order, *errs.Error) {
+	var names []string
+	var args map[string]interface{}
+	var err *errs.Error
+	if symbol == "" {
+		names, _, args, err = c.targets(nil, params)
+	} else {
+		var name string
+		name, _, symbol, args, err = c.route(symbol, params)
+		names = []string{name}
+	}
+	if err != nil {
+		return nil, err
+	}
+	var res []*banexg.Order
+	for _, name := range names {
+		ods, err := c.Exgs[name].FetchOpenOrders(symbol, since, limit, args)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, qualOrders(name, ods)...)
+	}
+	return res, nil
+}
+
+/*
+FetchBalance
+merge balances of all exchanges (or params[ParamExchange]) by currency code,
+balances of each exchange are kept in Info with exchange name as key
+按币种合并所有交易所（或params[ParamExchange]）的余额，各交易所的余额以交易所名称为键保存在Info中
+*/
+func (c *Composite) FetchBalance(params map[string]interface{}) (*banexg.Balances, *errs.Error) {
+	names, _, args, err := c.targets(nil, params)
+	if err != nil {
+		return nil, err
+	}
+	res := &banexg.Balances{
+		Free:   make(map[string]float64),
+		Used:   make(map[string]float64),
+		Total:  make(map[string]float64),
+		Assets: make(map[string]*banexg.Asset),
+		Info:   make(map[string]interface{}),
+	}
+	for _, name := range names {
+		bal, err := c.Exgs[name].FetchBalance(args)
+		if err != nil {
+			return nil, err
+		}
+		mergeBalance(res, bal)
+		res.Info[name] = bal
+	}
+	return res, nil
+}
+
+// mergeBalance add assets of src into dst
+func mergeBalance(dst, src *banexg.Balances) {
+	dst.TimeStamp = max(dst.TimeStamp, src.TimeStamp)
+	for code, a := range src.Assets {
+		cur, ok := dst.Assets[code]
+		if !ok {
+			cur = &banexg.Asset{Code: code}
+			dst.Assets[code] = cur
+		}
+		cur.Free += a.Free
+		cur.Used += a.Used
+		cur.Total += a.Total
+		cur.Debt += a.Debt
+		cur.UPol += a.UPol
+		dst.Free[code] = cur.Free
+		dst.Used[code] = cur.Used
+		dst.Total[code] = cur.Total
+	}
+}
+
+/*
+FetchPositions
+positions of all exchanges (or params[ParamExchange]) with exchange-qualified symbols
+所有交易所（或params[ParamExchange]）的持仓，symbol带交易所前缀
+*/
+func (c *Composite) FetchPositions(symbols []string, params map[string]interface{}) ([]*banexg.Position, *errs.Error) {
+	return c.fetchPositions(symbols, params, false)
+}
+
+func (c *Composite) FetchAccountPositions(symbols []string, params map[string]interface{}) ([]*banexg.Position, *errs.Error) {
+	return c.fetchPositions(symbols, params, true)
+}
+
+func (c *Composite) fetchPositions(symbols []string, params map[string]interface{}, isAcc bool) ([]*banexg.Position, *errs.Error) {
+	names, groups, args, err := c.targets(symbols, params)
+	if err != nil {
+		return nil, err
+	}
+	var res []*banexg.Position
+	for _, name := range names {
+		var items []*banexg.Position
+		if isAcc {
+			items, err = c.Exgs[name].FetchAccountPositions(groups[name], args)
+		} else {
+			items, err = c.Exgs[name].FetchPositions(groups[name], args)
+		}
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, qualPositions(name, items)...)
+	}
+	return res, nil
+}
+
+func (c *Composite) FetchIncomeHistory(inType string, symbol string, since int64, limit int, params map[string]interface{}) ([]*banexg.Income, *errs.Error) {
+	var names []string
+	var args map[string]interface{}
+	var err *errs.Error
+	if symbol == "" {
+		names, _, args, err = c.targets(nil, params)
+	} else {
+		var name string
+		name, _, symbol, args, err = c.route(symbol, params)
+		names = []string{name}
+	}
+	if err != nil {
+		return nil, err
+	}
+	var res []*banexg.Income
+	for _, name := range names {
+		items, err := c.Exgs[name].FetchIncomeHistory(inType, symbol, since, limit, args)
+		if err != nil {
+			return nil, err
+		}
+		for _, in := range items {
+			item := *in
+			item.Symbol = QualSymbol(name, in.Symbol)
+			res = append(res, &item)
+		}
+	}
+	return res, nil
+}
+
+func (c *Composite) CreateOrder(symbol, odType, side string, amount, price float64, params map[string]interface{}) (*banexg.Order, *errs.Error) {
+	name, exg, raw, args, err := c.route(symbol, params)
+	if err != nil {
+		return nil, err
+	}
+	od, err := exg.CreateOrder(raw, odType, side, amount, price, args)
+	if err != nil {
+		return nil, err
+	}
+	return qualOrder(name, od), nil
+}
+
+func (c *Composite) CreateOrderReq(req *banexg.OrderRequest) (*banexg.Order, *errs.Error) {
+	if req == nil {
+		return nil, errs.NewMsg(errs.CodeParamRequired, "order request is required")
+	}
+	name, exg, raw, args, err := c.route(req.Symbol, req.Extra)
+	if err != nil {
+		return nil, err
+	}
+	item := *req
+	item.Symbol = raw
+	item.Extra = args
+	od, err := exg.CreateOrderReq(&item)
+	if err != nil {
+		return nil, err
+	}
+	return qualOrder(name, od), nil
+}
+
+func (c *Composite) EditOrder(symbol, orderId, side string, amount, price float64, params map[string]interface{}) (*banexg.Order, *errs.Error) {
+	name, exg, raw, args, err := c.route(symbol, params)
+	if err != nil {
+		return nil, err
+	}
+	od, err := exg.EditOrder(raw, orderId, side, amount, price, args)
+	if err != nil {
+		return nil, err
+	}
+	return qualOrder(name, od), nil
+}
+
+func (c *Composite) CancelOrder(id string, symbol string, params map[string]interface{}) (*banexg.Order, *errs.Error) {
+	name, exg, raw, args, err := c.route(symbol, params)
+	if err != nil {
+		return nil, err
+	}
+	od, err := exg.CancelOrder(id, raw, args)
+	if err != nil {
+		return nil, err
+	}
+	return qualOrder(name, od), nil
+}
+
+func (c *Composite) SetFees(fees map[string]map[string]float64) {
+	for _, exg := range c.Exgs {
+		exg.SetFees(fees)
+	}
+}
+
+func (c *Composite) CalculateFee(symbol, odType, side string, amount float64, price float64, isMaker bool,
+	params map[string]interface{}) (*banexg.Fee, *errs.Error) {
+	_, exg, raw, args, err := c.route(symbol, params)
+	if err != nil {
+		return nil, err
+	}
+	return exg.CalculateFee(raw, odType, side, amount, price, isMaker, args)
+}
+
+func (c *Composite) SetLeverage(leverage float64, symbol string, params map[string]interface{}) (map[string]interface{}, *errs.Error) {
+	_, exg, raw, args, err := c.route(symbol, params)
+	if err != nil {
+		return nil, err
+	}
+	return exg.SetLeverage(leverage, raw, args)
+}
+
+func (c *Composite) GetLeverage(symbol string, notional float64, account string) (float64, float64) {
+	_, exg, raw, _, err := c.route(symbol, nil)
+	if err != nil {
+		return 0, 0
+	}
+	return exg.GetLeverage(raw, notional, account)
+}
+
+func (c *Composite) CalcMaintMargin(symbol string, cost float64) (float64, *errs.Error) {
+	_, exg, raw, _, err := c.route(symbol, nil)
+	if err != nil {
+		return 0, err
+	}
+	return exg.CalcMaintMargin(raw, cost)
+}
+
+func (c *Composite) LoadLeverageBrackets(reload bool, params map[string]interface{}) *errs.Error {
+	names, _, args, err := c.targets(nil, params)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err = c.Exgs[name].LoadLeverageBrackets(reload, args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Composite) InitLeverageBrackets() *errs.Error {
+	for _, name := range c.Names {
+		if err := c.Exgs[name].InitLeverageBrackets(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Composite) PriceOnePip(symbol string) (float64, *errs.Error) {
+	_, exg, raw, _, err := c.route(symbol, nil)
+	if err != nil {
+		return 0, err
+	}
+	return exg.PriceOnePip(raw)
+}
+
+// marketExg find exchange of market and return a market copy with raw symbol
+func (c *Composite) marketExg(m *banexg.Market) (banexg.BanExchange, *banexg.Market, *errs.Error) {
+	if m == nil {
+		return nil, nil, errs.NewMsg(errs.CodeParamRequired, "market is required")
+	}
+	_, exg, raw, _, err := c.route(m.Symbol, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	item := *m
+	item.Symbol = raw
+	return exg, &item, nil
+}
+
+func (c *Composite) PrecAmount(m *banexg.Market, amount float64) (float64, *errs.Error) {
+	exg, item, err := c.marketExg(m)
+	if err != nil {
+		return 0, err
+	}
+	return exg.PrecAmount(item, amount)
+}
+
+func (c *Composite) PrecPrice(m *banexg.Market, price float64) (float64, *errs.Error) {
+	exg, item, err := c.marketExg(m)
+	if err != nil {
+		return 0, err
+	}
+	return exg.PrecPrice(item, price)
+}
+
+func (c *Composite) PrecCost(m *banexg.Market, cost float64) (float64, *errs.Error) {
+	exg, item, err := c.marketExg(m)
+	if err != nil {
+		return 0, err
+	}
+	return exg.PrecCost(item, cost)
+}
+
+func (c *Composite) PrecFee(m *banexg.Market, fee float64) (float64, *errs.Error) {
+	exg, item, err := c.marketExg(m)
+	if err != nil {
+		return 0, err
+	}
+	return exg.PrecFee(item, fee)
+}
+
+func (c *Composite) SetOnWsChan(cb banexg.FuncOnWsChan) {
+	for _, exg := range c.Exgs {
+		exg.SetOnWsChan(cb)
+	}
+}
+
+func (c *Composite) AddAfterWsReCon(cb banexg.FuncAfterWsReCon) func() {
+	removes := make([]func(), 0, len(c.Exgs))
+	for _, exg := range c.Exgs {
+		removes = append(removes, exg.AddAfterWsReCon(cb))
+	}
+	return func() {
+		for _, remove := range removes {
+			remove()
+		}
+	}
+}
+
+func (c *Composite) SetOnHost(cb func(n string) string) {
+	for _, exg := range c.Exgs {
+		exg.SetOnHost(cb)
+	}
+}
+
+func (c *Composite) SetMarketType(marketType, contractType string) *errs.Error {
+	for _, name := range c.Names {
+		if err := c.Exgs[name].SetMarketType(marketType, contractType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Composite) SetNetDisable(v bool) {
+	for _, exg := range c.Exgs {
+		exg.SetNetDisable(v)
+	}
+}
+
+// Close close all exchanges and output chans, the first error is returned
+func (c *Composite) Close() *errs.Error {
+	var res *errs.Error
+	for _, name := range c.Names {
+		if err := c.Exgs[name].Close(); err != nil && res == nil {
+			res = err
+		}
+	}
+	c.bookFan.close()
+	c.klineFan.close()
+	c.markFan.close()
+	c.tradeFan.close()
+	c.myTradeFan.close()
+	c.balanceFan.close()
+	c.posFan.close()
+	c.accConfFan.close()
+	return res
+}
@@ -0,0 +1,224 @@
+package composite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/banbox/banexg"
+	"github.com/banbox/banexg/errs"
+)
+
+type fakeExg struct {
+	*banexg.Exchange
+	name      string
+	balance   *banexg.Balances
+	positions []*banexg.Position
+	orders    []string
+	books     chan *banexg.OrderBook
+	balances  chan *banexg.Balances
+	watchErr  *errs.Error
+	unwatched []interface{} // ParamWatchChan of UnWatchOrderBooks
+}
+
+func (e *fakeExg) FetchBalance(params map[string]interface{}) (*banexg.Balances, *errs.Error) {
+	return e.balance, nil
+}
+
+func (e *fakeExg) FetchPositions(symbols []string, params map[string]interface{}) ([]*banexg.Position, *errs.Error) {
+	return e.positions, nil
+}
+
+func (e *fakeExg) CreateOrder(symbol, odType, side string, amount, price float64, params map[string]interface{}) (*banexg.Order, *errs.Error) {
+	e.orders = append(e.orders, symbol)
+	return &banexg.Order{ID: e.name + "1", Symbol: symbol, Type: odType, Side: side, Amount: amount, Price: price}, nil
+}
+
+func (e *fakeExg) WatchOrderBooks(symbols []string, limit int, params map[string]interface{}) (chan *banexg.OrderBook, *errs.Error) {
+	if e.watchErr != nil {
+		return nil, e.watchErr
+	}
+	return e.books, nil
+}
+
+func (e *fakeExg) UnWatchOrderBooks(symbols []string, params map[string]interface{}) *errs.Error {
+	e.unwatched = append(e.unwatched, params[banexg.ParamWatchChan])
+	return nil
+}
+
+func (e *fakeExg) WatchBalance(params map[string]interface{}) (chan *banexg.Balances, *errs.Error) {
+	return e.balances, nil
+}
+
+func newFakeExg(name string, usdt float64) *fakeExg {
+	return &fakeExg{
+		Exchange: &banexg.Exchange{ExgInfo: &banexg.ExgInfo{ID: name}},
+		name:     name,
+		balance: &banexg.Balances{
+			Free:   map[string]float64{"USDT": usdt},
+			Used:   map[string]float64{"USDT": 0},
+			Total:  map[string]float64{"USDT": usdt},
+			Assets: map[string]*banexg.Asset{"USDT": {Code: "USDT", Free: usdt, Total: usdt}},
+		},
+		positions: []*banexg.Position{{Symbol: "BTC/USDT:USDT", Side: banexg.PosSideLong, Contracts: 1}},
+		books:     make(chan *banexg.OrderBook, 10),
+		balances:  make(chan *banexg.Balances, 10),
+	}
+}
+
+func newTestComposite(t *testing.T) (*Composite, *fakeExg, *fakeExg) {
+	bnb, okx := newFakeExg("binance", 100), newFakeExg("okx", 50)
+	exg, err := New(map[string]banexg.BanExchange{"binance": bnb, "okx": okx}, "")
+	if err != nil {
+		t.Fatalf("new composite fail: %v", err)
+	}
+	return exg, bnb, okx
+}
+
+func TestCompositeRoute(t *testing.T) {
+	exg, bnb, okx := newTestComposite(t)
+	if exg.Default != "binance" {
+		t.Fatalf("default should be first name, got %s", exg.Default)
+	}
+	od, err := exg.CreateOrder(QualSymbol("okx", "BTC/USDT"), banexg.OdTypeLimit, banexg.OdSideBuy, 1, 100, nil)
+	if err != nil {
+		t.Fatalf("create order fail: %v", err)
+	}
+	if od.Symbol != "okx@BTC/USDT" || len(okx.orders) != 1 || okx.orders[0] != "BTC/USDT" {
+		t.Fatalf("order should route to okx, got %s %v", od.Symbol, okx.orders)
+	}
+	_, err = exg.CreateOrder("ETH/USDT", banexg.OdTypeLimit, banexg.OdSideBuy, 1, 100,
+		map[string]interface{}{ParamExchange: "okx"})
+	if err != nil || len(okx.orders) != 2 {
+		t.Fatalf("params exchange should route to okx: %v", err)
+	}
+	_, err = exg.CreateOrder("ETH/USDT", banexg.OdTypeLimit, banexg.OdSideBuy, 1, 100, nil)
+	if err != nil || len(bnb.orders) != 1 {
+		t.Fatalf("raw symbol should route to default: %v", err)
+	}
+	_, err = exg.CreateOrder("okx@ETH/USDT", banexg.OdTypeLimit, banexg.OdSideBuy, 1, 100,
+		map[string]interface{}{ParamExchange: "binance"})
+	if err == nil {
+		t.Fatalf("conflict exchange should fail")
+	}
+	if _, err = exg.CreateOrder("bybit@ETH/USDT", banexg.OdTypeLimit, banexg.OdSideBuy, 1, 100, nil); err == nil {
+		t.Fatalf("unknown exchange should fail")
+	}
+}
+
+func TestCompositeMerge(t *testing.T) {
+	exg, _, _ := newTestComposite(t)
+	bal, err := exg.FetchBalance(nil)
+	if err != nil {
+		t.Fatalf("fetch balance fail: %v", err)
+	}
+	if bal.Total["USDT"] != 150 || bal.Assets["USDT"].Free != 150 {
+		t.Fatalf("merged balance wrong: %v", bal.Total)
+	}
+	if _, ok := bal.Info["okx"].(*banexg.Balances); !ok {
+		t.Fatalf("balance of okx should be in Info")
+	}
+	bal, err = exg.FetchBalance(map[string]interface{}{ParamExchange: "okx"})
+	if err != nil || bal.Total["USDT"] != 50 {
+		t.Fatalf("balance of okx wrong: %v", err)
+	}
+	pos, err := exg.FetchPositions(nil, nil)
+	if err != nil || len(pos) != 2 {
+		t.Fatalf("fetch positions fail: %v %d", err, len(pos))
+	}
+	if pos[0].Symbol != "binance@BTC/USDT:USDT" || pos[1].Symbol != "okx@BTC/USDT:USDT" {
+		t.Fatalf("position symbols wrong: %s %s", pos[0].Symbol, pos[1].Symbol)
+	}
+}
+
+func TestCompositeWatch(t *testing.T) {
+	exg, bnb, okx := newTestComposite(t)
+	out, err := exg.WatchOrderBooks([]string{"binance@BTC/USDT", "okx@BTC/USDT"}, 20, nil)
+	if err != nil {
+		t.Fatalf("watch books fail: %v", err)
+	}
+	bnb.books <- &banexg.OrderBook{Symbol: "BTC/USDT"}
+	okx.books <- &banexg.OrderBook{Symbol: "BTC/USDT"}
+	got := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		select {
+		case b := <-out:
+			got[b.Symbol] = true
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting books")
+		}
+	}
+	if !got["binance@BTC/USDT"] || !got["okx@BTC/USDT"] {
+		t.Fatalf("books should be tagged with exchange: %v", got)
+	}
+	balOut, err := exg.WatchBalance(nil)
+	if err != nil {
+		t.Fatalf("watch balance fail: %v", err)
+	}
+	okx.balances <- okx.balance
+	select {
+	case b := <-balOut:
+		if b.Info[InfoExchange] != "okx" {
+			t.Fatalf("balance should be tagged with okx, got %v", b.Info[InfoExchange])
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timeout waiting balance")
+	}
+	// output chan closed after all sources closed
+	close(bnb.books)
+	close(okx.books)
+	select {
+	case _, ok := <-out:
+		if ok {
+			t.Fatalf("book chan should be closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timeout waiting book chan close")
+	}
+	if err = exg.Close(); err != nil {
+		t.Fatalf("close fail: %v", err)
+	}
+	select {
+	case _, ok := <-balOut:
+		if ok {
+			t.Fatalf("balance chan should be closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timeout waiting balance chan close")
+	}
+}
+
+func TestCompositeWatchRollback(t *testing.T) {
+	exg, bnb, okx := newTestComposite(t)
+	okx.watchErr = errs.NewMsg(errs.CodeNetFail, "watch fail")
+	_, err := exg.WatchOrderBooks([]string{"binance@BTC/USDT", "okx@BTC/USDT"}, 20, nil)
+	if err == nil {
+		t.Fatalf("watch should fail when okx fails")
+	}
+	if len(bnb.unwatched) != 1 || bnb.unwatched[0] != bnb.books {
+		t.Fatalf("binance watch should be released by its chan, got %v", bnb.unwatched)
+	}
+	if len(okx.unwatched) != 0 {
+		t.Fatalf("failed okx watch should not be released")
+	}
+}
+
+func TestCompositeMapMarket(t *testing.T) {
+	exg, _, okx := newTestComposite(t)
+	okx.ExgInfo.MarketType = banexg.MarketSpot
+	okx.MarketsById = banexg.MarketArrMap{
+		"BTC-USDT": {{ID: "BTC-USDT", Symbol: "BTC/USDT", Type: banexg.MarketSpot}},
+	}
+	m, err := exg.MapMarket("okx@BTC-USDT", 0)
+	if err != nil || m.Symbol != "okx@BTC/USDT" {
+		t.Fatalf("map market wrong: %v %v", m, err)
+	}
+	if okx.MarketsById["BTC-USDT"][0].Symbol != "BTC/USDT" {
+		t.Fatalf("source market should not be changed")
+	}
+	if m = exg.GetMarketById("okx@BTC-USDT", ""); m == nil || m.Symbol != "okx@BTC/USDT" {
+		t.Fatalf("get market by id wrong: %v", m)
+	}
+	if _, err = exg.MapMarket("BTC-USDT", 0); err == nil {
+		t.Fatalf("raw id should route to default exchange without markets")
+	}
+}
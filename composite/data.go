@@ -0,0 +1,14 @@
+package composite
+
+const (
+	OptExchanges = "CompositeExchanges" // map[string]interface{}, exchange name: options, used by bex.New 交易所名称:选项
+	OptDefault   = "CompositeDefault"   // default exchange name for calls without exchange 未指定交易所时的默认交易所
+)
+
+const (
+	ParamExchange = "exchange" // params key to select exchange 通过params指定交易所
+	InfoExchange  = "exchange" // key of Balances.Info for source exchange name Balances.Info中的来源交易所键
+)
+
+// SymbolSep separates exchange name and symbol in exchange-qualified symbols, e.g. binance@BTC/USDT:USDT
+const SymbolSep = "@"
@@ -0,0 +1,49 @@
+package composite
+
+import (
+	"sort"
+
+	"github.com/banbox/banexg"
+	"github.com/banbox/banexg/errs"
+)
+
+/*
+New
+create composite exchange from named exchanges, defName is used for calls without exchange,
+the first name in order is used if empty.
+根据命名的交易所创建组合交易所，defName为默认交易所，为空时使用排序后第一个
+*/
+func New(exgs map[string]banexg.BanExchange, defName string) (*Composite, *errs.Error) {
+	if len(exgs) == 0 {
+		return nil, errs.NewMsg(errs.CodeParamRequired, "at least one exchange is required")
+	}
+	names := make([]string, 0, len(exgs))
+	for name, exg := range exgs {
+		if name == "" || exg == nil {
+			return nil, errs.NewMsg(errs.CodeParamInvalid, "invalid exchange: %s", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if defName == "" {
+		defName = names[0]
+	}
+	def, ok := exgs[defName]
+	if !ok {
+		return nil, errs.NewMsg(errs.CodeParamInvalid, "default exchange not found: %s", defName)
+	}
+	return &Composite{
+		BanExchange: def,
+		Exgs:        exgs,
+		Names:       names,
+		Default:     defName,
+		bookFan:     newFanIn[*banexg.OrderBook](),
+		klineFan:    newFanIn[*banexg.PairTFKline](),
+		markFan:     newFanIn[map[string]float64](),
+		tradeFan:    newFanIn[*banexg.Trade](),
+		myTradeFan:  newFanIn[*banexg.MyTrade](),
+		balanceFan:  newFanIn[*banexg.Balances](),
+		posFan:      newFanIn[[]*banexg.Position](),
+		accConfFan:  newFanIn[*banexg.AccountConfig](),
+	}, nil
+}
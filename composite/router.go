@@ -0,0 +1,320 @@
+package composite
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/banbox/banexg"
+	"github.com/banbox/banexg/errs"
+	"github.com/banbox/banexg/log"
+	"github.com/banbox/banexg/utils"
+	"go.uber.org/zap"
+)
+
+/*
+ParentOrder
+order to be split across exchanges by Router. Symbol should be raw symbol which is same on all exchanges.
+由Router拆分到多个交易所的母单。Symbol应为各交易所相同的原始symbol
+*/
+type ParentOrder struct {
+	Symbol    string
+	Side      string                 // OdSideBuy / OdSideSell
+	Amount    float64                // amount of base currency
+	Price     float64                // limit price, 0 for no limit 限价，0表示不限
+	Exchanges []string               // exchanges to use, empty for all 使用的交易所，为空表示全部
+	Params    map[string]interface{} // extra params for child orders 子订单额外参数
+}
+
+// ChildPlan planned child order on one exchange
+type ChildPlan struct {
+	Exchange string
+	Amount   float64
+	Price    float64 // worst book price used, as limit price of child order 用到的最差盘口价格，作为子订单限价
+	AvgPrice float64 // expected average price from order book
+	FeeRate  float64 // taker fee rate in quote
+	Cost     float64 // expected quote cost including fee, proceeds for sell
+}
+
+// ChildFill result of one child order
+type ChildFill struct {
+	*ChildPlan
+	Order *banexg.Order
+	Err   *errs.Error
+}
+
+/*
+FillReport
+aggregate result of a parent order
+母单的汇总成交结果
+*/
+type FillReport struct {
+	Symbol   string
+	Side     string
+	Amount   float64 // requested amount
+	Filled   float64
+	AvgPrice float64
+	Cost     float64            // filled quote value, fee excluded
+	Fees     map[string]float64 // currency: fee cost
+	Children []*ChildFill
+}
+
+// Remaining unfilled amount of parent order
+func (r *FillReport) Remaining() float64 {
+	return max(r.Amount-r.Filled, 0)
+}
+
+/*
+Router
+split a parent order across exchanges by live order books to minimize total cost including taker fees,
+then place child orders as IOC limit orders and track them until finished.
+根据实时订单簿将母单拆分到多个交易所，使含吃单手续费的总成本最低，然后以IOC限价单下子订单并跟踪至完成
+*/
+type Router struct {
+	Exgs      map[string]banexg.BanExchange
+	BookDepth int           // depth of order books to fetch
+	Timeout   time.Duration // max time to track child orders
+	PollIntv  time.Duration // interval to poll child orders not finished
+}
+
+// NewRouter create a router for named exchanges, Composite.Exgs can be used directly
+func NewRouter(exgs map[string]banexg.BanExchange) *Router {
+	return &Router{
+		Exgs:      exgs,
+		BookDepth: 50,
+		Timeout:   time.Second * 10,
+		PollIntv:  time.Millisecond * 500,
+	}
+}
+
+// bookLevel one price level of an exchange, with price adjusted by taker fee
+type bookLevel struct {
+	exg      string
+	price    float64
+	size     float64
+	effPrice float64
+}
+
+func (r *Router) exgNames(parent *ParentOrder) ([]string, *errs.Error) {
+	names := parent.Exchanges
+	if len(names) == 0 {
+		names = make([]string, 0, len(r.Exgs))
+		for name := range r.Exgs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	for _, name := range names {
+		if _, ok := r.Exgs[name]; !ok {
+			return nil, errs.NewMsg(errs.CodeParamInvalid, "unknown exchange: %s", name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, errs.NewMsg(errs.CodeParamRequired, "no exchange for router")
+	}
+	return names, nil
+}
+
+/*
+Plan
+fetch order books and split parent order. Levels of all exchanges are taken from the cheapest
+(fee included) until amount is reached; levels beyond the limit price are skipped.
+Amount which can not be filled by books is not planned.
+获取订单簿并拆分母单。从所有交易所（含手续费）最优的档位开始吃单直到满足数量；超出限价的档位跳过。
+订单簿无法满足的数量不会计划
+*/
+func (r *Router) Plan(parent *ParentOrder) ([]*ChildPlan, *errs.Error) {
+	if parent == nil || parent.Symbol == "" || parent.Amount <= 0 {
+		return nil, errs.NewMsg(errs.CodeParamInvalid, "invalid parent order")
+	}
+	if parent.Side != banexg.OdSideBuy && parent.Side != banexg.OdSideSell {
+		return nil, errs.NewMsg(errs.CodeParamInvalid, "invalid side: %s", parent.Side)
+	}
+	names, err := r.exgNames(parent)
+	if err != nil {
+		return nil, err
+	}
+	isBuy := parent.Side == banexg.OdSideBuy
+	var levels []*bookLevel
+	books := make(map[string]*banexg.OdBookSide)
+	rates := make(map[string]float64)
+	for _, name := range names {
+		exg := r.Exgs[name]
+		book, err := exg.FetchOrderBook(parent.Symbol, r.BookDepth, nil)
+		if err != nil {
+			log.Warn("router fetch order book fail", zap.String("exg", name),
+				zap.String("symbol", parent.Symbol), zap.String("err", err.Short()))
+			continue
+		}
+		side := book.Bids
+		if isBuy {
+			side = book.Asks
+		}
+		if side == nil {
+			continue
+		}
+		price0, _ := side.Level(0)
+		if price0 <= 0 {
+			continue
+		}
+		fee, err := exg.CalculateFee(parent.Symbol, banexg.OdTypeLimit, parent.Side, 1, price0, false, nil)
+		if err != nil {
+			log.Warn("router calc fee fail", zap.String("exg", name), zap.String("err", err.Short()))
+			continue
+		}
+		rate := fee.QuoteCost / price0
+		books[name] = side
+		rates[name] = rate
+		prices, sizes := side.Levels(0)
+		for i, price := range prices {
+			size := sizes[i]
+			if price <= 0 || size <= 0 {
+				break
+			}
+			if parent.Price > 0 && (isBuy && price > parent.Price || !isBuy && price < parent.Price) {
+				break
+			}
+			effPrice := price * (1 - rate)
+			if isBuy {
+				effPrice = price * (1 + rate)
+			}
+			levels = append(levels, &bookLevel{exg: name, price: price, size: size, effPrice: effPrice})
+		}
+	}
+	sort.SliceStable(levels, func(i, j int) bool {
+		if isBuy {
+			return levels[i].effPrice < levels[j].effPrice
+		}
+		return levels[i].effPrice > levels[j].effPrice
+	})
+	plans := make(map[string]*ChildPlan)
+	left := parent.Amount
+	for _, lv := range levels {
+		if left <= 0 {
+			break
+		}
+		take := min(left, lv.size)
+		left -= take
+		p, ok := plans[lv.exg]
+		if !ok {
+			p = &ChildPlan{Exchange: lv.exg, FeeRate: rates[lv.exg]}
+			plans[lv.exg] = p
+		}
+		p.Amount += take
+		p.Cost += take * lv.effPrice
+		if isBuy {
+			p.Price = max(p.Price, lv.price)
+		} else if p.Price == 0 || lv.price < p.Price {
+			p.Price = lv.price
+		}
+	}
+	res := make([]*ChildPlan, 0, len(plans))
+	for _, name := range names {
+		p, ok := plans[name]
+		if !ok {
+			continue
+		}
+		exg := r.Exgs[name]
+		market, err := exg.GetMarket(parent.Symbol)
+		if err != nil {
+			return nil, err
+		}
+		amount, err := exg.PrecAmount(market, p.Amount)
+		if err != nil {
+			return nil, err
+		}
+		if amount <= 0 || market.Limits != nil && market.Limits.Amount != nil && amount < market.Limits.Amount.Min {
+			continue
+		}
+		p.Cost = p.Cost * amount / p.Amount
+		p.Amount = amount
+		p.AvgPrice, _, _ = books[name].AvgPrice(amount)
+		res = append(res, p)
+	}
+	return res, nil
+}
+
+/*
+Execute
+plan the parent order, place child orders concurrently and track them until finished or Timeout.
+Errors of child orders are recorded in ChildFill.Err, error is returned only when planning failed.
+规划母单，并发下子订单并跟踪至完成或超时。子订单错误记录在ChildFill.Err，仅规划失败时返回错误
+*/
+func (r *Router) Execute(parent *ParentOrder) (*FillReport, *errs.Error) {
+	plans, err := r.Plan(parent)
+	if err != nil {
+		return nil, err
+	}
+	res := &FillReport{
+		Symbol:   parent.Symbol,
+		Side:     parent.Side,
+		Amount:   parent.Amount,
+		Fees:     make(map[string]float64),
+		Children: make([]*ChildFill, len(plans)),
+	}
+	var wg sync.WaitGroup
+	for i, p := range plans {
+		wg.Add(1)
+		go func(i int, p *ChildPlan) {
+			defer wg.Done()
+			res.Children[i] = r.placeChild(parent, p)
+		}(i, p)
+	}
+	wg.Wait()
+	for _, c := range res.Children {
+		od := c.Order
+		if od == nil || od.Filled <= 0 {
+			continue
+		}
+		price := od.Average
+		if price == 0 {
+			price = od.Price
+		}
+		res.Filled += od.Filled
+		res.Cost += od.Filled * price
+		if od.Fee != nil && od.Fee.Currency != "" {
+			res.Fees[od.Fee.Currency] += od.Fee.Cost
+		}
+	}
+	if res.Filled > 0 {
+		res.AvgPrice = res.Cost / res.Filled
+	}
+	return res, nil
+}
+
+func (r *Router) placeChild(parent *ParentOrder, p *ChildPlan) *ChildFill {
+	res := &ChildFill{ChildPlan: p}
+	exg := r.Exgs[p.Exchange]
+	args := utils.SafeParams(parent.Params)
+	args[banexg.ParamTimeInForce] = banexg.TimeInForceIOC
+	od, err := exg.CreateOrder(parent.Symbol, banexg.OdTypeLimit, parent.Side, p.Amount, p.Price, args)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	res.Order = od
+	stopAt := time.Now().Add(r.Timeout)
+	for !isOrderDone(od) && time.Now().Before(stopAt) {
+		time.Sleep(r.PollIntv)
+		cur, err := exg.FetchOrder(parent.Symbol, od.ID, nil)
+		if err != nil {
+			log.Warn("router fetch order fail", zap.String("exg", p.Exchange), zap.String("id", od.ID),
+				zap.String("err", err.Short()))
+			continue
+		}
+		od = cur
+		res.Order = od
+	}
+	if !isOrderDone(od) {
+		res.Err = errs.NewMsg(errs.CodeTimeout, "child order not finished: %s %s", p.Exchange, od.ID)
+	}
+	return res
+}
+
+func isOrderDone(od *banexg.Order) bool {
+	switch od.Status {
+	case banexg.OdStatusFilled, banexg.OdStatusCanceled, banexg.OdStatusRejected, banexg.OdStatusExpired:
+		return true
+	}
+	return false
+}
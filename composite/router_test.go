@@ -0,0 +1,106 @@
+package composite
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/banbox/banexg"
+	"github.com/banbox/banexg/errs"
+)
+
+type bookExg struct {
+	*banexg.Exchange
+	book    *banexg.OrderBook
+	delayed bool // return open order first, filled by FetchOrder
+	placed  *banexg.Order
+}
+
+func (e *bookExg) FetchOrderBook(symbol string, limit int, params map[string]interface{}) (*banexg.OrderBook, *errs.Error) {
+	return e.book, nil
+}
+
+func (e *bookExg) CreateOrder(symbol, odType, side string, amount, price float64, params map[string]interface{}) (*banexg.Order, *errs.Error) {
+	if params[banexg.ParamTimeInForce] != banexg.TimeInForceIOC {
+		return nil, errs.NewMsg(errs.CodeParamInvalid, "child order should be IOC")
+	}
+	od := &banexg.Order{ID: "1", Symbol: symbol, Type: odType, Side: side, Amount: amount, Price: price,
+		Status: banexg.OdStatusFilled, Filled: amount, Average: price,
+		Fee: &banexg.Fee{Currency: "USDT", Cost: amount * price * 0.001}}
+	e.placed = od
+	if e.delayed {
+		res := *od
+		res.Status = banexg.OdStatusOpen
+		res.Filled = 0
+		return &res, nil
+	}
+	return od, nil
+}
+
+func (e *bookExg) FetchOrder(symbol, id string, params map[string]interface{}) (*banexg.Order, *errs.Error) {
+	return e.placed, nil
+}
+
+func newBookExg(taker float64, asks [][2]float64) *bookExg {
+	m := &banexg.Market{
+		ID: "BTCUSDT", Symbol: "BTC/USDT", Base: "BTC", Quote: "USDT", Spot: true, Type: banexg.MarketSpot,
+		Taker: taker, Maker: taker,
+		Precision: &banexg.Precision{Amount: 0.001, Price: 0.1, ModeAmount: banexg.PrecModeTickSize,
+			ModePrice: banexg.PrecModeTickSize},
+	}
+	return &bookExg{
+		Exchange: &banexg.Exchange{ExgInfo: &banexg.ExgInfo{Markets: banexg.MarketMap{m.Symbol: m}}},
+		book: &banexg.OrderBook{
+			Symbol: m.Symbol,
+			Asks:   banexg.NewOdBookSide(false, 20, asks),
+			Bids:   banexg.NewOdBookSide(true, 20, [][2]float64{{99, 1}}),
+		},
+	}
+}
+
+func TestRouter(t *testing.T) {
+	// b has better price at first level, but higher fee makes a's 100 cheaper than b's 99.95
+	a := newBookExg(0.0001, [][2]float64{{100, 1}, {102, 5}})
+	b := newBookExg(0.002, [][2]float64{{99.95, 1}, {100.5, 5}})
+	b.delayed = true
+	router := NewRouter(map[string]banexg.BanExchange{"a": a, "b": b})
+	router.PollIntv = time.Millisecond
+	parent := &ParentOrder{Symbol: "BTC/USDT", Side: banexg.OdSideBuy, Amount: 3, Price: 101}
+	plans, err := router.Plan(parent)
+	if err != nil {
+		t.Fatalf("plan fail: %v", err)
+	}
+	if len(plans) != 2 || plans[0].Exchange != "a" || plans[1].Exchange != "b" {
+		t.Fatalf("should plan on a and b, got %d", len(plans))
+	}
+	if plans[0].Amount != 1 || plans[0].Price != 100 {
+		t.Fatalf("plan a wrong: %v %v", plans[0].Amount, plans[0].Price)
+	}
+	if plans[1].Amount != 2 || plans[1].Price != 100.5 {
+		t.Fatalf("plan b wrong: %v %v", plans[1].Amount, plans[1].Price)
+	}
+	res, err := router.Execute(parent)
+	if err != nil {
+		t.Fatalf("execute fail: %v", err)
+	}
+	if res.Filled != 3 || res.Remaining() != 0 {
+		t.Fatalf("filled wrong: %v", res.Filled)
+	}
+	if math.Abs(res.AvgPrice-(100+2*100.5)/3) > 1e-9 {
+		t.Fatalf("avg price wrong: %v", res.AvgPrice)
+	}
+	if math.Abs(res.Fees["USDT"]-(100+201)*0.001) > 1e-9 {
+		t.Fatalf("fee wrong: %v", res.Fees["USDT"])
+	}
+	for _, c := range res.Children {
+		if c.Err != nil {
+			t.Fatalf("child %s fail: %v", c.Exchange, c.Err)
+		}
+	}
+	// limit price restricts levels, remaining is not planned
+	parent.Amount, parent.Price = 10, 100
+	res, err = router.Execute(parent)
+	if err != nil || res.Filled != 2 || res.Remaining() != 8 {
+		t.Fatalf("limited execute wrong: %v %v", err, res.Filled)
+	}
+}
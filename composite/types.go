@@ -0,0 +1,41 @@
+package composite
+
+import (
+	"sync"
+
+	"github.com/banbox/banexg"
+	"github.com/sasha-s/go-deadlock"
+)
+
+/*
+Composite
+own several exchanges and route calls by exchange-qualified symbols (binance@BTC/USDT) or params[ParamExchange].
+Symbols in all results are qualified with the source exchange, so they can be passed back directly.
+Calls which can not be routed are served by the default exchange.
+管理多个交易所，根据带交易所前缀的symbol或params[ParamExchange]路由调用。返回结果中的symbol均带有来源交易所前缀，可直接回传。
+无法路由的调用由默认交易所处理
+*/
+type Composite struct {
+	banexg.BanExchange // default exchange 默认交易所
+	Exgs               map[string]banexg.BanExchange
+	Names              []string // sorted exchange names
+	Default            string
+
+	bookFan    *fanIn[*banexg.OrderBook]
+	klineFan   *fanIn[*banexg.PairTFKline]
+	markFan    *fanIn[map[string]float64]
+	tradeFan   *fanIn[*banexg.Trade]
+	myTradeFan *fanIn[*banexg.MyTrade]
+	balanceFan *fanIn[*banexg.Balances]
+	posFan     *fanIn[[]*banexg.Position]
+	accConfFan *fanIn[*banexg.AccountConfig]
+}
+
+// fanIn forward several source chans into one output chan, output is closed after all sources closed
+type fanIn[T any] struct {
+	lock deadlock.Mutex
+	out  chan T
+	srcs map[chan T]bool
+	done chan struct{}   // closed by Close to stop all forwarding goroutines
+	wg   *sync.WaitGroup // forwarding goroutines of current out
+}
@@ -0,0 +1,426 @@
+package composite
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/banbox/banexg"
+	"github.com/banbox/banexg/errs"
+	"github.com/banbox/banexg/log"
+	"github.com/banbox/banexg/utils"
+	"go.uber.org/zap"
+)
+
+func newFanIn[T any]() *fanIn[T] {
+	return &fanIn[T]{srcs: make(map[chan T]bool)}
+}
+
+/*
+add
+forward messages of src into the shared output chan after convert, return the output chan.
+output chan is closed after all sources closed, or after close called.
+将src的消息转换后转发到共享的输出通道，返回输出通道。所有来源关闭或调用close后，输出通道会被关闭
+*/
+func (f *fanIn[T]) add(src chan T, chanCap int, convert func(T) T) chan T {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.out == nil {
+		f.out = make(chan T, chanCap)
+		f.done = make(chan struct{})
+		f.wg = &sync.WaitGroup{}
+	}
+	if f.srcs[src] {
+		return f.out
+	}
+	f.srcs[src] = true
+	out, done, wg := f.out, f.done, f.wg
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case msg, ok := <-src:
+				if !ok {
+					f.remove(src, out)
+					return
+				}
+				select {
+				case out <- convert(msg):
+				case <-done:
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// remove called by the forwarding goroutine after src closed, close out if it's the last source
+func (f *fanIn[T]) remove(src chan T, out chan T) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.out != out {
+		return
+	}
+	delete(f.srcs, src)
+	if len(f.srcs) == 0 {
+		close(out)
+		f.out = nil
+	}
+}
+
+func (f *fanIn[T]) close() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.out == nil {
+		return
+	}
+	out, wg := f.out, f.wg
+	close(f.done)
+	f.out = nil
+	f.srcs = make(map[chan T]bool)
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+}
+
+func getChanCap(params map[string]interface{}) int {
+	return utils.GetMapVal(params, banexg.ParamChanCap, 100)
+}
+
+/*
+watchEach
+call watch for each exchange in order, return source chans in the same order. If one fails, subscriptions
+already made on earlier exchanges are released by unwatch before returning the error.
+unwatch is nil for account streams, which have no UnWatch method; their sources are just not forwarded.
+按顺序对每个交易所调用watch，返回同顺序的来源通道。某个失败时，先用unwatch释放之前交易所已建立的订阅再返回错误。
+账户类订阅没有UnWatch方法，unwatch为nil，仅不转发其来源通道
+*/
+func watchEach[T any](names []string, watch func(name string) (chan T, *errs.Error),
+	unwatch func(name string, in chan T) *errs.Error) ([]chan T, *errs.Error) {
+	ins := make([]chan T, 0, len(names))
+	for _, name := range names {
+		in, err := watch(name)
+		if err == nil {
+			ins = append(ins, in)
+			continue
+		}
+		if unwatch != nil {
+			for i := len(ins) - 1; i >= 0; i-- {
+				if err2 := unwatch(names[i], ins[i]); err2 != nil {
+					log.Warn("composite unwatch fail", zap.String("exg", names[i]), zap.String("err", err2.Short()))
+				}
+			}
+		}
+		return nil, err
+	}
+	return ins, nil
+}
+
+// watchArgs copy args with ParamWatchChan, so UnWatch* only releases refs of that watch
+func watchArgs(args map[string]interface{}, in interface{}) map[string]interface{} {
+	res := utils.SafeParams(args)
+	res[banexg.ParamWatchChan] = in
+	return res
+}
+
+func qualBook(name string, book *banexg.OrderBook) *banexg.OrderBook {
+	if book == nil {
+		return nil
+	}
+	res := *book
+	res.Symbol = QualSymbol(name, book.Symbol)
+	return &res
+}
+
+/*
+WatchOrderBooks
+subscribe order books grouped by exchange, books of all exchanges are sent to one chan with exchange-qualified symbol
+按交易所分组订阅订单簿，所有交易所的订单簿发送到同一通道，symbol带交易所前缀
+*/
+func (c *Composite) WatchOrderBooks(symbols []string, limit int, params map[string]interface{}) (chan *banexg.OrderBook, *errs.Error) {
+	names, groups, args, err := c.targets(symbols, params)
+	if err != nil {
+		return nil, err
+	}
+	chanCap := getChanCap(args)
+	ins, err := watchEach(names, func(name string) (chan *banexg.OrderBook, *errs.Error) {
+		return c.Exgs[name].WatchOrderBooks(groups[name], limit, args)
+	}, func(name string, in chan *banexg.OrderBook) *errs.Error {
+		return c.Exgs[name].UnWatchOrderBooks(groups[name], watchArgs(args, in))
+	})
+	if err != nil {
+		return nil, err
+	}
+	var out chan *banexg.OrderBook
+	for i, name := range names {
+		exgName := name
+		out = c.bookFan.add(ins[i], chanCap, func(b *banexg.OrderBook) *banexg.OrderBook {
+			return qualBook(exgName, b)
+		})
+	}
+	return out, nil
+}
+
+func (c *Composite) UnWatchOrderBooks(symbols []string, params map[string]interface{}) *errs.Error {
+	names, groups, args, err := c.targets(symbols, params)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err = c.Exgs[name].UnWatchOrderBooks(groups[name], args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groupJobs group [symbol, timeframe] jobs by exchange, symbols in result are raw
+func (c *Composite) groupJobs(jobs [][2]string, params map[string]interface{}) ([]string, map[string][][2]string, map[string]interface{}, *errs.Error) {
+	args := utils.SafeParams(params)
+	defName := utils.PopMapVal(args, ParamExchange, c.Default)
+	res := make(map[string][][2]string)
+	names := make([]string, 0)
+	for _, j := range jobs {
+		name, raw := SplitSymbol(j[0])
+		if name == "" {
+			name = defName
+		}
+		if _, ok := c.Exgs[name]; !ok {
+			return nil, nil, nil, errs.NewMsg(errs.CodeParamInvalid, "unknown exchange: %s", name)
+		}
+		if _, ok := res[name]; !ok {
+			names = append(names, name)
+		}
+		res[name] = append(res[name], [2]string{raw, j[1]})
+	}
+	sort.Strings(names)
+	return names, res, args, nil
+}
+
+func (c *Composite) WatchOHLCVs(jobs [][2]string, params map[string]interface{}) (chan *banexg.PairTFKline, *errs.Error) {
+	names, groups, args, err := c.groupJobs(jobs, params)
+	if err != nil {
+		return nil, err
+	}
+	chanCap := getChanCap(args)
+	ins, err := watchEach(names, func(name string) (chan *banexg.PairTFKline, *errs.Error) {
+		return c.Exgs[name].WatchOHLCVs(groups[name], args)
+	}, func(name string, in chan *banexg.PairTFKline) *errs.Error {
+		return c.Exgs[name].UnWatchOHLCVs(groups[name], watchArgs(args, in))
+	})
+	if err != nil {
+		return nil, err
+	}
+	var out chan *banexg.PairTFKline
+	for i, name := range names {
+		exgName := name
+		out = c.klineFan.add(ins[i], chanCap, func(k *banexg.PairTFKline) *banexg.PairTFKline {
+			res := *k
+			res.Symbol = QualSymbol(exgName, k.Symbol)
+			return &res
+		})
+	}
+	return out, nil
+}
+
+func (c *Composite) UnWatchOHLCVs(jobs [][2]string, params map[string]interface{}) *errs.Error {
+	names, groups, args, err := c.groupJobs(jobs, params)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err = c.Exgs[name].UnWatchOHLCVs(groups[name], args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Composite) WatchMarkPrices(symbols []string, params map[string]interface{}) (chan map[string]float64, *errs.Error) {
+	names, groups, args, err := c.targets(symbols, params)
+	if err != nil {
+		return nil, err
+	}
+	chanCap := getChanCap(args)
+	ins, err := watchEach(names, func(name string) (chan map[string]float64, *errs.Error) {
+		return c.Exgs[name].WatchMarkPrices(groups[name], args)
+	}, func(name string, in chan map[string]float64) *errs.Error {
+		return c.Exgs[name].UnWatchMarkPrices(groups[name], watchArgs(args, in))
+	})
+	if err != nil {
+		return nil, err
+	}
+	var out chan map[string]float64
+	for i, name := range names {
+		exgName := name
+		out = c.markFan.add(ins[i], chanCap, func(prices map[string]float64) map[string]float64 {
+			res := make(map[string]float64, len(prices))
+			for key, price := range prices {
+				res[QualSymbol(exgName, key)] = price
+			}
+			return res
+		})
+	}
+	return out, nil
+}
+
+func (c *Composite) UnWatchMarkPrices(symbols []string, params map[string]interface{}) *errs.Error {
+	names, groups, args, err := c.targets(symbols, params)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err = c.Exgs[name].UnWatchMarkPrices(groups[name], args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Composite) WatchTrades(symbols []string, params map[string]interface{}) (chan *banexg.Trade, *errs.Error) {
+	names, groups, args, err := c.targets(symbols, params)
+	if err != nil {
+		return nil, err
+	}
+	chanCap := getChanCap(args)
+	ins, err := watchEach(names, func(name string) (chan *banexg.Trade, *errs.Error) {
+		return c.Exgs[name].WatchTrades(groups[name], args)
+	}, func(name string, in chan *banexg.Trade) *errs.Error {
+		return c.Exgs[name].UnWatchTrades(groups[name], watchArgs(args, in))
+	})
+	if err != nil {
+		return nil, err
+	}
+	var out chan *banexg.Trade
+	for i, name := range names {
+		exgName := name
+		out = c.tradeFan.add(ins[i], chanCap, func(t *banexg.Trade) *banexg.Trade {
+			res := *t
+			res.Symbol = QualSymbol(exgName, t.Symbol)
+			return &res
+		})
+	}
+	return out, nil
+}
+
+func (c *Composite) UnWatchTrades(symbols []string, params map[string]interface{}) *errs.Error {
+	names, groups, args, err := c.targets(symbols, params)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err = c.Exgs[name].UnWatchTrades(groups[name], args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WatchMyTrades watch fills of all exchanges (or params[ParamExchange])
+func (c *Composite) WatchMyTrades(params map[string]interface{}) (chan *banexg.MyTrade, *errs.Error) {
+	names, _, args, err := c.targets(nil, params)
+	if err != nil {
+		return nil, err
+	}
+	chanCap := getChanCap(args)
+	ins, err := watchEach(names, func(name string) (chan *banexg.MyTrade, *errs.Error) {
+		return c.Exgs[name].WatchMyTrades(args)
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out chan *banexg.MyTrade
+	for i, name := range names {
+		exgName := name
+		out = c.myTradeFan.add(ins[i], chanCap, func(t *banexg.MyTrade) *banexg.MyTrade {
+			res := *t
+			res.Symbol = QualSymbol(exgName, t.Symbol)
+			return &res
+		})
+	}
+	return out, nil
+}
+
+/*
+WatchBalance
+watch balances of all exchanges (or params[ParamExchange]), source exchange name is set in Info[InfoExchange]
+监听所有交易所（或params[ParamExchange]）的余额，来源交易所名称保存在Info[InfoExchange]
+*/
+func (c *Composite) WatchBalance(params map[string]interface{}) (chan *banexg.Balances, *errs.Error) {
+	names, _, args, err := c.targets(nil, params)
+	if err != nil {
+		return nil, err
+	}
+	chanCap := getChanCap(args)
+	ins, err := watchEach(names, func(name string) (chan *banexg.Balances, *errs.Error) {
+		return c.Exgs[name].WatchBalance(args)
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out chan *banexg.Balances
+	for i, name := range names {
+		exgName := name
+		out = c.balanceFan.add(ins[i], chanCap, func(b *banexg.Balances) *banexg.Balances {
+			res := *b
+			res.Info = make(map[string]interface{}, len(b.Info)+1)
+			for k, v := range b.Info {
+				res.Info[k] = v
+			}
+			res.Info[InfoExchange] = exgName
+			return &res
+		})
+	}
+	return out, nil
+}
+
+// WatchPositions watch positions of all exchanges (or params[ParamExchange]) with exchange-qualified symbols
+func (c *Composite) WatchPositions(params map[string]interface{}) (chan []*banexg.Position, *errs.Error) {
+	names, _, args, err := c.targets(nil, params)
+	if err != nil {
+		return nil, err
+	}
+	chanCap := getChanCap(args)
+	ins, err := watchEach(names, func(name string) (chan []*banexg.Position, *errs.Error) {
+		return c.Exgs[name].WatchPositions(args)
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out chan []*banexg.Position
+	for i, name := range names {
+		exgName := name
+		out = c.posFan.add(ins[i], chanCap, func(items []*banexg.Position) []*banexg.Position {
+			return qualPositions(exgName, items)
+		})
+	}
+	return out, nil
+}
+
+func (c *Composite) WatchAccountConfig(params map[string]interface{}) (chan *banexg.AccountConfig, *errs.Error) {
+	names, _, args, err := c.targets(nil, params)
+	if err != nil {
+		return nil, err
+	}
+	chanCap := getChanCap(args)
+	ins, err := watchEach(names, func(name string) (chan *banexg.AccountConfig, *errs.Error) {
+		return c.Exgs[name].WatchAccountConfig(args)
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out chan *banexg.AccountConfig
+	for i, name := range names {
+		exgName := name
+		out = c.accConfFan.add(ins[i], chanCap, func(a *banexg.AccountConfig) *banexg.AccountConfig {
+			res := *a
+			res.Symbol = QualSymbol(exgName, a.Symbol)
+			return &res
+		})
+	}
+	return out, nil
+}
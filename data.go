@@ -87,13 +87,21 @@ var (
 	hostWaitLock    deadlock.Mutex
 	hostFlowChans   = make(map[string]chan struct{})
 	hostFlowLock    deadlock.Mutex
-	HostHttpConcurr = 3 // Maximum concurrent number of HTTP requests per domain name 每个域名发起http请求最大并发数
+	hostQueueNums   = make(map[string]int) // number of requests waiting for host semaphore
+	HostHttpConcurr = 3                    // Maximum concurrent number of HTTP requests per domain name 每个域名发起http请求最大并发数
 )
 
 const (
 	DefTimeInForce = TimeInForceGTC
 )
 
+const (
+	WsDumpVersion   = 2 // version of ws dump written by SetDump, legacy gob dump is 1
+	wsDumpFormat    = "banexg-ws"
+	wsBlockMagic    = "WSBK"
+	wsBlockHeadSize = 28
+)
+
 const (
 	HasFail = 1 << iota
 	HasOk
@@ -132,11 +140,26 @@ const (
 	OptDumpPath        = "DumpPath"
 	OptDumpBatchSize   = "DumpBatchSize"
 	OptReplayPath      = "ReplayPath"
+	OptReplayStart     = "ReplayStart" // int64, replay messages from this 13 digit timestamp
+	OptReplayEnd       = "ReplayEnd"   // int64, replay messages until this 13 digit timestamp
+	OptApiDumpPath     = "ApiDumpPath"
+	OptApiReplayPath   = "ApiReplayPath"
+	OptCacheStore      = "CacheStore"     // CacheStore, or CacheStoreMemory/CacheStoreFile/a directory for file store
+	OptCacheSize       = "CacheSize"      // max items for CacheStoreMemory
+	OptMetrics         = "Metrics"        // MetricsHook
+	OptClock           = "Clock"          // Clock, source of MilliSeconds
+	OptCircuitBreaker  = "CircuitBreaker" // *CircuitConfig, enable circuit breaker for RequestApiRetryAdv
+	OptDecimal         = "Decimal"        // bool, set Dec fields with exact values from exchange strings
 	OptEnv             = "Env"
 	OptWsTimeout       = "WsTimeout"
 	OptRecvWindow      = "RecvWindow"
 )
 
+const (
+	CacheStoreMemory = "memory"
+	CacheStoreFile   = "file"
+)
+
 const (
 	PrecModeDecimalPlace = utils.PrecModeDecimalPlace // 保留小数点后位数
 	PrecModeSignifDigits = utils.PrecModeSignifDigits // 保留有效数字位数
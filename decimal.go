@@ -0,0 +1,244 @@
+package banexg
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+/*
+DecKeys
+map field names of Dec structs to keys of raw exchange data, the first non-empty key is used.
+用于Dec结构体字段名到交易所原始数据键的映射，使用第一个非空的键
+*/
+type DecKeys map[string][]string
+
+/*
+OrderDec
+exact values of Order, only set when OptDecimal is enabled.
+Order的精确十进制值，仅在启用OptDecimal时设置
+*/
+type OrderDec struct {
+	Price           decimal.Decimal `json:"price"`
+	Average         decimal.Decimal `json:"average"`
+	Amount          decimal.Decimal `json:"amount"`
+	Filled          decimal.Decimal `json:"filled"`
+	Remaining       decimal.Decimal `json:"remaining"`
+	TriggerPrice    decimal.Decimal `json:"triggerPrice"`
+	StopPrice       decimal.Decimal `json:"stopPrice"`
+	TakeProfitPrice decimal.Decimal `json:"takeProfitPrice"`
+	StopLossPrice   decimal.Decimal `json:"stopLossPrice"`
+	Cost            decimal.Decimal `json:"cost"`
+	FeeCost         decimal.Decimal `json:"feeCost"`
+}
+
+type FeeDec struct {
+	Cost decimal.Decimal `json:"cost"`
+	Rate decimal.Decimal `json:"rate"`
+}
+
+type PositionDec struct {
+	Contracts        decimal.Decimal `json:"contracts"`
+	ContractSize     decimal.Decimal `json:"contractSize"`
+	EntryPrice       decimal.Decimal `json:"entryPrice"`
+	MarkPrice        decimal.Decimal `json:"markPrice"`
+	Notional         decimal.Decimal `json:"notional"`
+	Collateral       decimal.Decimal `json:"collateral"`
+	InitialMargin    decimal.Decimal `json:"initialMargin"`
+	MaintMargin      decimal.Decimal `json:"maintenanceMargin"`
+	UnrealizedPnl    decimal.Decimal `json:"unrealizedPnl"`
+	LiquidationPrice decimal.Decimal `json:"liquidationPrice"`
+}
+
+type AssetDec struct {
+	Free  decimal.Decimal
+	Used  decimal.Decimal
+	Total decimal.Decimal
+	Debt  decimal.Decimal
+	UPol  decimal.Decimal
+}
+
+type KlineDec struct {
+	Open      decimal.Decimal
+	High      decimal.Decimal
+	Low       decimal.Decimal
+	Close     decimal.Decimal
+	Volume    decimal.Decimal
+	Quote     decimal.Decimal
+	BuyVolume decimal.Decimal
+}
+
+/*
+ParseDec
+parse exact decimal from raw exchange value. strings and json.Number keep all digits,
+float64 uses the shortest representation. ok is false for empty or invalid values.
+从交易所原始值解析精确十进制数
+*/
+func ParseDec(val interface{}) (decimal.Decimal, bool) {
+	var text string
+	switch v := val.(type) {
+	case string:
+		text = strings.TrimSpace(v)
+	case json.Number:
+		text = v.String()
+	case float64:
+		return decimal.NewFromFloat(v), true
+	case int:
+		return decimal.NewFromInt(int64(v)), true
+	case int64:
+		return decimal.NewFromInt(v), true
+	default:
+		return decimal.Zero, false
+	}
+	if text == "" {
+		return decimal.Zero, false
+	}
+	res, err := decimal.NewFromString(text)
+	if err != nil {
+		return decimal.Zero, false
+	}
+	return res, true
+}
+
+/*
+DecStr parse text as decimal, use fallback float when text is empty or invalid
+*/
+func DecStr(text string, fallback float64) decimal.Decimal {
+	if res, ok := ParseDec(text); ok {
+		return res
+	}
+	return decimal.NewFromFloat(fallback)
+}
+
+func fillDecFields(fields map[string]*decimal.Decimal, raw map[string]interface{}, keys DecKeys) {
+	if raw == nil {
+		return
+	}
+	for name, items := range keys {
+		ptr, ok := fields[name]
+		if !ok {
+			continue
+		}
+		for _, k := range items {
+			if val, ok := ParseDec(raw[k]); ok {
+				// keep derived value when exchange returns zero, e.g. price of market orders
+				if !val.IsZero() || ptr.IsZero() {
+					*ptr = val
+				}
+				break
+			}
+		}
+	}
+}
+
+/*
+SetDec
+set Dec from float fields, and override with raw strings in Info by keys.
+根据浮点字段设置Dec，并使用Info中keys对应的原始字符串覆盖
+*/
+func (o *Order) SetDec(keys DecKeys) {
+	d := &OrderDec{
+		Price:           decimal.NewFromFloat(o.Price),
+		Average:         decimal.NewFromFloat(o.Average),
+		Amount:          decimal.NewFromFloat(o.Amount),
+		Filled:          decimal.NewFromFloat(o.Filled),
+		Remaining:       decimal.NewFromFloat(o.Remaining),
+		TriggerPrice:    decimal.NewFromFloat(o.TriggerPrice),
+		StopPrice:       decimal.NewFromFloat(o.StopPrice),
+		TakeProfitPrice: decimal.NewFromFloat(o.TakeProfitPrice),
+		StopLossPrice:   decimal.NewFromFloat(o.StopLossPrice),
+		Cost:            decimal.NewFromFloat(o.Cost),
+	}
+	if o.Fee != nil {
+		d.FeeCost = decimal.NewFromFloat(o.Fee.Cost)
+	}
+	fillDecFields(map[string]*decimal.Decimal{
+		"Price": &d.Price, "Average": &d.Average, "Amount": &d.Amount, "Filled": &d.Filled,
+		"Remaining": &d.Remaining, "TriggerPrice": &d.TriggerPrice, "StopPrice": &d.StopPrice,
+		"TakeProfitPrice": &d.TakeProfitPrice, "StopLossPrice": &d.StopLossPrice, "Cost": &d.Cost,
+		"FeeCost": &d.FeeCost,
+	}, o.Info, keys)
+	if _, ok := keys["Remaining"]; !ok && !d.Amount.IsZero() {
+		d.Remaining = d.Amount.Sub(d.Filled)
+	}
+	if o.Fee != nil {
+		o.Fee.Dec = &FeeDec{Cost: d.FeeCost, Rate: decimal.NewFromFloat(o.Fee.Rate)}
+	}
+	o.Dec = d
+}
+
+/*
+SetDec set Dec from float fields, and override with raw strings in Info by keys
+*/
+func (p *Position) SetDec(keys DecKeys) {
+	d := &PositionDec{
+		Contracts:        decimal.NewFromFloat(p.Contracts),
+		ContractSize:     decimal.NewFromFloat(p.ContractSize),
+		EntryPrice:       decimal.NewFromFloat(p.EntryPrice),
+		MarkPrice:        decimal.NewFromFloat(p.MarkPrice),
+		Notional:         decimal.NewFromFloat(p.Notional),
+		Collateral:       decimal.NewFromFloat(p.Collateral),
+		InitialMargin:    decimal.NewFromFloat(p.InitialMargin),
+		MaintMargin:      decimal.NewFromFloat(p.MaintMargin),
+		UnrealizedPnl:    decimal.NewFromFloat(p.UnrealizedPnl),
+		LiquidationPrice: decimal.NewFromFloat(p.LiquidationPrice),
+	}
+	fillDecFields(map[string]*decimal.Decimal{
+		"Contracts": &d.Contracts, "ContractSize": &d.ContractSize, "EntryPrice": &d.EntryPrice,
+		"MarkPrice": &d.MarkPrice, "Notional": &d.Notional, "Collateral": &d.Collateral,
+		"InitialMargin": &d.InitialMargin, "MaintMargin": &d.MaintMargin, "UnrealizedPnl": &d.UnrealizedPnl,
+		"LiquidationPrice": &d.LiquidationPrice,
+	}, p.Info, keys)
+	if d.Contracts.IsNegative() {
+		// Contracts are always positive, side is used for direction
+		d.Contracts = d.Contracts.Neg()
+	}
+	p.Dec = d
+}
+
+/*
+SetDec set Dec of asset from raw strings, fallback to float fields
+*/
+func (a *Asset) SetDec(free, used, total, debt, upol string) {
+	a.Dec = &AssetDec{
+		Free:  DecStr(free, a.Free),
+		Used:  DecStr(used, a.Used),
+		Total: DecStr(total, a.Total),
+		Debt:  DecStr(debt, a.Debt),
+		UPol:  DecStr(upol, a.UPol),
+	}
+}
+
+/*
+SetDec set Dec of kline from raw strings, fallback to float fields
+*/
+func (k *Kline) SetDec(open, high, low, close, volume, quote, buyVolume string) {
+	k.Dec = &KlineDec{
+		Open:      DecStr(open, k.Open),
+		High:      DecStr(high, k.High),
+		Low:       DecStr(low, k.Low),
+		Close:     DecStr(close, k.Close),
+		Volume:    DecStr(volume, k.Volume),
+		Quote:     DecStr(quote, k.Quote),
+		BuyVolume: DecStr(buyVolume, k.BuyVolume),
+	}
+}
+
+/*
+SetDec set Dec of all assets from float fields, for adapters without raw strings
+*/
+func (b *Balances) SetDec() {
+	for _, a := range b.Assets {
+		if a.Dec == nil {
+			a.SetDec("", "", "", "", "")
+		}
+	}
+	for _, items := range b.IsolatedAssets {
+		for _, a := range items {
+			if a.Dec == nil {
+				a.SetDec("", "", "", "", "")
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package banexg
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseDec(t *testing.T) {
+	cases := []struct {
+		val  interface{}
+		want string
+		ok   bool
+	}{
+		{"0.30000000000000004", "0.30000000000000004", true},
+		{" 12.5 ", "12.5", true},
+		{json.Number("1e-8"), "0.00000001", true},
+		{0.1, "0.1", true},
+		{int64(7), "7", true},
+		{"", "0", false},
+		{"abc", "0", false},
+		{nil, "0", false},
+	}
+	for _, c := range cases {
+		res, ok := ParseDec(c.val)
+		if ok != c.ok || res.String() != c.want {
+			t.Errorf("ParseDec(%v) = %s, %v; want %s, %v", c.val, res, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestOrderSetDec(t *testing.T) {
+	od := &Order{
+		Price:  0.3,
+		Amount: 3,
+		Filled: 0.1 + 0.2,
+		Fee:    &Fee{Cost: 0.001, Rate: 0.0002},
+		Info: map[string]interface{}{
+			"price":       "0",
+			"origQty":     "3.000000000000000001",
+			"executedQty": "0.3",
+			"commission":  "0.00100000",
+		},
+	}
+	od.SetDec(DecKeys{
+		"Price":   {"price"},
+		"Amount":  {"quantity", "origQty"},
+		"Filled":  {"executedQty"},
+		"FeeCost": {"commission"},
+	})
+	if od.Dec == nil || od.Fee.Dec == nil {
+		t.Fatalf("Dec should be set")
+	}
+	// raw zero should not override derived value
+	if od.Dec.Price.String() != "0.3" {
+		t.Errorf("price = %s", od.Dec.Price)
+	}
+	if od.Dec.Amount.String() != "3.000000000000000001" {
+		t.Errorf("amount = %s", od.Dec.Amount)
+	}
+	if od.Dec.Filled.String() != "0.3" {
+		t.Errorf("filled = %s", od.Dec.Filled)
+	}
+	if od.Dec.Remaining.String() != "2.700000000000000001" {
+		t.Errorf("remaining = %s", od.Dec.Remaining)
+	}
+	if od.Fee.Dec.Cost.String() != "0.001" || od.Fee.Dec.Rate.String() != "0.0002" {
+		t.Errorf("fee = %+v", od.Fee.Dec)
+	}
+}
+
+func TestPositionSetDec(t *testing.T) {
+	pos := &Position{Contracts: 2, EntryPrice: 100, Info: map[string]interface{}{
+		"positionAmt": "-2.001",
+		"entryPrice":  "100.0000001",
+	}}
+	pos.SetDec(DecKeys{"Contracts": {"positionAmt"}, "EntryPrice": {"entryPrice"}})
+	if pos.Dec.Contracts.String() != "2.001" || pos.Dec.EntryPrice.String() != "100.0000001" {
+		t.Errorf("unexpected Dec: %+v", pos.Dec)
+	}
+}
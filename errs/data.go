@@ -66,6 +66,7 @@ const (
 	CodeOrderNotCancelable
 	CodeLeverageInvalid
 	CodePrecisionViolation
+	CodeCircuitOpen
 )
 
 var (
@@ -135,4 +136,5 @@ var errCodeNames = map[int]string{
 	CodeOrderNotCancelable:   "OrderNotCancelable",
 	CodeLeverageInvalid:      "LeverageInvalid",
 	CodePrecisionViolation:   "PrecisionViolation",
+	CodeCircuitOpen:          "CircuitOpen",
 }
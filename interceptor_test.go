@@ -0,0 +1,128 @@
+package banexg
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/banbox/banexg/errs"
+)
+
+func newInterceptExg(url string) *Exchange {
+	return &Exchange{
+		ExgInfo:    &ExgInfo{ID: "test"},
+		HttpClient: &http.Client{},
+		Sign: func(api *Entry, params map[string]interface{}) *HttpReq {
+			return &HttpReq{AccName: "acc1", Url: url + "/" + api.Path, Method: api.Method, Headers: http.Header{}}
+		},
+	}
+}
+
+func TestInterceptorChainOrder(t *testing.T) {
+	var gotHeader string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Get("X-Acc")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	e := newInterceptExg(srv.URL)
+	var trace []string
+	e.Use(func(next RoundTrip) RoundTrip {
+		return func(ctx context.Context, api *Entry, req *HttpReq) *HttpRes {
+			trace = append(trace, "outer")
+			req.Headers.Set("X-Acc", req.AccName)
+			res := next(ctx, api, req)
+			trace = append(trace, "outer-done")
+			return res
+		}
+	}, func(next RoundTrip) RoundTrip {
+		return func(ctx context.Context, api *Entry, req *HttpReq) *HttpRes {
+			trace = append(trace, "inner")
+			res := next(ctx, api, req)
+			if res.Error == nil || res.Error.Code != errs.CodeServerError {
+				t.Errorf("interceptor should see mapped error, got %v", res.Error)
+			}
+			return res
+		}
+	})
+	res := e.RequestApi(context.Background(), "", &Entry{Path: "ping", Method: "GET", RawHost: "intercept-order.test"},
+		nil, false, false)
+	if res.Status != http.StatusServiceUnavailable || gotHeader != "acc1" {
+		t.Fatalf("unexpected result: status %d, header %q", res.Status, gotHeader)
+	}
+	want := []string{"outer", "inner", "outer-done"}
+	if len(trace) != len(want) {
+		t.Fatalf("trace = %v", trace)
+	}
+	for i, v := range want {
+		if trace[i] != v {
+			t.Fatalf("trace = %v", trace)
+		}
+	}
+}
+
+func TestInterceptorFaultInjection(t *testing.T) {
+	e := newInterceptExg("http://127.0.0.1:1")
+	e.Use(func(next RoundTrip) RoundTrip {
+		return func(ctx context.Context, api *Entry, req *HttpReq) *HttpRes {
+			return &HttpRes{Url: req.Url, AccName: req.AccName, Status: 200, Content: `{"ok":true}`}
+		}
+	})
+	res := e.RequestApi(context.Background(), "", &Entry{Path: "ping", Method: "GET", RawHost: "intercept-fault.test"},
+		nil, false, false)
+	if res.Error != nil || res.Content != `{"ok":true}` {
+		t.Fatalf("injected response not returned: %#v", res)
+	}
+}
+
+func TestInterceptorSeesSignError(t *testing.T) {
+	e := newInterceptExg("")
+	e.Sign = func(api *Entry, params map[string]interface{}) *HttpReq {
+		return &HttpReq{Error: errs.NewMsg(errs.CodeCredsRequired, "no creds")}
+	}
+	var seen *errs.Error
+	e.Use(func(next RoundTrip) RoundTrip {
+		return func(ctx context.Context, api *Entry, req *HttpReq) *HttpRes {
+			seen = req.Error
+			return next(ctx, api, req)
+		}
+	})
+	res := e.RequestApi(context.Background(), "", &Entry{Path: "ping", RawHost: "intercept-sign.test"}, nil, false, false)
+	if seen == nil || res.Error == nil || res.Error.Code != errs.CodeCredsRequired {
+		t.Fatalf("sign error not propagated: %v %v", seen, res.Error)
+	}
+}
+
+func TestInterceptorUseConcurrent(t *testing.T) {
+	e := newInterceptExg("http://127.0.0.1:1")
+	var calls atomic.Int64
+	counter := func(next RoundTrip) RoundTrip {
+		return func(ctx context.Context, api *Entry, req *HttpReq) *HttpRes {
+			calls.Add(1)
+			return &HttpRes{Url: req.Url, AccName: req.AccName, Status: 200, Content: "{}"}
+		}
+	}
+	e.Use(counter)
+	api := &Entry{Path: "ping", Method: "GET", RawHost: "intercept-concurrent.test"}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			e.Use(func(next RoundTrip) RoundTrip { return next })
+		}()
+		go func() {
+			defer wg.Done()
+			if res := e.RequestApi(context.Background(), "", api, nil, false, false); res.Error != nil {
+				t.Errorf("request fail: %v", res.Error)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(e.Interceptors) != 9 || calls.Load() != 8 {
+		t.Fatalf("expect 9 interceptors and 8 calls, got %d %d", len(e.Interceptors), calls.Load())
+	}
+}
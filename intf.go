@@ -53,6 +53,7 @@ type BanExchange interface {
 	FetchIncomeHistory(inType string, symbol string, since int64, limit int, params map[string]interface{}) ([]*Income, *errs.Error)
 
 	CreateOrder(symbol, odType, side string, amount, price float64, params map[string]interface{}) (*Order, *errs.Error)
+	CreateOrderReq(req *OrderRequest) (*Order, *errs.Error)
 	EditOrder(symbol, orderId, side string, amount, price float64, params map[string]interface{}) (*Order, *errs.Error)
 	CancelOrder(id string, symbol string, params map[string]interface{}) (*Order, *errs.Error)
 
@@ -77,16 +78,22 @@ type BanExchange interface {
 
 	// SetDump Record all websocket messages to the specified file 将websocket所有消息记录到指定文件
 	SetDump(path string) *errs.Error
-	// SetReplay Replay all websocket messages from the specified file 从指定文件重放所有websocket消息
-	SetReplay(path string) *errs.Error
+	// SetReplay Replay websocket messages between fromMS and toMS (0 for no limit) from the specified file 从指定文件重放fromMS到toMS(0表示不限)之间的websocket消息
+	SetReplay(path string, fromMS, toMS int64) *errs.Error
 	// GetReplayTo Retrieve the 13 bit timestamp of the next message to be replayed, with sys. MaxInt64 indicating no next message 获取下一个要重放的消息13位时间戳，sys.MaxInt64表示无下一个消息
 	GetReplayTo() int64
 	// ReplayOne Replay the next websocket message 重放下一个websocket消息
 	ReplayOne() *errs.Error
 	// ReplayAll Replay all recorded websocket messages 重放所有记录的websocket消息
 	ReplayAll() *errs.Error
+	// SetApiDump Record all REST requests and responses to the specified file 将所有REST请求和响应记录到指定文件
+	SetApiDump(path string) *errs.Error
+	// SetApiReplay Serve REST requests from the specified record file without network 从指定记录文件响应REST请求，不访问网络
+	SetApiReplay(path string) *errs.Error
 	// SetOnWsChan Trigger callback when creating a new websocket message chan 创建新websocket消息chan时触发回调
 	SetOnWsChan(cb FuncOnWsChan)
+	// AddAfterWsReCon Add callback after a websocket connection is reconnected and re-subscribed, call the returned func to remove it 添加websocket重连并重新订阅后的回调，调用返回的函数移除
+	AddAfterWsReCon(cb FuncAfterWsReCon) func()
 
 	PrecAmount(m *Market, amount float64) (float64, *errs.Error)
 	PrecPrice(m *Market, price float64) (float64, *errs.Error)
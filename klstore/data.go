@@ -0,0 +1,11 @@
+package klstore
+
+const (
+	recSize  = 72   // bytes of one kline record: time, open, high, low, close, volume, quote, buy volume, trade num
+	idxSize  = 16   // bytes of one index entry: time, record number
+	idxStep  = 1024 // add an index entry every idxStep records
+	syncPage = 10   // pages of ExgInfo.KlinePage fetched by Sync before each append
+	defLimit = 500  // default limit of FetchOHLCV
+	extData  = ".dat"
+	extIndex = ".idx"
+)
@@ -0,0 +1,66 @@
+package klstore
+
+import (
+	"github.com/banbox/banexg"
+	"github.com/banbox/banexg/errs"
+	"github.com/banbox/banexg/log"
+	"github.com/banbox/banexg/utils"
+	"go.uber.org/zap"
+)
+
+// Wrap create exchange reading klines from store
+func Wrap(exg banexg.BanExchange, store *Store) *Exchange {
+	return &Exchange{BanExchange: exg, Store: store, Name: exg.Info().ID}
+}
+
+/*
+FetchOHLCV
+read klines from store with the same arguments as exchanges, banexg.ParamUntil is supported.
+When net is enabled and store doesn't cover the request, klines are synced first. As store is append-only,
+klines before the first stored one are not available.
+使用与交易所相同的参数从存储读取K线，支持banexg.ParamUntil。启用网络且存储未覆盖请求时先同步K线。
+由于存储仅追加，早于第一条存储K线的数据不可用
+*/
+func (e *Exchange) FetchOHLCV(symbol, timeframe string, since int64, limit int, params map[string]interface{}) ([]*banexg.Kline, *errs.Error) {
+	secs, err_ := utils.TFToSecSafe(timeframe)
+	if err_ != nil || secs <= 0 {
+		return nil, errs.NewMsg(errs.CodeInvalidTimeFrame, "invalid timeframe: %s", timeframe)
+	}
+	tfMSecs := int64(secs) * 1000
+	args := utils.SafeParams(params)
+	until := utils.PopMapVal(args, banexg.ParamUntil, int64(0))
+	if limit <= 0 {
+		limit = defLimit
+	}
+	if !e.GetNetDisable() {
+		first, last, count, err := e.Store.Range(e.Name, symbol, timeframe)
+		if err != nil {
+			return nil, err
+		}
+		need := until
+		if need <= 0 {
+			need = e.MilliSeconds()
+		}
+		if since > 0 {
+			need = min(need, since+int64(limit)*tfMSecs)
+		}
+		need = utils.AlignTfMSecs(need, tfMSecs)
+		if count == 0 || last+tfMSecs < need {
+			start := since
+			if start <= 0 {
+				start = need - int64(limit)*tfMSecs
+			}
+			if count > 0 && start < first {
+				log.Debug("klines before first stored are not available", zap.String("symbol", symbol),
+					zap.String("tf", timeframe))
+			}
+			if _, err = e.Store.sync(e.Name, e.BanExchange, symbol, timeframe, start, args); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if since > 0 {
+		return e.Store.Read(e.Name, symbol, timeframe, since, until, limit)
+	}
+	return e.Store.ReadLast(e.Name, symbol, timeframe, until, limit)
+}
@@ -0,0 +1,338 @@
+package klstore
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/banbox/banexg"
+	"github.com/banbox/banexg/errs"
+)
+
+// Open create store in dir, series files are opened on demand
+func Open(dir string) (*Store, *errs.Error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errs.New(errs.CodeIOWriteFail, err)
+	}
+	return &Store{Dir: dir, series: make(map[string]*series)}, nil
+}
+
+// symbolDir convert symbol to safe dir name, e.g. BTC/USDT:USDT -> BTC_USDT-USDT
+func symbolDir(symbol string) string {
+	return strings.NewReplacer("/", "_", ":", "-", "\\", "_").Replace(symbol)
+}
+
+// getSeries open series files, create them if create is true. lock required
+func (s *Store) getSeries(exgName, symbol, timeframe string, create bool) (*series, *errs.Error) {
+	key := exgName + "|" + symbol + "|" + timeframe
+	if res, ok := s.series[key]; ok {
+		return res, nil
+	}
+	path := filepath.Join(s.Dir, exgName, symbolDir(symbol), timeframe)
+	if !create {
+		if _, err := os.Stat(path + extData); err != nil {
+			return nil, nil
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, errs.New(errs.CodeIOWriteFail, err)
+	}
+	res, err := openSeries(path)
+	if err != nil {
+		return nil, err
+	}
+	s.series[key] = res
+	return res, nil
+}
+
+func openSeries(path string) (*series, *errs.Error) {
+	data, err_ := os.OpenFile(path+extData, os.O_RDWR|os.O_CREATE, 0644)
+	if err_ != nil {
+		return nil, errs.New(errs.CodeIOReadFail, err_)
+	}
+	index, err_ := os.OpenFile(path+extIndex, os.O_RDWR|os.O_CREATE, 0644)
+	if err_ != nil {
+		_ = data.Close()
+		return nil, errs.New(errs.CodeIOReadFail, err_)
+	}
+	res := &series{path: path, data: data, index: index}
+	if err := res.load(); err != nil {
+		res.close()
+		return nil, err
+	}
+	return res, nil
+}
+
+// load read count and index, drop partial record written by interrupted append, rebuild broken index
+func (r *series) load() *errs.Error {
+	stat, err_ := r.data.Stat()
+	if err_ != nil {
+		return errs.New(errs.CodeIOReadFail, err_)
+	}
+	r.count = stat.Size() / recSize
+	if stat.Size()%recSize != 0 {
+		if err_ = r.data.Truncate(r.count * recSize); err_ != nil {
+			return errs.New(errs.CodeIOWriteFail, err_)
+		}
+	}
+	if r.count == 0 {
+		r.items = nil
+		if err_ = r.index.Truncate(0); err_ != nil {
+			return errs.New(errs.CodeIOWriteFail, err_)
+		}
+		return nil
+	}
+	raw, err_ := io.ReadAll(io.NewSectionReader(r.index, 0, math.MaxInt64))
+	if err_ != nil {
+		return errs.New(errs.CodeIOReadFail, err_)
+	}
+	r.items = make([]*idxEntry, 0, len(raw)/idxSize)
+	for i := 0; i+idxSize <= len(raw); i += idxSize {
+		r.items = append(r.items, &idxEntry{
+			time:  int64(binary.LittleEndian.Uint64(raw[i:])),
+			recNo: int64(binary.LittleEndian.Uint64(raw[i+8:])),
+		})
+	}
+	expect := (r.count + idxStep - 1) / idxStep
+	if int64(len(r.items)) != expect || len(raw)%idxSize != 0 {
+		if err := r.rebuildIndex(); err != nil {
+			return err
+		}
+	}
+	first, err := r.readAt(0, 1)
+	if err != nil {
+		return err
+	}
+	last, err := r.readAt(r.count-1, 1)
+	if err != nil {
+		return err
+	}
+	r.first, r.last = first[0].Time, last[0].Time
+	return nil
+}
+
+func (r *series) rebuildIndex() *errs.Error {
+	r.items = make([]*idxEntry, 0, r.count/idxStep+1)
+	buf := make([]byte, 0, (r.count/idxStep+1)*idxSize)
+	for recNo := int64(0); recNo < r.count; recNo += idxStep {
+		k, err := r.readAt(recNo, 1)
+		if err != nil {
+			return err
+		}
+		r.items = append(r.items, &idxEntry{time: k[0].Time, recNo: recNo})
+		buf = appendIndex(buf, k[0].Time, recNo)
+	}
+	if err := r.index.Truncate(0); err != nil {
+		return errs.New(errs.CodeIOWriteFail, err)
+	}
+	if _, err := r.index.WriteAt(buf, 0); err != nil {
+		return errs.New(errs.CodeIOWriteFail, err)
+	}
+	return nil
+}
+
+func appendIndex(buf []byte, time, recNo int64) []byte {
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(time))
+	return binary.LittleEndian.AppendUint64(buf, uint64(recNo))
+}
+
+func (r *series) close() {
+	_ = r.data.Close()
+	_ = r.index.Close()
+}
+
+func encodeKline(buf []byte, k *banexg.Kline) []byte {
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(k.Time))
+	for _, v := range []float64{k.Open, k.High, k.Low, k.Close, k.Volume, k.Quote, k.BuyVolume} {
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(v))
+	}
+	return binary.LittleEndian.AppendUint64(buf, uint64(k.TradeNum))
+}
+
+func decodeKline(buf []byte) *banexg.Kline {
+	f := func(i int) float64 {
+		return math.Float64frombits(binary.LittleEndian.Uint64(buf[i*8:]))
+	}
+	return &banexg.Kline{
+		Time:      int64(binary.LittleEndian.Uint64(buf)),
+		Open:      f(1),
+		High:      f(2),
+		Low:       f(3),
+		Close:     f(4),
+		Volume:    f(5),
+		Quote:     f(6),
+		BuyVolume: f(7),
+		TradeNum:  int64(binary.LittleEndian.Uint64(buf[64:])),
+	}
+}
+
+// readAt read num records from recNo
+func (r *series) readAt(recNo, num int64) ([]*banexg.Kline, *errs.Error) {
+	num = min(num, r.count-recNo)
+	if num <= 0 {
+		return nil, nil
+	}
+	buf := make([]byte, num*recSize)
+	if _, err := r.data.ReadAt(buf, recNo*recSize); err != nil {
+		return nil, errs.New(errs.CodeIOReadFail, err)
+	}
+	res := make([]*banexg.Kline, 0, num)
+	for i := int64(0); i < num; i++ {
+		res = append(res, decodeKline(buf[i*recSize:]))
+	}
+	return res, nil
+}
+
+// search return number of the first record with time >= stamp
+func (r *series) search(stamp int64) (int64, *errs.Error) {
+	if r.count == 0 || stamp <= r.first {
+		return 0, nil
+	}
+	if stamp > r.last {
+		return r.count, nil
+	}
+	// the last index entry before stamp
+	i := sort.Search(len(r.items), func(i int) bool {
+		return r.items[i].time >= stamp
+	})
+	from := int64(0)
+	if i > 0 {
+		from = r.items[i-1].recNo
+	}
+	bars, err := r.readAt(from, idxStep+1)
+	if err != nil {
+		return 0, err
+	}
+	j := sort.Search(len(bars), func(j int) bool {
+		return bars[j].Time >= stamp
+	})
+	return from + int64(j), nil
+}
+
+/*
+Append
+append klines after the last stored one, klines not newer than the last are skipped. return number appended
+在最后一条之后追加K线，不晚于最后一条的会被跳过。返回追加的数量
+*/
+func (s *Store) Append(exgName, symbol, timeframe string, bars []*banexg.Kline) (int, *errs.Error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	r, err := s.getSeries(exgName, symbol, timeframe, true)
+	if err != nil {
+		return 0, err
+	}
+	buf := make([]byte, 0, len(bars)*recSize)
+	var idxBuf []byte
+	var items []*idxEntry
+	count, last := r.count, r.last
+	for _, k := range bars {
+		if count > 0 && k.Time <= last {
+			continue
+		}
+		if count%idxStep == 0 {
+			items = append(items, &idxEntry{time: k.Time, recNo: count})
+			idxBuf = appendIndex(idxBuf, k.Time, count)
+		}
+		buf = encodeKline(buf, k)
+		count += 1
+		last = k.Time
+	}
+	num := count - r.count
+	if num == 0 {
+		return 0, nil
+	}
+	// data is written first, index is rebuilt on load if interrupted
+	if _, err_ := r.data.WriteAt(buf, r.count*recSize); err_ != nil {
+		return 0, errs.New(errs.CodeIOWriteFail, err_)
+	}
+	if len(idxBuf) > 0 {
+		if _, err_ := r.index.WriteAt(idxBuf, int64(len(r.items))*idxSize); err_ != nil {
+			return 0, errs.New(errs.CodeIOWriteFail, err_)
+		}
+	}
+	if r.count == 0 {
+		r.first = items[0].time
+	}
+	r.items = append(r.items, items...)
+	r.count, r.last = count, last
+	return int(num), nil
+}
+
+/*
+Range
+return time of first and last stored klines, and number of klines. count is 0 if nothing stored
+返回已存储的第一条和最后一条K线时间及数量，无数据时count为0
+*/
+func (s *Store) Range(exgName, symbol, timeframe string) (int64, int64, int, *errs.Error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	r, err := s.getSeries(exgName, symbol, timeframe, false)
+	if err != nil || r == nil {
+		return 0, 0, 0, err
+	}
+	return r.first, r.last, int(r.count), nil
+}
+
+/*
+Read
+read klines with time in [start, end), end is not limited if 0. at most limit klines are returned if limit > 0
+读取时间在[start, end)的K线，end为0时不限制。limit大于0时最多返回limit条
+*/
+func (s *Store) Read(exgName, symbol, timeframe string, start, end int64, limit int) ([]*banexg.Kline, *errs.Error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	r, err := s.getSeries(exgName, symbol, timeframe, false)
+	if err != nil || r == nil {
+		return nil, err
+	}
+	from, err := r.search(start)
+	if err != nil {
+		return nil, err
+	}
+	to := r.count
+	if end > 0 {
+		if to, err = r.search(end); err != nil {
+			return nil, err
+		}
+	}
+	if limit > 0 {
+		to = min(to, from+int64(limit))
+	}
+	return r.readAt(from, to-from)
+}
+
+/*
+ReadLast
+read the last limit klines with time before end, end is not limited if 0
+读取时间在end之前的最后limit条K线，end为0时不限制
+*/
+func (s *Store) ReadLast(exgName, symbol, timeframe string, end int64, limit int) ([]*banexg.Kline, *errs.Error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	r, err := s.getSeries(exgName, symbol, timeframe, false)
+	if err != nil || r == nil {
+		return nil, err
+	}
+	to := r.count
+	if end > 0 {
+		if to, err = r.search(end); err != nil {
+			return nil, err
+		}
+	}
+	from := max(to-int64(limit), 0)
+	return r.readAt(from, to-from)
+}
+
+// Close close all opened files
+func (s *Store) Close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for key, r := range s.series {
+		r.close()
+		delete(s.series, key)
+	}
+}
@@ -0,0 +1,141 @@
+package klstore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/banbox/banexg"
+	"github.com/banbox/banexg/errs"
+)
+
+// 2024-01-01 00:00:00 UTC
+const baseMS = int64(1704067200000)
+
+func makeBars(start int64, num int) []*banexg.Kline {
+	res := make([]*banexg.Kline, 0, num)
+	for i := 0; i < num; i++ {
+		p := float64(i)
+		res = append(res, &banexg.Kline{Time: start + int64(i)*60000, Open: p, High: p + 1, Low: p - 1, Close: p,
+			Volume: 1, Quote: p, BuyVolume: 0.5, TradeNum: int64(i)})
+	}
+	return res
+}
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatalf("open fail: %v", err)
+	}
+	bars := makeBars(baseMS, 3000)
+	num, err := store.Append("binance", "BTC/USDT:USDT", "1m", bars[:2000])
+	if err != nil || num != 2000 {
+		t.Fatalf("append fail: %v %d", err, num)
+	}
+	// overlapped klines are skipped
+	num, err = store.Append("binance", "BTC/USDT:USDT", "1m", bars[1500:])
+	if err != nil || num != 1000 {
+		t.Fatalf("append overlap fail: %v %d", err, num)
+	}
+	res, err := store.Read("binance", "BTC/USDT:USDT", "1m", bars[1500].Time, bars[1510].Time, 0)
+	if err != nil || len(res) != 10 || *res[0] != *bars[1500] {
+		t.Fatalf("read fail: %v %d", err, len(res))
+	}
+	res, err = store.ReadLast("binance", "BTC/USDT:USDT", "1m", 0, 5)
+	if err != nil || len(res) != 5 || res[4].Time != bars[2999].Time {
+		t.Fatalf("read last fail: %v %d", err, len(res))
+	}
+	store.Close()
+
+	// partial record and broken index are repaired on load
+	path := filepath.Join(dir, "binance", "BTC_USDT-USDT", "1m")
+	f, _ := os.OpenFile(path+extData, os.O_APPEND|os.O_WRONLY, 0644)
+	_, _ = f.Write([]byte{1, 2, 3})
+	_ = f.Close()
+	_ = os.Truncate(path+extIndex, 5)
+	store, err = Open(dir)
+	if err != nil {
+		t.Fatalf("reopen fail: %v", err)
+	}
+	defer store.Close()
+	first, last, count, err := store.Range("binance", "BTC/USDT:USDT", "1m")
+	if err != nil || count != 3000 || first != bars[0].Time || last != bars[2999].Time {
+		t.Fatalf("range wrong: %v %d", err, count)
+	}
+	res, err = store.Read("binance", "BTC/USDT:USDT", "1m", bars[2100].Time+1, 0, 3)
+	if err != nil || len(res) != 3 || res[0].Time != bars[2101].Time {
+		t.Fatalf("read after reopen fail: %v %d", err, len(res))
+	}
+	if _, _, count, _ = store.Range("okx", "BTC/USDT:USDT", "1m"); count != 0 {
+		t.Fatalf("missing series should be empty")
+	}
+}
+
+type fakeExg struct {
+	*banexg.Exchange
+	bars  []*banexg.Kline
+	now   int64
+	calls int
+}
+
+func (e *fakeExg) MilliSeconds() int64 {
+	return e.now
+}
+
+func (e *fakeExg) FetchOHLCV(symbol, timeframe string, since int64, limit int, params map[string]interface{}) ([]*banexg.Kline, *errs.Error) {
+	if e.NetDisable {
+		return nil, errs.NewMsg(errs.CodeNetDisable, "net disabled")
+	}
+	e.calls += 1
+	var res []*banexg.Kline
+	for _, k := range e.bars {
+		if k.Time >= since && k.Time <= e.now && len(res) < limit {
+			res = append(res, k)
+		}
+	}
+	return res, nil
+}
+
+func TestSync(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("open fail: %v", err)
+	}
+	defer store.Close()
+	inner := &fakeExg{
+		Exchange: &banexg.Exchange{ExgInfo: &banexg.ExgInfo{ID: "fake", KlinePage: 100}},
+		bars:     makeBars(baseMS, 5000),
+		now:      baseMS + 1000*60000 + 30000,
+	}
+	num, err := store.Sync(inner, "BTC/USDT", "1m", baseMS, nil)
+	if err != nil || num != 1000 {
+		t.Fatalf("sync fail: %v %d", err, num)
+	}
+	// resume from the last stored kline
+	inner.now += 500 * 60000
+	inner.calls = 0
+	num, err = store.Sync(inner, "BTC/USDT", "1m", baseMS, nil)
+	if err != nil || num != 500 || inner.calls > 6 {
+		t.Fatalf("resume sync fail: %v %d calls %d", err, num, inner.calls)
+	}
+
+	// read offline with the same signature as exchanges
+	inner.NetDisable = true
+	exg := Wrap(inner, store)
+	res, err := exg.FetchOHLCV("BTC/USDT", "1m", baseMS+100*60000, 10, nil)
+	if err != nil || len(res) != 10 || res[0].Time != baseMS+100*60000 {
+		t.Fatalf("offline fetch fail: %v %d", err, len(res))
+	}
+	res, err = exg.FetchOHLCV("BTC/USDT", "1m", 0, 10, map[string]interface{}{banexg.ParamUntil: baseMS + 200*60000})
+	if err != nil || len(res) != 10 || res[9].Time != baseMS+199*60000 {
+		t.Fatalf("offline fetch until fail: %v %d", err, len(res))
+	}
+	// missing klines are synced when net is enabled
+	inner.NetDisable = false
+	inner.now += 100 * 60000
+	res, err = exg.FetchOHLCV("BTC/USDT", "1m", 0, 10, nil)
+	if err != nil || len(res) != 10 || res[9].Time != baseMS+1599*60000 {
+		t.Fatalf("fetch with sync fail: %v %d", err, len(res))
+	}
+}
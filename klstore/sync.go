@@ -0,0 +1,64 @@
+package klstore
+
+import (
+	"github.com/banbox/banexg"
+	"github.com/banbox/banexg/errs"
+	"github.com/banbox/banexg/log"
+	"github.com/banbox/banexg/utils"
+	"go.uber.org/zap"
+)
+
+/*
+Sync
+download finished klines of symbol from exg by banexg.FetchOHLCVRange and append them to store.
+It resumes from the last stored kline, start is only used when nothing is stored. return number appended
+通过banexg.FetchOHLCVRange从exg下载品种已完成的K线并追加到存储。从最后存储的K线继续，start仅在无数据时使用。返回追加的数量
+*/
+func (s *Store) Sync(exg banexg.BanExchange, symbol, timeframe string, start int64, params map[string]interface{}) (int, *errs.Error) {
+	return s.sync(exg.Info().ID, exg, symbol, timeframe, start, params)
+}
+
+func (s *Store) sync(name string, exg banexg.BanExchange, symbol, timeframe string, start int64, params map[string]interface{}) (int, *errs.Error) {
+	secs, err_ := utils.TFToSecSafe(timeframe)
+	if err_ != nil || secs <= 0 {
+		return 0, errs.NewMsg(errs.CodeInvalidTimeFrame, "invalid timeframe: %s", timeframe)
+	}
+	tfMSecs := int64(secs) * 1000
+	_, last, count, err := s.Range(name, symbol, timeframe)
+	if err != nil {
+		return 0, err
+	}
+	since := start
+	if count > 0 {
+		since = last + tfMSecs
+	}
+	if since <= 0 {
+		return 0, errs.NewMsg(errs.CodeParamRequired, "start is required for empty store: %s %s", symbol, timeframe)
+	}
+	// klines before end are finished
+	end := utils.AlignTfMSecs(exg.MilliSeconds(), tfMSecs)
+	page := defLimit
+	if info := exg.Info(); info != nil && info.KlinePage > 0 {
+		page = info.KlinePage
+	}
+	chunk := int64(page*syncPage) * tfMSecs
+	total := 0
+	for since < end {
+		to := min(since+chunk, end)
+		rng, err := banexg.FetchOHLCVRange(exg, symbol, timeframe, since, to, params)
+		if err != nil {
+			return total, err
+		}
+		if len(rng.Holes) > 0 {
+			log.Debug("kline holes found", zap.String("symbol", symbol), zap.String("tf", timeframe),
+				zap.Int("num", len(rng.Holes)))
+		}
+		num, err := s.Append(name, symbol, timeframe, rng.Klines)
+		if err != nil {
+			return total, err
+		}
+		total += num
+		since = to
+	}
+	return total, nil
+}
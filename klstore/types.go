@@ -0,0 +1,49 @@
+package klstore
+
+import (
+	"os"
+
+	"github.com/banbox/banexg"
+	"github.com/sasha-s/go-deadlock"
+)
+
+/*
+Store
+append-only file store of klines, one data file and one index file for each exchange/symbol/timeframe.
+Data file is a list of fixed size little endian records in time order; index file holds (time, record number)
+of every idxStep records, and is rebuilt from data file if broken.
+仅追加的K线文件存储，每个交易所/品种/周期一个数据文件和一个索引文件。数据文件是按时间顺序的定长小端记录；
+索引文件保存每idxStep条记录的(时间, 记录序号)，损坏时从数据文件重建
+*/
+type Store struct {
+	Dir    string
+	lock   deadlock.Mutex
+	series map[string]*series
+}
+
+// series opened data of one exchange/symbol/timeframe
+type series struct {
+	path  string // path without extension
+	data  *os.File
+	index *os.File
+	count int64       // number of records
+	first int64       // time of first record
+	last  int64       // time of last record
+	items []*idxEntry // all index entries
+}
+
+type idxEntry struct {
+	time  int64
+	recNo int64
+}
+
+/*
+Exchange
+wrap an exchange, FetchOHLCV reads klines from Store, missing klines are synced first unless net is disabled
+包装交易所，FetchOHLCV从Store读取K线，除非禁用网络，否则先同步缺失的K线
+*/
+type Exchange struct {
+	banexg.BanExchange
+	Store *Store
+	Name  string // exchange name in store, ID of wrapped exchange by default
+}
@@ -0,0 +1,303 @@
+package banexg
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sasha-s/go-deadlock"
+)
+
+/*
+MetricsHook
+receive SDK health events. Implementations must be safe for concurrent use and should return quickly.
+接收SDK运行状况事件。实现需并发安全，且应尽快返回
+*/
+type MetricsHook interface {
+	// OnRequest called after each RequestApi round trip, errCode is 0 when succeed
+	OnRequest(exgID, endpoint string, status, errCode int, cost time.Duration)
+	// OnRateLimitWait called when a request has to wait for rate limit of host
+	OnRateLimitWait(host string, wait time.Duration)
+	// OnHostQueue called when the number of requests waiting for host semaphore changes
+	OnHostQueue(host string, depth int)
+	// OnWsReconnect called after a websocket connection reconnected
+	OnWsReconnect(exgID, url string)
+	// OnSubsStale report milliseconds since the last message of a subscription key, every SubsStaleIntv
+	OnSubsStale(exgID, key string, staleMS int64)
+	// OnOutChanDrop called when a message is dropped by a full out chan
+	OnOutChanDrop(exgID, chanKey string)
+	// OnBookResync called when a local order book is broken by a sequence gap or checksum mismatch and resynced
+	OnBookResync(exgID, symbol, reason string)
+}
+
+var (
+	// DefMetrics is used by exchanges with Metrics unset, and for host level events
+	DefMetrics MetricsHook
+)
+
+func (e *Exchange) metrics() MetricsHook {
+	if e != nil && e.Metrics != nil {
+		return e.Metrics
+	}
+	return DefMetrics
+}
+
+// SubsStaleIntv interval to report OnSubsStale for subscriptions of all ws clients 报告订阅未更新时长的间隔
+var SubsStaleIntv = time.Second * 5
+
+// startSubsStale start the loop reporting OnSubsStale once, called when a ws client is created
+func (e *Exchange) startSubsStale() {
+	e.lockStale.Lock()
+	defer e.lockStale.Unlock()
+	if e.staleStop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	e.staleStop = stop
+	go func() {
+		ticker := time.NewTicker(SubsStaleIntv)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				e.ReportSubsStale()
+			}
+		}
+	}()
+}
+
+func (e *Exchange) stopSubsStale() {
+	e.lockStale.Lock()
+	defer e.lockStale.Unlock()
+	if e.staleStop != nil {
+		close(e.staleStop)
+		e.staleStop = nil
+	}
+}
+
+/*
+ReportSubsStale
+report OnSubsStale for subscription keys of all ws clients. Called every SubsStaleIntv for all exchanges
+after the first ws client created, can also be called manually.
+为所有ws客户端的订阅key报告OnSubsStale。创建首个ws客户端后对所有交易所每SubsStaleIntv调用一次，也可手动调用
+*/
+func (e *Exchange) ReportSubsStale() {
+	hook := e.metrics()
+	if hook == nil {
+		return
+	}
+	for _, client := range e.GetWsClients() {
+		client.reportSubsStale(hook, e.ID)
+	}
+}
+
+var defLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type metricKey struct {
+	name   string
+	labels string
+}
+
+type histogram struct {
+	counts []uint64 // cumulative counts for each bucket
+	count  uint64
+	sum    float64
+}
+
+/*
+PromMetrics
+A MetricsHook collecting values in memory, which can be exported as Prometheus text format by WriteTo.
+No http server is started, serve Text() in your own handler if needed.
+在内存中收集指标，可通过WriteTo导出为Prometheus文本格式。不启动http服务
+*/
+type PromMetrics struct {
+	Buckets  []float64 // latency buckets in seconds
+	counters map[metricKey]float64
+	gauges   map[metricKey]float64
+	hists    map[metricKey]*histogram
+	helps    map[string][2]string // name: type, help
+	lock     deadlock.Mutex
+}
+
+func NewPromMetrics() *PromMetrics {
+	return &PromMetrics{
+		Buckets:  defLatencyBuckets,
+		counters: make(map[metricKey]float64),
+		gauges:   make(map[metricKey]float64),
+		hists:    make(map[metricKey]*histogram),
+		helps:    make(map[string][2]string),
+	}
+}
+
+// promEscaper escape label values as Prometheus text format: only backslash, double quote and newline
+var promEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func promLabels(pairs ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(pairs[i])
+		b.WriteString("=")
+		b.WriteString(`"`)
+		b.WriteString(promEscaper.Replace(pairs[i+1]))
+		b.WriteString(`"`)
+	}
+	return b.String()
+}
+
+func (m *PromMetrics) addCounter(name, help string, val float64, labels ...string) {
+	m.lock.Lock()
+	m.helps[name] = [2]string{"counter", help}
+	m.counters[metricKey{name, promLabels(labels...)}] += val
+	m.lock.Unlock()
+}
+
+func (m *PromMetrics) setGauge(name, help string, val float64, labels ...string) {
+	m.lock.Lock()
+	m.helps[name] = [2]string{"gauge", help}
+	m.gauges[metricKey{name, promLabels(labels...)}] = val
+	m.lock.Unlock()
+}
+
+func (m *PromMetrics) observe(name, help string, val float64, labels ...string) {
+	key := metricKey{name, promLabels(labels...)}
+	m.lock.Lock()
+	m.helps[name] = [2]string{"histogram", help}
+	hist, ok := m.hists[key]
+	if !ok {
+		hist = &histogram{counts: make([]uint64, len(m.Buckets))}
+		m.hists[key] = hist
+	}
+	for i, bound := range m.Buckets {
+		if val <= bound {
+			hist.counts[i] += 1
+		}
+	}
+	hist.count += 1
+	hist.sum += val
+	m.lock.Unlock()
+}
+
+func (m *PromMetrics) OnRequest(exgID, endpoint string, status, errCode int, cost time.Duration) {
+	m.addCounter("banexg_requests_total", "REST requests by endpoint and error code", 1,
+		"exg", exgID, "endpoint", endpoint, "status", strconv.Itoa(status), "code", strconv.Itoa(errCode))
+	m.observe("banexg_request_duration_seconds", "REST request latency", cost.Seconds(),
+		"exg", exgID, "endpoint", endpoint)
+}
+
+func (m *PromMetrics) OnRateLimitWait(host string, wait time.Duration) {
+	m.addCounter("banexg_rate_limit_waits_total", "requests delayed by rate limit", 1, "host", host)
+	m.addCounter("banexg_rate_limit_wait_seconds_total", "total seconds waited for rate limit",
+		wait.Seconds(), "host", host)
+}
+
+func (m *PromMetrics) OnHostQueue(host string, depth int) {
+	m.setGauge("banexg_host_queue_depth", "requests waiting for host semaphore", float64(depth), "host", host)
+}
+
+func (m *PromMetrics) OnWsReconnect(exgID, url string) {
+	m.addCounter("banexg_ws_reconnects_total", "websocket reconnections", 1, "exg", exgID, "url", url)
+}
+
+func (m *PromMetrics) OnSubsStale(exgID, key string, staleMS int64) {
+	m.setGauge("banexg_ws_sub_stale_seconds", "seconds since the last message of subscription",
+		float64(staleMS)/1000, "exg", exgID, "key", key)
+}
+
+func (m *PromMetrics) OnOutChanDrop(exgID, chanKey string) {
+	m.addCounter("banexg_out_chan_drops_total", "messages dropped by full out chan", 1,
+		"exg", exgID, "key", chanKey)
+}
+
+func (m *PromMetrics) OnBookResync(exgID, symbol, reason string) {
+	m.addCounter("banexg_book_resyncs_total", "order book resyncs", 1,
+		"exg", exgID, "symbol", symbol, "reason", reason)
+}
+
+func formatPromValue(val float64) string {
+	return strconv.FormatFloat(val, 'g', -1, 64)
+}
+
+func writePromLine(b *strings.Builder, name, labels string, val string) {
+	b.WriteString(name)
+	if labels != "" {
+		b.WriteString("{")
+		b.WriteString(labels)
+		b.WriteString("}")
+	}
+	b.WriteString(" ")
+	b.WriteString(val)
+	b.WriteString("\n")
+}
+
+func joinLabels(labels, extra string) string {
+	if labels == "" {
+		return extra
+	}
+	return labels + "," + extra
+}
+
+/*
+Text return all metrics in Prometheus text exposition format
+*/
+func (m *PromMetrics) Text() string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	byName := make(map[string][]metricKey)
+	for k := range m.counters {
+		byName[k.name] = append(byName[k.name], k)
+	}
+	for k := range m.gauges {
+		byName[k.name] = append(byName[k.name], k)
+	}
+	for k := range m.hists {
+		byName[k.name] = append(byName[k.name], k)
+	}
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		meta := m.helps[name]
+		b.WriteString(fmt.Sprintf("# HELP %s %s\n# TYPE %s %s\n", name, meta[1], name, meta[0]))
+		keys := byName[name]
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].labels < keys[j].labels
+		})
+		for _, k := range keys {
+			switch meta[0] {
+			case "counter":
+				writePromLine(&b, name, k.labels, formatPromValue(m.counters[k]))
+			case "gauge":
+				writePromLine(&b, name, k.labels, formatPromValue(m.gauges[k]))
+			case "histogram":
+				hist := m.hists[k]
+				for i, bound := range m.Buckets {
+					le := "le=" + strconv.Quote(formatPromValue(bound))
+					writePromLine(&b, name+"_bucket", joinLabels(k.labels, le), strconv.FormatUint(hist.counts[i], 10))
+				}
+				writePromLine(&b, name+"_bucket", joinLabels(k.labels, `le="+Inf"`), strconv.FormatUint(hist.count, 10))
+				writePromLine(&b, name+"_sum", k.labels, formatPromValue(hist.sum))
+				writePromLine(&b, name+"_count", k.labels, strconv.FormatUint(hist.count, 10))
+			}
+		}
+	}
+	return b.String()
+}
+
+/*
+WriteTo write metrics in Prometheus text format, implements io.WriterTo
+*/
+func (m *PromMetrics) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, m.Text())
+	return int64(n), err
+}
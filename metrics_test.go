@@ -0,0 +1,93 @@
+package banexg
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPromMetricsText(t *testing.T) {
+	m := NewPromMetrics()
+	m.OnRequest("binance", "ping", 200, 0, time.Millisecond*80)
+	m.OnRequest("binance", "ping", 200, 0, time.Second*3)
+	m.OnRateLimitWait("api.binance.com", time.Millisecond*500)
+	m.OnHostQueue("api.binance.com", 3)
+	m.OnOutChanDrop("binance", "trades")
+	m.OnBookResync("okx", "BTC/USDT", BookResyncChecksum)
+	text := m.Text()
+	wants := []string{
+		"# TYPE banexg_requests_total counter",
+		`banexg_requests_total{exg="binance",endpoint="ping",status="200",code="0"} 2`,
+		`banexg_request_duration_seconds_bucket{exg="binance",endpoint="ping",le="0.1"} 1`,
+		`banexg_request_duration_seconds_bucket{exg="binance",endpoint="ping",le="+Inf"} 2`,
+		`banexg_request_duration_seconds_count{exg="binance",endpoint="ping"} 2`,
+		`banexg_rate_limit_wait_seconds_total{host="api.binance.com"} 0.5`,
+		`banexg_host_queue_depth{host="api.binance.com"} 3`,
+		`banexg_out_chan_drops_total{exg="binance",key="trades"} 1`,
+		`banexg_book_resyncs_total{exg="okx",symbol="BTC/USDT",reason="checksum"} 1`,
+	}
+	for _, w := range wants {
+		if !strings.Contains(text, w) {
+			t.Errorf("missing %q in:\n%s", w, text)
+		}
+	}
+}
+
+func TestRequestApiMetrics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	e := newInterceptExg(srv.URL)
+	m := NewPromMetrics()
+	e.Metrics = m
+	res := e.RequestApi(context.Background(), "", &Entry{Path: "ping", Method: "GET", RawHost: "metrics.test"},
+		nil, false, false)
+	if res.Error == nil {
+		t.Fatalf("expect error for 503")
+	}
+	text := m.Text()
+	want := `banexg_requests_total{exg="test",endpoint="ping",status="503",code="` + strconv.Itoa(res.Error.Code) + `"} 1`
+	if !strings.Contains(text, want) {
+		t.Errorf("missing %q in:\n%s", want, text)
+	}
+	if !strings.Contains(text, `banexg_host_queue_depth{host="metrics.test"} 0`) {
+		t.Errorf("host queue depth not reported:\n%s", text)
+	}
+}
+
+func TestReportSubsStale(t *testing.T) {
+	m := NewPromMetrics()
+	clock := NewFixedClock(10000)
+	exg := &Exchange{ExgInfo: &ExgInfo{ID: "okx"}, Clock: clock, Metrics: m}
+	client := &WsClient{
+		Exg:           exg,
+		SubscribeKeys: map[string]int{"trades:BTC-USDT": 1, "books:BTC-USDT": 1},
+		SubsKeyStamps: map[string]int64{},
+		subsKeyMap:    map[string]string{},
+	}
+	exg.WSClients = map[string]*WsClient{"@wss": client}
+	client.SetSubsKeyStamp("trades:BTC-USDT", exg.MilliSeconds())
+	clock.Add(2500)
+	exg.ReportSubsStale()
+	text := m.Text()
+	want := `banexg_ws_sub_stale_seconds{exg="okx",key="trades:BTC-USDT"} 2.5`
+	if !strings.Contains(text, want) {
+		t.Fatalf("missing %q in:\n%s", want, text)
+	}
+	if strings.Contains(text, "books:BTC-USDT") {
+		t.Fatalf("keys never received should not be reported:\n%s", text)
+	}
+}
+
+func TestPromLabelsEscape(t *testing.T) {
+	got := promLabels("key", "a\"b\\c\nd", "sym", "币安@BTC")
+	want := `key="a\"b\\c\nd",sym="币安@BTC"`
+	if got != want {
+		t.Fatalf("expect %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,135 @@
+package banexg
+
+import (
+	"sort"
+
+	"github.com/banbox/banexg/errs"
+	"github.com/banbox/banexg/utils"
+)
+
+/*
+FetchOHLCVRange
+fetch klines in [start, end) by paging FetchOHLCV of exg, forward from start or backward from end
+by ExgInfo.KlineBack. Boundary klines are deduplicated, end is current time if 0.
+Ranges without klines longer than ExgInfo.Min1mHole minutes are reported as holes, note that market
+closures of non 24h markets are also reported.
+通过分页调用exg的FetchOHLCV获取[start, end)的K线，根据ExgInfo.KlineBack从start向后或从end向前分页。
+边界K线会去重，end为0时使用当前时间。超过ExgInfo.Min1mHole分钟的无K线区间作为空洞返回，非24小时市场的休市也会包含在内
+*/
+func FetchOHLCVRange(exg BanExchange, symbol, timeframe string, start, end int64, params map[string]interface{}) (*KlineRange, *errs.Error) {
+	secs, err_ := utils.TFToSecSafe(timeframe)
+	if err_ != nil || secs <= 0 {
+		return nil, errs.NewMsg(errs.CodeInvalidTimeFrame, "invalid timeframe: %s", timeframe)
+	}
+	tfMSecs := int64(secs) * 1000
+	if end <= 0 {
+		end = exg.MilliSeconds()
+	}
+	if start <= 0 || start >= end {
+		return nil, errs.NewMsg(errs.CodeParamInvalid, "invalid range: %d - %d", start, end)
+	}
+	info := exg.Info()
+	page, back, minHole := 500, false, int64(1)
+	if info != nil {
+		if info.KlinePage > 0 {
+			page = info.KlinePage
+		}
+		back = info.KlineBack
+		minHole = max(int64(info.Min1mHole), 1)
+	}
+	var bars []*Kline
+	var err *errs.Error
+	if back {
+		bars, err = pageKlinesBack(exg, symbol, timeframe, start, end, page, params)
+	} else {
+		bars, err = pageKlines(exg, symbol, timeframe, tfMSecs, start, end, page, params)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(bars, func(i, j int) bool {
+		return bars[i].Time < bars[j].Time
+	})
+	res := &KlineRange{Klines: make([]*Kline, 0, len(bars))}
+	for _, k := range bars {
+		if n := len(res.Klines); n > 0 && res.Klines[n-1].Time == k.Time {
+			res.Klines[n-1] = k
+			continue
+		}
+		res.Klines = append(res.Klines, k)
+	}
+	// holes shorter than this are regarded as quiet market
+	holeMSecs := max(minHole*60000, 1)
+	addHole := func(from, to int64) {
+		if to-from >= holeMSecs {
+			res.Holes = append(res.Holes, [2]int64{from, to})
+		}
+	}
+	expect := utils.AlignTfMSecs(start+tfMSecs-1, tfMSecs)
+	for _, k := range res.Klines {
+		addHole(expect, k.Time)
+		expect = k.Time + tfMSecs
+	}
+	// the last kline in progress is not finished, holes stop at it
+	addHole(expect, utils.AlignTfMSecs(min(end, exg.MilliSeconds()), tfMSecs))
+	return res, nil
+}
+
+// pageKlines page forward from start, pages without klines are skipped until end
+func pageKlines(exg BanExchange, symbol, timeframe string, tfMSecs, start, end int64, page int,
+	params map[string]interface{}) ([]*Kline, *errs.Error) {
+	var res []*Kline
+	for since := start; since < end; {
+		items, err := exg.FetchOHLCV(symbol, timeframe, since, page, utils.SafeParams(params))
+		if err != nil {
+			return nil, err
+		}
+		next := since + int64(page)*tfMSecs
+		for _, k := range items {
+			if k.Time >= since && k.Time < end {
+				res = append(res, k)
+			}
+			if k.Time+tfMSecs > next {
+				next = k.Time + tfMSecs
+			}
+		}
+		if len(items) > 0 && len(items) < page {
+			last := items[len(items)-1].Time
+			if last < items[0].Time {
+				last = items[0].Time
+			}
+			if last+tfMSecs >= exg.MilliSeconds() {
+				// reached the newest kline
+				break
+			}
+		}
+		since = next
+	}
+	return res, nil
+}
+
+// pageKlinesBack page backward from end by ParamUntil, stop when klines before start or no more klines
+func pageKlinesBack(exg BanExchange, symbol, timeframe string, start, end int64, page int,
+	params map[string]interface{}) ([]*Kline, *errs.Error) {
+	var res []*Kline
+	for until := end; until > start; {
+		args := utils.SafeParams(params)
+		args[ParamUntil] = until
+		items, err := exg.FetchOHLCV(symbol, timeframe, 0, page, args)
+		if err != nil {
+			return nil, err
+		}
+		first := until
+		for _, k := range items {
+			if k.Time >= start && k.Time < until {
+				res = append(res, k)
+			}
+			first = min(first, k.Time)
+		}
+		if len(items) == 0 || first >= until {
+			break
+		}
+		until = first
+	}
+	return res, nil
+}
@@ -0,0 +1,89 @@
+package banexg
+
+import (
+	"testing"
+
+	"github.com/banbox/banexg/errs"
+)
+
+type rangeExg struct {
+	*Exchange
+	bars  []*Kline
+	now   int64
+	calls int
+}
+
+func (e *rangeExg) MilliSeconds() int64 {
+	return e.now
+}
+
+// FetchOHLCV return klines from since forward, or latest klines before until when since is 0
+func (e *rangeExg) FetchOHLCV(symbol, timeframe string, since int64, limit int, params map[string]interface{}) ([]*Kline, *errs.Error) {
+	e.calls += 1
+	until, _ := params[ParamUntil].(int64)
+	var res []*Kline
+	if since > 0 {
+		for _, k := range e.bars {
+			if k.Time >= since && len(res) < limit {
+				res = append(res, k)
+			}
+		}
+		return res, nil
+	}
+	for i := len(e.bars) - 1; i >= 0 && len(res) < limit; i-- {
+		if until <= 0 || e.bars[i].Time < until {
+			res = append(res, e.bars[i])
+		}
+	}
+	return res, nil
+}
+
+func TestFetchOHLCVRange(t *testing.T) {
+	start := int64(1704067200000)
+	var bars []*Kline
+	for i := 0; i < 100; i++ {
+		if i >= 40 && i < 45 {
+			continue // hole of 5 minutes
+		}
+		if i == 60 {
+			continue // single missing kline
+		}
+		bars = append(bars, &Kline{Time: start + int64(i)*60000, Close: float64(i)})
+	}
+	for _, back := range []bool{false, true} {
+		exg := &rangeExg{
+			Exchange: &Exchange{ExgInfo: &ExgInfo{Min1mHole: 2, KlinePage: 30, KlineBack: back}},
+			bars:     bars,
+			now:      start + 100*60000,
+		}
+		res, err := FetchOHLCVRange(exg, "BTC/USDT", "1m", start, 0, nil)
+		if err != nil {
+			t.Fatalf("back %v: fetch range fail: %v", back, err)
+		}
+		if len(res.Klines) != len(bars) {
+			t.Fatalf("back %v: expect %d klines, got %d", back, len(bars), len(res.Klines))
+		}
+		for i := 1; i < len(res.Klines); i++ {
+			if res.Klines[i].Time <= res.Klines[i-1].Time {
+				t.Fatalf("back %v: klines not sorted or duplicated at %d", back, i)
+			}
+		}
+		if len(res.Holes) != 1 || res.Holes[0] != [2]int64{start + 40*60000, start + 45*60000} {
+			t.Fatalf("back %v: holes wrong: %v", back, res.Holes)
+		}
+		if exg.calls < 4 {
+			t.Fatalf("back %v: should page, calls: %d", back, exg.calls)
+		}
+	}
+	// missing klines at tail are reported
+	exg := &rangeExg{Exchange: &Exchange{ExgInfo: &ExgInfo{Min1mHole: 1}}, bars: bars, now: start + 110*60000}
+	res, err := FetchOHLCVRange(exg, "BTC/USDT", "1m", start+50*60000, 0, nil)
+	if err != nil {
+		t.Fatalf("fetch range fail: %v", err)
+	}
+	holes := res.Holes
+	if len(holes) != 2 || holes[0] != [2]int64{start + 60*60000, start + 61*60000} ||
+		holes[1] != [2]int64{start + 100*60000, start + 110*60000} {
+		t.Fatalf("holes wrong: %v", holes)
+	}
+}
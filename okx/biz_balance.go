@@ -111,6 +111,9 @@ func parsePositions(e *OKX, items []map[string]interface{}, symbols map[string]s
 		if pos == nil {
 			continue
 		}
+		if e.DecimalMode {
+			pos.SetDec(posDecKeys)
+		}
 		if symbols != nil {
 			if _, ok := symbols[pos.Symbol]; !ok {
 				continue
@@ -138,12 +141,20 @@ func parseBalance(e *OKX, bal *Balance, info map[string]interface{}) *banexg.Bal
 		if total == 0 {
 			total = parseFloat(d.CashBal)
 		}
-		res.Assets[code] = &banexg.Asset{
+		asset := &banexg.Asset{
 			Code:  code,
 			Free:  free,
 			Used:  used,
 			Total: total,
 		}
+		if e.DecimalMode {
+			totalStr := d.Eq
+			if parseFloat(totalStr) == 0 {
+				totalStr = d.CashBal
+			}
+			asset.SetDec(d.AvailBal, d.FrozenBal, totalStr, "", "")
+		}
+		res.Assets[code] = asset
 	}
 	return res.Init()
 }
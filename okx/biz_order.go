@@ -8,6 +8,7 @@ import (
 	"github.com/banbox/banexg"
 	"github.com/banbox/banexg/errs"
 	"github.com/banbox/banexg/utils"
+	"github.com/shopspring/decimal"
 )
 
 var (
@@ -52,34 +53,59 @@ func pickOrdersHistoryMethod(args map[string]interface{}, since, until int64) st
 }
 
 func (e *OKX) CreateOrder(symbol, odType, side string, amount, price float64, params map[string]interface{}) (*banexg.Order, *errs.Error) {
+	return e.CreateOrderReq(banexg.NewOrderRequest(symbol, odType, side, amount, price, params))
+}
+
+// orderExtraKeys keys accepted in OrderRequest.Extra besides typed fields, native algo fields are sent as is
+var orderExtraKeys = map[string]bool{
+	banexg.ParamAlgoOrder: true, banexg.ParamTag: true, banexg.ParamBanAmend: true, banexg.ParamPxAmendType: true,
+	banexg.ParamWorkingType: true, FldTpOrdPx: true, FldSlOrdPx: true, FldTriggerPx: true, FldOrderPx: true,
+	FldSzLimit: true, FldPxLimit: true, FldTimeInterval: true, FldCallbackRatio: true, FldCallbackSpread: true,
+	FldActivePx: true,
+}
+
+/*
+CreateOrderReq
+map OrderRequest to okx order args. OKX has no GTD orders; IOC/FOK/GTX(PO) are order types of okx.
+将OrderRequest转为okx下单参数。OKX不支持GTD；IOC/FOK/GTX(PO)在okx中为订单类型
+*/
+func (e *OKX) CreateOrderReq(req *banexg.OrderRequest) (*banexg.Order, *errs.Error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if req.GoodTillDate > 0 || req.TimeInForce == banexg.TimeInForceGTD {
+		return nil, errs.NewMsg(errs.CodeNotSupport, "okx not support GTD orders")
+	}
+	params, err := req.ExtraArgs(e.ID, orderExtraKeys)
+	if err != nil {
+		return nil, err
+	}
+	symbol, odType, side, amount, price := req.Symbol, req.Type, req.Side, req.Amount, req.Price
 	args, market, err := e.LoadArgsMarket(symbol, params)
 	if err != nil {
 		return nil, err
 	}
-	triggerPrice := utils.PopMapVal(args, banexg.ParamTriggerPrice, float64(0))
-	stopLossPrice := utils.PopMapVal(args, banexg.ParamStopLossPrice, float64(0))
+	stopLossPrice := req.StopLossPrice
 	if stopLossPrice == 0 {
-		stopLossPrice = triggerPrice
+		stopLossPrice = req.TriggerPrice
 	}
-	takeProfitPrice := utils.PopMapVal(args, banexg.ParamTakeProfitPrice, float64(0))
+	takeProfitPrice := req.TakeProfitPrice
 	algoOrder := utils.PopMapVal(args, banexg.ParamAlgoOrder, false)
-	postOnly := utils.PopMapVal(args, banexg.ParamPostOnly, false)
 	ordType, ok := orderTypeMap[odType]
 	if !ok {
 		ordType = odType
 	}
 	if ordType == "limit" {
-		tif := utils.PopMapVal(args, banexg.ParamTimeInForce, "")
-		switch tif {
+		switch req.TimeInForce {
 		case banexg.TimeInForceIOC:
 			ordType = "ioc"
 		case banexg.TimeInForceFOK:
 			ordType = "fok"
-		case banexg.TimeInForcePO:
+		case banexg.TimeInForcePO, banexg.TimeInForceGTX:
 			ordType = "post_only"
 		}
 	}
-	if postOnly {
+	if req.PostOnly {
 		if ordType == "market" {
 			return nil, errs.NewMsg(errs.CodeParamInvalid, "market orders cannot be postOnly")
 		}
@@ -91,21 +117,24 @@ func (e *OKX) CreateOrder(symbol, odType, side string, amount, price float64, pa
 
 	if market.Type == banexg.MarketSpot {
 		args[FldTdMode] = TdModeCash
+	} else if req.MarginMode != "" {
+		args[FldTdMode] = req.MarginMode
 	} else {
-		mgnMode := utils.PopMapVal(args, banexg.ParamMarginMode, banexg.MarginCross)
-		args[FldTdMode] = mgnMode
+		args[FldTdMode] = banexg.MarginCross
 	}
-	if clOrdId := utils.PopMapVal(args, banexg.ParamClientOrderId, ""); clOrdId != "" {
-		if !validateClOrdId(clOrdId) {
-			return nil, errs.NewMsg(errs.CodeParamInvalid, "clOrdId must be 1-32 alphanumeric characters")
-		}
-		args[FldClOrdId] = clOrdId
+	clOrdId := req.ClientOrderID
+	if clOrdId == "" {
+		// always send clOrdId, so the order can be reconciled when the result is unknown
+		clOrdId = banexg.NewClientOrderID()
+	} else if !validateClOrdId(clOrdId) {
+		return nil, errs.NewMsg(errs.CodeParamInvalid, "clOrdId must be 1-32 alphanumeric characters")
 	}
-	if reduceOnly := utils.PopMapVal(args, banexg.ParamReduceOnly, false); reduceOnly {
+	args[FldClOrdId] = clOrdId
+	if req.ReduceOnly {
 		args[FldReduceOnly] = true
 	}
-	if stpMode := utils.PopMapVal(args, banexg.ParamSelfTradePreventionMode, ""); stpMode != "" {
-		args[FldStpMode] = stpMode
+	if req.STPMode != "" {
+		args[FldStpMode] = req.STPMode
 	}
 	if tag := utils.PopMapVal(args, banexg.ParamTag, ""); tag != "" {
 		args[FldTag] = tag
@@ -124,11 +153,14 @@ func (e *OKX) CreateOrder(symbol, odType, side string, amount, price float64, pa
 		}
 	}
 	if market.Contract {
-		posSide := utils.PopMapVal(args, banexg.ParamPositionSide, "net")
-		args[FldPosSide] = strings.ToLower(posSide)
+		posSide := strings.ToLower(req.PositionSide)
+		if posSide == "" || posSide == "both" {
+			posSide = "net"
+		}
+		args[FldPosSide] = posSide
 	}
 	if ordType == "market" && market.Spot {
-		cost := utils.PopMapVal(args, banexg.ParamCost, 0.0)
+		cost := req.Cost
 		if cost > 0 {
 			args[FldTgtCcy] = TgtCcyQuote
 			precCost, err := e.PrecCost(market, cost)
@@ -165,13 +197,19 @@ func (e *OKX) CreateOrder(symbol, odType, side string, amount, price float64, pa
 	}
 
 	if algoOrder || isAlgoOrderType(odType) || stopLossPrice != 0 || takeProfitPrice != 0 {
-		return e.createAlgoOrder(market, odType, side, amount, price, args, stopLossPrice, takeProfitPrice)
+		res, err := e.createAlgoOrder(market, req, args, stopLossPrice, takeProfitPrice)
+		if err != nil {
+			algoArgs := utils.SafeParams(params)
+			algoArgs[banexg.ParamAlgoOrder] = true
+			return e.reconcileOrder("CreateOrder", symbol, "", clOrdId, algoArgs, err, nil)
+		}
+		return res, nil
 	}
 
 	tryNum := e.GetRetryNum("CreateOrder", 1)
 	res := requestRetry[[]OrderResult](e, MethodTradePostOrder, args, tryNum)
 	if res.Error != nil {
-		return nil, res.Error
+		return e.reconcileOrder("CreateOrder", symbol, "", clOrdId, params, res.Error, nil)
 	}
 	if len(res.Result) == 0 {
 		return nil, errs.NewMsg(errs.CodeDataNotFound, "empty order result")
@@ -198,13 +236,17 @@ func (e *OKX) EditOrder(symbol, orderId, side string, amount, price float64, par
 		return nil, err
 	}
 	args[FldInstId] = market.ID
+	clOrdId := utils.GetMapVal(args, banexg.ParamClientOrderId, "")
 	if err := setOrderID(args, orderId); err != nil {
 		return nil, err
 	}
+	// new amount and price as returned by FetchOrder, to reconcile unknown outcome
+	newAmt, newPrice := float64(0), float64(0)
 	if amount > 0 {
 		// For contract markets, convert coin amount to contracts
 		szAmount := amount
-		if market.Contract && market.ContractSize > 0 && market.ContractSize != 1 {
+		isCont := market.Contract && market.ContractSize > 0 && market.ContractSize != 1
+		if isCont {
 			szAmount = amount / market.ContractSize
 		}
 		precAmt, err := e.PrecAmount(market, szAmount)
@@ -212,6 +254,10 @@ func (e *OKX) EditOrder(symbol, orderId, side string, amount, price float64, par
 			return nil, err
 		}
 		args[FldNewSz] = strconv.FormatFloat(precAmt, 'f', -1, 64)
+		newAmt = precAmt
+		if isCont {
+			newAmt = precAmt * market.ContractSize
+		}
 	}
 	if price > 0 {
 		precPrice, err := e.PrecPrice(market, price)
@@ -219,11 +265,13 @@ func (e *OKX) EditOrder(symbol, orderId, side string, amount, price float64, par
 			return nil, err
 		}
 		args[FldNewPx] = strconv.FormatFloat(precPrice, 'f', -1, 64)
+		newPrice = precPrice
 	}
 	tryNum := e.GetRetryNum("EditOrder", 1)
 	res := requestRetry[[]OrderResult](e, MethodTradePostAmendOrder, args, tryNum)
 	if res.Error != nil {
-		return nil, res.Error
+		return e.reconcileOrder("EditOrder", symbol, orderId, clOrdId, params, res.Error,
+			banexg.OrderEdited(newAmt, newPrice))
 	}
 	if len(res.Result) == 0 {
 		return nil, errs.NewMsg(errs.CodeDataNotFound, "empty amend result")
@@ -253,13 +301,14 @@ func (e *OKX) CancelOrder(id string, symbol string, params map[string]interface{
 		return e.cancelAlgoOrder(id, market, args)
 	}
 	args[FldInstId] = market.ID
+	clOrdId := utils.GetMapVal(args, banexg.ParamClientOrderId, "")
 	if err := setOrderID(args, id); err != nil {
 		return nil, err
 	}
 	tryNum := e.GetRetryNum("CancelOrder", 1)
 	res := requestRetry[[]OrderResult](e, MethodTradePostCancelOrder, args, tryNum)
 	if res.Error != nil {
-		return nil, res.Error
+		return e.reconcileOrder("CancelOrder", symbol, id, clOrdId, params, res.Error, banexg.OrderCanceled)
 	}
 	if len(res.Result) == 0 {
 		return nil, errs.NewMsg(errs.CodeDataNotFound, "empty cancel result")
@@ -276,6 +325,31 @@ func (e *OKX) CancelOrder(id string, symbol string, params map[string]interface{
 	}, nil
 }
 
+/*
+reconcileOrder
+query the real order state by orderId or clientOrderId, after a trading request failed with unknown outcome.
+applied is passed to banexg.ReconcileOrder
+交易请求结果未知时，通过订单ID或客户端订单ID查询订单真实状态
+*/
+func (e *OKX) reconcileOrder(action, symbol, orderId, clOrdId string, params map[string]interface{}, reqErr *errs.Error,
+	applied func(*banexg.Order) bool) (*banexg.Order, *errs.Error) {
+	if orderId == "" && clOrdId == "" {
+		return nil, reqErr
+	}
+	return e.ReconcileOrder(action, reqErr, func() (*banexg.Order, *errs.Error) {
+		args := map[string]interface{}{}
+		for _, key := range []string{banexg.ParamAccount, banexg.ParamAlgoOrder} {
+			if val, ok := params[key]; ok {
+				args[key] = val
+			}
+		}
+		if orderId == "" {
+			args[banexg.ParamClientOrderId] = clOrdId
+		}
+		return e.FetchOrder(symbol, orderId, args)
+	}, applied)
+}
+
 func (e *OKX) FetchOrder(symbol, id string, params map[string]interface{}) (*banexg.Order, *errs.Error) {
 	args, market, err := e.LoadArgsMarket(symbol, params)
 	if err != nil {
@@ -579,7 +653,7 @@ func parseOrder(e *OKX, item *Order, info map[string]interface{}, marketType str
 			reduceOnly = parseBoolStr(v)
 		}
 	}
-	return &banexg.Order{
+	res := &banexg.Order{
 		Info:                info,
 		ID:                  item.OrdId,
 		ClientOrderID:       item.ClOrdId,
@@ -601,6 +675,28 @@ func parseOrder(e *OKX, item *Order, info map[string]interface{}, marketType str
 		ReduceOnly:          reduceOnly,
 		Fee:                 fee,
 	}
+	if e != nil && e.DecimalMode {
+		res.SetDec(orderDecKeys)
+		if market != nil && market.Contract && market.ContractSize > 0 && market.ContractSize != 1 {
+			// sz of contract markets is number of contracts
+			ctVal := decimal.NewFromFloat(market.ContractSize)
+			res.Dec.Amount = banexg.DecStr(item.Sz, 0).Mul(ctVal)
+			res.Dec.Filled = banexg.DecStr(item.AccFillSz, 0).Mul(ctVal)
+			if !res.Dec.Amount.IsZero() {
+				res.Dec.Remaining = res.Dec.Amount.Sub(res.Dec.Filled)
+			}
+		}
+	}
+	return res
+}
+
+// raw keys of okx orders for exact values, amounts are in contracts for contract markets
+var orderDecKeys = banexg.DecKeys{
+	"Price":   {"px"},
+	"Average": {"avgPx"},
+	"Amount":  {"sz"},
+	"Filled":  {"accFillSz"},
+	"FeeCost": {"fee"},
 }
 
 func mapOrderStatus(status string) string {
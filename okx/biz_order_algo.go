@@ -202,75 +202,38 @@ func setAlgoOrderID(args map[string]interface{}, algoId string) *errs.Error {
 	return errs.NewMsg(errs.CodeParamRequired, "algo id or clientOrderId required")
 }
 
-func (e *OKX) createAlgoOrder(market *banexg.Market, odType, side string, amount, price float64, params map[string]interface{}, stopLossPrice, takeProfitPrice float64) (*banexg.Order, *errs.Error) {
+func (e *OKX) createAlgoOrder(market *banexg.Market, req *banexg.OrderRequest, params map[string]interface{}, stopLossPrice, takeProfitPrice float64) (*banexg.Order, *errs.Error) {
+	odType, side, amount, price := req.Type, req.Side, req.Amount, req.Price
 	args := utils.SafeParams(params)
 	args[FldInstId] = market.ID
 	args[FldSide] = strings.ToLower(side)
-	if _, ok := args[FldTdMode]; !ok {
-		if market.Type == banexg.MarketSpot {
-			args[FldTdMode] = TdModeCash
-		} else {
-			mgnMode := utils.PopMapVal(args, banexg.ParamMarginMode, banexg.MarginCross)
-			args[FldTdMode] = mgnMode
-		}
-	}
-	if market.Contract {
-		if _, ok := args[FldPosSide]; !ok {
-			posSide := utils.PopMapVal(args, banexg.ParamPositionSide, "net")
-			args[FldPosSide] = strings.ToLower(posSide)
-		}
-	}
-	if _, ok := args[FldReduceOnly]; !ok {
-		if reduceOnly := utils.PopMapVal(args, banexg.ParamReduceOnly, false); reduceOnly {
-			args[FldReduceOnly] = true
-		}
-	}
-	closePosition := utils.PopMapVal(args, banexg.ParamClosePosition, false)
+	closePosition := req.ClosePosition
 	if closePosition {
 		args[FldCloseFraction] = "1"
-		if _, ok := args[FldReduceOnly]; !ok {
-			args[FldReduceOnly] = true
-		}
+		args[FldReduceOnly] = true
 		delete(args, FldSz)
 	}
-	if _, ok := args[FldCallbackRatio]; !ok {
-		if callbackRate := utils.PopMapVal(args, banexg.ParamCallbackRate, 0.0); callbackRate > 0 {
-			args[FldCallbackRatio] = strconv.FormatFloat(callbackRate, 'f', -1, 64)
-		}
+	if _, ok := args[FldCallbackRatio]; !ok && req.CallbackRate > 0 {
+		args[FldCallbackRatio] = strconv.FormatFloat(req.CallbackRate, 'f', -1, 64)
 	}
-	if _, ok := args[FldCallbackSpread]; !ok {
-		if trailingDelta := utils.PopMapVal(args, banexg.ParamTrailingDelta, 0.0); trailingDelta > 0 {
-			precSpread, err := e.PrecPrice(market, trailingDelta)
-			if err != nil {
-				return nil, err
-			}
-			args[FldCallbackSpread] = strconv.FormatFloat(precSpread, 'f', -1, 64)
+	if _, ok := args[FldCallbackSpread]; !ok && req.TrailingDelta > 0 {
+		precSpread, err := e.PrecPrice(market, req.TrailingDelta)
+		if err != nil {
+			return nil, err
 		}
+		args[FldCallbackSpread] = strconv.FormatFloat(precSpread, 'f', -1, 64)
 	}
-	if _, ok := args[FldActivePx]; !ok {
-		if activationPrice := utils.PopMapVal(args, banexg.ParamActivationPrice, 0.0); activationPrice > 0 {
-			precPx, err := e.PrecPrice(market, activationPrice)
-			if err != nil {
-				return nil, err
-			}
-			args[FldActivePx] = strconv.FormatFloat(precPx, 'f', -1, 64)
+	if _, ok := args[FldActivePx]; !ok && req.ActivationPrice > 0 {
+		precPx, err := e.PrecPrice(market, req.ActivationPrice)
+		if err != nil {
+			return nil, err
 		}
+		args[FldActivePx] = strconv.FormatFloat(precPx, 'f', -1, 64)
 	}
 	if clOrdId, ok := args[FldClOrdId]; ok {
-		if s, isStr := clOrdId.(string); isStr {
-			if !validateClOrdId(s) {
-				return nil, errs.NewMsg(errs.CodeParamInvalid, "clOrdId must be 1-32 alphanumeric characters")
-			}
-			args[FldAlgoClOrdId] = s
-		} else {
-			args[FldAlgoClOrdId] = clOrdId
-		}
-		delete(args, FldClOrdId)
-	} else if clOrdId := utils.PopMapVal(args, banexg.ParamClientOrderId, ""); clOrdId != "" {
-		if !validateClOrdId(clOrdId) {
-			return nil, errs.NewMsg(errs.CodeParamInvalid, "clOrdId must be 1-32 alphanumeric characters")
-		}
+		// algo orders use algoClOrdId, validated by CreateOrderReq
 		args[FldAlgoClOrdId] = clOrdId
+		delete(args, FldClOrdId)
 	}
 	if market.Spot {
 		if tradeQuoteCcy := getTradeQuoteCcy(market); tradeQuoteCcy != "" {
@@ -279,7 +242,7 @@ func (e *OKX) createAlgoOrder(market *banexg.Market, odType, side string, amount
 	}
 	if !closePosition {
 		if market.Spot && odType == banexg.OdTypeMarket {
-			cost := utils.PopMapVal(args, banexg.ParamCost, 0.0)
+			cost := req.Cost
 			if cost > 0 {
 				args[FldTgtCcy] = TgtCcyQuote
 				precCost, err := e.PrecCost(market, cost)
@@ -413,7 +376,6 @@ func (e *OKX) createAlgoOrder(market *banexg.Market, odType, side string, amount
 		}
 	}
 	delete(args, FldPx)
-	delete(args, banexg.ParamTimeInForce)
 
 	tryNum := e.GetRetryNum("CreateOrder", 1)
 	res := requestRetry[[]map[string]interface{}](e, MethodTradePostOrderAlgo, args, tryNum)
@@ -1,9 +1,12 @@
 package okx
 
 import (
+	"encoding/json"
+	"net/http"
 	"testing"
 
 	"github.com/banbox/banexg"
+	"github.com/banbox/banexg/errs"
 	"github.com/banbox/banexg/utils"
 )
 
@@ -233,3 +236,51 @@ func TestAPI_CreateOrderWithStpMode(t *testing.T) {
 		t.Logf("failed to cancel: %v", err)
 	}
 }
+
+func TestCreateOrderReqNative(t *testing.T) {
+	var body map[string]interface{}
+	exg, _ := newMockOKX(t, func(w http.ResponseWriter, r *http.Request) {
+		body = nil
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		_, _ = w.Write([]byte(`{"code":"0","msg":"","data":[{"ordId":"1","clOrdId":"c1","sCode":"0","sMsg":""}]}`))
+	}, MethodTradePostOrder)
+	seedMarket(exg, "BTC-USDT-SWAP", "BTC/USDT:USDT", banexg.MarketSwap)
+	market := exg.Markets["BTC/USDT:USDT"]
+	market.Contract = true
+	market.Precision = &banexg.Precision{Price: 0.1, Amount: 1, ModePrice: banexg.PrecModeTickSize,
+		ModeAmount: banexg.PrecModeTickSize}
+	req := &banexg.OrderRequest{Symbol: "BTC/USDT:USDT", Type: banexg.OdTypeLimit, Side: banexg.OdSideBuy,
+		Amount: 1, Price: 100, TimeInForce: banexg.TimeInForceGTX, PositionSide: "BOTH", ClientOrderID: "c1",
+		ReduceOnly: true, MarginMode: banexg.MarginIsolated}
+	if _, err := exg.CreateOrderReq(req); err != nil {
+		t.Fatalf("create fail: %v", err)
+	}
+	if body[FldOrdType] != "post_only" || body[FldPosSide] != "net" || body[FldClOrdId] != "c1" ||
+		body[FldReduceOnly] != true || body[FldTdMode] != banexg.MarginIsolated || body[FldSz] != "1" {
+		t.Fatalf("unexpected args: %v", body)
+	}
+	if _, ok := body[banexg.ParamTimeInForce]; ok {
+		t.Fatalf("timeInForce should not be sent: %v", body)
+	}
+	req.Extra = map[string]interface{}{"reduce_only": true}
+	if _, err := exg.CreateOrderReq(req); err == nil || err.Code != errs.CodeParamInvalid {
+		t.Fatalf("unknown extra key should be rejected, got %v", err)
+	}
+	req.Extra = nil
+	req.TimeInForce = banexg.TimeInForceGTD
+	req.GoodTillDate = 1700000000000
+	if _, err := exg.CreateOrderReq(req); err == nil || err.Code != errs.CodeNotSupport {
+		t.Fatalf("GTD should not be supported, got %v", err)
+	}
+	// map API is lenient: loose values converted, unknown keys passed as is
+	_, err := exg.CreateOrder("BTC/USDT:USDT", banexg.OdTypeLimit, banexg.OdSideBuy, 1, 100, map[string]interface{}{
+		banexg.ParamPostOnly: "true", "quickMgnType": "auto_borrow"})
+	if err != nil {
+		t.Fatalf("create fail: %v", err)
+	}
+	if body[FldOrdType] != "post_only" || body["quickMgnType"] != "auto_borrow" {
+		t.Fatalf("unexpected args: %v", body)
+	}
+}
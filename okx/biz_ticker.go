@@ -71,10 +71,15 @@ func (e *OKX) FetchOHLCV(symbol, timeframe string, since int64, limit int, param
 	method := MethodMarketGetCandles
 	// history-candles 用于获取历史K线，当指定since且数据较老时使用
 	// 对于最近的数据（1天内），使用regular candles以获取最新数据
-	if since > 0 {
+	// 仅指定until向前分页时，同样根据until判断
+	refMs := since
+	if refMs <= 0 {
+		refMs = until
+	}
+	if refMs > 0 {
 		nowMs := time.Now().UnixMilli()
 		// 如果since在1天以前，使用history-candles
-		if nowMs-since > 86400000 {
+		if nowMs-refMs > 86400000 {
 			method = MethodMarketGetHistoryCandles
 		}
 	}
@@ -83,7 +88,7 @@ func (e *OKX) FetchOHLCV(symbol, timeframe string, since int64, limit int, param
 	if res.Error != nil {
 		return nil, res.Error
 	}
-	return parseOHLCV(res.Result), nil
+	return parseOHLCV(res.Result, e.DecimalMode), nil
 }
 
 func (e *OKX) FetchTickerPrice(symbol string, params map[string]interface{}) (map[string]float64, *errs.Error) {
@@ -242,7 +247,7 @@ func parseOrderBook(market *banexg.Market, ob *OrderBook, limit int) *banexg.Ord
 	}
 }
 
-func parseOHLCV(rows [][]string) []*banexg.Kline {
+func parseOHLCV(rows [][]string, dec bool) []*banexg.Kline {
 	if len(rows) == 0 {
 		return nil
 	}
@@ -260,21 +265,25 @@ func parseOHLCV(rows [][]string) []*banexg.Kline {
 		low := parseFloat(row[3])
 		closeP := parseFloat(row[4])
 		vol := parseFloat(row[5])
-		info := 0.0
+		quoteStr := ""
 		if len(row) > 7 {
-			info = parseFloat(row[7])
+			quoteStr = row[7]
 		} else if len(row) > 6 {
-			info = parseFloat(row[6])
+			quoteStr = row[6]
 		}
-		res = append(res, &banexg.Kline{
+		k := &banexg.Kline{
 			Time:   stamp,
 			Open:   open,
 			High:   high,
 			Low:    low,
 			Close:  closeP,
 			Volume: vol,
-			Quote:  info,
-		})
+			Quote:  parseFloat(quoteStr),
+		}
+		if dec {
+			k.SetDec(row[1], row[2], row[3], row[4], row[5], quoteStr, "")
+		}
+		res = append(res, k)
 	}
 	// OKX返回数据是降序的（最新在前），需要反转为升序（最旧在前）以与其他交易所保持一致
 	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
@@ -73,7 +73,7 @@ func TestParseOHLCV(t *testing.T) {
 		"12698348.04828491",
 		"0",
 	}}
-	klines := parseOHLCV(rows)
+	klines := parseOHLCV(rows, false)
 	if len(klines) != 1 {
 		t.Fatalf("unexpected kline len: %d", len(klines))
 	}
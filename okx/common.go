@@ -90,6 +90,16 @@ func instFamilyFromID(instId string) string {
 	return parts[0] + "-" + parts[1]
 }
 
+// raw keys of okx positions for exact values, notional is calculated
+var posDecKeys = banexg.DecKeys{
+	"Contracts":        {"pos"},
+	"EntryPrice":       {"avgPx"},
+	"MarkPrice":        {"markPx"},
+	"Collateral":       {"margin"},
+	"UnrealizedPnl":    {"upl"},
+	"LiquidationPrice": {"liqPx"},
+}
+
 func parsePosition(e *OKX, item *Position, info map[string]interface{}) *banexg.Position {
 	if item == nil {
 		return nil
@@ -77,6 +77,9 @@ const (
 	WsChanCandlePrefix    = "candle"
 )
 
+// wsBookCheckDepth is the number of levels covered by order book checksum
+const wsBookCheckDepth = 25
+
 // OKX instType values
 const (
 	InstTypeSpot    = "SPOT"
@@ -13,6 +13,8 @@ func New(options map[string]interface{}) (*OKX, *errs.Error) {
 				ID:        "okx",
 				Name:      "OKX",
 				Countries: []string{"SC"},
+				KlinePage: 100, // history-candles returns at most 100
+				KlineBack: true,
 			},
 			RateLimit:  20,
 			Options:    options,
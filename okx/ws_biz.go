@@ -12,7 +12,6 @@ import (
 	"github.com/banbox/banexg/errs"
 	"github.com/banbox/banexg/log"
 	"github.com/banbox/banexg/utils"
-	"github.com/banbox/bntp"
 	"go.uber.org/zap"
 )
 
@@ -192,8 +191,7 @@ func (e *OKX) WatchOrderBooks(symbols []string, limit int, params map[string]int
 	}
 	chanKey := client.Prefix(channel)
 	create := func(cap int) chan *banexg.OrderBook { return make(chan *banexg.OrderBook, cap) }
-	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, params)
-	e.AddWsChanRefs(chanKey, symbols...)
+	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, params, symbols...)
 	e.DumpWS("WatchOrderBooks", symbols)
 	return out, nil
 }
@@ -207,6 +205,11 @@ func (e *OKX) UnWatchOrderBooks(symbols []string, params map[string]interface{})
 		return err
 	}
 	channel := WsChanBooks
+	chanKey := client.Prefix(channel)
+	symbols = e.ReleaseWsRefs(chanKey, params, symbols...)
+	if len(symbols) == 0 {
+		return nil
+	}
 	argsList := make([]map[string]interface{}, 0, len(symbols))
 	keys := make([]string, 0, len(symbols))
 	for _, sym := range symbols {
@@ -217,12 +220,7 @@ func (e *OKX) UnWatchOrderBooks(symbols []string, params map[string]interface{})
 		argsList = append(argsList, map[string]interface{}{FldChannel: channel, FldInstId: id})
 		keys = append(keys, buildWsKey(channel, id))
 	}
-	if err := e.writeWsArgs(client, 0, false, keys, argsList); err != nil {
-		return err
-	}
-	chanKey := client.Prefix(channel)
-	e.DelWsChanRefs(chanKey, symbols...)
-	return nil
+	return e.writeWsArgs(client, 0, false, keys, argsList)
 }
 
 func (e *OKX) WatchTrades(symbols []string, params map[string]interface{}) (chan *banexg.Trade, *errs.Error) {
@@ -253,8 +251,7 @@ func (e *OKX) WatchTrades(symbols []string, params map[string]interface{}) (chan
 	}
 	chanKey := client.Prefix(channel)
 	create := func(cap int) chan *banexg.Trade { return make(chan *banexg.Trade, cap) }
-	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, params)
-	e.AddWsChanRefs(chanKey, symbols...)
+	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, params, symbols...)
 	e.DumpWS("WatchTrades", symbols)
 	return out, nil
 }
@@ -268,6 +265,11 @@ func (e *OKX) UnWatchTrades(symbols []string, params map[string]interface{}) *er
 		return err
 	}
 	channel := WsChanTrades
+	chanKey := client.Prefix(channel)
+	symbols = e.ReleaseWsRefs(chanKey, params, symbols...)
+	if len(symbols) == 0 {
+		return nil
+	}
 	argsList := make([]map[string]interface{}, 0, len(symbols))
 	keys := make([]string, 0, len(symbols))
 	for _, sym := range symbols {
@@ -278,12 +280,7 @@ func (e *OKX) UnWatchTrades(symbols []string, params map[string]interface{}) *er
 		argsList = append(argsList, map[string]interface{}{FldChannel: channel, FldInstId: id})
 		keys = append(keys, buildWsKey(channel, id))
 	}
-	if err := e.writeWsArgs(client, 0, false, keys, argsList); err != nil {
-		return err
-	}
-	chanKey := client.Prefix(channel)
-	e.DelWsChanRefs(chanKey, symbols...)
-	return nil
+	return e.writeWsArgs(client, 0, false, keys, argsList)
 }
 
 func (e *OKX) WatchOHLCVs(jobs [][2]string, params map[string]interface{}) (chan *banexg.PairTFKline, *errs.Error) {
@@ -318,15 +315,14 @@ func (e *OKX) WatchOHLCVs(jobs [][2]string, params map[string]interface{}) (chan
 		channel := okxCandleChannel(tf)
 		argsList = append(argsList, map[string]interface{}{FldChannel: channel, FldInstId: id})
 		keys = append(keys, buildWsKey(channel, id))
-		refKeys = append(refKeys, symbol+"@"+timeframe)
+		refKeys = append(refKeys, symbol+"@"+okxTimeFrame(tf))
 	}
 	if err := e.writeWsArgs(client, 0, true, keys, argsList); err != nil {
 		return nil, err
 	}
 	chanKey := client.Prefix("candle")
 	create := func(cap int) chan *banexg.PairTFKline { return make(chan *banexg.PairTFKline, cap) }
-	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, params)
-	e.AddWsChanRefs(chanKey, refKeys...)
+	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, params, refKeys...)
 	e.DumpWS("WatchOHLCVs", jobs)
 	return out, nil
 }
@@ -363,14 +359,15 @@ func (e *OKX) UnWatchOHLCVs(jobs [][2]string, params map[string]interface{}) *er
 		channel := okxCandleChannel(tf)
 		argsList = append(argsList, map[string]interface{}{FldChannel: channel, FldInstId: id})
 		keys = append(keys, buildWsKey(channel, id))
-		refKeys = append(refKeys, symbol+"@"+timeframe)
+		refKeys = append(refKeys, symbol+"@"+okxTimeFrame(tf))
 	}
-	if err := e.writeWsArgs(client, 0, false, keys, argsList); err != nil {
-		return err
+	free := e.ReleaseWsRefs(client.Prefix("candle"), params, refKeys...)
+	if len(free) == 0 {
+		return nil
 	}
-	chanKey := client.Prefix("candle")
-	e.DelWsChanRefs(chanKey, refKeys...)
-	return nil
+	argsList = banexg.PickFreeRefs(argsList, refKeys, free)
+	keys = banexg.PickFreeRefs(keys, refKeys, free)
+	return e.writeWsArgs(client, 0, false, keys, argsList)
 }
 
 func (e *OKX) WatchMarkPrices(symbols []string, params map[string]interface{}) (chan map[string]float64, *errs.Error) {
@@ -401,8 +398,7 @@ func (e *OKX) WatchMarkPrices(symbols []string, params map[string]interface{}) (
 	}
 	chanKey := client.Prefix("markPrice")
 	create := func(cap int) chan map[string]float64 { return make(chan map[string]float64, cap) }
-	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, params)
-	e.AddWsChanRefs(chanKey, "markPrice")
+	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, params, symbols...)
 	e.DumpWS("WatchMarkPrices", symbols)
 	return out, nil
 }
@@ -420,6 +416,10 @@ func (e *OKX) UnWatchMarkPrices(symbols []string, params map[string]interface{})
 		return err
 	}
 	channel := WsChanMarkPrice
+	symbols = e.ReleaseWsRefs(client.Prefix("markPrice"), params, symbols...)
+	if len(symbols) == 0 {
+		return nil
+	}
 	argsList := make([]map[string]interface{}, 0, len(symbols))
 	keys := make([]string, 0, len(symbols))
 	for _, sym := range symbols {
@@ -430,12 +430,7 @@ func (e *OKX) UnWatchMarkPrices(symbols []string, params map[string]interface{})
 		argsList = append(argsList, map[string]interface{}{FldChannel: channel, FldInstId: id})
 		keys = append(keys, buildWsKey(channel, id))
 	}
-	if err := e.writeWsArgs(client, 0, false, keys, argsList); err != nil {
-		return err
-	}
-	chanKey := client.Prefix("markPrice")
-	e.DelWsChanRefs(chanKey, "markPrice")
-	return nil
+	return e.writeWsArgs(client, 0, false, keys, argsList)
 }
 
 func (e *OKX) WatchBalance(params map[string]interface{}) (chan *banexg.Balances, *errs.Error) {
@@ -446,8 +441,7 @@ func (e *OKX) WatchBalance(params map[string]interface{}) (chan *banexg.Balances
 	chanKey := client.Prefix("balance")
 	create := func(cap int) chan *banexg.Balances { return make(chan *banexg.Balances, cap) }
 	args := utils.SafeParams(params)
-	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, args)
-	e.AddWsChanRefs(chanKey, "account")
+	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, args, "account")
 	if balances, err := e.FetchBalance(args); err == nil && balances != nil {
 		if acc, err := e.GetAccount(client.AccName); err == nil {
 			acc.LockBalance.Lock()
@@ -470,8 +464,7 @@ func (e *OKX) WatchPositions(params map[string]interface{}) (chan []*banexg.Posi
 	}
 	chanKey := client.Prefix("positions")
 	create := func(cap int) chan []*banexg.Position { return make(chan []*banexg.Position, cap) }
-	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, args)
-	e.AddWsChanRefs(chanKey, "account")
+	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, args, "account")
 	if positions, err := e.FetchPositions(nil, args); err == nil && len(positions) > 0 {
 		if acc, err := e.GetAccount(client.AccName); err == nil {
 			acc.LockPos.Lock()
@@ -492,8 +485,7 @@ func (e *OKX) WatchAccountConfig(params map[string]interface{}) (chan *banexg.Ac
 	chanKey := client.Prefix("accConfig")
 	create := func(cap int) chan *banexg.AccountConfig { return make(chan *banexg.AccountConfig, cap) }
 	args := utils.SafeParams(params)
-	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, args)
-	e.AddWsChanRefs(chanKey, "account")
+	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, args, "account")
 	e.DumpWS("WatchAccountConfig", nil)
 	return out, nil
 }
@@ -530,8 +522,7 @@ func (e *OKX) WatchMyTrades(params map[string]interface{}) (chan *banexg.MyTrade
 		log.Warn("subscribe algo orders channel fail", zap.Error(err))
 	}
 	create := func(cap int) chan *banexg.MyTrade { return make(chan *banexg.MyTrade, cap) }
-	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, args)
-	e.AddWsChanRefs(chanKey, "account")
+	out := banexg.GetWsOutChan(e.Exchange, chanKey, create, args, "account")
 	e.DumpWS("WatchMyTrades", nil)
 	return out, nil
 }
@@ -809,7 +800,7 @@ func (e *OKX) handleWsTrades(client *banexg.WsClient, msg map[string]interface{}
 		}
 	}
 	if instId != "" {
-		client.SetSubsKeyStamp(buildWsKey("trades", instId), bntp.UTCStamp())
+		client.SetSubsKeyStamp(buildWsKey("trades", instId), e.MilliSeconds())
 	}
 	chanKey := client.Prefix("trades")
 	for _, item := range items {
@@ -831,7 +822,7 @@ func (e *OKX) handleWsOrderBooks(client *banexg.WsClient, msg map[string]interfa
 		}
 	}
 	if instId != "" {
-		client.SetSubsKeyStamp(buildWsKey(channel, instId), bntp.UTCStamp())
+		client.SetSubsKeyStamp(buildWsKey(channel, instId), e.MilliSeconds())
 	}
 	action := getMapString(msg, "action")
 	chanKey := client.Prefix(channel)
@@ -856,9 +847,21 @@ func (e *OKX) applyWsOrderBookUpdate(client *banexg.WsClient, item map[string]in
 	}
 	asksRaw := getMapSlice(item, "asks")
 	bidsRaw := getMapSlice(item, "bids")
-	asks := parseWsBookSide(asksRaw)
-	bids := parseWsBookSide(bidsRaw)
+	asks, askTexts := parseWsBookSide(asksRaw)
+	bids, bidTexts := parseWsBookSide(bidsRaw)
 	ts := parseInt(getMapString(item, "ts"))
+	delta := &banexg.BookDelta{
+		Asks:      asks,
+		Bids:      bids,
+		AskTexts:  askTexts,
+		BidTexts:  bidTexts,
+		LastID:    parseInt(getMapString(item, "seqId")),
+		TimeStamp: ts,
+	}
+	if text := getMapString(item, "checksum"); text != "" {
+		delta.CheckDepth = wsBookCheckDepth
+		delta.Checksum = int32(parseInt(text))
+	}
 	e.OdBookLock.Lock()
 	book, ok := e.OrderBooks[symbol]
 	if !ok || action == "snapshot" {
@@ -870,18 +873,34 @@ func (e *OKX) applyWsOrderBookUpdate(client *banexg.WsClient, item map[string]in
 			limit = 400
 		}
 		book = &banexg.OrderBook{
-			Symbol:    symbol,
-			TimeStamp: ts,
-			Asks:      banexg.NewOdBookSide(false, limit, asks),
-			Bids:      banexg.NewOdBookSide(true, limit, bids),
-			Limit:     limit,
-			Cache:     make([]map[string]string, 0),
+			Symbol: symbol,
+			Asks:   banexg.NewOdBookSide(false, limit, nil),
+			Bids:   banexg.NewOdBookSide(true, limit, nil),
+			Limit:  limit,
+			Cache:  make([]map[string]string, 0),
 		}
 		e.OrderBooks[symbol] = book
 		e.OdBookLock.Unlock()
+		// snapshot has no PrevID, so only the checksum is verified
+		if _, reason := book.ApplyDelta(delta); reason != "" {
+			e.resyncOrderBook(client, book, channel, instId, reason)
+			return nil
+		}
 		return book
 	}
 	e.OdBookLock.Unlock()
+	if action == "update" {
+		delta.PrevID = parseInt(getMapString(item, "prevSeqId"))
+		applied, reason := book.ApplyDelta(delta)
+		if reason != "" {
+			e.resyncOrderBook(client, book, channel, instId, reason,
+				zap.Int64("cur", book.Nonce), zap.Int64("prev", delta.PrevID))
+		}
+		if !applied {
+			return nil
+		}
+		return book
+	}
 	if len(asks) > 0 {
 		book.Asks.Update(asks)
 	}
@@ -892,6 +911,36 @@ func (e *OKX) applyWsOrderBookUpdate(client *banexg.WsClient, item map[string]in
 	return book
 }
 
+/*
+resyncOrderBook
+reset a broken order book and resubscribe the channel to receive a new snapshot
+重置失效的订单簿，并重新订阅以获取新快照
+*/
+func (e *OKX) resyncOrderBook(client *banexg.WsClient, book *banexg.OrderBook, channel, instId, reason string, fields ...zap.Field) {
+	e.BookResync(book.Symbol, reason, fields...)
+	book.Reset()
+	if e.IsReplay() {
+		// skip resubscribe in replay mode
+		return
+	}
+	go func() {
+		err := e.fetchOrderBookSnapshot(client, channel, instId)
+		if err != nil {
+			log.Error("resubscribe okx order book fail", zap.String("code", book.Symbol), zap.Error(err))
+		}
+	}()
+}
+
+// fetchOrderBookSnapshot resubscribe order book channel, okx pushes a full snapshot after subscribed
+func (e *OKX) fetchOrderBookSnapshot(client *banexg.WsClient, channel, instId string) *errs.Error {
+	keys := []string{buildWsKey(channel, instId)}
+	args := []map[string]interface{}{{FldChannel: channel, FldInstId: instId}}
+	if err := e.writeWsArgs(client, 0, false, keys, args); err != nil {
+		return err
+	}
+	return e.writeWsArgs(client, 0, true, keys, args)
+}
+
 func (e *OKX) handleWsOHLCV(client *banexg.WsClient, msg map[string]interface{}, arg map[string]interface{}) {
 	items := getMapSlice(msg, "data")
 	if len(items) == 0 {
@@ -913,7 +962,8 @@ func (e *OKX) handleWsOHLCV(client *banexg.WsClient, msg map[string]interface{},
 	if tf == channel {
 		tf = ""
 	}
-	client.SetSubsKeyStamp(buildWsKey(channel, instId), bntp.UTCStamp())
+	tf = okxTimeFrame(tf)
+	client.SetSubsKeyStamp(buildWsKey(channel, instId), e.MilliSeconds())
 	chanKey := client.Prefix("candle")
 	for _, item := range items {
 		kline := parseWsCandleItem(item)
@@ -952,7 +1002,7 @@ func (e *OKX) handleWsMarkPrices(client *banexg.WsClient, msg map[string]interfa
 		data[symbol] = price
 		result[symbol] = price
 		if instId != "" {
-			client.SetSubsKeyStamp(buildWsKey("mark-price", instId), bntp.UTCStamp())
+			client.SetSubsKeyStamp(buildWsKey("mark-price", instId), e.MilliSeconds())
 		}
 	}
 	e.MarkPriceLock.Unlock()
@@ -1013,7 +1063,7 @@ func (e *OKX) handleWsBalanceAndPosition(client *banexg.WsClient, msg map[string
 		if pTime > 0 {
 			client.SetSubsKeyStamp(termKey, pTime)
 		} else {
-			client.SetSubsKeyStamp(termKey, bntp.UTCStamp())
+			client.SetSubsKeyStamp(termKey, e.MilliSeconds())
 		}
 	}
 }
@@ -1024,7 +1074,7 @@ func (e *OKX) hasPositionsSubscription(client *banexg.WsClient) bool {
 		return false
 	}
 	// Check all WebSocket clients for positions channel subscription
-	for _, c := range e.WSClients {
+	for _, c := range e.GetWsClients() {
 		if c.AccName != client.AccName {
 			continue
 		}
@@ -1059,7 +1109,7 @@ func (e *OKX) handleWsPositions(client *banexg.WsClient, msg map[string]interfac
 	for _, cfg := range accConfigs {
 		banexg.WriteOutChan(e.Exchange, accChanKey, cfg, true)
 	}
-	client.SetSubsKeyStamp(termKey, bntp.UTCStamp())
+	client.SetSubsKeyStamp(termKey, e.MilliSeconds())
 }
 
 func parseWsTradeItem(e *OKX, item map[string]interface{}) *banexg.Trade {
@@ -1086,20 +1136,24 @@ func parseWsTradeItem(e *OKX, item map[string]interface{}) *banexg.Trade {
 	return trade
 }
 
-func parseWsBookSide(levels []map[string]interface{}) [][2]float64 {
+// parseWsBookSide return levels and their raw price/size strings, which are used by checksum
+func parseWsBookSide(levels []map[string]interface{}) ([][2]float64, [][2]string) {
 	if len(levels) == 0 {
-		return nil
+		return nil, nil
 	}
 	res := make([][2]float64, 0, len(levels))
+	texts := make([][2]string, 0, len(levels))
 	for _, lvl := range levels {
-		price := parseFloat(getMapString(lvl, "0"))
-		size := parseFloat(getMapString(lvl, "1"))
+		priceStr, sizeStr := getMapString(lvl, "0"), getMapString(lvl, "1")
+		price := parseFloat(priceStr)
+		size := parseFloat(sizeStr)
 		if price == 0 && size == 0 {
 			continue
 		}
 		res = append(res, [2]float64{price, size})
+		texts = append(texts, [2]string{priceStr, sizeStr})
 	}
-	return res
+	return res, texts
 }
 
 func parseWsBalanceData(e *OKX, items []map[string]interface{}) *banexg.Balances {
@@ -1248,7 +1302,7 @@ func (e *OKX) handleWsOrders(client *banexg.WsClient, msg map[string]interface{}
 				subKey = buildWsKeyWithType("orders", instType, instId)
 			}
 		}
-		client.SetSubsKeyStamp(subKey, bntp.UTCStamp())
+		client.SetSubsKeyStamp(subKey, e.MilliSeconds())
 		banexg.WriteOutChan(e.Exchange, chanKey, trade, true)
 	}
 }
@@ -1281,7 +1335,7 @@ func (e *OKX) handleWsAlgoOrders(client *banexg.WsClient, msg map[string]interfa
 				subKey = buildWsKeyWithType(WsChanOrdersAlgo, instType, instId)
 			}
 		}
-		client.SetSubsKeyStamp(subKey, bntp.UTCStamp())
+		client.SetSubsKeyStamp(subKey, e.MilliSeconds())
 		banexg.WriteOutChan(e.Exchange, chanKey, trade, true)
 	}
 }
@@ -1478,6 +1532,16 @@ func okxCandleChannel(timeframe string) string {
 	return "candle" + timeframe
 }
 
+// okxTimeFrame map okx bar like 1H to unified timeframe 将okx周期如1H转为统一周期
+func okxTimeFrame(bar string) string {
+	for tf, val := range timeFrameMap {
+		if val == bar {
+			return tf
+		}
+	}
+	return bar
+}
+
 func parseWsCandleItem(item map[string]interface{}) *banexg.Kline {
 	if item == nil {
 		return nil
@@ -1662,7 +1726,7 @@ func makeCheckWsTimeout(e *OKX) func() {
 		pingInterval := time.Second * 20
 		for {
 			time.Sleep(pingInterval)
-			for _, client := range e.WSClients {
+			for _, client := range e.GetWsClients() {
 				conns, lock := client.LockConns()
 				for _, conn := range conns {
 					// Send raw "ping" string to keep connection alive
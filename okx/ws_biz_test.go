@@ -1,6 +1,9 @@
 package okx
 
 import (
+	"encoding/json"
+	"hash/crc32"
+	"strconv"
 	"testing"
 	"time"
 
@@ -179,12 +182,87 @@ func TestParseWsBookSide(t *testing.T) {
 		{"0": "100", "1": "2"},
 		{"0": "101", "1": "3"},
 	}
-	out := parseWsBookSide(levels)
-	if len(out) != 2 {
+	out, texts := parseWsBookSide(levels)
+	if len(out) != 2 || len(texts) != 2 {
 		t.Fatalf("unexpected len: %d", len(out))
 	}
-	if out[0][0] != 100 || out[0][1] != 2 {
-		t.Fatalf("unexpected level: %+v", out[0])
+	if out[0][0] != 100 || out[0][1] != 2 || texts[1][0] != "101" {
+		t.Fatalf("unexpected level: %+v %+v", out[0], texts[1])
+	}
+}
+
+func TestApplyWsOrderBookIntegrity(t *testing.T) {
+	exg, err := New(nil)
+	if err != nil {
+		t.Fatalf("new okx fail: %v", err)
+	}
+	lvl := func(px, sz string) []interface{} { return []interface{}{px, sz, "0", "1"} }
+	// example from okx docs
+	sum := int32(crc32.ChecksumIEEE([]byte("3366.1:7:3366.8:9:3366:6:3368:8")))
+	snap := map[string]interface{}{
+		"instId":    "BTC-USDT",
+		"asks":      []interface{}{lvl("3366.8", "9"), lvl("3368", "8")},
+		"bids":      []interface{}{lvl("3366.1", "7"), lvl("3366", "6")},
+		"ts":        "1700000000000",
+		"seqId":     json.Number("100"),
+		"prevSeqId": json.Number("-1"),
+		"checksum":  json.Number(strconv.Itoa(int(sum))),
+	}
+	book := exg.applyWsOrderBookUpdate(nil, snap, WsChanBooks, "snapshot")
+	if book == nil || book.Nonce != 100 {
+		t.Fatalf("snapshot rejected: %+v", book)
+	}
+	sum = int32(crc32.ChecksumIEEE([]byte("3366.1:7:3366.8:9:3366:6:3368:5")))
+	upd := map[string]interface{}{
+		"instId":    "BTC-USDT",
+		"asks":      []interface{}{lvl("3368", "5")},
+		"ts":        "1700000001000",
+		"seqId":     json.Number("103"),
+		"prevSeqId": json.Number("100"),
+		"checksum":  json.Number(strconv.Itoa(int(sum))),
+	}
+	book = exg.applyWsOrderBookUpdate(nil, upd, WsChanBooks, "update")
+	if book == nil || book.Nonce != 103 || book.Asks.Sizes()[1] != 5 {
+		t.Fatalf("update rejected: %+v", book)
+	}
+	// wrong checksum
+	upd["seqId"], upd["prevSeqId"] = json.Number("104"), json.Number("103")
+	upd["checksum"] = json.Number("1")
+	if book = exg.applyWsOrderBookUpdate(nil, upd, WsChanBooks, "update"); book != nil {
+		t.Fatalf("checksum mismatch should drop the update")
+	}
+	stored := exg.OrderBooks["BTC-USDT"]
+	if stored.Nonce != 0 || stored.Asks.Len() != 0 {
+		t.Fatalf("broken book should be reset, nonce=%d", stored.Nonce)
+	}
+	// updates are dropped until the next snapshot
+	upd["seqId"], upd["prevSeqId"] = json.Number("105"), json.Number("104")
+	if book = exg.applyWsOrderBookUpdate(nil, upd, WsChanBooks, "update"); book != nil {
+		t.Fatalf("update before snapshot should be dropped")
+	}
+
+	// checksum is computed over raw strings with trailing zeros
+	sum = int32(crc32.ChecksumIEEE([]byte("0.10:1.50:0.11:2")))
+	snap = map[string]interface{}{
+		"instId":   "BTC-USDT",
+		"asks":     []interface{}{lvl("0.11", "2")},
+		"bids":     []interface{}{lvl("0.10", "1.50")},
+		"seqId":    json.Number("200"),
+		"checksum": json.Number(strconv.Itoa(int(sum))),
+	}
+	if book = exg.applyWsOrderBookUpdate(nil, snap, WsChanBooks, "snapshot"); book == nil {
+		t.Fatalf("snapshot with trailing zeros rejected")
+	}
+	sum = int32(crc32.ChecksumIEEE([]byte("0.10:1.50:0.11:3.0")))
+	upd = map[string]interface{}{
+		"instId":    "BTC-USDT",
+		"asks":      []interface{}{lvl("0.11", "3.0")},
+		"seqId":     json.Number("201"),
+		"prevSeqId": json.Number("200"),
+		"checksum":  json.Number(strconv.Itoa(int(sum))),
+	}
+	if book = exg.applyWsOrderBookUpdate(nil, upd, WsChanBooks, "update"); book == nil {
+		t.Fatalf("update with trailing zeros rejected")
 	}
 }
 
@@ -0,0 +1,134 @@
+package banexg
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/banbox/banexg/errs"
+	"github.com/banbox/banexg/log"
+	"github.com/banbox/banexg/utils"
+	"go.uber.org/zap"
+)
+
+var (
+	ReconcileIntv = time.Millisecond * 500 // wait interval between queries when reconciling 对账时查询订单的间隔
+)
+
+/*
+NewClientOrderID
+generate a unique client order id of 32 alphanumerics, which is accepted by binance/okx/bybit.
+生成32位字母数字组成的唯一客户端订单ID，适用于binance/okx/bybit
+*/
+func NewClientOrderID() string {
+	buf := make([]byte, 15)
+	if _, err := rand.Read(buf); err != nil {
+		// fallback to nanoseconds, still unique in one process
+		stamp := time.Now().UnixNano()
+		for i := range buf {
+			buf[i] = byte(stamp >> (i % 8 * 8))
+		}
+	}
+	return "bx" + hex.EncodeToString(buf)
+}
+
+/*
+IsUnknownOutcome
+whether a failed trading request may have been executed by the exchange.
+下单/撤单等请求失败时，交易所是否可能已执行
+*/
+func IsUnknownOutcome(err *errs.Error) bool {
+	if err == nil {
+		return false
+	}
+	switch err.Code {
+	case errs.CodeExecutionUnknown, errs.CodeTimeout, errs.CodeNetFail:
+		return true
+	default:
+		return false
+	}
+}
+
+/*
+ReconcileOrder
+called after an order request failed. When the outcome is unknown (timeout, 5xx of risky apis),
+query the real order state by fetch (usually FetchOrder with clientOrderId).
+applied checks whether the found order shows the request took effect, like OrderCanceled for CancelOrder and
+OrderEdited for EditOrder; nil means any found order counts, for CreateOrder.
+Returns the order if found and applied; otherwise returns the original error, or CodeExecutionUnknown if all queries
+return OrderNotFound/DataNotFound. Not found is not proof the request failed: the exchange may still be processing it,
+and order queries can lag behind order creation. Retrying with a new clientOrderId may fill twice, retry with the same
+clientOrderId (rejected as duplicate if the first one exists) or check open orders later.
+Retry count can be set by Retries["ReconcileOrder"] (default 3).
+订单请求失败后调用。结果未知时（超时、危险接口5xx等），通过fetch查询订单真实状态。
+applied检查查到的订单是否表明请求已生效，如撤单用OrderCanceled，改单用OrderEdited；为nil时查到即可，用于下单。
+找到且已生效则返回订单；否则返回原始错误，多次查询均不存在时返回CodeExecutionUnknown。查不到不代表请求失败：
+交易所可能仍在处理，订单查询也可能滞后于下单。用新的clientOrderId重试可能重复成交，应使用相同clientOrderId重试
+（若首单已存在会被作为重复请求拒绝），或稍后检查未完成订单
+*/
+func (e *Exchange) ReconcileOrder(action string, reqErr *errs.Error, fetch func() (*Order, *errs.Error),
+	applied func(od *Order) bool) (*Order, *errs.Error) {
+	if fetch == nil || !IsUnknownOutcome(reqErr) {
+		return nil, reqErr
+	}
+	tryNum := e.GetRetryNum("ReconcileOrder", 3)
+	notFound := 0
+	var lastErr *errs.Error
+	for i := 0; i < tryNum; i++ {
+		if i > 0 {
+			time.Sleep(ReconcileIntv)
+		}
+		od, err := fetch()
+		if err == nil && od != nil {
+			if applied == nil || applied(od) {
+				log.Info("reconciled order after unknown outcome", zap.String("exg", e.ID),
+					zap.String("action", action), zap.String("id", od.ID), zap.String("status", od.Status))
+				return od, nil
+			}
+			// found but the request has not taken effect (yet)
+			lastErr = errs.NewMsg(errs.CodeExecutionUnknown, "%s not applied, order %s status: %s",
+				action, od.ID, od.Status)
+			continue
+		}
+		if err != nil && (err.Code == errs.CodeOrderNotFound || err.Code == errs.CodeDataNotFound) {
+			notFound += 1
+		}
+		lastErr = err
+	}
+	if notFound > 0 && notFound == tryNum {
+		log.Warn("reconcile order not found, outcome still unknown", zap.String("exg", e.ID),
+			zap.String("action", action), zap.Int("queries", tryNum))
+		return nil, errs.NewMsg(errs.CodeExecutionUnknown, "%s outcome unknown, order not found after %d queries: %s",
+			action, tryNum, reqErr.Short())
+	}
+	log.Warn("reconcile order fail", zap.String("exg", e.ID), zap.String("action", action),
+		zap.String("err", lastErr.Short()))
+	return nil, reqErr
+}
+
+/*
+OrderCanceled
+whether the order can no longer be filled, used to reconcile CancelOrder
+订单是否已不会再成交，用于撤单对账
+*/
+func OrderCanceled(od *Order) bool {
+	switch od.Status {
+	case OdStatusCanceled, OdStatusFilled, OdStatusExpired, OdStatusRejected:
+		return true
+	}
+	return false
+}
+
+/*
+OrderEdited
+return a check whether the order has the new amount and price (ignored if <=0), used to reconcile EditOrder
+返回检查订单是否为新数量和价格（<=0时忽略）的函数，用于改单对账
+*/
+func OrderEdited(amount, price float64) func(od *Order) bool {
+	return func(od *Order) bool {
+		if amount > 0 && !utils.EqualNearly(od.Amount, amount) {
+			return false
+		}
+		return price <= 0 || utils.EqualNearly(od.Price, price)
+	}
+}
@@ -0,0 +1,94 @@
+package banexg
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/banbox/banexg/errs"
+)
+
+func TestNewClientOrderID(t *testing.T) {
+	valid := regexp.MustCompile(`^[a-zA-Z0-9]{32}$`)
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id := NewClientOrderID()
+		if !valid.MatchString(id) {
+			t.Fatalf("invalid client order id: %s", id)
+		}
+		if seen[id] {
+			t.Fatalf("duplicate client order id: %s", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestReconcileOrder(t *testing.T) {
+	oldIntv := ReconcileIntv
+	ReconcileIntv = 0
+	defer func() { ReconcileIntv = oldIntv }()
+	e := &Exchange{ExgInfo: &ExgInfo{ID: "test"}}
+	unknown := errs.NewMsg(errs.CodeExecutionUnknown, "502")
+
+	// definitive errors are returned without queries
+	calls := 0
+	fetch := func() (*Order, *errs.Error) {
+		calls += 1
+		return nil, errs.NewMsg(errs.CodeOrderNotFound, "not found")
+	}
+	rejected := errs.NewMsg(errs.CodeInsufficientFunds, "no money")
+	if _, err := e.ReconcileOrder("CreateOrder", rejected, fetch, nil); err != rejected || calls != 0 {
+		t.Fatalf("should return original error, got %v, calls %d", err, calls)
+	}
+
+	// found after a delay
+	calls = 0
+	od, err := e.ReconcileOrder("CreateOrder", unknown, func() (*Order, *errs.Error) {
+		calls += 1
+		if calls < 2 {
+			return nil, errs.NewMsg(errs.CodeOrderNotFound, "not found")
+		}
+		return &Order{ID: "1", Status: OdStatusOpen}, nil
+	}, nil)
+	if err != nil || od == nil || od.ID != "1" || calls != 2 {
+		t.Fatalf("expect order found, got %v, %v, calls %d", od, err, calls)
+	}
+
+	// not found may be a lagging query, the outcome stays unknown
+	calls = 0
+	_, err = e.ReconcileOrder("CreateOrder", unknown, fetch, nil)
+	if err == nil || err == unknown || err.Code != errs.CodeExecutionUnknown || calls != 3 {
+		t.Fatalf("expect unknown after not found, got %v, calls %d", err, calls)
+	}
+
+	// query failed, keep unknown
+	_, err = e.ReconcileOrder("CancelOrder", unknown, func() (*Order, *errs.Error) {
+		return nil, errs.NewMsg(errs.CodeNetFail, "down")
+	}, OrderCanceled)
+	if err != unknown {
+		t.Fatalf("expect original error, got %v", err)
+	}
+
+	// found but still open, the cancel is not confirmed
+	calls = 0
+	open := func() (*Order, *errs.Error) {
+		calls += 1
+		return &Order{ID: "1", Status: OdStatusOpen, Amount: 1, Price: 10}, nil
+	}
+	if _, err = e.ReconcileOrder("CancelOrder", unknown, open, OrderCanceled); err != unknown || calls != 3 {
+		t.Fatalf("open order shouldn't confirm cancel, got %v, calls %d", err, calls)
+	}
+	od, err = e.ReconcileOrder("CancelOrder", unknown, func() (*Order, *errs.Error) {
+		return &Order{ID: "1", Status: OdStatusFilled}, nil
+	}, OrderCanceled)
+	if err != nil || od.Status != OdStatusFilled {
+		t.Fatalf("filled order should confirm cancel, got %v", err)
+	}
+
+	// edit is confirmed only with the new price and amount
+	if _, err = e.ReconcileOrder("EditOrder", unknown, open, OrderEdited(1, 11)); err != unknown {
+		t.Fatalf("old price shouldn't confirm edit, got %v", err)
+	}
+	if od, err = e.ReconcileOrder("EditOrder", unknown, open, OrderEdited(1, 10)); err != nil || od == nil {
+		t.Fatalf("new price should confirm edit, got %v", err)
+	}
+}
@@ -0,0 +1,238 @@
+package banexg
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/banbox/banexg/errs"
+	"github.com/banbox/banexg/log"
+	"github.com/banbox/banexg/utils"
+	"go.uber.org/zap"
+)
+
+/*
+OrderRequest
+Typed arguments for CreateOrderReq, replacing the Param* keys of CreateOrder params.
+Exchange specific keys which have no typed field can be passed by Extra.
+CreateOrderReq的类型化参数，替代CreateOrder中params的Param*键。无对应字段的交易所特有参数可通过Extra传入
+*/
+type OrderRequest struct {
+	Symbol          string
+	Type            string  // OdType*
+	Side            string  // OdSideBuy / OdSideSell
+	Amount          float64 // amount of base currency
+	Price           float64 // ignored for market orders
+	Cost            float64 // quote amount for spot market orders
+	TimeInForce     string  // TimeInForce*
+	PostOnly        bool
+	ReduceOnly      bool
+	ClosePosition   bool    // close all position after triggered
+	TriggerPrice    float64 // trigger price for stop orders
+	StopLossPrice   float64
+	TakeProfitPrice float64
+	TrailingDelta   float64 // trailing distance, bips for binance spot
+	CallbackRate    float64 // trailing callback percent
+	ActivationPrice float64 // activation price for trailing stop
+	PositionSide    string  // PosSideLong / PosSideShort, empty for one-way mode
+	ClientOrderID   string
+	STPMode         string // self trade prevention mode, exchange specific value
+	GoodTillDate    int64  // 13 digits timestamp for TimeInForceGTD
+	MarginMode      string // MarginCross / MarginIsolated, or exchange specific value
+	// Extra native args of the exchange, or Param* keys without typed field (e.g. ParamAccount).
+	// Keys unknown to the exchange are rejected, unless LenientExtra is set.
+	Extra map[string]interface{}
+	// LenientExtra pass unknown Extra keys to the exchange with a warning instead of rejecting them.
+	// Set by NewOrderRequest, as CreateOrder used to send unknown keys as is.
+	// 不拒绝未知的Extra键，仅警告后原样发给交易所。NewOrderRequest会设置，与CreateOrder原行为一致
+	LenientExtra bool
+}
+
+// typed keys which should not be passed by OrderRequest.Extra
+var orderReqKeys = []string{ParamCost, ParamTimeInForce, ParamPostOnly, ParamReduceOnly, ParamClosePosition,
+	ParamTriggerPrice, ParamStopLossPrice, ParamTakeProfitPrice, ParamTrailingDelta, ParamCallbackRate,
+	ParamActivationPrice, ParamPositionSide, ParamClientOrderId, ParamSelfTradePreventionMode,
+	ParamGoodTillDate, ParamMarginMode}
+
+// orderCommonKeys Extra keys handled by Exchange for every adapter
+var orderCommonKeys = map[string]bool{ParamAccount: true, ParamMarket: true, ParamContract: true, ParamDebug: true}
+
+var validTimeInForces = map[string]bool{
+	TimeInForceGTC: true, TimeInForceIOC: true, TimeInForceFOK: true,
+	TimeInForceGTX: true, TimeInForceGTD: true, TimeInForcePO: true,
+}
+
+/*
+NewOrderRequest
+build OrderRequest from arguments of CreateOrder, known Param* keys are moved to typed fields,
+others are kept in Extra and LenientExtra is set. Values are converted like CreateOrder did: numbers and bools
+can be passed as strings, values which can't be converted are ignored with a warning.
+根据CreateOrder的参数构建OrderRequest，已知的Param*键转为字段，其余保留在Extra并设置LenientExtra。
+值的转换与原CreateOrder一致：数字和布尔值可为字符串，无法转换的值忽略并警告
+*/
+func NewOrderRequest(symbol, odType, side string, amount, price float64, params map[string]interface{}) *OrderRequest {
+	args := utils.SafeParams(params)
+	req := &OrderRequest{Symbol: symbol, Type: odType, Side: side, Amount: amount, Price: price, LenientExtra: true}
+	ignore := func(key string, val interface{}) {
+		log.Warn("invalid order param, ignored", zap.String("key", key), zap.Any("val", val))
+	}
+	popStr := func(key string) string {
+		val, ok := args[key]
+		if !ok || val == nil {
+			return ""
+		}
+		delete(args, key)
+		if text, ok := val.(string); ok {
+			return text
+		}
+		return fmt.Sprintf("%v", val)
+	}
+	popBool := func(key string) bool {
+		val, ok := args[key]
+		if !ok || val == nil {
+			return false
+		}
+		delete(args, key)
+		switch v := val.(type) {
+		case bool:
+			return v
+		case string:
+			flag, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err == nil {
+				return flag
+			}
+		default:
+			if num, err := utils.ParseNum(v); err == nil {
+				return num != 0
+			}
+		}
+		ignore(key, val)
+		return false
+	}
+	popFloat := func(key string) float64 {
+		val, ok := args[key]
+		if !ok {
+			return 0
+		}
+		delete(args, key)
+		num, err := utils.ParseNum(val)
+		if err != nil {
+			ignore(key, val)
+		}
+		return num
+	}
+	req.Cost = popFloat(ParamCost)
+	req.TimeInForce = strings.ToUpper(strings.TrimSpace(popStr(ParamTimeInForce)))
+	if req.TimeInForce == "POSTONLY" {
+		req.TimeInForce = TimeInForcePO
+	}
+	req.PostOnly = popBool(ParamPostOnly)
+	req.ReduceOnly = popBool(ParamReduceOnly)
+	req.ClosePosition = popBool(ParamClosePosition)
+	req.TriggerPrice = popFloat(ParamTriggerPrice)
+	req.StopLossPrice = popFloat(ParamStopLossPrice)
+	req.TakeProfitPrice = popFloat(ParamTakeProfitPrice)
+	req.TrailingDelta = popFloat(ParamTrailingDelta)
+	req.CallbackRate = popFloat(ParamCallbackRate)
+	req.ActivationPrice = popFloat(ParamActivationPrice)
+	req.PositionSide = popStr(ParamPositionSide)
+	req.ClientOrderID = popStr(ParamClientOrderId)
+	req.STPMode = popStr(ParamSelfTradePreventionMode)
+	req.MarginMode = popStr(ParamMarginMode)
+	if val, ok := args[ParamGoodTillDate]; ok {
+		delete(args, ParamGoodTillDate)
+		stamp, err := utils.ParseInt64(val)
+		if err != nil {
+			ignore(ParamGoodTillDate, val)
+		}
+		req.GoodTillDate = stamp
+	}
+	if len(args) > 0 {
+		req.Extra = args
+	}
+	return req
+}
+
+/*
+Validate check common constraints of order request, exchange specific checks are done by adapters.
+检查订单请求的通用约束，交易所特有的检查由各适配器完成
+*/
+func (r *OrderRequest) Validate() *errs.Error {
+	if r.Symbol == "" {
+		return errs.NewMsg(errs.CodeParamRequired, "symbol is required")
+	}
+	if r.Type == "" {
+		return errs.NewMsg(errs.CodeParamRequired, "order type is required")
+	}
+	if side := strings.ToLower(r.Side); side != OdSideBuy && side != OdSideSell {
+		return errs.NewMsg(errs.CodeParamInvalid, "invalid order side: %s", r.Side)
+	}
+	if r.Amount < 0 || r.Price < 0 || r.Cost < 0 {
+		return errs.NewMsg(errs.CodeParamInvalid, "amount/price/cost can not be negative")
+	}
+	if r.TriggerPrice < 0 || r.StopLossPrice < 0 || r.TakeProfitPrice < 0 || r.ActivationPrice < 0 {
+		return errs.NewMsg(errs.CodeParamInvalid, "trigger prices can not be negative")
+	}
+	if r.TrailingDelta < 0 || r.CallbackRate < 0 {
+		return errs.NewMsg(errs.CodeParamInvalid, "trailingDelta/callbackRate can not be negative")
+	}
+	if (r.Type == OdTypeLimit || r.Type == OdTypeLimitMaker) && r.Price == 0 {
+		return errs.NewMsg(errs.CodeParamRequired, "price is required for %s order", r.Type)
+	}
+	if r.TimeInForce != "" && !validTimeInForces[r.TimeInForce] {
+		return errs.NewMsg(errs.CodeParamInvalid, "invalid timeInForce: %s", r.TimeInForce)
+	}
+	if r.PostOnly {
+		if r.Type == OdTypeMarket {
+			return errs.NewMsg(errs.CodeParamInvalid, "market orders cannot be postOnly")
+		}
+		if r.TimeInForce == TimeInForceIOC || r.TimeInForce == TimeInForceFOK {
+			return errs.NewMsg(errs.CodeParamInvalid, "postOnly orders cannot have timeInForce: %s", r.TimeInForce)
+		}
+	}
+	if r.TimeInForce == TimeInForceGTD && r.GoodTillDate <= 0 {
+		return errs.NewMsg(errs.CodeParamRequired, "goodTillDate is required for GTD order")
+	}
+	if r.GoodTillDate > 0 && r.TimeInForce != "" && r.TimeInForce != TimeInForceGTD {
+		return errs.NewMsg(errs.CodeParamInvalid, "goodTillDate requires timeInForce GTD, got %s", r.TimeInForce)
+	}
+	switch strings.ToLower(r.PositionSide) {
+	case "", PosSideLong, PosSideShort, "both", "net":
+	default:
+		return errs.NewMsg(errs.CodeParamInvalid, "invalid positionSide: %s", r.PositionSide)
+	}
+	for _, key := range orderReqKeys {
+		if _, ok := r.Extra[key]; ok {
+			return errs.NewMsg(errs.CodeParamInvalid, "%s should be set by typed field of OrderRequest", key)
+		}
+	}
+	return nil
+}
+
+/*
+ExtraArgs
+copy Extra as initial args for the native api of exchange. Keys handled by Exchange (ParamAccount, ParamMarket,
+ParamContract, ParamDebug) and keys in known are accepted, others are rejected with CodeParamInvalid,
+or passed through with a warning when LenientExtra is set.
+复制Extra作为交易所原生接口的初始参数。接受Exchange处理的键和known中的键，其他键返回CodeParamInvalid；
+设置LenientExtra时仅警告并原样传递
+*/
+func (r *OrderRequest) ExtraArgs(exgID string, known map[string]bool) (map[string]interface{}, *errs.Error) {
+	args := utils.SafeParams(r.Extra)
+	var unknown []string
+	for key := range args {
+		if !orderCommonKeys[key] && !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) == 0 {
+		return args, nil
+	}
+	sort.Strings(unknown)
+	if !r.LenientExtra {
+		return nil, errs.NewMsg(errs.CodeParamInvalid, "unknown order params for %s: %s", exgID, strings.Join(unknown, ","))
+	}
+	log.Warn("unknown order params, sent as is", zap.String("exg", exgID), zap.Strings("keys", unknown))
+	return args, nil
+}
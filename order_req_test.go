@@ -0,0 +1,90 @@
+package banexg
+
+import (
+	"testing"
+
+	"github.com/banbox/banexg/errs"
+)
+
+func TestNewOrderRequest(t *testing.T) {
+	req := NewOrderRequest("BTC/USDT:USDT", OdTypeLimit, OdSideBuy, 1, 100, map[string]interface{}{
+		ParamTimeInForce:   "PostOnly",
+		ParamReduceOnly:    true,
+		ParamTrailingDelta: 30,
+		ParamGoodTillDate:  "1700000000000",
+		ParamClientOrderId: "abc",
+		"orderLinkId":      "native",
+	})
+	if req.TimeInForce != TimeInForcePO || !req.ReduceOnly || req.TrailingDelta != 30 ||
+		req.GoodTillDate != 1700000000000 || req.ClientOrderID != "abc" || !req.LenientExtra {
+		t.Fatalf("unexpected request: %+v", req)
+	}
+	if len(req.Extra) != 1 || req.Extra["orderLinkId"] != "native" {
+		t.Fatalf("unknown keys should be kept in Extra: %v", req.Extra)
+	}
+	// loose values are converted like CreateOrder did, invalid ones are ignored
+	req = NewOrderRequest("BTC/USDT", OdTypeLimit, OdSideBuy, 1, 100, map[string]interface{}{
+		ParamPostOnly:   "true",
+		ParamReduceOnly: 1,
+		ParamCost:       "abc",
+	})
+	if !req.PostOnly || !req.ReduceOnly || req.Cost != 0 || len(req.Extra) != 0 {
+		t.Fatalf("unexpected request: %+v", req)
+	}
+}
+
+func TestOrderRequestExtraArgs(t *testing.T) {
+	known := map[string]bool{"orderLinkId": true}
+	req := &OrderRequest{Extra: map[string]interface{}{"orderLinkId": "a", ParamAccount: "acc", "bad": 1, "abc": 2}}
+	_, err := req.ExtraArgs("test", known)
+	if err == nil || err.Code != errs.CodeParamInvalid || err.Message() != "unknown order params for test: abc,bad" {
+		t.Fatalf("unknown keys should be rejected, got %v", err)
+	}
+	req.LenientExtra = true
+	args, err := req.ExtraArgs("test", known)
+	if err != nil {
+		t.Fatalf("lenient should pass: %v", err)
+	}
+	if len(args) != 4 || args["bad"] != 1 {
+		t.Fatalf("unexpected args: %v", args)
+	}
+	args["orderLinkId"] = "b"
+	if req.Extra["orderLinkId"] != "a" {
+		t.Fatalf("Extra should be copied")
+	}
+}
+
+func TestOrderRequestValidate(t *testing.T) {
+	cases := []struct {
+		name string
+		req  OrderRequest
+		code int
+	}{
+		{"ok", OrderRequest{Symbol: "BTC/USDT", Type: OdTypeLimit, Side: OdSideBuy, Amount: 1, Price: 10}, 0},
+		{"no symbol", OrderRequest{Type: OdTypeMarket, Side: OdSideBuy, Amount: 1}, errs.CodeParamRequired},
+		{"bad side", OrderRequest{Symbol: "BTC/USDT", Type: OdTypeMarket, Side: "long", Amount: 1}, errs.CodeParamInvalid},
+		{"limit no price", OrderRequest{Symbol: "BTC/USDT", Type: OdTypeLimit, Side: OdSideBuy, Amount: 1}, errs.CodeParamRequired},
+		{"post only market", OrderRequest{Symbol: "BTC/USDT", Type: OdTypeMarket, Side: OdSideBuy, Amount: 1,
+			PostOnly: true}, errs.CodeParamInvalid},
+		{"bad tif", OrderRequest{Symbol: "BTC/USDT", Type: OdTypeLimit, Side: OdSideBuy, Amount: 1, Price: 10,
+			TimeInForce: "GTT"}, errs.CodeParamInvalid},
+		{"gtd no date", OrderRequest{Symbol: "BTC/USDT", Type: OdTypeLimit, Side: OdSideBuy, Amount: 1, Price: 10,
+			TimeInForce: TimeInForceGTD}, errs.CodeParamRequired},
+		{"gtd with ioc", OrderRequest{Symbol: "BTC/USDT", Type: OdTypeLimit, Side: OdSideBuy, Amount: 1, Price: 10,
+			TimeInForce: TimeInForceIOC, GoodTillDate: 1700000000000}, errs.CodeParamInvalid},
+		{"bad pos side", OrderRequest{Symbol: "BTC/USDT", Type: OdTypeMarket, Side: OdSideBuy, Amount: 1,
+			PositionSide: "up"}, errs.CodeParamInvalid},
+		{"typed key in extra", OrderRequest{Symbol: "BTC/USDT", Type: OdTypeMarket, Side: OdSideBuy, Amount: 1,
+			Extra: map[string]interface{}{ParamReduceOnly: true}}, errs.CodeParamInvalid},
+	}
+	for _, c := range cases {
+		err := c.req.Validate()
+		code := 0
+		if err != nil {
+			code = err.Code
+		}
+		if code != c.code {
+			t.Errorf("%s: expect code %d, got %v", c.name, c.code, err)
+		}
+	}
+}
@@ -0,0 +1,514 @@
+package banexg
+
+import (
+	"sort"
+	"time"
+
+	"github.com/banbox/banexg/errs"
+	"github.com/banbox/banexg/log"
+	"github.com/banbox/banexg/utils"
+	"github.com/sasha-s/go-deadlock"
+	"go.uber.org/zap"
+)
+
+const (
+	OdEventNew      = "new"
+	OdEventPartFill = "part_fill"
+	OdEventFill     = "fill"
+	OdEventCancel   = "cancel" // canceled or expired
+	OdEventReject   = "reject"
+)
+
+/*
+OrderEvent
+state change of an order tracked by OrderTracker
+OrderTracker跟踪的订单状态变化
+*/
+type OrderEvent struct {
+	Type    string   // OdEvent*
+	Account string   // account name
+	Order   *Order   // snapshot of order after this event, should not be modified
+	Trade   *MyTrade // websocket update which triggered this event, nil if from REST
+}
+
+/*
+OrderTracker
+keep an in-memory map of open orders per account/symbol from WatchMyTrades, and fill gaps by
+polling FetchOpenOrders/FetchOrder periodically and after websocket reconnects.
+State changes are queued and sent to Events in order after Start by one goroutine without holding any lock,
+so consumers may call back into the tracker. Events should be consumed in time, or the queue keeps growing.
+通过WatchMyTrades维护各账户/品种的未完成订单，并定期及在websocket重连后通过FetchOpenOrders/FetchOrder补齐缺口。
+状态变化先入队，Start后由单个协程在不持有锁的情况下按顺序发送到Events，消费方可回调跟踪器。需及时消费，否则队列持续增长
+*/
+type OrderTracker struct {
+	Exg      BanExchange
+	Accounts []string         // accounts to track
+	Symbols  []string         // symbols to poll open orders, empty to poll all symbols at once
+	SyncIntv time.Duration    // interval to poll REST, 0 to only sync after reconnects
+	DoneKeep time.Duration    // keep finished order ids to ignore late updates
+	Events   chan *OrderEvent // events of order state changes
+
+	orders    map[string]map[string]map[string]*Order // account: symbol: order id: open order
+	done      map[string]int64                        // account/order id: finish timestamp
+	pending   []*OrderEvent                           // events waiting to be sent to Events, guarded by lock
+	lock      deadlock.Mutex
+	syncLock  deadlock.Mutex
+	outs      map[string]chan *MyTrade // account: chan of WatchMyTrades, released by Stop
+	delReCon  func()                   // remove the callback of AddAfterWsReCon
+	emitChan  chan struct{}
+	syncChan  chan struct{}
+	stopChan  chan struct{}
+	isStopped bool
+}
+
+/*
+NewOrderTracker
+create a tracker for given accounts, the default account is used if accounts is empty. Call Start to run.
+创建订单跟踪器，accounts为空时使用默认账户。调用Start启动
+*/
+func NewOrderTracker(exg BanExchange, symbols []string, accounts ...string) *OrderTracker {
+	if len(accounts) == 0 {
+		accounts = []string{exg.GetExg().DefAccName}
+	}
+	return &OrderTracker{
+		Exg:      exg,
+		Accounts: accounts,
+		Symbols:  symbols,
+		SyncIntv: time.Minute,
+		DoneKeep: time.Minute * 10,
+		Events:   make(chan *OrderEvent, 1000),
+		orders:   make(map[string]map[string]map[string]*Order),
+		done:     make(map[string]int64),
+		outs:     make(map[string]chan *MyTrade),
+		emitChan: make(chan struct{}, 1),
+		syncChan: make(chan struct{}, 1),
+		stopChan: make(chan struct{}),
+	}
+}
+
+/*
+Start watch private trades of all accounts, then sync open orders by REST.
+The tracker is stopped if any watch fails.
+监听所有账户的私有成交流，然后通过REST同步未完成订单。任一监听失败时跟踪器被停止
+*/
+func (t *OrderTracker) Start() *errs.Error {
+	for _, acc := range t.Accounts {
+		out, err := t.Exg.WatchMyTrades(map[string]interface{}{ParamAccount: acc})
+		if err != nil {
+			t.Stop()
+			return err
+		}
+		if !t.setOut(acc, out) {
+			return errs.NewMsg(errs.CodeRunTime, "OrderTracker stopped")
+		}
+		go t.consume(acc, out)
+	}
+	go t.loopEmit()
+	delReCon := t.Exg.AddAfterWsReCon(func(client *WsClient) {
+		if client.AccName != "" && utils.ArrContains(t.Accounts, client.AccName) {
+			t.TriggerSync()
+		}
+	})
+	t.lock.Lock()
+	t.delReCon = delReCon
+	t.lock.Unlock()
+	err := t.Sync()
+	go t.loopSync()
+	return err
+}
+
+/*
+Stop stop all goroutines, release chans of WatchMyTrades and remove the reconnect callback
+停止所有协程，释放WatchMyTrades的通道并移除重连回调
+*/
+func (t *OrderTracker) Stop() {
+	t.lock.Lock()
+	if t.isStopped {
+		t.lock.Unlock()
+		return
+	}
+	t.isStopped = true
+	close(t.stopChan)
+	outs, delReCon := t.outs, t.delReCon
+	t.outs, t.delReCon = nil, nil
+	t.lock.Unlock()
+	if delReCon != nil {
+		delReCon()
+	}
+	for _, out := range outs {
+		t.Exg.GetExg().ReleaseWsOut(out)
+	}
+}
+
+// setOut save the chan of acc, it's released at once and false is returned if stopped
+func (t *OrderTracker) setOut(acc string, out chan *MyTrade) bool {
+	t.lock.Lock()
+	stopped := t.isStopped
+	if !stopped {
+		t.outs[acc] = out
+	}
+	t.lock.Unlock()
+	if stopped {
+		t.Exg.GetExg().ReleaseWsOut(out)
+	}
+	return !stopped
+}
+
+// TriggerSync request an asynchronous REST sync
+func (t *OrderTracker) TriggerSync() {
+	select {
+	case t.syncChan <- struct{}{}:
+	default:
+	}
+}
+
+func (t *OrderTracker) loopSync() {
+	var tick <-chan time.Time
+	if t.SyncIntv > 0 {
+		ticker := time.NewTicker(t.SyncIntv)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-t.stopChan:
+			return
+		case <-tick:
+		case <-t.syncChan:
+		}
+		if err := t.Sync(); err != nil {
+			log.Warn("order tracker sync fail", zap.String("exg", t.Exg.Info().ID), zap.String("err", err.Short()))
+		}
+	}
+}
+
+func (t *OrderTracker) consume(acc string, out chan *MyTrade) {
+	for {
+		select {
+		case <-t.stopChan:
+			return
+		case trade, ok := <-out:
+			if ok {
+				t.OnMyTrade(acc, trade)
+				continue
+			}
+		}
+		// channel closed, watch again and fill the gap by REST
+		log.Warn("order tracker: mytrades chan closed, rewatch", zap.String("acc", acc))
+		out = rewatch(t.stopChan, "mytrades/"+acc, func() (chan *MyTrade, *errs.Error) {
+			return t.Exg.WatchMyTrades(map[string]interface{}{ParamAccount: acc})
+		})
+		if out == nil || !t.setOut(acc, out) {
+			return
+		}
+		t.TriggerSync()
+	}
+}
+
+/*
+OnMyTrade apply an order update from websocket
+应用websocket推送的订单更新
+*/
+func (t *OrderTracker) OnMyTrade(acc string, trade *MyTrade) {
+	if trade == nil || trade.Order == "" {
+		return
+	}
+	t.lock.Lock()
+	old, isDone := t.find(acc, trade.Symbol, trade.Order)
+	if isDone {
+		t.lock.Unlock()
+		return
+	}
+	cur := orderFromMyTrade(old, trade)
+	t.emit(t.apply(acc, old, cur, trade))
+}
+
+/*
+Track add an order returned by CreateOrder, so it's tracked before any websocket update
+添加CreateOrder返回的订单，使其在收到websocket推送前即被跟踪
+*/
+func (t *OrderTracker) Track(acc string, od *Order) {
+	if od == nil || od.ID == "" {
+		return
+	}
+	t.lock.Lock()
+	old, isDone := t.find(acc, od.Symbol, od.ID)
+	if isDone {
+		t.lock.Unlock()
+		return
+	}
+	cur := *od
+	t.emit(t.apply(acc, old, &cur, nil))
+}
+
+/*
+Sync fetch open orders by REST, and query the final state of tracked orders which are not open any more
+通过REST获取未完成订单，并查询不再未完成的已跟踪订单的最终状态
+*/
+func (t *OrderTracker) Sync() *errs.Error {
+	t.syncLock.Lock()
+	defer t.syncLock.Unlock()
+	var lastErr *errs.Error
+	for _, acc := range t.Accounts {
+		if err := t.syncAccount(acc); err != nil {
+			lastErr = err
+		}
+	}
+	t.lock.Lock()
+	minStamp := t.Exg.MilliSeconds() - t.DoneKeep.Milliseconds()
+	for key, stamp := range t.done {
+		if stamp < minStamp {
+			delete(t.done, key)
+		}
+	}
+	t.lock.Unlock()
+	return lastErr
+}
+
+func (t *OrderTracker) syncAccount(acc string) *errs.Error {
+	var symbols []string
+	if len(t.Symbols) == 0 {
+		symbols = []string{""}
+	} else {
+		symbols = append(symbols, t.Symbols...)
+		t.lock.Lock()
+		for symbol, items := range t.orders[acc] {
+			if len(items) > 0 && !utils.ArrContains(symbols, symbol) {
+				symbols = append(symbols, symbol)
+			}
+		}
+		t.lock.Unlock()
+	}
+	seen := make(map[string]bool)
+	for _, symbol := range symbols {
+		orders, err := t.Exg.FetchOpenOrders(symbol, 0, 0, map[string]interface{}{ParamAccount: acc})
+		if err != nil {
+			// unable to tell which orders are finished
+			return err
+		}
+		for _, od := range orders {
+			seen[od.ID] = true
+			t.Track(acc, od)
+		}
+	}
+	// tracked orders missing from open orders are finished
+	t.lock.Lock()
+	var missing []*Order
+	for _, items := range t.orders[acc] {
+		for id, od := range items {
+			if !seen[id] {
+				missing = append(missing, od)
+			}
+		}
+	}
+	t.lock.Unlock()
+	for _, od := range missing {
+		res, err := t.Exg.FetchOrder(od.Symbol, od.ID, map[string]interface{}{ParamAccount: acc})
+		if err != nil {
+			if err.Code != errs.CodeOrderNotFound && err.Code != errs.CodeDataNotFound {
+				log.Warn("order tracker fetch order fail", zap.String("acc", acc), zap.String("id", od.ID),
+					zap.String("err", err.Short()))
+				continue
+			}
+			canceled := *od
+			canceled.Status = OdStatusCanceled
+			res = &canceled
+		}
+		t.Track(acc, res)
+	}
+	return nil
+}
+
+// OpenOrders return open orders of account, all symbols if symbol is empty
+func (t *OrderTracker) OpenOrders(acc, symbol string) []*Order {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	var res []*Order
+	for sym, items := range t.orders[acc] {
+		if symbol != "" && sym != symbol {
+			continue
+		}
+		for _, od := range items {
+			res = append(res, od)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Timestamp < res[j].Timestamp
+	})
+	return res
+}
+
+// GetOrder return an open order by id, nil if not found
+func (t *OrderTracker) GetOrder(acc, symbol, id string) *Order {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	od, _ := t.find(acc, symbol, id)
+	return od
+}
+
+// find should be called with t.lock held
+func (t *OrderTracker) find(acc, symbol, id string) (*Order, bool) {
+	if _, ok := t.done[acc+"/"+id]; ok {
+		return nil, true
+	}
+	if items, ok := t.orders[acc][symbol]; ok {
+		return items[id], false
+	}
+	return nil, false
+}
+
+// apply save cur as the latest state and return events, should be called with t.lock held.
+// cur is never modified after saved, so it can be shared by events.
+func (t *OrderTracker) apply(acc string, old, cur *Order, trade *MyTrade) []*OrderEvent {
+	if old != nil {
+		if cur.Filled < old.Filled {
+			// stale update
+			return nil
+		}
+		if len(cur.Trades) == 0 {
+			cur.Trades = old.Trades
+		}
+		if cur.Amount == 0 {
+			cur.Amount = old.Amount
+		}
+		if cur.Price == 0 {
+			cur.Price = old.Price
+		}
+	}
+	symOrders, ok := t.orders[acc]
+	if !ok {
+		symOrders = make(map[string]map[string]*Order)
+		t.orders[acc] = symOrders
+	}
+	items, ok := symOrders[cur.Symbol]
+	if !ok {
+		items = make(map[string]*Order)
+		symOrders[cur.Symbol] = items
+	}
+	if IsOrderDone(cur.Status) {
+		delete(items, cur.ID)
+		t.done[acc+"/"+cur.ID] = t.Exg.MilliSeconds()
+	} else {
+		items[cur.ID] = cur
+	}
+	types := orderEventTypes(old, cur)
+	res := make([]*OrderEvent, 0, len(types))
+	for _, tp := range types {
+		res = append(res, &OrderEvent{Type: tp, Account: acc, Order: cur, Trade: trade})
+	}
+	return res
+}
+
+// emit queue events for loopEmit, should be called with t.lock held, which is released here
+func (t *OrderTracker) emit(events []*OrderEvent) {
+	if len(events) > 0 {
+		t.pending = append(t.pending, events...)
+	}
+	t.lock.Unlock()
+	if len(events) > 0 {
+		select {
+		case t.emitChan <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// loopEmit send queued events to Events in order, without holding locks 不持有锁按顺序发送队列中的事件
+func (t *OrderTracker) loopEmit() {
+	for {
+		select {
+		case <-t.stopChan:
+			return
+		case <-t.emitChan:
+		}
+		t.lock.Lock()
+		events := t.pending
+		t.pending = nil
+		t.lock.Unlock()
+		for _, evt := range events {
+			select {
+			case t.Events <- evt:
+			case <-t.stopChan:
+				return
+			}
+		}
+	}
+}
+
+func orderEventTypes(old, cur *Order) []string {
+	var res []string
+	oldStatus, oldFilled := "", float64(0)
+	if old == nil {
+		if cur.Status == OdStatusRejected {
+			return []string{OdEventReject}
+		}
+		res = append(res, OdEventNew)
+	} else {
+		oldStatus, oldFilled = old.Status, old.Filled
+	}
+	if cur.Status == OdStatusFilled && oldStatus != OdStatusFilled {
+		res = append(res, OdEventFill)
+	} else if cur.Filled > oldFilled {
+		res = append(res, OdEventPartFill)
+	}
+	switch cur.Status {
+	case OdStatusCanceled, OdStatusExpired:
+		if oldStatus != OdStatusCanceled && oldStatus != OdStatusExpired {
+			res = append(res, OdEventCancel)
+		}
+	case OdStatusRejected:
+		if oldStatus != OdStatusRejected {
+			res = append(res, OdEventReject)
+		}
+	}
+	return res
+}
+
+func orderFromMyTrade(old *Order, trade *MyTrade) *Order {
+	var od Order
+	if old != nil {
+		od = *old
+		od.Trades = append([]*Trade{}, old.Trades...)
+	} else {
+		od = Order{
+			ID:            trade.Order,
+			ClientOrderID: trade.ClientID,
+			Timestamp:     trade.Timestamp,
+			Symbol:        trade.Symbol,
+			Type:          trade.Type,
+			PositionSide:  trade.PosSide,
+			Side:          trade.Side,
+			ReduceOnly:    trade.ReduceOnly,
+		}
+	}
+	filled := trade.Filled
+	if filled == 0 && trade.Amount > 0 {
+		filled = od.Filled + trade.Amount
+	}
+	if filled > od.Filled {
+		od.Filled = filled
+	}
+	if trade.Average > 0 {
+		od.Average = trade.Average
+	}
+	if trade.Amount > 0 {
+		od.Trades = append(od.Trades, &trade.Trade)
+		od.LastTradeTimestamp = trade.Timestamp
+	}
+	if od.Average > 0 {
+		od.Cost = od.Average * od.Filled
+	}
+	if od.Amount > 0 {
+		od.Remaining = max(od.Amount-od.Filled, 0)
+	}
+	od.LastUpdateTimestamp = trade.Timestamp
+	od.Status = trade.State
+	if od.Status == "" {
+		if od.Filled > 0 {
+			od.Status = OdStatusPartFilled
+		} else {
+			od.Status = OdStatusOpen
+		}
+	}
+	return &od
+}
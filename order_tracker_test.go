@@ -0,0 +1,202 @@
+package banexg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/banbox/banexg/errs"
+)
+
+type trackerExg struct {
+	*Exchange
+	trades  chan *MyTrade
+	open    []*Order
+	fetched map[string]*Order
+}
+
+func (e *trackerExg) WatchMyTrades(params map[string]interface{}) (chan *MyTrade, *errs.Error) {
+	return e.trades, nil
+}
+
+func (e *trackerExg) FetchOpenOrders(symbol string, since int64, limit int, params map[string]interface{}) ([]*Order, *errs.Error) {
+	return e.open, nil
+}
+
+func (e *trackerExg) FetchOrder(symbol, orderId string, params map[string]interface{}) (*Order, *errs.Error) {
+	if od, ok := e.fetched[orderId]; ok {
+		return od, nil
+	}
+	return nil, errs.NewMsg(errs.CodeOrderNotFound, "not found")
+}
+
+func readOrderEvent(t *testing.T, tracker *OrderTracker, wantType, wantID string) *OrderEvent {
+	t.Helper()
+	select {
+	case evt := <-tracker.Events:
+		if evt.Type != wantType || evt.Order.ID != wantID {
+			t.Fatalf("expect %s %s, got %s %s", wantType, wantID, evt.Type, evt.Order.ID)
+		}
+		return evt
+	case <-time.After(time.Second):
+		t.Fatalf("wait %s %s timeout", wantType, wantID)
+	}
+	return nil
+}
+
+func TestOrderTracker(t *testing.T) {
+	exg := &trackerExg{
+		Exchange: &Exchange{ExgInfo: &ExgInfo{ID: "test"}, DefAccName: "acc"},
+		trades:   make(chan *MyTrade, 10),
+		open:     []*Order{{ID: "1", Symbol: "BTC/USDT", Side: OdSideBuy, Amount: 2, Price: 10, Status: OdStatusOpen}},
+		fetched:  map[string]*Order{},
+	}
+	tracker := NewOrderTracker(exg, []string{"BTC/USDT"})
+	tracker.SyncIntv = 0
+	if err := tracker.Start(); err != nil {
+		t.Fatalf("start fail: %v", err)
+	}
+	defer tracker.Stop()
+	readOrderEvent(t, tracker, OdEventNew, "1")
+
+	trade := func(id, state string, amount, filled float64) *MyTrade {
+		return &MyTrade{Trade: Trade{Symbol: "BTC/USDT", Side: OdSideBuy, Order: id, Amount: amount, Price: 10},
+			Filled: filled, Average: 10, State: state}
+	}
+	exg.trades <- trade("1", OdStatusPartFilled, 1, 1)
+	evt := readOrderEvent(t, tracker, OdEventPartFill, "1")
+	if evt.Trade == nil || evt.Order.Amount != 2 || evt.Order.Remaining != 1 || evt.Account != "acc" {
+		t.Fatalf("unexpected event: %+v %+v", evt, evt.Order)
+	}
+	exg.trades <- trade("2", OdStatusOpen, 0, 0)
+	readOrderEvent(t, tracker, OdEventNew, "2")
+	exg.trades <- trade("3", OdStatusRejected, 0, 0)
+	readOrderEvent(t, tracker, OdEventReject, "3")
+	exg.trades <- trade("1", OdStatusFilled, 1, 2)
+	readOrderEvent(t, tracker, OdEventFill, "1")
+	// late updates of finished orders are ignored
+	exg.trades <- trade("1", OdStatusPartFilled, 1, 1)
+	exg.trades <- trade("2", OdStatusOpen, 0, 0)
+
+	// order 2 is missing from open orders, query its final state
+	exg.open = nil
+	exg.fetched["2"] = &Order{ID: "2", Symbol: "BTC/USDT", Side: OdSideBuy, Amount: 1, Price: 10, Status: OdStatusCanceled}
+	time.Sleep(time.Millisecond * 50)
+	if err := tracker.Sync(); err != nil {
+		t.Fatalf("sync fail: %v", err)
+	}
+	readOrderEvent(t, tracker, OdEventCancel, "2")
+	if ods := tracker.OpenOrders("acc", ""); len(ods) != 0 {
+		t.Fatalf("expect no open orders, got %d", len(ods))
+	}
+	select {
+	case evt := <-tracker.Events:
+		t.Fatalf("unexpected event: %s %s", evt.Type, evt.Order.ID)
+	default:
+	}
+}
+
+func TestOrderTrackerSlowConsumer(t *testing.T) {
+	exg := &trackerExg{
+		Exchange: &Exchange{ExgInfo: &ExgInfo{ID: "test"}, DefAccName: "acc"},
+		trades:   make(chan *MyTrade, 10),
+		fetched:  map[string]*Order{},
+	}
+	tracker := NewOrderTracker(exg, []string{"BTC/USDT"})
+	tracker.SyncIntv = 0
+	tracker.Events = make(chan *OrderEvent, 1)
+	if err := tracker.Start(); err != nil {
+		t.Fatalf("start fail: %v", err)
+	}
+	defer tracker.Stop()
+	done := make(chan struct{})
+	go func() {
+		// Track shouldn't block when Events is full
+		for _, id := range []string{"1", "2", "3"} {
+			tracker.Track("acc", &Order{ID: id, Symbol: "BTC/USDT", Amount: 1, Status: OdStatusOpen})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Track blocked by full Events")
+	}
+	for _, id := range []string{"1", "2", "3"} {
+		readOrderEvent(t, tracker, OdEventNew, id)
+		// consumer calls back into tracker while events are pending
+		if ods := tracker.OpenOrders("acc", ""); len(ods) != 3 {
+			t.Fatalf("expect 3 open orders, got %d", len(ods))
+		}
+	}
+}
+
+// trackerWsExg create a real out chan for each WatchMyTrades, fail for account "bad"
+type trackerWsExg struct {
+	*trackerExg
+}
+
+func (e *trackerWsExg) WatchMyTrades(params map[string]interface{}) (chan *MyTrade, *errs.Error) {
+	acc := params[ParamAccount].(string)
+	if acc == "bad" {
+		return nil, errs.NewMsg(errs.CodeNetFail, "watch fail")
+	}
+	create := func(cap int) chan *MyTrade { return make(chan *MyTrade, cap) }
+	return GetWsOutChan(e.Exchange, acc+"@mytrades", create, params, "account"), nil
+}
+
+func TestOrderTrackerStop(t *testing.T) {
+	newExg := func() *trackerWsExg {
+		return &trackerWsExg{trackerExg: &trackerExg{
+			Exchange: &Exchange{ExgInfo: &ExgInfo{ID: "test"}, DefAccName: "acc",
+				WsOutChans: map[string][]*WsHandle{}, WsChanRefs: map[string]map[string]int{}},
+			fetched: map[string]*Order{},
+		}}
+	}
+	exg := newExg()
+	tracker := NewOrderTracker(exg, nil, "acc", "acc2")
+	tracker.SyncIntv = 0
+	if err := tracker.Start(); err != nil {
+		t.Fatalf("start fail: %v", err)
+	}
+	if len(exg.WsOutChans) != 2 || len(exg.afterWsReCons) != 1 {
+		t.Fatalf("expect 2 watches and 1 callback, got %d %d", len(exg.WsOutChans), len(exg.afterWsReCons))
+	}
+	tracker.Stop()
+	if len(exg.WsOutChans) != 0 || len(exg.WsChanRefs) != 0 || len(exg.afterWsReCons) != 0 {
+		t.Fatalf("watches or callback left after Stop: %v %v %d", exg.WsOutChans, exg.WsChanRefs, len(exg.afterWsReCons))
+	}
+	// watches started before a failed one are rolled back
+	exg = newExg()
+	tracker = NewOrderTracker(exg, nil, "acc", "bad")
+	if err := tracker.Start(); err == nil {
+		t.Fatalf("start should fail")
+	}
+	if len(exg.WsOutChans) != 0 || len(exg.afterWsReCons) != 0 {
+		t.Fatalf("watches or callback left after failed Start: %v %d", exg.WsOutChans, len(exg.afterWsReCons))
+	}
+}
+
+func TestOrderEventTypes(t *testing.T) {
+	cases := []struct {
+		old  *Order
+		cur  *Order
+		want []string
+	}{
+		{nil, &Order{Status: OdStatusFilled, Filled: 1}, []string{OdEventNew, OdEventFill}},
+		{&Order{Status: OdStatusOpen}, &Order{Status: OdStatusCanceled, Filled: 0.5},
+			[]string{OdEventPartFill, OdEventCancel}},
+		{&Order{Status: OdStatusPartFilled, Filled: 0.5}, &Order{Status: OdStatusPartFilled, Filled: 0.5}, nil},
+		{&Order{Status: OdStatusOpen}, &Order{Status: OdStatusExpired}, []string{OdEventCancel}},
+	}
+	for i, c := range cases {
+		got := orderEventTypes(c.old, c.cur)
+		if len(got) != len(c.want) {
+			t.Fatalf("case %d: got %v, want %v", i, got, c.want)
+		}
+		for j := range got {
+			if got[j] != c.want[j] {
+				t.Fatalf("case %d: got %v, want %v", i, got, c.want)
+			}
+		}
+	}
+}
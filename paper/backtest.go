@@ -0,0 +1,360 @@
+package paper
+
+import (
+	"encoding/csv"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/banbox/banexg"
+	"github.com/banbox/banexg/errs"
+	"github.com/banbox/banexg/utils"
+)
+
+/*
+Backtest
+backtest exchange based on Paper. The virtual clock is advanced by Step, driven by klines from AddKlines/LoadKlineCSV,
+or websocket messages replayed after SetReplay. Funding fees are not simulated.
+基于Paper的回测交易所。虚拟时钟由Step推进，数据来自AddKlines/LoadKlineCSV加载的K线，或SetReplay回放的websocket消息。不模拟资金费
+*/
+type Backtest struct {
+	*Paper
+	now      int64 // virtual time, accessed atomically
+	replay   bool
+	series   map[string]*klineSeries // symbol|timeframe
+	jobs     map[string]bool         // symbol|timeframe subscribed by WatchOHLCVs
+	ohlcvOut chan *banexg.PairTFKline
+}
+
+type klineSeries struct {
+	symbol    string
+	timeFrame string
+	tfMSecs   int64
+	bars      []*banexg.Kline
+	next      int // index of the next bar to be closed
+}
+
+/*
+NewBacktest
+create backtest exchange, exg provides markets and fee rates, and replays websocket messages if SetReplay is called.
+Options of paper (OptBalance/OptLatency/OptSlippage/OptFillRate...) are supported.
+创建回测交易所，exg提供市场和费率信息，调用SetReplay后回放websocket消息。支持paper的所有选项
+*/
+func NewBacktest(exg banexg.BanExchange, options map[string]interface{}) (*Backtest, *errs.Error) {
+	p, err := newPaper(exg, options)
+	if err != nil {
+		return nil, err
+	}
+	res := &Backtest{
+		Paper:  p,
+		series: make(map[string]*klineSeries),
+		jobs:   make(map[string]bool),
+	}
+	p.offline = true
+	p.syncPump = true
+	p.clock = func() int64 {
+		return atomic.LoadInt64(&res.now)
+	}
+	return res, nil
+}
+
+func seriesKey(symbol, timeFrame string) string {
+	return symbol + "|" + timeFrame
+}
+
+/*
+AddKlines
+add klines of symbol and timeframe as data source, klines with the same time are replaced
+添加品种周期的K线作为数据源，相同时间的K线被替换
+*/
+func (b *Backtest) AddKlines(symbol, timeFrame string, klines []*banexg.Kline) *errs.Error {
+	tfSecs, err_ := utils.TFToSecSafe(timeFrame)
+	if err_ != nil {
+		return errs.New(errs.CodeInvalidTimeFrame, err_)
+	}
+	market, err := b.GetMarket(symbol)
+	if err != nil {
+		return err
+	}
+	key := seriesKey(market.Symbol, timeFrame)
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	s, ok := b.series[key]
+	if !ok {
+		s = &klineSeries{symbol: market.Symbol, timeFrame: timeFrame, tfMSecs: int64(tfSecs) * 1000}
+		b.series[key] = s
+	}
+	bars := make(map[int64]*banexg.Kline, len(s.bars)+len(klines))
+	for _, k := range s.bars {
+		bars[k.Time] = k
+	}
+	for _, k := range klines {
+		bars[k.Time] = k
+	}
+	s.bars = make([]*banexg.Kline, 0, len(bars))
+	for _, k := range bars {
+		s.bars = append(s.bars, k)
+	}
+	sort.Slice(s.bars, func(i, j int) bool {
+		return s.bars[i].Time < s.bars[j].Time
+	})
+	now := atomic.LoadInt64(&b.now)
+	s.next = sort.Search(len(s.bars), func(i int) bool {
+		return s.bars[i].Time+s.tfMSecs > now
+	})
+	return nil
+}
+
+/*
+LoadKlineCSV
+load klines from csv file with columns: time(13 digits),open,high,low,close,volume. A header row is allowed.
+从csv文件加载K线，列为：13位时间戳,open,high,low,close,volume，允许有表头
+*/
+func (b *Backtest) LoadKlineCSV(symbol, timeFrame, path string) *errs.Error {
+	file, err_ := os.Open(path)
+	if err_ != nil {
+		return errs.New(errs.CodeIOReadFail, err_)
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	klines := make([]*banexg.Kline, 0)
+	for line := 1; ; line++ {
+		row, err_ := reader.Read()
+		if err_ == io.EOF {
+			break
+		} else if err_ != nil {
+			return errs.New(errs.CodeIOReadFail, err_)
+		}
+		if len(row) < 6 {
+			return errs.NewMsg(errs.CodeInvalidData, "%s line %d: require 6 columns, got %d", path, line, len(row))
+		}
+		stamp, err_ := strconv.ParseInt(row[0], 10, 64)
+		if err_ != nil {
+			if line == 1 {
+				continue
+			}
+			return errs.NewMsg(errs.CodeInvalidData, "%s line %d: invalid time %s", path, line, row[0])
+		}
+		var vals [5]float64
+		for i := range vals {
+			vals[i], err_ = strconv.ParseFloat(row[i+1], 64)
+			if err_ != nil {
+				return errs.NewMsg(errs.CodeInvalidData, "%s line %d: invalid number %s", path, line, row[i+1])
+			}
+		}
+		klines = append(klines, &banexg.Kline{Time: stamp, Open: vals[0], High: vals[1], Low: vals[2],
+			Close: vals[3], Volume: vals[4]})
+	}
+	return b.AddKlines(symbol, timeFrame, klines)
+}
+
+func (b *Backtest) SetReplay(path string, fromMS, toMS int64) *errs.Error {
+	if err := b.BanExchange.SetReplay(path, fromMS, toMS); err != nil {
+		return err
+	}
+	b.lock.Lock()
+	b.replay = path != ""
+	b.lock.Unlock()
+	return nil
+}
+
+/*
+NextTime return the time of next event, math.MaxInt64 if no data left
+返回下一个事件的时间，无数据时返回math.MaxInt64
+*/
+func (b *Backtest) NextTime() int64 {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.nextTime()
+}
+
+// nextTime lock required
+func (b *Backtest) nextTime() int64 {
+	res := int64(math.MaxInt64)
+	for _, s := range b.series {
+		if s.next < len(s.bars) {
+			res = min(res, s.bars[s.next].Time+s.tfMSecs)
+		}
+	}
+	if b.replay {
+		res = min(res, b.BanExchange.GetReplayTo())
+	}
+	return res
+}
+
+/*
+Step
+advance the virtual clock to the next event: replay websocket messages and close klines of that time,
+then match orders. Returns false when all data is consumed.
+Channels returned by Watch* are filled in Step, consume them before calling the next Step.
+推进虚拟时钟到下一事件：回放该时间的websocket消息，收盘该时间的K线，并撮合订单。数据耗尽时返回false。
+Watch*返回的chan在Step中写入，应在下次Step前消费
+*/
+func (b *Backtest) Step() (bool, *errs.Error) {
+	b.lock.Lock()
+	stamp := b.nextTime()
+	replay := b.replay
+	b.lock.Unlock()
+	if stamp == math.MaxInt64 {
+		return false, nil
+	}
+	atomic.StoreInt64(&b.now, stamp)
+	for replay && b.BanExchange.GetReplayTo() == stamp {
+		if err := b.BanExchange.ReplayOne(); err != nil {
+			return false, err
+		}
+		b.drainPumps()
+	}
+	b.lock.Lock()
+	closed := make([]*klineSeries, 0)
+	for _, s := range b.series {
+		if s.next < len(s.bars) && s.bars[s.next].Time+s.tfMSecs == stamp {
+			closed = append(closed, s)
+		}
+	}
+	b.lock.Unlock()
+	sort.Slice(closed, func(i, j int) bool {
+		return seriesKey(closed[i].symbol, closed[i].timeFrame) < seriesKey(closed[j].symbol, closed[j].timeFrame)
+	})
+	for _, s := range closed {
+		b.closeBar(s)
+	}
+	b.expireOrders()
+	b.lock.Lock()
+	b.activateOrders("")
+	b.lock.Unlock()
+	return true, nil
+}
+
+/*
+closeBar
+simulate trades of a kline: open, the nearer extreme, the other extreme, close. Volume is split equally,
+unlimited if volume is zero.
+模拟K线内的成交：开盘、较近的极值、另一极值、收盘。成交量平均分配，成交量为0时不限量
+*/
+func (b *Backtest) closeBar(s *klineSeries) {
+	b.lock.Lock()
+	bar := s.bars[s.next]
+	s.next += 1
+	out := b.ohlcvOut
+	subscribed := b.jobs[seriesKey(s.symbol, s.timeFrame)]
+	b.lock.Unlock()
+	prices := []float64{bar.Open, bar.Low, bar.High, bar.Close}
+	if bar.Close < bar.Open {
+		prices[1], prices[2] = bar.High, bar.Low
+	}
+	amount := bar.Volume / float64(len(prices))
+	if amount <= 0 {
+		amount = math.Inf(1)
+	}
+	stamp := bar.Time + s.tfMSecs
+	for _, price := range prices {
+		b.onTrade(&banexg.Trade{Symbol: s.symbol, Price: price, Amount: amount, Timestamp: stamp})
+	}
+	if subscribed {
+		b.lock.Lock()
+		if b.ohlcvOut == out {
+			sendOrPop(out, &banexg.PairTFKline{Kline: *bar, Symbol: s.symbol, TimeFrame: s.timeFrame})
+		}
+		b.lock.Unlock()
+	}
+}
+
+/*
+FetchOHLCV
+return closed klines before the virtual time, the wrapped exchange is used if no klines are loaded
+返回虚拟时间前已收盘的K线，未加载K线时使用被包装的交易所
+*/
+func (b *Backtest) FetchOHLCV(symbol, timeframe string, since int64, limit int, params map[string]interface{}) ([]*banexg.Kline, *errs.Error) {
+	b.lock.Lock()
+	s, ok := b.series[seriesKey(symbol, timeframe)]
+	if !ok {
+		b.lock.Unlock()
+		return b.BanExchange.FetchOHLCV(symbol, timeframe, since, limit, params)
+	}
+	bars := s.bars[:s.next]
+	b.lock.Unlock()
+	start := sort.Search(len(bars), func(i int) bool {
+		return bars[i].Time >= since
+	})
+	bars = bars[start:]
+	if limit > 0 && len(bars) > limit {
+		if since > 0 {
+			bars = bars[:limit]
+		} else {
+			bars = bars[len(bars)-limit:]
+		}
+	}
+	res := make([]*banexg.Kline, len(bars))
+	for i, k := range bars {
+		val := *k
+		res[i] = &val
+	}
+	return res, nil
+}
+
+// WatchOHLCVs receive klines when they are closed by Step
+func (b *Backtest) WatchOHLCVs(jobs [][2]string, params map[string]interface{}) (chan *banexg.PairTFKline, *errs.Error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, job := range jobs {
+		key := seriesKey(job[0], job[1])
+		if _, ok := b.series[key]; !ok {
+			return nil, errs.NewMsg(errs.CodeDataNotFound, "no klines loaded for %s %s", job[0], job[1])
+		}
+	}
+	for _, job := range jobs {
+		b.jobs[seriesKey(job[0], job[1])] = true
+	}
+	if b.ohlcvOut == nil {
+		b.ohlcvOut = make(chan *banexg.PairTFKline, getChanCap(params))
+	}
+	return b.ohlcvOut, nil
+}
+
+func (b *Backtest) UnWatchOHLCVs(jobs [][2]string, params map[string]interface{}) *errs.Error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, job := range jobs {
+		delete(b.jobs, seriesKey(job[0], job[1]))
+	}
+	if len(b.jobs) == 0 && b.ohlcvOut != nil {
+		close(b.ohlcvOut)
+		b.ohlcvOut = nil
+	}
+	return nil
+}
+
+func (b *Backtest) WatchOrderBooks(symbols []string, limit int, params map[string]interface{}) (chan *banexg.OrderBook, *errs.Error) {
+	if !b.isReplay() {
+		return nil, errs.NewMsg(errs.CodeNotSupport, "order books require SetReplay for backtest")
+	}
+	return b.Paper.WatchOrderBooks(symbols, limit, params)
+}
+
+func (b *Backtest) WatchTrades(symbols []string, params map[string]interface{}) (chan *banexg.Trade, *errs.Error) {
+	if !b.isReplay() {
+		return nil, errs.NewMsg(errs.CodeNotSupport, "trades require SetReplay for backtest")
+	}
+	return b.Paper.WatchTrades(symbols, params)
+}
+
+func (b *Backtest) isReplay() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.replay
+}
+
+func (b *Backtest) Close() *errs.Error {
+	b.lock.Lock()
+	if b.ohlcvOut != nil {
+		close(b.ohlcvOut)
+		b.ohlcvOut = nil
+	}
+	b.lock.Unlock()
+	return b.Paper.Close()
+}
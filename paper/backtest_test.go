@@ -0,0 +1,115 @@
+package paper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/banbox/banexg"
+)
+
+func TestBacktest(t *testing.T) {
+	bt, err := NewBacktest(newTestInner(), map[string]interface{}{
+		OptBalance:  map[string]float64{"USDT": 10000},
+		OptLatency:  1000,
+		OptSlippage: 0.001,
+	})
+	if err != nil {
+		t.Fatalf("new backtest fail: %v", err)
+	}
+	defer bt.Close()
+	symbol := "BTC/USDT"
+	base := int64(1700000040000)
+	path := filepath.Join(t.TempDir(), "btc_1m.csv")
+	content := "time,open,high,low,close,volume\n" +
+		"1700000040000,100,102,99,101,40\n" +
+		"1700000100000,101,105,100,104,40\n" +
+		"1700000160000,104,111,103,108,40\n"
+	if err_ := os.WriteFile(path, []byte(content), 0644); err_ != nil {
+		t.Fatal(err_)
+	}
+	if err = bt.LoadKlineCSV(symbol, "1m", path); err != nil {
+		t.Fatalf("load csv fail: %v", err)
+	}
+	out, err := bt.WatchOHLCVs([][2]string{{symbol, "1m"}}, nil)
+	if err != nil {
+		t.Fatalf("watch ohlcv fail: %v", err)
+	}
+
+	ok, err := bt.Step()
+	if !ok || err != nil || bt.MilliSeconds() != base+60000 {
+		t.Fatalf("first step fail: %v %v %v", ok, err, bt.MilliSeconds())
+	}
+	if k := <-out; k.Time != base || k.Symbol != symbol {
+		t.Fatalf("unexpected kline: %+v", k)
+	}
+	klines, _ := bt.FetchOHLCV(symbol, "1m", 0, 0, nil)
+	if len(klines) != 1 {
+		t.Fatalf("future klines should be invisible, got %d", len(klines))
+	}
+
+	// latency: market order reaches engine at the open of next bar
+	od, err := bt.CreateOrder(symbol, banexg.OdTypeMarket, banexg.OdSideBuy, 1, 0, nil)
+	if err != nil || od.Status != banexg.OdStatusOpen {
+		t.Fatalf("create order fail: %v %+v", err, od)
+	}
+	if ok, _ = bt.Step(); !ok {
+		t.Fatalf("second step fail")
+	}
+	<-out
+	cur, _ := bt.FetchOrder(symbol, od.ID, nil)
+	if cur.Status != banexg.OdStatusFilled || !near(cur.Average, 101*1.001) {
+		t.Fatalf("market order should fill at next open with slippage: %+v", cur)
+	}
+
+	// resting limit order filled by the high of bar as maker
+	od, err = bt.CreateOrder(symbol, banexg.OdTypeLimit, banexg.OdSideSell, 1, 110, nil)
+	if err != nil {
+		t.Fatalf("create limit fail: %v", err)
+	}
+	if ok, _ = bt.Step(); !ok {
+		t.Fatalf("third step fail")
+	}
+	cur, _ = bt.FetchOrder(symbol, od.ID, nil)
+	if cur.Status != banexg.OdStatusFilled || cur.Average != 110 || cur.LastTradeTimestamp != base+180000 {
+		t.Fatalf("limit order should fill at 110: %+v", cur)
+	}
+	if ok, _ = bt.Step(); ok {
+		t.Fatalf("should finish after all klines consumed")
+	}
+	bal, _ := bt.FetchBalance(nil)
+	want := 10000 - 101.101 - 0.101101 + 110 - 0.055
+	if !near(bal.Total["USDT"], want) || !near(bal.Total["BTC"], 0) {
+		t.Fatalf("unexpected balances %v, want USDT %v", bal.Total, want)
+	}
+}
+
+func TestBacktestFillRate(t *testing.T) {
+	bt, err := NewBacktest(newTestInner(), map[string]interface{}{
+		OptBalance:  map[string]float64{"USDT": 10000},
+		OptFillRate: 0.1,
+	})
+	if err != nil {
+		t.Fatalf("new backtest fail: %v", err)
+	}
+	defer bt.Close()
+	symbol := "BTC/USDT"
+	err = bt.AddKlines(symbol, "1m", []*banexg.Kline{
+		{Time: 60000, Open: 100, High: 100, Low: 100, Close: 100, Volume: 40},
+		{Time: 120000, Open: 100, High: 100, Low: 90, Close: 95, Volume: 40},
+	})
+	if err != nil {
+		t.Fatalf("add klines fail: %v", err)
+	}
+	bt.Step()
+	od, err := bt.CreateOrder(symbol, banexg.OdTypeLimit, banexg.OdSideBuy, 5, 98, nil)
+	if err != nil {
+		t.Fatalf("create order fail: %v", err)
+	}
+	bt.Step()
+	cur, _ := bt.FetchOrder(symbol, od.ID, nil)
+	// low and close cross the price, each fills 10% of 10 volume
+	if cur.Status != banexg.OdStatusPartFilled || !near(cur.Filled, 2) {
+		t.Fatalf("unexpected partial fill: %+v", cur)
+	}
+}
@@ -0,0 +1,540 @@
+package paper
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/banbox/banexg"
+	"github.com/banbox/banexg/errs"
+	"github.com/banbox/banexg/log"
+	"github.com/banbox/banexg/utils"
+	"go.uber.org/zap"
+)
+
+// order types which are executed as market orders after triggered
+var marketTrigTypes = map[string]bool{
+	banexg.OdTypeStopMarket:       true,
+	banexg.OdTypeStopLoss:         true,
+	banexg.OdTypeTakeProfitMarket: true,
+}
+
+var trigTypes = map[string]bool{
+	banexg.OdTypeStop:             true,
+	banexg.OdTypeStopMarket:       true,
+	banexg.OdTypeStopLoss:         true,
+	banexg.OdTypeStopLossLimit:    true,
+	banexg.OdTypeTakeProfit:       true,
+	banexg.OdTypeTakeProfitLimit:  true,
+	banexg.OdTypeTakeProfitMarket: true,
+}
+
+func sortOrders(items []*paperOrder) {
+	sort.Slice(items, func(i, j int) bool {
+		a, _ := strconv.ParseInt(items[i].ID, 10, 64)
+		b, _ := strconv.ParseInt(items[j].ID, 10, 64)
+		return a < b
+	})
+}
+
+func (p *Paper) CreateOrder(symbol, odType, side string, amount, price float64, params map[string]interface{}) (*banexg.Order, *errs.Error) {
+	return p.CreateOrderReq(banexg.NewOrderRequest(symbol, odType, side, amount, price, params))
+}
+
+/*
+CreateOrderReq
+create a simulated order. Market and crossed limit orders are filled as taker against the latest order book,
+trigger orders wait for trades crossing the trigger price. Attached stop loss/take profit and trailing orders
+are not supported.
+创建模拟订单。市价单和穿越盘口的限价单立即按最新订单簿吃单成交，条件单等待成交价触发。不支持附带止盈止损和跟踪止损
+*/
+func (p *Paper) CreateOrderReq(req *banexg.OrderRequest) (*banexg.Order, *errs.Error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if req.TrailingDelta > 0 || req.CallbackRate > 0 || req.Type == banexg.OdTypeTrailingStopMarket {
+		return nil, errs.NewMsg(errs.CodeNotSupport, "trailing stop is not supported by paper exchange")
+	}
+	market, err := p.GetMarket(req.Symbol)
+	if err != nil {
+		return nil, err
+	}
+	isTrig := trigTypes[req.Type]
+	trigger := req.TriggerPrice
+	if isTrig && trigger == 0 {
+		trigger = req.StopLossPrice
+		if trigger == 0 {
+			trigger = req.TakeProfitPrice
+		}
+	} else if req.StopLossPrice > 0 || req.TakeProfitPrice > 0 {
+		return nil, errs.NewMsg(errs.CodeNotSupport, "attached stopLoss/takeProfit is not supported by paper exchange")
+	}
+	if isTrig && trigger == 0 {
+		return nil, errs.NewMsg(errs.CodeParamRequired, "trigger price is required for %s order", req.Type)
+	}
+	amount := req.Amount
+	price := req.Price
+	if req.Type == banexg.OdTypeMarket || marketTrigTypes[req.Type] {
+		price = 0
+	} else if price > 0 {
+		if price, err = p.PrecPrice(market, price); err != nil {
+			return nil, err
+		}
+	}
+	if !p.offline {
+		p.ensureWatch(req.Symbol)
+		p.ensureBook(req.Symbol)
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if amount == 0 && req.Cost > 0 {
+		ref := price
+		if ref == 0 {
+			ref = p.refPrice(req.Symbol, req.Side == banexg.OdSideBuy)
+		}
+		if ref == 0 {
+			return nil, errs.NewMsg(errs.CodeMarketUnavailable, "no market data for %s", req.Symbol)
+		}
+		amount = req.Cost / ref
+	}
+	if amount, err = p.PrecAmount(market, amount); err != nil {
+		return nil, err
+	}
+	if amount <= 0 {
+		return nil, errs.NewMsg(errs.CodeParamInvalid, "amount is too small for %s", req.Symbol)
+	}
+	now := p.MilliSeconds()
+	p.orderNum += 1
+	clientID := req.ClientOrderID
+	if clientID == "" {
+		clientID = banexg.NewClientOrderID()
+	}
+	posSide := req.PositionSide
+	if posSide != banexg.PosSideLong && posSide != banexg.PosSideShort {
+		posSide = ""
+	}
+	tif := req.TimeInForce
+	if tif == "" && price > 0 {
+		tif = banexg.TimeInForceGTC
+	}
+	od := &banexg.Order{
+		Info:                map[string]interface{}{},
+		ID:                  strconv.FormatInt(p.orderNum, 10),
+		ClientOrderID:       clientID,
+		Datetime:            utils.ISO8601(now),
+		Timestamp:           now,
+		LastUpdateTimestamp: now,
+		Status:              banexg.OdStatusOpen,
+		Symbol:              market.Symbol,
+		Type:                req.Type,
+		TimeInForce:         tif,
+		PositionSide:        posSide,
+		Side:                req.Side,
+		Price:               price,
+		Amount:              amount,
+		Remaining:           amount,
+		TriggerPrice:        trigger,
+		PostOnly:            req.PostOnly,
+		ReduceOnly:          req.ReduceOnly || req.ClosePosition,
+	}
+	o := &paperOrder{
+		Order:    od,
+		market:   market,
+		leverage: p.getLeverage(market.Symbol),
+		expireAt: req.GoodTillDate,
+	}
+	if !market.Contract {
+		o.leverage = 1
+	}
+	p.orders[od.ID] = o
+	o.trigger = trigger
+	if p.Latency > 0 {
+		o.activeAt = now + p.Latency
+		return cloneOrder(od), nil
+	}
+	if err = p.activate(o); err != nil {
+		delete(p.orders, od.ID)
+		return nil, err
+	}
+	return cloneOrder(od), nil
+}
+
+/*
+EditOrder
+modify amount or price of an open order, the order is matched again after modified.
+修改挂单的数量或价格，修改后重新撮合
+*/
+func (p *Paper) EditOrder(symbol, orderId, side string, amount, price float64, params map[string]interface{}) (*banexg.Order, *errs.Error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	o, err := p.getOpenOrder(orderId, params)
+	if err != nil {
+		return nil, err
+	}
+	if side != "" && side != o.Side {
+		return nil, errs.NewMsg(errs.CodeParamInvalid, "can not change side of order %s", o.ID)
+	}
+	if amount > 0 {
+		if amount, err = p.PrecAmount(o.market, amount); err != nil {
+			return nil, err
+		}
+		if amount <= o.Filled {
+			return nil, errs.NewMsg(errs.CodeParamInvalid, "amount %v should be greater than filled %v", amount, o.Filled)
+		}
+	} else {
+		amount = o.Amount
+	}
+	if price > 0 {
+		if o.isMarket() {
+			return nil, errs.NewMsg(errs.CodeParamInvalid, "can not set price for market order %s", o.ID)
+		}
+		if price, err = p.PrecPrice(o.market, price); err != nil {
+			return nil, err
+		}
+	} else {
+		price = o.Price
+	}
+	oldAmount, oldPrice := o.Amount, o.Price
+	p.releaseFrozen(o, 1)
+	o.Amount, o.Price, o.Remaining = amount, price, amount-o.Filled
+	o.LastUpdateTimestamp = p.MilliSeconds()
+	if o.trigDir != 0 || o.activeAt > 0 {
+		return cloneOrder(o.Order), nil
+	}
+	if err = p.placeOrder(o); err != nil {
+		o.Amount, o.Price, o.Remaining = oldAmount, oldPrice, oldAmount-o.Filled
+		if err2 := p.freezeOrder(o, oldPrice); err2 != nil {
+			log.Warn("paper restore order fail", zap.String("id", o.ID), zap.String("err", err2.Short()))
+		}
+		return nil, err
+	}
+	return cloneOrder(o.Order), nil
+}
+
+func (p *Paper) CancelOrder(id string, symbol string, params map[string]interface{}) (*banexg.Order, *errs.Error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	o, err := p.getOpenOrder(id, params)
+	if err != nil {
+		return nil, err
+	}
+	p.finishOrder(o, banexg.OdStatusCanceled)
+	p.emitAccount()
+	return cloneOrder(o.Order), nil
+}
+
+// getOpenOrder find open order by id or clientOrderId of params. lock required
+func (p *Paper) getOpenOrder(id string, params map[string]interface{}) (*paperOrder, *errs.Error) {
+	clientID := utils.GetMapVal(params, banexg.ParamClientOrderId, "")
+	for _, o := range p.orders {
+		if id != "" && o.ID == id || id == "" && clientID != "" && o.ClientOrderID == clientID {
+			return o, nil
+		}
+	}
+	if od := p.findDone(id, clientID); od != nil {
+		return nil, errs.NewMsg(errs.CodeOrderNotCancelable, "order %s is %s", od.ID, od.Status)
+	}
+	return nil, errs.NewMsg(errs.CodeOrderNotFound, "order not found: %s %s", id, clientID)
+}
+
+func (p *Paper) findDone(id, clientID string) *banexg.Order {
+	if id != "" {
+		return p.done[id]
+	}
+	if clientID == "" {
+		return nil
+	}
+	for _, od := range p.done {
+		if od.ClientOrderID == clientID {
+			return od
+		}
+	}
+	return nil
+}
+
+func (p *Paper) FetchOrder(symbol, id string, params map[string]interface{}) (*banexg.Order, *errs.Error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	o, err := p.getOpenOrder(id, params)
+	if err == nil {
+		return cloneOrder(o.Order), nil
+	}
+	clientID := utils.GetMapVal(params, banexg.ParamClientOrderId, "")
+	if od := p.findDone(id, clientID); od != nil {
+		return cloneOrder(od), nil
+	}
+	return nil, errs.NewMsg(errs.CodeOrderNotFound, "order not found: %s %s", id, clientID)
+}
+
+/*
+FetchOrders
+return open and recent finished orders of symbol, sorted by time
+返回品种的挂单和最近完成的订单，按时间排序
+*/
+func (p *Paper) FetchOrders(symbol string, since int64, limit int, params map[string]interface{}) ([]*banexg.Order, *errs.Error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	items := make([]*paperOrder, 0, len(p.orders)+len(p.done))
+	for _, o := range p.orders {
+		items = append(items, o)
+	}
+	for _, od := range p.done {
+		items = append(items, &paperOrder{Order: od})
+	}
+	return filterOrders(items, symbol, since, limit), nil
+}
+
+func (p *Paper) FetchOpenOrders(symbol string, since int64, limit int, params map[string]interface{}) ([]*banexg.Order, *errs.Error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	items := make([]*paperOrder, 0, len(p.orders))
+	for _, o := range p.orders {
+		items = append(items, o)
+	}
+	return filterOrders(items, symbol, since, limit), nil
+}
+
+func filterOrders(items []*paperOrder, symbol string, since int64, limit int) []*banexg.Order {
+	sortOrders(items)
+	res := make([]*banexg.Order, 0, len(items))
+	for _, o := range items {
+		if symbol != "" && o.Symbol != symbol || o.Timestamp < since {
+			continue
+		}
+		res = append(res, cloneOrder(o.Order))
+	}
+	if limit > 0 && len(res) > limit {
+		res = res[len(res)-limit:]
+	}
+	return res
+}
+
+func (p *Paper) FetchBalance(params map[string]interface{}) (*banexg.Balances, *errs.Error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.copyBalances(), nil
+}
+
+func (p *Paper) FetchPositions(symbols []string, params map[string]interface{}) ([]*banexg.Position, *errs.Error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.copyPositions(symbols), nil
+}
+
+func (p *Paper) FetchAccountPositions(symbols []string, params map[string]interface{}) ([]*banexg.Position, *errs.Error) {
+	return p.FetchPositions(symbols, params)
+}
+
+func (p *Paper) FetchIncomeHistory(inType string, symbol string, since int64, limit int, params map[string]interface{}) ([]*banexg.Income, *errs.Error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	res := make([]*banexg.Income, 0)
+	for _, item := range p.incomes {
+		if inType != "" && item.IncomeType != inType || symbol != "" && item.Symbol != symbol || item.Time < since {
+			continue
+		}
+		val := *item
+		res = append(res, &val)
+	}
+	if limit > 0 && len(res) > limit {
+		res = res[len(res)-limit:]
+	}
+	return res, nil
+}
+
+func (p *Paper) SetLeverage(leverage float64, symbol string, params map[string]interface{}) (map[string]interface{}, *errs.Error) {
+	if leverage <= 0 {
+		return nil, errs.NewMsg(errs.CodeLeverageInvalid, "invalid leverage: %v", leverage)
+	}
+	market, err := p.GetMarket(symbol)
+	if err != nil {
+		return nil, err
+	}
+	p.lock.Lock()
+	p.leverages[market.Symbol] = leverage
+	sendOrPop(p.confOut, &banexg.AccountConfig{Symbol: market.Symbol, Leverage: int(leverage)})
+	p.lock.Unlock()
+	return map[string]interface{}{"symbol": market.Symbol, "leverage": leverage}, nil
+}
+
+// FetchAccountAccess return simulated access: trading allowed, withdraw not 模拟账户权限：允许交易，不允许提现
+func (p *Paper) FetchAccountAccess(params map[string]interface{}) (*banexg.AccountAccess, *errs.Error) {
+	return &banexg.AccountAccess{
+		TradeAllowed:  true,
+		TradeKnown:    true,
+		WithdrawKnown: true,
+		Info:          map[string]interface{}{"paper": true},
+	}, nil
+}
+
+/*
+Call is not supported, as it may send any private request to the live exchange with real credentials
+不支持Call，因其可能使用真实凭证向实盘交易所发送任意私有请求
+*/
+func (p *Paper) Call(method string, params map[string]interface{}) (*banexg.HttpRes, *errs.Error) {
+	return nil, errs.NewMsg(errs.CodeNotSupport, "Call is not supported by paper exchange: %s", method)
+}
+
+// GetAccount is not supported, accounts of the wrapped exchange hold real credentials 不支持，被包装交易所的账户含真实凭证
+func (p *Paper) GetAccount(id string) (*banexg.Account, *errs.Error) {
+	return nil, errs.NewMsg(errs.CodeNotSupport, "GetAccount is not supported by paper exchange")
+}
+
+/*
+GetLeverage return simulated leverage, and max leverage from the wrapped exchange
+*/
+func (p *Paper) GetLeverage(symbol string, notional float64, account string) (float64, float64) {
+	_, maxVal := p.BanExchange.GetLeverage(symbol, notional, account)
+	p.lock.Lock()
+	lev := p.getLeverage(symbol)
+	p.lock.Unlock()
+	return lev, maxVal
+}
+
+// copyBalances lock required
+func (p *Paper) copyBalances() *banexg.Balances {
+	upols := make(map[string]float64)
+	for _, pos := range p.positions {
+		if m, err := p.GetMarket(pos.Symbol); err == nil {
+			upols[m.Settle] += pos.UnrealizedPnl
+		}
+	}
+	res := &banexg.Balances{
+		TimeStamp: p.MilliSeconds(),
+		Assets:    make(map[string]*banexg.Asset, len(p.assets)),
+	}
+	for code, item := range p.assets {
+		res.Assets[code] = &banexg.Asset{
+			Code:  code,
+			Free:  item.Free,
+			Used:  item.Used,
+			Total: item.Free + item.Used,
+			UPol:  upols[code],
+		}
+	}
+	return res.Init()
+}
+
+// copyPositions lock required
+func (p *Paper) copyPositions(symbols []string) []*banexg.Position {
+	keys := make([]string, 0, len(p.positions))
+	for key, pos := range p.positions {
+		if len(symbols) > 0 && !utils.ArrContains(symbols, pos.Symbol) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	res := make([]*banexg.Position, 0, len(keys))
+	for _, key := range keys {
+		val := *p.positions[key]
+		res = append(res, &val)
+	}
+	return res
+}
+
+// emitAccount push balances and positions to watchers. lock required
+func (p *Paper) emitAccount() {
+	if p.balOut != nil {
+		sendOrPop(p.balOut, p.copyBalances())
+	}
+	if p.posOut != nil {
+		sendOrPop(p.posOut, p.copyPositions(nil))
+	}
+}
+
+func (p *Paper) loop() {
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-time.After(p.FundingIntv):
+			p.checkFunding()
+			p.expireOrders()
+			p.lock.Lock()
+			p.activateOrders("")
+			p.lock.Unlock()
+		}
+	}
+}
+
+/*
+checkFunding
+fetch funding rates for symbols with positions, settle with the previous rate when the funding time passed
+查询持仓品种的资金费率，资金费时间过后按上一费率结算
+*/
+func (p *Paper) checkFunding() {
+	p.lock.Lock()
+	symbols := make([]string, 0)
+	for _, pos := range p.positions {
+		if !utils.ArrContains(symbols, pos.Symbol) {
+			symbols = append(symbols, pos.Symbol)
+		}
+	}
+	p.lock.Unlock()
+	for _, symbol := range symbols {
+		cur, err := p.FetchFundingRate(symbol, nil)
+		if err != nil {
+			log.Warn("paper fetch funding rate fail", zap.String("symbol", symbol), zap.String("err", err.Short()))
+			continue
+		}
+		p.applyFunding(symbol, cur)
+	}
+}
+
+func (p *Paper) applyFunding(symbol string, cur *banexg.FundingRateCur) {
+	market, err := p.GetMarket(symbol)
+	if err != nil {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	old := p.fundings[symbol]
+	p.fundings[symbol] = cur
+	if old == nil || old.FundingTimestamp == 0 || cur.FundingTimestamp <= old.FundingTimestamp {
+		return
+	}
+	for _, pos := range p.positions {
+		if pos.Symbol != symbol {
+			continue
+		}
+		price := pos.MarkPrice
+		if price == 0 {
+			price = pos.EntryPrice
+		}
+		// positive rate: longs pay shorts
+		val := contractValue(market, pos.Contracts, price) * old.FundingRate * sideDir(pos.Side)
+		p.asset(market.Settle).Free -= val
+		p.addIncome(IncomeFundingFee, symbol, market.Settle, -val, old.FundingTimestamp)
+	}
+	p.emitAccount()
+}
+
+// expireOrders cancel GTD orders after expired
+func (p *Paper) expireOrders() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	now := p.MilliSeconds()
+	for _, o := range p.orders {
+		if o.expireAt > 0 && o.expireAt <= now {
+			p.finishOrder(o, banexg.OdStatusExpired)
+		}
+	}
+}
+
+func (p *Paper) Close() *errs.Error {
+	p.lock.Lock()
+	select {
+	case <-p.stop:
+		p.lock.Unlock()
+		return nil
+	default:
+		close(p.stop)
+	}
+	for _, out := range []interface{}{p.bookOut, p.tradeOut, p.myTrades, p.balOut, p.posOut, p.confOut} {
+		closeChan(out)
+	}
+	p.bookOut, p.tradeOut, p.myTrades, p.balOut, p.posOut, p.confOut = nil, nil, nil, nil, nil, nil
+	p.lock.Unlock()
+	return p.BanExchange.Close()
+}
@@ -0,0 +1,318 @@
+package paper
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/banbox/banexg"
+	"github.com/banbox/banexg/errs"
+)
+
+type fakeExg struct {
+	*banexg.Exchange
+	books   chan *banexg.OrderBook
+	trades  chan *banexg.Trade
+	book    *banexg.OrderBook
+	funding *banexg.FundingRateCur
+}
+
+func (e *fakeExg) WatchOrderBooks(symbols []string, limit int, params map[string]interface{}) (chan *banexg.OrderBook, *errs.Error) {
+	return e.books, nil
+}
+
+func (e *fakeExg) WatchTrades(symbols []string, params map[string]interface{}) (chan *banexg.Trade, *errs.Error) {
+	return e.trades, nil
+}
+
+func (e *fakeExg) UnWatchOrderBooks(symbols []string, params map[string]interface{}) *errs.Error {
+	return nil
+}
+
+func (e *fakeExg) UnWatchTrades(symbols []string, params map[string]interface{}) *errs.Error {
+	return nil
+}
+
+func (e *fakeExg) FetchOrderBook(symbol string, limit int, params map[string]interface{}) (*banexg.OrderBook, *errs.Error) {
+	return e.book, nil
+}
+
+func (e *fakeExg) FetchFundingRate(symbol string, params map[string]interface{}) (*banexg.FundingRateCur, *errs.Error) {
+	return e.funding, nil
+}
+
+func newTestMarket(symbol string, contract bool) *banexg.Market {
+	m := &banexg.Market{
+		ID:     symbol,
+		Symbol: symbol,
+		Base:   "BTC",
+		Quote:  "USDT",
+		Settle: "USDT",
+		Spot:   !contract,
+		Active: true,
+		Taker:  0.001,
+		Maker:  0.0005,
+		Precision: &banexg.Precision{
+			Amount:     0.001,
+			Price:      0.1,
+			ModeAmount: banexg.PrecModeTickSize,
+			ModePrice:  banexg.PrecModeTickSize,
+		},
+	}
+	if contract {
+		m.Type = banexg.MarketLinear
+		m.Contract = true
+		m.Linear = true
+		m.Swap = true
+		m.ContractSize = 1
+	} else {
+		m.Type = banexg.MarketSpot
+	}
+	return m
+}
+
+func newTestBook(symbol string, asks, bids [][2]float64) *banexg.OrderBook {
+	return &banexg.OrderBook{
+		Symbol: symbol,
+		Asks:   banexg.NewOdBookSide(false, 20, asks),
+		Bids:   banexg.NewOdBookSide(true, 20, bids),
+	}
+}
+
+func newTestPaper(t *testing.T, balance map[string]float64) (*Paper, *fakeExg) {
+	inner := newTestInner()
+	exg, err := New(inner, map[string]interface{}{OptBalance: balance})
+	if err != nil {
+		t.Fatalf("new paper fail: %v", err)
+	}
+	t.Cleanup(func() {
+		exg.lock.Lock()
+		close(exg.stop)
+		exg.lock.Unlock()
+	})
+	return exg, inner
+}
+
+func newTestInner() *fakeExg {
+	spot := newTestMarket("BTC/USDT", false)
+	swap := newTestMarket("BTC/USDT:USDT", true)
+	inner := &fakeExg{
+		Exchange: &banexg.Exchange{
+			ExgInfo: &banexg.ExgInfo{
+				ID:         "fake",
+				MarketType: banexg.MarketSpot,
+				Markets:    banexg.MarketMap{spot.Symbol: spot, swap.Symbol: swap},
+			},
+		},
+		books:  make(chan *banexg.OrderBook, 10),
+		trades: make(chan *banexg.Trade, 10),
+	}
+	inner.book = newTestBook(spot.Symbol, [][2]float64{{100, 1}, {101, 2}}, [][2]float64{{99, 1}, {98, 2}})
+	return inner
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-8
+}
+
+func TestPaperSpot(t *testing.T) {
+	exg, _ := newTestPaper(t, map[string]float64{"USDT": 10000})
+	symbol := "BTC/USDT"
+	od, err := exg.CreateOrder(symbol, banexg.OdTypeMarket, banexg.OdSideBuy, 2, 0, nil)
+	if err != nil {
+		t.Fatalf("market buy fail: %v", err)
+	}
+	if od.Status != banexg.OdStatusFilled || !near(od.Average, 100.5) || od.Fee == nil || !near(od.Fee.Cost, 0.201) {
+		t.Fatalf("unexpected market order: %+v fee %+v", od, od.Fee)
+	}
+	bal, _ := exg.FetchBalance(nil)
+	if !near(bal.Free["USDT"], 10000-201-0.201) || !near(bal.Free["BTC"], 2) {
+		t.Fatalf("unexpected balances: %v", bal.Free)
+	}
+
+	// resting sell freezes base, filled as maker when a trade crosses the price
+	od, err = exg.CreateOrder(symbol, banexg.OdTypeLimit, banexg.OdSideSell, 1.5, 105, nil)
+	if err != nil || od.Status != banexg.OdStatusOpen {
+		t.Fatalf("limit sell fail: %v %+v", err, od)
+	}
+	bal, _ = exg.FetchBalance(nil)
+	if !near(bal.Used["BTC"], 1.5) || !near(bal.Free["BTC"], 0.5) {
+		t.Fatalf("base should be frozen: %v %v", bal.Free, bal.Used)
+	}
+	trades, _ := exg.WatchMyTrades(nil)
+	exg.onTrade(&banexg.Trade{Symbol: symbol, Price: 105, Amount: 1})
+	if cur, _ := exg.FetchOrder(symbol, od.ID, nil); cur.Filled != 0 {
+		t.Fatalf("trade on the same price should not fill: %+v", cur)
+	}
+	exg.onTrade(&banexg.Trade{Symbol: symbol, Price: 106, Amount: 1})
+	cur, _ := exg.FetchOrder(symbol, od.ID, nil)
+	if cur.Status != banexg.OdStatusPartFilled || cur.Filled != 1 || cur.Average != 105 {
+		t.Fatalf("unexpected partial fill: %+v", cur)
+	}
+	select {
+	case trade := <-trades:
+		if !trade.Maker || trade.Order != od.ID || trade.Amount != 1 {
+			t.Fatalf("unexpected my trade: %+v", trade)
+		}
+	default:
+		t.Fatalf("my trade should be pushed")
+	}
+
+	// cancel releases the rest frozen
+	if _, err = exg.CancelOrder(od.ID, symbol, nil); err != nil {
+		t.Fatalf("cancel fail: %v", err)
+	}
+	bal, _ = exg.FetchBalance(nil)
+	if !near(bal.Used["BTC"], 0) || !near(bal.Free["BTC"], 1) {
+		t.Fatalf("frozen should be released: %v %v", bal.Free, bal.Used)
+	}
+	if _, err = exg.CancelOrder(od.ID, symbol, nil); err == nil || err.Code != errs.CodeOrderNotCancelable {
+		t.Fatalf("cancel finished order should fail, got %v", err)
+	}
+
+	// post only crossing the book is rejected
+	_, err = exg.CreateOrder(symbol, banexg.OdTypeLimit, banexg.OdSideBuy, 1, 100, map[string]interface{}{
+		banexg.ParamPostOnly: true,
+	})
+	if err == nil || err.Code != errs.CodeOrderRejected {
+		t.Fatalf("post only should be rejected, got %v", err)
+	}
+	_, err = exg.CreateOrder(symbol, banexg.OdTypeLimit, banexg.OdSideBuy, 1000, 90, nil)
+	if err == nil || err.Code != errs.CodeInsufficientFunds {
+		t.Fatalf("expect insufficient funds, got %v", err)
+	}
+}
+
+func TestPaperContract(t *testing.T) {
+	exg, inner := newTestPaper(t, map[string]float64{"USDT": 1000})
+	symbol := "BTC/USDT:USDT"
+	exg.onBook(newTestBook(symbol, [][2]float64{{100, 5}}, [][2]float64{{99, 5}}))
+	if _, err := exg.SetLeverage(10, symbol, nil); err != nil {
+		t.Fatalf("set leverage fail: %v", err)
+	}
+	if _, err := exg.CreateOrder(symbol, banexg.OdTypeMarket, banexg.OdSideBuy, 1, 0, nil); err != nil {
+		t.Fatalf("open long fail: %v", err)
+	}
+	pos, _ := exg.FetchPositions(nil, nil)
+	if len(pos) != 1 || pos[0].Side != banexg.PosSideLong || pos[0].Contracts != 1 || !near(pos[0].InitialMargin, 10) {
+		t.Fatalf("unexpected positions: %+v", pos)
+	}
+	bal, _ := exg.FetchBalance(nil)
+	if !near(bal.Used["USDT"], 10) || !near(bal.Free["USDT"], 1000-10-0.1) {
+		t.Fatalf("unexpected margin: %v %v", bal.Free, bal.Used)
+	}
+	exg.onTrade(&banexg.Trade{Symbol: symbol, Price: 110, Amount: 1})
+	pos, _ = exg.FetchPositions(nil, nil)
+	if !near(pos[0].UnrealizedPnl, 10) {
+		t.Fatalf("unexpected upnl: %v", pos[0].UnrealizedPnl)
+	}
+
+	// funding is settled with the previous rate after funding time passed
+	exg.applyFunding(symbol, &banexg.FundingRateCur{Symbol: symbol, FundingRate: 0.001, FundingTimestamp: 1000})
+	inner.funding = &banexg.FundingRateCur{Symbol: symbol, FundingRate: 0.002, FundingTimestamp: 2000}
+	exg.checkFunding()
+	incomes, _ := exg.FetchIncomeHistory(IncomeFundingFee, symbol, 0, 0, nil)
+	if len(incomes) != 1 || !near(incomes[0].Income, -0.11) {
+		t.Fatalf("unexpected funding: %+v", incomes)
+	}
+
+	// stop loss triggered by trades, then filled as market order
+	od, err := exg.CreateOrder(symbol, banexg.OdTypeStopMarket, banexg.OdSideSell, 1, 0, map[string]interface{}{
+		banexg.ParamTriggerPrice: 95.0,
+		banexg.ParamReduceOnly:   true,
+	})
+	if err != nil || od.Status != banexg.OdStatusOpen {
+		t.Fatalf("create stop fail: %v %+v", err, od)
+	}
+	exg.onTrade(&banexg.Trade{Symbol: symbol, Price: 96, Amount: 1})
+	if cur, _ := exg.FetchOrder(symbol, od.ID, nil); cur.Status != banexg.OdStatusOpen {
+		t.Fatalf("stop should not trigger: %+v", cur)
+	}
+	exg.onTrade(&banexg.Trade{Symbol: symbol, Price: 94, Amount: 1})
+	cur, _ := exg.FetchOrder(symbol, od.ID, nil)
+	if cur.Status != banexg.OdStatusFilled || cur.Average != 99 {
+		t.Fatalf("stop should fill at bid: %+v", cur)
+	}
+	pos, _ = exg.FetchPositions(nil, nil)
+	if len(pos) != 0 {
+		t.Fatalf("position should be closed: %+v", pos)
+	}
+	bal, _ = exg.FetchBalance(nil)
+	want := 1000 - 0.1 - 0.11 - 1 - 0.099
+	if !near(bal.Total["USDT"], want) || !near(bal.Used["USDT"], 0) {
+		t.Fatalf("unexpected balance %v, want %v", bal.Total["USDT"], want)
+	}
+	_, err = exg.CreateOrder(symbol, banexg.OdTypeMarket, banexg.OdSideSell, 1, 0, map[string]interface{}{
+		banexg.ParamReduceOnly: true,
+	})
+	if err == nil || err.Code != errs.CodeReduceOnlyRejected {
+		t.Fatalf("reduce only without position should fail, got %v", err)
+	}
+}
+
+func TestPaperWatch(t *testing.T) {
+	exg, inner := newTestPaper(t, map[string]float64{"USDT": 1000})
+	symbol := "BTC/USDT"
+	books, err := exg.WatchOrderBooks([]string{symbol}, 20, nil)
+	if err != nil {
+		t.Fatalf("watch books fail: %v", err)
+	}
+	od, err := exg.CreateOrder(symbol, banexg.OdTypeLimit, banexg.OdSideBuy, 1, 98, nil)
+	if err != nil || od.Status != banexg.OdStatusOpen {
+		t.Fatalf("create order fail: %v %+v", err, od)
+	}
+	inner.books <- newTestBook(symbol, [][2]float64{{97, 2}}, [][2]float64{{96, 1}})
+	select {
+	case book := <-books:
+		if book.Symbol != symbol {
+			t.Fatalf("unexpected book: %v", book.Symbol)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("book should be forwarded")
+	}
+	cur, _ := exg.FetchOrder(symbol, od.ID, nil)
+	if cur.Status != banexg.OdStatusFilled || cur.Average != 98 {
+		t.Fatalf("order should be filled by crossed book: %+v", cur)
+	}
+	if _, err = exg.CreateOrder(symbol, banexg.OdTypeLimit, banexg.OdSideBuy, 1, 90, nil); err != nil {
+		t.Fatalf("create order fail: %v", err)
+	}
+	if err = exg.UnWatchOrderBooks([]string{symbol}, nil); err != nil {
+		t.Fatalf("unwatch fail: %v", err)
+	}
+	exg.lock.Lock()
+	watched := exg.watched[symbol]
+	exg.lock.Unlock()
+	if !watched {
+		t.Fatalf("symbol with open orders should keep watched")
+	}
+}
+
+func TestPaperPrivateCalls(t *testing.T) {
+	exg, _ := newTestPaper(t, map[string]float64{"USDT": 1000})
+	if _, err := exg.Call("privatePostOrder", nil); err == nil || err.Code != errs.CodeNotSupport {
+		t.Fatalf("Call should not be sent to live exchange, got %v", err)
+	}
+	if _, err := exg.GetAccount(""); err == nil || err.Code != errs.CodeNotSupport {
+		t.Fatalf("GetAccount should not expose live account, got %v", err)
+	}
+	access, err := exg.FetchAccountAccess(nil)
+	if err != nil || !access.TradeAllowed || access.WithdrawAllowed {
+		t.Fatalf("unexpected simulated access: %+v %v", access, err)
+	}
+	confs, err := exg.WatchAccountConfig(nil)
+	if err != nil {
+		t.Fatalf("watch account config fail: %v", err)
+	}
+	if _, err = exg.SetLeverage(5, "BTC/USDT:USDT", nil); err != nil {
+		t.Fatalf("set leverage fail: %v", err)
+	}
+	select {
+	case c := <-confs:
+		if c.Symbol != "BTC/USDT:USDT" || c.Leverage != 5 {
+			t.Fatalf("unexpected account config: %+v", c)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("leverage change should be sent")
+	}
+}
@@ -0,0 +1,21 @@
+package paper
+
+const (
+	OptExchange = "PaperExchange" // name of wrapped exchange for market data, used by bex.New 提供行情的交易所名称
+	OptBalance  = "PaperBalance"  // map[string]float64, initial balances of simulated account 模拟账户初始资金
+	OptLeverage = "PaperLeverage" // default leverage for contracts, 1 by default 合约默认杠杆
+	OptLatency  = "PaperLatency"  // milliseconds before new orders reach matching engine 订单延迟毫秒
+	OptSlippage = "PaperSlippage" // price rate applied against taker fills, e.g. 0.0005 吃单滑点比率
+	OptFillRate = "PaperFillRate" // (0, 1], max rate of trade or book volume filled by one order, 1 by default 单次最多成交量比例
+)
+
+const (
+	IncomeFundingFee  = "FUNDING_FEE"
+	IncomeRealizedPnl = "REALIZED_PNL"
+	IncomeCommission  = "COMMISSION"
+)
+
+const (
+	defBookDepth = 20
+	keepDoneNum  = 1000 // max finished orders kept for FetchOrder/FetchOrders
+)
@@ -0,0 +1,93 @@
+package paper
+
+import (
+	"time"
+
+	"github.com/banbox/banexg"
+	"github.com/banbox/banexg/errs"
+	"github.com/banbox/banexg/utils"
+)
+
+/*
+New
+create a paper trading exchange wrapping exg for market data. Initial balances are set by OptBalance.
+创建模拟交易所，exg提供行情数据，初始资金通过OptBalance设置
+*/
+func New(exg banexg.BanExchange, options map[string]interface{}) (*Paper, *errs.Error) {
+	res, err := newPaper(exg, options)
+	if err != nil {
+		return nil, err
+	}
+	go res.loop()
+	return res, nil
+}
+
+func newPaper(exg banexg.BanExchange, options map[string]interface{}) (*Paper, *errs.Error) {
+	if exg == nil {
+		return nil, errs.NewMsg(errs.CodeParamRequired, "exchange for market data is required")
+	}
+	args := utils.SafeParams(options)
+	res := &Paper{
+		BanExchange: exg,
+		Leverage:    1,
+		BookDepth:   defBookDepth,
+		FundingIntv: time.Minute,
+		FillRate:    1,
+		assets:      make(map[string]*banexg.Asset),
+		positions:   make(map[string]*banexg.Position),
+		leverages:   make(map[string]float64),
+		orders:      make(map[string]*paperOrder),
+		done:        make(map[string]*banexg.Order),
+		fundings:    make(map[string]*banexg.FundingRateCur),
+		books:       make(map[string]*banexg.OrderBook),
+		prices:      make(map[string]float64),
+		watched:     make(map[string]bool),
+		userBooks:   make(map[string]bool),
+		userTrade:   make(map[string]bool),
+		pumps:       make(map[interface{}]string),
+		stop:        make(chan struct{}),
+	}
+	var err *errs.Error
+	parseNum := func(key string, val *float64, minVal, maxVal float64) {
+		raw, ok := args[key]
+		if !ok || err != nil {
+			return
+		}
+		num, err_ := utils.ParseNum(raw)
+		if err_ != nil || num < minVal || maxVal > 0 && num > maxVal {
+			err = errs.NewMsg(errs.CodeParamInvalid, "invalid %s: %v", key, raw)
+			return
+		}
+		*val = num
+	}
+	var latency float64
+	parseNum(OptLeverage, &res.Leverage, 1e-9, 0)
+	parseNum(OptLatency, &latency, 0, 0)
+	parseNum(OptSlippage, &res.Slippage, 0, 1)
+	parseNum(OptFillRate, &res.FillRate, 1e-9, 1)
+	if err != nil {
+		return nil, err
+	}
+	res.Latency = int64(latency)
+	if val, ok := args[OptBalance]; ok {
+		items, ok := val.(map[string]float64)
+		if !ok {
+			raw, ok2 := val.(map[string]interface{})
+			if !ok2 {
+				return nil, errs.NewMsg(errs.CodeParamInvalid, "%s should be map[string]float64, got %T", OptBalance, val)
+			}
+			items = make(map[string]float64, len(raw))
+			for code, v := range raw {
+				num, err_ := utils.ParseNum(v)
+				if err_ != nil {
+					return nil, errs.NewMsg(errs.CodeParamInvalid, "invalid balance for %s: %v", code, v)
+				}
+				items[code] = num
+			}
+		}
+		for code, amt := range items {
+			res.assets[code] = &banexg.Asset{Code: code, Free: amt, Total: amt}
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,644 @@
+package paper
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/banbox/banexg"
+	"github.com/banbox/banexg/errs"
+	"github.com/banbox/banexg/log"
+	"github.com/banbox/banexg/utils"
+	"go.uber.org/zap"
+)
+
+func posKey(symbol, side string) string {
+	return symbol + "|" + side
+}
+
+// contract value in settle currency
+func contractValue(m *banexg.Market, qty, price float64) float64 {
+	size := m.ContractSize
+	if size == 0 {
+		size = 1
+	}
+	if m.Inverse {
+		if price == 0 {
+			return 0
+		}
+		return qty * size / price
+	}
+	return qty * size * price
+}
+
+// profit in settle currency of a long position from entry to exit
+func contractPnl(m *banexg.Market, entry, exit, qty float64) float64 {
+	size := m.ContractSize
+	if size == 0 {
+		size = 1
+	}
+	if m.Inverse {
+		if entry == 0 || exit == 0 {
+			return 0
+		}
+		return qty * size * (1/entry - 1/exit)
+	}
+	return qty * size * (exit - entry)
+}
+
+func sideDir(posSide string) float64 {
+	if posSide == banexg.PosSideShort {
+		return -1
+	}
+	return 1
+}
+
+func bookLevels(side *banexg.OdBookSide) ([]float64, []float64) {
+	if side == nil {
+		return nil, nil
+	}
+	return side.Levels(0)
+}
+
+func (o *paperOrder) isBuy() bool {
+	return o.Side == banexg.OdSideBuy
+}
+
+func (o *paperOrder) isMarket() bool {
+	return o.Type == banexg.OdTypeMarket || o.Price == 0
+}
+
+// whether price is acceptable for this order
+func (o *paperOrder) canFill(price float64) bool {
+	if o.isMarket() {
+		return true
+	}
+	if o.isBuy() {
+		return price <= o.Price
+	}
+	return price >= o.Price
+}
+
+func cloneOrder(od *banexg.Order) *banexg.Order {
+	res := *od
+	if od.Fee != nil {
+		fee := *od.Fee
+		res.Fee = &fee
+	}
+	return &res
+}
+
+func (p *Paper) asset(code string) *banexg.Asset {
+	item, ok := p.assets[code]
+	if !ok {
+		item = &banexg.Asset{Code: code}
+		p.assets[code] = item
+	}
+	return item
+}
+
+// refPrice latest trade price, or the best price of order book. lock required
+func (p *Paper) refPrice(symbol string, isBuy bool) float64 {
+	if price, ok := p.prices[symbol]; ok && price > 0 {
+		return price
+	}
+	book, ok := p.books[symbol]
+	if !ok {
+		return 0
+	}
+	side := book.Bids
+	if isBuy {
+		side = book.Asks
+	}
+	if side == nil {
+		return 0
+	}
+	price, _ := side.Level(0)
+	return price
+}
+
+func (p *Paper) getLeverage(symbol string) float64 {
+	if lev, ok := p.leverages[symbol]; ok {
+		return lev
+	}
+	return p.Leverage
+}
+
+/*
+closeSide return the position side to be reduced and the side to be opened by this order.
+for one-way mode, the opposite position is reduced first and the rest opens a new position.
+*/
+func (o *paperOrder) closeOpenSides() (string, string) {
+	long, short := banexg.PosSideLong, banexg.PosSideShort
+	switch o.PositionSide {
+	case long:
+		if o.isBuy() {
+			return "", long
+		}
+		return long, ""
+	case short:
+		if o.isBuy() {
+			return short, ""
+		}
+		return "", short
+	}
+	if o.isBuy() {
+		if o.ReduceOnly {
+			return short, ""
+		}
+		return short, long
+	}
+	if o.ReduceOnly {
+		return long, ""
+	}
+	return long, short
+}
+
+// calcFreeze return the currency and amount to be frozen for the remaining of order. lock required
+func (p *Paper) calcFreeze(o *paperOrder, price float64) (string, float64) {
+	m := o.market
+	if !m.Contract {
+		if o.isBuy() {
+			return m.Quote, o.Remaining * price
+		}
+		return m.Base, o.Remaining
+	}
+	closeSide, openSide := o.closeOpenSides()
+	if openSide == "" {
+		return m.Settle, 0
+	}
+	qty := o.Remaining
+	if closeSide != "" && o.PositionSide == "" {
+		// one-way mode: the part closing existing position needs no margin
+		if pos, ok := p.positions[posKey(o.Symbol, closeSide)]; ok {
+			qty = math.Max(0, qty-pos.Contracts)
+		}
+	}
+	return m.Settle, contractValue(m, qty, price) / o.leverage
+}
+
+// freezeOrder check and freeze funds for a new order. lock required
+func (p *Paper) freezeOrder(o *paperOrder, price float64) *errs.Error {
+	code, need := p.calcFreeze(o, price)
+	o.freeze = code
+	if need <= 0 {
+		return nil
+	}
+	item := p.asset(code)
+	if item.Free < need {
+		errCode := errs.CodeInsufficientFunds
+		if o.market.Contract {
+			errCode = errs.CodeInsufficientMargin
+		}
+		return errs.NewMsg(errCode, "%s free %v, require %v", code, item.Free, need)
+	}
+	item.Free -= need
+	item.Used += need
+	o.frozen = need
+	return nil
+}
+
+// release frozen funds by rate of remaining. lock required
+func (p *Paper) releaseFrozen(o *paperOrder, rate float64) {
+	if o.frozen <= 0 {
+		return
+	}
+	val := o.frozen * math.Min(rate, 1)
+	item := p.asset(o.freeze)
+	item.Used -= val
+	item.Free += val
+	o.frozen -= val
+}
+
+// checkReduceOnly cap amount of reduce only orders to position size. lock required
+func (p *Paper) checkReduceOnly(o *paperOrder) *errs.Error {
+	if !o.ReduceOnly || !o.market.Contract {
+		return nil
+	}
+	closeSide, _ := o.closeOpenSides()
+	pos, ok := p.positions[posKey(o.Symbol, closeSide)]
+	if !ok || pos.Contracts <= 0 {
+		return errs.NewMsg(errs.CodeReduceOnlyRejected, "no %s position to reduce for %s", closeSide, o.Symbol)
+	}
+	if o.Remaining > pos.Contracts {
+		o.Amount = o.Filled + pos.Contracts
+		o.Remaining = pos.Contracts
+	}
+	return nil
+}
+
+/*
+placeOrder
+freeze funds and match the new order against order book as taker. lock required
+冻结资金，并作为吃单方与订单簿撮合
+*/
+func (p *Paper) placeOrder(o *paperOrder) *errs.Error {
+	if err := p.checkReduceOnly(o); err != nil {
+		return err
+	}
+	price := o.Price
+	if o.isMarket() {
+		price = p.refPrice(o.Symbol, o.isBuy())
+		if price == 0 {
+			return errs.NewMsg(errs.CodeMarketUnavailable, "no market data for %s", o.Symbol)
+		}
+	}
+	if err := p.freezeOrder(o, price); err != nil {
+		return err
+	}
+	prices, sizes := p.takerLevels(o)
+	tif := o.TimeInForce
+	if o.PostOnly || tif == banexg.TimeInForceGTX || tif == banexg.TimeInForcePO {
+		if len(prices) > 0 {
+			p.releaseFrozen(o, 1)
+			return errs.NewMsg(errs.CodeOrderRejected, "post only order would be taker: %s %v", o.Side, o.Price)
+		}
+		return nil
+	}
+	if tif == banexg.TimeInForceFOK {
+		total := float64(0)
+		for _, size := range sizes {
+			total += size * p.FillRate
+		}
+		if total < o.Remaining && !utils.EqualNearly(total, o.Remaining) {
+			p.finishOrder(o, banexg.OdStatusExpired)
+			return nil
+		}
+	}
+	p.fillLevels(o, prices, sizes, false)
+	if o.Remaining > 0 && o.isMarket() {
+		// book exhausted, fill the rest with the worst price seen
+		last := price
+		if len(prices) > 0 {
+			last = prices[len(prices)-1]
+		}
+		p.fill(o, o.Remaining, last, false)
+	}
+	if o.Remaining > 0 && (tif == banexg.TimeInForceIOC || tif == banexg.TimeInForceFOK) {
+		p.finishOrder(o, banexg.OdStatusExpired)
+	}
+	return nil
+}
+
+// takerLevels return levels of opposite book acceptable by order. lock required
+func (p *Paper) takerLevels(o *paperOrder) ([]float64, []float64) {
+	book, ok := p.books[o.Symbol]
+	if !ok {
+		return nil, nil
+	}
+	side := book.Bids
+	if o.isBuy() {
+		side = book.Asks
+	}
+	prices, sizes := bookLevels(side)
+	end := 0
+	for end < len(prices) && o.canFill(prices[end]) {
+		end += 1
+	}
+	return prices[:end], sizes[:end]
+}
+
+// fillLevels fill order by price levels, stop when order finished. lock required
+func (p *Paper) fillLevels(o *paperOrder, prices, sizes []float64, maker bool) {
+	for i, price := range prices {
+		if o.Remaining <= 0 || o.Status != banexg.OdStatusOpen && o.Status != banexg.OdStatusPartFilled {
+			return
+		}
+		qty := math.Min(o.Remaining, sizes[i]*p.FillRate)
+		if maker {
+			price = o.Price
+		}
+		p.fill(o, qty, price, maker)
+	}
+}
+
+/*
+fill
+apply a fill to order, balances and positions, and emit MyTrade. lock required
+更新订单、余额、持仓，并推送MyTrade
+*/
+func (p *Paper) fill(o *paperOrder, qty, price float64, maker bool) {
+	if qty <= 0 {
+		return
+	}
+	if o.Remaining-qty < 0 || utils.EqualNearly(o.Remaining, qty) {
+		qty = o.Remaining
+	}
+	m := o.market
+	now := p.MilliSeconds()
+	if !maker {
+		price = p.slipPrice(o, price)
+	}
+	p.releaseFrozen(o, qty/o.Remaining)
+	fee, err := p.CalculateFee(o.Symbol, o.Type, o.Side, qty, price, maker, nil)
+	if err != nil {
+		log.Warn("paper calculate fee fail", zap.String("symbol", o.Symbol), zap.String("err", err.Short()))
+		fee = nil
+	}
+	cost := qty * price
+	var pnl float64
+	if m.Contract {
+		pnl = p.applyContract(o, qty, price)
+	} else if o.isBuy() {
+		p.asset(m.Quote).Free -= cost
+		p.asset(m.Base).Free += qty
+	} else {
+		p.asset(m.Base).Free -= qty
+		p.asset(m.Quote).Free += cost
+	}
+	if fee != nil && fee.Cost != 0 {
+		p.asset(fee.Currency).Free -= fee.Cost
+		p.addIncome(IncomeCommission, o.Symbol, fee.Currency, -fee.Cost, now)
+		if o.Fee == nil {
+			o.Fee = &banexg.Fee{Currency: fee.Currency, IsMaker: fee.IsMaker, Rate: fee.Rate}
+		}
+		o.Fee.Cost += fee.Cost
+		o.Fee.QuoteCost += fee.QuoteCost
+	}
+	if pnl != 0 {
+		p.addIncome(IncomeRealizedPnl, o.Symbol, m.Settle, pnl, now)
+	}
+	o.Filled += qty
+	o.Remaining -= qty
+	o.Cost += cost
+	o.Average = o.Cost / o.Filled
+	o.LastTradeTimestamp = now
+	o.LastUpdateTimestamp = now
+	if o.Remaining <= 0 {
+		o.Remaining = 0
+		p.finishOrder(o, banexg.OdStatusFilled)
+	} else {
+		o.Status = banexg.OdStatusPartFilled
+	}
+	p.tradeNum += 1
+	trade := &banexg.MyTrade{
+		Trade: banexg.Trade{
+			ID:        strconv.FormatInt(p.tradeNum, 10),
+			Symbol:    o.Symbol,
+			Side:      o.Side,
+			Type:      o.Type,
+			Amount:    qty,
+			Price:     price,
+			Cost:      cost,
+			Order:     o.ID,
+			Timestamp: now,
+			Maker:     maker,
+			Fee:       fee,
+		},
+		Filled:     o.Filled,
+		ClientID:   o.ClientOrderID,
+		Average:    o.Average,
+		State:      o.Status,
+		PosSide:    o.PositionSide,
+		ReduceOnly: o.ReduceOnly,
+	}
+	sendOrPop(p.myTrades, trade)
+	p.emitAccount()
+}
+
+// slipPrice apply slippage against taker, limit price is never exceeded
+func (p *Paper) slipPrice(o *paperOrder, price float64) float64 {
+	if p.Slippage <= 0 {
+		return price
+	}
+	if o.isBuy() {
+		price *= 1 + p.Slippage
+		if !o.isMarket() {
+			price = math.Min(price, o.Price)
+		}
+	} else {
+		price *= 1 - p.Slippage
+		if !o.isMarket() {
+			price = math.Max(price, o.Price)
+		}
+	}
+	return price
+}
+
+/*
+applyContract
+close the reduced side and open the rest. return realized pnl. lock required
+先平仓再开仓，返回已实现盈亏
+*/
+func (p *Paper) applyContract(o *paperOrder, qty, price float64) float64 {
+	m := o.market
+	settle := p.asset(m.Settle)
+	closeSide, openSide := o.closeOpenSides()
+	pnl := float64(0)
+	if closeSide != "" {
+		key := posKey(o.Symbol, closeSide)
+		if pos, ok := p.positions[key]; ok {
+			num := math.Min(qty, pos.Contracts)
+			profit := contractPnl(m, pos.EntryPrice, price, num) * sideDir(closeSide)
+			margin := pos.InitialMargin * num / pos.Contracts
+			settle.Used -= margin
+			settle.Free += margin + profit
+			pos.Contracts -= num
+			pos.InitialMargin -= margin
+			pnl += profit
+			qty -= num
+			if pos.Contracts <= 0 || utils.EqualNearly(pos.Contracts, 0) {
+				delete(p.positions, key)
+			} else {
+				p.refreshPos(pos, m, price)
+			}
+		}
+	}
+	if qty <= 0 || openSide == "" {
+		return pnl
+	}
+	margin := contractValue(m, qty, price) / o.leverage
+	settle.Free -= margin
+	settle.Used += margin
+	key := posKey(o.Symbol, openSide)
+	pos, ok := p.positions[key]
+	if !ok {
+		pos = &banexg.Position{
+			ID:           key,
+			Symbol:       o.Symbol,
+			Side:         openSide,
+			Hedged:       o.PositionSide != "",
+			ContractSize: m.ContractSize,
+			Leverage:     int(o.leverage),
+			MarginMode:   banexg.MarginCross,
+		}
+		p.positions[key] = pos
+	}
+	if pos.Contracts == 0 {
+		pos.EntryPrice = price
+	} else if m.Inverse {
+		pos.EntryPrice = (pos.Contracts + qty) / (pos.Contracts/pos.EntryPrice + qty/price)
+	} else {
+		pos.EntryPrice = (pos.EntryPrice*pos.Contracts + price*qty) / (pos.Contracts + qty)
+	}
+	pos.Contracts += qty
+	pos.InitialMargin += margin
+	p.refreshPos(pos, m, price)
+	return pnl
+}
+
+func (p *Paper) MilliSeconds() int64 {
+	if p.clock != nil {
+		return p.clock()
+	}
+	return p.BanExchange.MilliSeconds()
+}
+
+func (p *Paper) refreshPos(pos *banexg.Position, m *banexg.Market, markPrice float64) {
+	pos.MarkPrice = markPrice
+	pos.TimeStamp = p.MilliSeconds()
+	pos.UnrealizedPnl = contractPnl(m, pos.EntryPrice, markPrice, pos.Contracts) * sideDir(pos.Side)
+	pos.Notional = contractValue(m, pos.Contracts, markPrice)
+	pos.Collateral = pos.InitialMargin + pos.UnrealizedPnl
+	if pos.InitialMargin > 0 {
+		pos.Percentage = pos.UnrealizedPnl / pos.InitialMargin * 100
+	}
+}
+
+// finishOrder release frozen funds and move order to done. lock required
+func (p *Paper) finishOrder(o *paperOrder, status string) {
+	p.releaseFrozen(o, 1)
+	o.Status = status
+	o.LastUpdateTimestamp = p.MilliSeconds()
+	delete(p.orders, o.ID)
+	if _, ok := p.done[o.ID]; !ok {
+		p.doneIds = append(p.doneIds, o.ID)
+	}
+	p.done[o.ID] = o.Order
+	if len(p.doneIds) > keepDoneNum {
+		delete(p.done, p.doneIds[0])
+		p.doneIds = p.doneIds[1:]
+	}
+}
+
+func (p *Paper) addIncome(inType, symbol, code string, amount float64, stamp int64) {
+	p.incomes = append(p.incomes, &banexg.Income{
+		Symbol:     symbol,
+		IncomeType: inType,
+		Income:     amount,
+		Asset:      code,
+		Time:       stamp,
+		TranID:     strconv.Itoa(len(p.incomes) + 1),
+	})
+}
+
+/*
+onBook
+match resting limit orders whose price is crossed by the new order book
+挂单价格被订单簿穿越时成交
+*/
+func (p *Paper) onBook(book *banexg.OrderBook) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.books[book.Symbol] = book
+	p.activateOrders(book.Symbol)
+	for _, o := range p.symbolOrders(book.Symbol) {
+		if o.trigDir != 0 || o.activeAt > 0 || o.isMarket() {
+			continue
+		}
+		prices, sizes := p.takerLevels(o)
+		p.fillLevels(o, prices, sizes, true)
+	}
+}
+
+/*
+onTrade
+trigger stop orders, match resting orders crossed by the trade, and update unrealized pnl.
+Queue position on the same price is not simulated, resting orders only fill when trades cross the price.
+触发条件单，成交被穿越的挂单，更新未实现盈亏。不模拟同价位排队，仅在成交价穿越挂单价时成交
+*/
+func (p *Paper) onTrade(trade *banexg.Trade) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	price := trade.Price
+	p.prices[trade.Symbol] = price
+	p.activateOrders(trade.Symbol)
+	for _, o := range p.symbolOrders(trade.Symbol) {
+		if o.activeAt > 0 {
+			continue
+		}
+		if o.trigDir != 0 {
+			if o.trigDir > 0 && price >= o.trigger || o.trigDir < 0 && price <= o.trigger {
+				p.triggerOrder(o)
+			}
+			continue
+		}
+		if o.isMarket() {
+			continue
+		}
+		if o.isBuy() && price < o.Price || !o.isBuy() && price > o.Price {
+			p.fill(o, math.Min(o.Remaining, trade.Amount*p.FillRate), o.Price, true)
+		}
+	}
+	changed := false
+	for _, pos := range p.positions {
+		if pos.Symbol != trade.Symbol {
+			continue
+		}
+		if m, err := p.GetMarket(pos.Symbol); err == nil {
+			p.refreshPos(pos, m, price)
+			changed = true
+		}
+	}
+	if changed {
+		sendOrPop(p.posOut, p.copyPositions(nil))
+	}
+}
+
+/*
+activate
+called when a new order reaches matching engine: wait for trigger price, or match as taker
+新订单到达撮合引擎：等待触发，或作为吃单方撮合
+*/
+func (p *Paper) activate(o *paperOrder) *errs.Error {
+	o.activeAt = 0
+	if o.trigger <= 0 {
+		return p.placeOrder(o)
+	}
+	ref := p.refPrice(o.Symbol, o.isBuy())
+	if ref == 0 {
+		return errs.NewMsg(errs.CodeMarketUnavailable, "no market data for %s", o.Symbol)
+	}
+	o.trigDir = -1
+	if o.trigger > ref {
+		o.trigDir = 1
+	}
+	return nil
+}
+
+// activateOrders activate delayed orders of symbol which reach matching engine, all if symbol is empty. lock required
+func (p *Paper) activateOrders(symbol string) {
+	now := p.MilliSeconds()
+	for _, o := range p.symbolOrders(symbol) {
+		if o.activeAt == 0 || o.activeAt > now {
+			continue
+		}
+		if err := p.activate(o); err != nil {
+			log.Warn("paper activate order fail", zap.String("id", o.ID), zap.String("symbol", o.Symbol),
+				zap.String("err", err.Short()))
+			p.finishOrder(o, banexg.OdStatusRejected)
+		}
+	}
+}
+
+// triggerOrder activate a stop order and match it as a new order. lock required
+func (p *Paper) triggerOrder(o *paperOrder) {
+	o.trigDir = 0
+	o.LastUpdateTimestamp = p.MilliSeconds()
+	if err := p.placeOrder(o); err != nil {
+		log.Warn("paper trigger order fail", zap.String("id", o.ID), zap.String("symbol", o.Symbol),
+			zap.String("err", err.Short()))
+		p.finishOrder(o, banexg.OdStatusRejected)
+	}
+}
+
+// symbolOrders return open orders of symbol sorted by id, all if symbol is empty. lock required
+func (p *Paper) symbolOrders(symbol string) []*paperOrder {
+	res := make([]*paperOrder, 0)
+	for _, o := range p.orders {
+		if symbol == "" || o.Symbol == symbol {
+			res = append(res, o)
+		}
+	}
+	sortOrders(res)
+	return res
+}
@@ -0,0 +1,66 @@
+package paper
+
+import (
+	"time"
+
+	"github.com/banbox/banexg"
+	"github.com/sasha-s/go-deadlock"
+)
+
+/*
+Paper
+simulated exchange: market data comes from the wrapped adapter, while balances, positions and orders
+are kept in memory and matched against live order books and trades. Only one account is simulated.
+模拟交易所：行情来自被包装的交易所，余额、持仓、订单保存在内存中，根据实时订单簿和成交撮合。仅模拟单个账户
+*/
+type Paper struct {
+	banexg.BanExchange               // wrapped adapter for market data 提供行情的交易所
+	Leverage           float64       // default leverage for contracts 合约默认杠杆
+	BookDepth          int           // depth of order books subscribed for matching 撮合用订单簿深度
+	FundingIntv        time.Duration // interval to check funding settlement and expired orders 检查资金费结算的间隔
+	Latency            int64         // milliseconds before new orders reach the matching engine 订单到达撮合的延迟毫秒
+	Slippage           float64       // price rate applied against taker fills 吃单滑点比率
+	FillRate           float64       // max rate of a trade or book level volume filled by one order 单次最多成交量比例
+
+	clock    func() int64 // virtual clock, MilliSeconds of wrapped exchange is used if nil
+	offline  bool         // never subscribe or fetch market data from wrapped exchange
+	syncPump bool         // chans of wrapped exchange are read by drainPumps instead of goroutines
+
+	lock      deadlock.Mutex
+	assets    map[string]*banexg.Asset    // code: asset, Free/Used only
+	positions map[string]*banexg.Position // symbol|side: position
+	leverages map[string]float64          // symbol: leverage
+	orders    map[string]*paperOrder      // open orders by id
+	done      map[string]*banexg.Order    // finished orders by id
+	doneIds   []string
+	incomes   []*banexg.Income
+	fundings  map[string]*banexg.FundingRateCur // symbol: latest funding rate
+	books     map[string]*banexg.OrderBook
+	prices    map[string]float64 // symbol: last trade price
+	orderNum  int64
+	tradeNum  int64
+
+	watched   map[string]bool        // symbols subscribed for matching
+	userBooks map[string]bool        // symbols subscribed by WatchOrderBooks
+	userTrade map[string]bool        // symbols subscribed by WatchTrades
+	pumps     map[interface{}]string // chans of wrapped adapter being read
+	bookOut   chan *banexg.OrderBook
+	tradeOut  chan *banexg.Trade
+	myTrades  chan *banexg.MyTrade
+	balOut    chan *banexg.Balances
+	posOut    chan []*banexg.Position
+	confOut   chan *banexg.AccountConfig
+	stop      chan struct{}
+}
+
+type paperOrder struct {
+	*banexg.Order
+	market   *banexg.Market
+	frozen   float64 // frozen amount of freeze code, released proportionally by fills 冻结的资金
+	freeze   string  // currency code of frozen
+	trigDir  int     // 1: trigger when price >= trigger price, -1: when <=, 0: not a pending trigger order
+	trigger  float64
+	leverage float64
+	expireAt int64 // 13 digits timestamp for TimeInForceGTD
+	activeAt int64 // order reaches matching engine at this time, 0 if already active
+}
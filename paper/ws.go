@@ -0,0 +1,340 @@
+package paper
+
+import (
+	"reflect"
+
+	"github.com/banbox/banexg"
+	"github.com/banbox/banexg/errs"
+	"github.com/banbox/banexg/log"
+	"github.com/banbox/banexg/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	pumpBook  = "book"
+	pumpTrade = "trade"
+)
+
+// sendOrPop send msg without blocking, drop the oldest message when chan is full
+func sendOrPop[T any](out chan T, msg T) {
+	if out == nil {
+		return
+	}
+	for {
+		select {
+		case out <- msg:
+			return
+		default:
+		}
+		select {
+		case <-out:
+		default:
+		}
+	}
+}
+
+func closeChan(out interface{}) {
+	val := reflect.ValueOf(out)
+	if val.Kind() == reflect.Chan && !val.IsNil() {
+		val.Close()
+	}
+}
+
+func getChanCap(params map[string]interface{}) int {
+	return utils.GetMapVal(params, banexg.ParamChanCap, 100)
+}
+
+/*
+ensureWatch
+subscribe order book and trades of symbol from the wrapped exchange for matching
+从被包装的交易所订阅品种的订单簿和成交，用于撮合
+*/
+func (p *Paper) ensureWatch(symbol string) {
+	p.lock.Lock()
+	if p.watched[symbol] {
+		p.lock.Unlock()
+		return
+	}
+	p.watched[symbol] = true
+	p.lock.Unlock()
+	books, err := p.BanExchange.WatchOrderBooks([]string{symbol}, p.BookDepth, nil)
+	if err == nil {
+		p.pumpBooks(books)
+		var trades chan *banexg.Trade
+		trades, err = p.BanExchange.WatchTrades([]string{symbol}, nil)
+		if err == nil {
+			p.pumpTrades(trades)
+			return
+		}
+	}
+	log.Warn("paper watch market fail", zap.String("symbol", symbol), zap.String("err", err.Short()))
+	p.lock.Lock()
+	delete(p.watched, symbol)
+	p.lock.Unlock()
+}
+
+// ensureBook fetch order book by REST when no market data is received yet
+func (p *Paper) ensureBook(symbol string) {
+	p.lock.Lock()
+	_, hasBook := p.books[symbol]
+	_, hasPrice := p.prices[symbol]
+	p.lock.Unlock()
+	if hasBook || hasPrice {
+		return
+	}
+	book, err := p.BanExchange.FetchOrderBook(symbol, p.BookDepth, nil)
+	if err != nil {
+		log.Warn("paper fetch order book fail", zap.String("symbol", symbol), zap.String("err", err.Short()))
+		return
+	}
+	p.lock.Lock()
+	if _, ok := p.books[symbol]; !ok {
+		p.books[symbol] = book
+	}
+	p.lock.Unlock()
+}
+
+func (p *Paper) addPump(in interface{}, kind string) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if _, ok := p.pumps[in]; ok {
+		return false
+	}
+	p.pumps[in] = kind
+	return true
+}
+
+// delPump called after chan of wrapped exchange closed, close output chan if no pump left for kind
+func (p *Paper) delPump(in interface{}) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	kind := p.pumps[in]
+	delete(p.pumps, in)
+	// subscriptions may be closed, re-subscribe for next order
+	p.watched = make(map[string]bool)
+	for _, k := range p.pumps {
+		if k == kind {
+			return
+		}
+	}
+	if kind == pumpBook {
+		closeChan(p.bookOut)
+		p.bookOut = nil
+	} else {
+		closeChan(p.tradeOut)
+		p.tradeOut = nil
+	}
+}
+
+func (p *Paper) pumpBooks(in chan *banexg.OrderBook) {
+	if !p.addPump(in, pumpBook) || p.syncPump {
+		return
+	}
+	go func() {
+		for book := range in {
+			p.handleBook(book)
+		}
+		p.delPump(in)
+	}()
+}
+
+func (p *Paper) pumpTrades(in chan *banexg.Trade) {
+	if !p.addPump(in, pumpTrade) || p.syncPump {
+		return
+	}
+	go func() {
+		for trade := range in {
+			p.handleTrade(trade)
+		}
+		p.delPump(in)
+	}()
+}
+
+func (p *Paper) handleBook(book *banexg.OrderBook) {
+	p.onBook(book)
+	p.lock.Lock()
+	if p.userBooks[book.Symbol] {
+		sendOrPop(p.bookOut, book)
+	}
+	p.lock.Unlock()
+}
+
+func (p *Paper) handleTrade(trade *banexg.Trade) {
+	p.onTrade(trade)
+	p.lock.Lock()
+	if p.userTrade[trade.Symbol] {
+		sendOrPop(p.tradeOut, trade)
+	}
+	p.lock.Unlock()
+}
+
+/*
+drainPumps
+read all pending messages of wrapped exchange chans in current goroutine, used when syncPump is set
+在当前协程读取被包装交易所所有待处理消息，用于syncPump模式
+*/
+func (p *Paper) drainPumps() {
+	p.lock.Lock()
+	chans := make([]interface{}, 0, len(p.pumps))
+	for in := range p.pumps {
+		chans = append(chans, in)
+	}
+	p.lock.Unlock()
+	for _, in := range chans {
+		closed := false
+		switch ch := in.(type) {
+		case chan *banexg.OrderBook:
+			closed = drainChan(ch, p.handleBook)
+		case chan *banexg.Trade:
+			closed = drainChan(ch, p.handleTrade)
+		}
+		if closed {
+			p.delPump(in)
+		}
+	}
+}
+
+// drainChan handle all buffered messages, return whether chan is closed
+func drainChan[T any](in chan T, handle func(T)) bool {
+	for {
+		select {
+		case msg, ok := <-in:
+			if !ok {
+				return true
+			}
+			handle(msg)
+		default:
+			return false
+		}
+	}
+}
+
+// busySymbols symbols with open orders or positions, which should keep subscribed. lock required
+func (p *Paper) busySymbols() map[string]bool {
+	res := make(map[string]bool)
+	for _, o := range p.orders {
+		res[o.Symbol] = true
+	}
+	for _, pos := range p.positions {
+		res[pos.Symbol] = true
+	}
+	return res
+}
+
+// unWatchable remove symbols from user subscriptions, return symbols which can be unsubscribed. lock required
+func (p *Paper) unWatchable(symbols []string, users map[string]bool) []string {
+	busy := p.busySymbols()
+	res := make([]string, 0, len(symbols))
+	for _, symbol := range symbols {
+		delete(users, symbol)
+		if busy[symbol] {
+			continue
+		}
+		delete(p.watched, symbol)
+		res = append(res, symbol)
+	}
+	return res
+}
+
+func (p *Paper) WatchOrderBooks(symbols []string, limit int, params map[string]interface{}) (chan *banexg.OrderBook, *errs.Error) {
+	chanCap := getChanCap(params)
+	in, err := p.BanExchange.WatchOrderBooks(symbols, limit, params)
+	if err != nil {
+		return nil, err
+	}
+	p.lock.Lock()
+	for _, symbol := range symbols {
+		p.userBooks[symbol] = true
+	}
+	if p.bookOut == nil {
+		p.bookOut = make(chan *banexg.OrderBook, chanCap)
+	}
+	out := p.bookOut
+	p.lock.Unlock()
+	p.pumpBooks(in)
+	return out, nil
+}
+
+/*
+UnWatchOrderBooks
+symbols with open orders or positions keep subscribed for matching
+有挂单或持仓的品种保持订阅用于撮合
+*/
+func (p *Paper) UnWatchOrderBooks(symbols []string, params map[string]interface{}) *errs.Error {
+	p.lock.Lock()
+	items := p.unWatchable(symbols, p.userBooks)
+	p.lock.Unlock()
+	if len(items) == 0 {
+		return nil
+	}
+	return p.BanExchange.UnWatchOrderBooks(items, params)
+}
+
+func (p *Paper) WatchTrades(symbols []string, params map[string]interface{}) (chan *banexg.Trade, *errs.Error) {
+	chanCap := getChanCap(params)
+	in, err := p.BanExchange.WatchTrades(symbols, params)
+	if err != nil {
+		return nil, err
+	}
+	p.lock.Lock()
+	for _, symbol := range symbols {
+		p.userTrade[symbol] = true
+	}
+	if p.tradeOut == nil {
+		p.tradeOut = make(chan *banexg.Trade, chanCap)
+	}
+	out := p.tradeOut
+	p.lock.Unlock()
+	p.pumpTrades(in)
+	return out, nil
+}
+
+func (p *Paper) UnWatchTrades(symbols []string, params map[string]interface{}) *errs.Error {
+	p.lock.Lock()
+	items := p.unWatchable(symbols, p.userTrade)
+	p.lock.Unlock()
+	if len(items) == 0 {
+		return nil
+	}
+	return p.BanExchange.UnWatchTrades(items, params)
+}
+
+// WatchMyTrades receive simulated fills
+func (p *Paper) WatchMyTrades(params map[string]interface{}) (chan *banexg.MyTrade, *errs.Error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.myTrades == nil {
+		p.myTrades = make(chan *banexg.MyTrade, getChanCap(params))
+	}
+	return p.myTrades, nil
+}
+
+// WatchBalance receive simulated balances after changed
+func (p *Paper) WatchBalance(params map[string]interface{}) (chan *banexg.Balances, *errs.Error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.balOut == nil {
+		p.balOut = make(chan *banexg.Balances, getChanCap(params))
+	}
+	return p.balOut, nil
+}
+
+// WatchPositions receive simulated positions after changed
+func (p *Paper) WatchPositions(params map[string]interface{}) (chan []*banexg.Position, *errs.Error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.posOut == nil {
+		p.posOut = make(chan []*banexg.Position, getChanCap(params))
+	}
+	return p.posOut, nil
+}
+
+// WatchAccountConfig receive simulated leverage changes by SetLeverage
+func (p *Paper) WatchAccountConfig(params map[string]interface{}) (chan *banexg.AccountConfig, *errs.Error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.confOut == nil {
+		p.confOut = make(chan *banexg.AccountConfig, getChanCap(params))
+	}
+	return p.confOut, nil
+}
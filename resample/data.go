@@ -0,0 +1,10 @@
+package resample
+
+const (
+	OptEnable = "Resample" // bool, wrap exchange by bex.New to synthesize unsupported timeframes 由bex.New包装交易所以合成不支持的周期
+)
+
+const (
+	msecsDay   = int64(86400000)
+	fetchBatch = 1000 // max source bars per FetchOHLCV call 每次FetchOHLCV请求的最大源K线数
+)
@@ -0,0 +1,301 @@
+package resample
+
+import (
+	"github.com/banbox/banexg"
+	"github.com/banbox/banexg/errs"
+	"github.com/banbox/banexg/utils"
+	"github.com/sasha-s/go-deadlock"
+)
+
+/*
+Exchange
+wrap an exchange, FetchOHLCV and WatchOHLCVs synthesize timeframes not supported by the wrapped exchange
+from the largest supported timeframe which divides them. Other methods are served by the wrapped exchange.
+包装交易所，FetchOHLCV和WatchOHLCVs使用能整除的最大支持周期合成被包装交易所不支持的周期。其他方法由被包装交易所处理
+*/
+type Exchange struct {
+	banexg.BanExchange
+	Supported map[string]bool // timeframes supported by wrapped exchange, nil for all 被包装交易所支持的周期，nil表示全部
+
+	rawTFs map[string]string // exchange specific timeframe: common timeframe
+	lock   deadlock.Mutex
+	direct map[string]int                   // symbol|timeframe: count of direct subscriptions
+	synth  map[string]map[string]*Resampler // source symbol|timeframe: target timeframe: resampler
+	out    chan *banexg.PairTFKline
+	pumps  map[chan *banexg.PairTFKline]bool
+}
+
+/*
+Wrap
+wrap exchange, supported timeframes are keys of Exchange.TimeFrames
+包装交易所，支持的周期为Exchange.TimeFrames的键
+*/
+func Wrap(exg banexg.BanExchange) *Exchange {
+	res := &Exchange{
+		BanExchange: exg,
+		rawTFs:      make(map[string]string),
+		direct:      make(map[string]int),
+		synth:       make(map[string]map[string]*Resampler),
+		pumps:       make(map[chan *banexg.PairTFKline]bool),
+	}
+	if base := exg.GetExg(); base != nil && base.TimeFrames != nil {
+		res.Supported = make(map[string]bool)
+		for tf, raw := range base.TimeFrames {
+			res.Supported[tf] = true
+			res.rawTFs[raw] = tf
+		}
+	}
+	return res
+}
+
+func jobKey(symbol, timeframe string) string {
+	return symbol + "|" + timeframe
+}
+
+/*
+SourceTF
+return timeframe to fetch from wrapped exchange for timeframe, which is itself if supported
+返回用于合成timeframe的源周期，支持时返回自身
+*/
+func (e *Exchange) SourceTF(timeframe string) (string, *errs.Error) {
+	if e.Supported == nil || e.Supported[timeframe] {
+		return timeframe, nil
+	}
+	dst, err := New(timeframe)
+	if err != nil {
+		return "", err
+	}
+	best, bestMSecs := "", int64(0)
+	for tf := range e.Supported {
+		src, err := New(tf)
+		if err != nil || src.TFMSecs >= dst.TFMSecs || dst.TFMSecs%src.TFMSecs != 0 {
+			continue
+		}
+		if (dst.Offset-src.Offset)%src.TFMSecs != 0 || src.TFMSecs <= bestMSecs {
+			continue
+		}
+		best, bestMSecs = tf, src.TFMSecs
+	}
+	if best == "" {
+		return "", errs.NewMsg(errs.CodeInvalidTimeFrame, "no source timeframe for %s", timeframe)
+	}
+	return best, nil
+}
+
+func (e *Exchange) newResampler(symbol, timeframe string) (*Resampler, *errs.Error) {
+	market, err := e.BanExchange.GetMarket(symbol)
+	if err != nil {
+		return New(timeframe)
+	}
+	return NewSession(timeframe, market)
+}
+
+/*
+FetchOHLCV
+bars of unsupported timeframe are aggregated from source bars fetched in batches, the last bar may be in progress
+不支持周期的K线由分批获取的源K线聚合，最后一根可能未完成
+*/
+func (e *Exchange) FetchOHLCV(symbol, timeframe string, since int64, limit int, params map[string]interface{}) ([]*banexg.Kline, *errs.Error) {
+	srcTF, err := e.SourceTF(timeframe)
+	if err != nil {
+		return nil, err
+	}
+	if srcTF == timeframe {
+		return e.BanExchange.FetchOHLCV(symbol, timeframe, since, limit, params)
+	}
+	r, err := e.newResampler(symbol, timeframe)
+	if err != nil {
+		return nil, err
+	}
+	srcMSecs := int64(utils.TFToSecs(srcTF)) * 1000
+	if limit <= 0 {
+		limit = 500
+	}
+	fromEnd := since <= 0
+	if fromEnd {
+		since = e.MilliSeconds() - int64(limit)*r.TFMSecs
+	}
+	since, _ = r.bucket(since)
+	need := limit * int(r.TFMSecs/srcMSecs)
+	pageSize := fetchBatch
+	if info := e.Info(); info != nil && info.KlinePage > 0 {
+		pageSize = info.KlinePage
+	}
+	bars := make([]*banexg.Kline, 0, need)
+	for cur := since; len(bars) < need; {
+		batch := min(pageSize, need-len(bars))
+		page, err := e.BanExchange.FetchOHLCV(symbol, srcTF, cur, batch, params)
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range page {
+			if k.Time >= cur {
+				bars = append(bars, k)
+			}
+		}
+		// exchanges may cap pages below batch, so only an empty page means no more data
+		if len(page) == 0 {
+			break
+		}
+		next := page[len(page)-1].Time + srcMSecs
+		if next <= cur || next > e.MilliSeconds() {
+			break
+		}
+		cur = next
+	}
+	res := r.Klines(bars)
+	if len(res) > limit {
+		if fromEnd {
+			res = res[len(res)-limit:]
+		} else {
+			res = res[:limit]
+		}
+	}
+	return res, nil
+}
+
+/*
+WatchOHLCVs
+source bars of unsupported timeframes are subscribed from wrapped exchange, the target bar in progress
+is sent after each source update
+不支持的周期从被包装交易所订阅源K线，每次源K线更新后发送目标周期的当前K线
+*/
+func (e *Exchange) WatchOHLCVs(jobs [][2]string, params map[string]interface{}) (chan *banexg.PairTFKline, *errs.Error) {
+	subs := make([][2]string, 0, len(jobs))
+	added := make(map[string]bool)
+	addSub := func(symbol, tf string) {
+		key := jobKey(symbol, tf)
+		if !added[key] {
+			added[key] = true
+			subs = append(subs, [2]string{symbol, tf})
+		}
+	}
+	type synthJob struct {
+		srcKey string
+		tf     string
+		r      *Resampler
+	}
+	var direct []string
+	var synths []*synthJob
+	for _, j := range jobs {
+		srcTF, err := e.SourceTF(j[1])
+		if err != nil {
+			return nil, err
+		}
+		addSub(j[0], srcTF)
+		if srcTF == j[1] {
+			direct = append(direct, jobKey(j[0], j[1]))
+			continue
+		}
+		r, err := e.newResampler(j[0], j[1])
+		if err != nil {
+			return nil, err
+		}
+		synths = append(synths, &synthJob{srcKey: jobKey(j[0], srcTF), tf: j[1], r: r})
+	}
+	in, err := e.BanExchange.WatchOHLCVs(subs, params)
+	if err != nil {
+		return nil, err
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	for _, key := range direct {
+		e.direct[key] += 1
+	}
+	for _, s := range synths {
+		items, ok := e.synth[s.srcKey]
+		if !ok {
+			items = make(map[string]*Resampler)
+			e.synth[s.srcKey] = items
+		}
+		if _, ok = items[s.tf]; !ok {
+			items[s.tf] = s.r
+		}
+	}
+	if e.out == nil {
+		e.out = make(chan *banexg.PairTFKline, utils.GetMapVal(params, banexg.ParamChanCap, 100))
+	}
+	out := e.out
+	if !e.pumps[in] {
+		e.pumps[in] = true
+		go e.pump(in, out)
+	}
+	return out, nil
+}
+
+func (e *Exchange) pump(in, out chan *banexg.PairTFKline) {
+	for k := range in {
+		for _, msg := range e.handleKline(k) {
+			out <- msg
+		}
+	}
+	e.lock.Lock()
+	delete(e.pumps, in)
+	if len(e.pumps) == 0 && e.out == out {
+		close(out)
+		e.out = nil
+	}
+	e.lock.Unlock()
+}
+
+// handleKline return messages to send for a source bar
+func (e *Exchange) handleKline(k *banexg.PairTFKline) []*banexg.PairTFKline {
+	tf := k.TimeFrame
+	if e.Supported != nil && !e.Supported[tf] {
+		if common, ok := e.rawTFs[tf]; ok {
+			tf = common
+		}
+	}
+	key := jobKey(k.Symbol, tf)
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	var res []*banexg.PairTFKline
+	if e.direct[key] > 0 {
+		res = append(res, k)
+	}
+	for dstTF, r := range e.synth[key] {
+		r.AddKline(&k.Kline)
+		if cur := r.Current(); cur != nil {
+			res = append(res, &banexg.PairTFKline{Kline: *cur, Symbol: k.Symbol, TimeFrame: dstTF})
+		}
+	}
+	return res
+}
+
+// UnWatchOHLCVs source bars are unsubscribed after no timeframe depends on them
+func (e *Exchange) UnWatchOHLCVs(jobs [][2]string, params map[string]interface{}) *errs.Error {
+	subs := make([][2]string, 0, len(jobs))
+	e.lock.Lock()
+	for _, j := range jobs {
+		srcTF, err := e.SourceTF(j[1])
+		if err != nil {
+			e.lock.Unlock()
+			return err
+		}
+		srcKey := jobKey(j[0], srcTF)
+		if srcTF == j[1] {
+			if e.direct[srcKey] <= 1 {
+				delete(e.direct, srcKey)
+			} else {
+				e.direct[srcKey] -= 1
+			}
+		} else if items, ok := e.synth[srcKey]; ok {
+			delete(items, j[1])
+			if len(items) == 0 {
+				delete(e.synth, srcKey)
+			}
+		}
+		if _, ok := e.direct[srcKey]; ok {
+			continue
+		}
+		if _, ok := e.synth[srcKey]; ok {
+			continue
+		}
+		subs = append(subs, [2]string{j[0], srcTF})
+	}
+	e.lock.Unlock()
+	if len(subs) == 0 {
+		return nil
+	}
+	return e.BanExchange.UnWatchOHLCVs(subs, params)
+}
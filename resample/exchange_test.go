@@ -0,0 +1,167 @@
+package resample
+
+import (
+	"testing"
+	"time"
+
+	"github.com/banbox/banexg"
+	"github.com/banbox/banexg/errs"
+)
+
+type fakeExg struct {
+	*banexg.Exchange
+	bars   []*banexg.Kline
+	calls  int
+	maxNum int // cap of bars per page like real exchanges, 0 for no cap
+	klines chan *banexg.PairTFKline
+	subs   [][2]string
+	unsubs [][2]string
+}
+
+func (e *fakeExg) FetchOHLCV(symbol, timeframe string, since int64, limit int, params map[string]interface{}) ([]*banexg.Kline, *errs.Error) {
+	if timeframe != "1m" {
+		return nil, errs.NewMsg(errs.CodeInvalidTimeFrame, "unsupported: %s", timeframe)
+	}
+	e.calls += 1
+	if e.maxNum > 0 {
+		limit = min(limit, e.maxNum)
+	}
+	var res []*banexg.Kline
+	for _, k := range e.bars {
+		if k.Time >= since && len(res) < limit {
+			res = append(res, k)
+		}
+	}
+	return res, nil
+}
+
+func (e *fakeExg) WatchOHLCVs(jobs [][2]string, params map[string]interface{}) (chan *banexg.PairTFKline, *errs.Error) {
+	e.subs = append(e.subs, jobs...)
+	return e.klines, nil
+}
+
+func (e *fakeExg) UnWatchOHLCVs(jobs [][2]string, params map[string]interface{}) *errs.Error {
+	e.unsubs = append(e.unsubs, jobs...)
+	return nil
+}
+
+func newFakeExg() *fakeExg {
+	return &fakeExg{
+		Exchange: &banexg.Exchange{
+			ExgInfo:    &banexg.ExgInfo{ID: "fake"},
+			TimeFrames: map[string]string{"1m": "1m", "5m": "5m", "1h": "1H"},
+		},
+		bars:   makeBars(baseMS, 60000, 2500),
+		klines: make(chan *banexg.PairTFKline, 10),
+	}
+}
+
+func TestSourceTF(t *testing.T) {
+	exg := Wrap(newFakeExg())
+	cases := map[string]string{"5m": "5m", "10m": "5m", "7m": "1m", "2h": "1h", "1d": "1h"}
+	for tf, expect := range cases {
+		src, err := exg.SourceTF(tf)
+		if err != nil || src != expect {
+			t.Errorf("source of %s should be %s, got %s %v", tf, expect, src, err)
+		}
+	}
+	if _, err := exg.SourceTF("30s"); err == nil {
+		t.Errorf("30s should have no source")
+	}
+}
+
+func TestFetchOHLCV(t *testing.T) {
+	inner := newFakeExg()
+	inner.TimeFrames = map[string]string{"1m": "1m"}
+	exg := Wrap(inner)
+	since := (baseMS/420000 + 1) * 420000
+	res, err := exg.FetchOHLCV("BTC/USDT", "7m", since, 200, nil)
+	if err != nil {
+		t.Fatalf("fetch fail: %v", err)
+	}
+	if len(res) != 200 {
+		t.Fatalf("expect 200 bars, got %d", len(res))
+	}
+	if inner.calls != 2 {
+		t.Fatalf("source should be fetched in 2 batches, got %d", inner.calls)
+	}
+	for i, k := range res {
+		if k.Volume != 7 || k.Time%(7*60000) != 0 {
+			t.Fatalf("bar %d wrong: %+v", i, *k)
+		}
+	}
+}
+
+func TestFetchOHLCVCappedPage(t *testing.T) {
+	inner := newFakeExg()
+	inner.TimeFrames = map[string]string{"1m": "1m"}
+	inner.maxNum = 300
+	exg := Wrap(inner)
+	since := (baseMS/420000 + 1) * 420000
+	res, err := exg.FetchOHLCV("BTC/USDT", "7m", since, 200, nil)
+	if err != nil {
+		t.Fatalf("fetch fail: %v", err)
+	}
+	if len(res) != 200 {
+		t.Fatalf("capped pages shouldn't truncate result, got %d", len(res))
+	}
+	if inner.calls != 5 {
+		t.Fatalf("source should be fetched in 5 pages, got %d", inner.calls)
+	}
+	// page size follows KlinePage
+	inner.calls = 0
+	inner.ExgInfo.KlinePage = 300
+	if res, err = exg.FetchOHLCV("BTC/USDT", "7m", since, 200, nil); err != nil || len(res) != 200 {
+		t.Fatalf("fetch by KlinePage fail: %d %v", len(res), err)
+	}
+	if inner.calls != 5 {
+		t.Fatalf("expect 5 pages of KlinePage, got %d", inner.calls)
+	}
+}
+
+func TestWatchOHLCVs(t *testing.T) {
+	inner := newFakeExg()
+	exg := Wrap(inner)
+	out, err := exg.WatchOHLCVs([][2]string{{"BTC/USDT", "1h"}, {"BTC/USDT", "2h"}}, nil)
+	if err != nil {
+		t.Fatalf("watch fail: %v", err)
+	}
+	if len(inner.subs) != 1 || inner.subs[0][1] != "1h" {
+		t.Fatalf("should subscribe 1h once: %v", inner.subs)
+	}
+	// raw timeframe of exchange is mapped back
+	inner.klines <- &banexg.PairTFKline{Symbol: "BTC/USDT", TimeFrame: "1H",
+		Kline: banexg.Kline{Time: baseMS, Open: 1, High: 2, Low: 1, Close: 2, Volume: 1}}
+	inner.klines <- &banexg.PairTFKline{Symbol: "BTC/USDT", TimeFrame: "1H",
+		Kline: banexg.Kline{Time: baseMS + 3600000, Open: 2, High: 3, Low: 2, Close: 3, Volume: 2}}
+	got := make(map[string]*banexg.PairTFKline)
+	for i := 0; i < 4; i++ {
+		select {
+		case k := <-out:
+			got[k.TimeFrame] = k
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting klines")
+		}
+	}
+	if k := got["2h"]; k == nil || k.Volume != 3 || k.Close != 3 || k.Time != baseMS {
+		t.Fatalf("2h bar wrong: %+v", k)
+	}
+	if k := got["1H"]; k == nil || k.Volume != 2 {
+		t.Fatalf("direct bar wrong: %+v", k)
+	}
+	if err = exg.UnWatchOHLCVs([][2]string{{"BTC/USDT", "2h"}}, nil); err != nil || len(inner.unsubs) != 0 {
+		t.Fatalf("1h is still used, should not unsubscribe: %v", inner.unsubs)
+	}
+	if err = exg.UnWatchOHLCVs([][2]string{{"BTC/USDT", "1h"}}, nil); err != nil || len(inner.unsubs) != 1 {
+		t.Fatalf("1h should be unsubscribed: %v", inner.unsubs)
+	}
+	close(inner.klines)
+	select {
+	case _, ok := <-out:
+		if ok {
+			t.Fatalf("out should be closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timeout waiting close")
+	}
+}
@@ -0,0 +1,249 @@
+package resample
+
+import (
+	"time"
+
+	"github.com/banbox/banexg"
+	"github.com/banbox/banexg/errs"
+	"github.com/banbox/banexg/utils"
+)
+
+/*
+Resampler
+aggregate klines or trades of one symbol into the target timeframe.
+Bars are aligned by utils.GetTfAlignOrigin. With trading sessions (China futures), intraday bars start at
+each session start and never cross sessions; daily bars are grouped by trading day, night session belongs
+to the next trading day.
+将单个品种的K线或成交聚合为目标周期。K线按utils.GetTfAlignOrigin对齐。有交易时段时（国内期货），日内K线从每个时段开始
+且不跨时段；日线按交易日分组，夜盘属于下一交易日
+*/
+type Resampler struct {
+	TimeFrame string
+	TFMSecs   int64
+	Offset    int64 // align offset in milliseconds 对齐偏移毫秒
+	sessions  [][2]int64
+	nightAt   int64 // milliseconds of day when night session starts, -1 if none
+	cur       *banexg.Kline
+	curEnd    int64         // end of cur bucket
+	last      *banexg.Kline // latest source bar, may be updated again
+}
+
+// New create resampler for timeframe without trading sessions
+func New(timeframe string) (*Resampler, *errs.Error) {
+	secs, err := utils.TFToSecSafe(timeframe)
+	if err != nil || secs <= 0 {
+		return nil, errs.NewMsg(errs.CodeInvalidTimeFrame, "invalid timeframe: %s", timeframe)
+	}
+	_, offset := utils.GetTfAlignOrigin(secs)
+	return &Resampler{
+		TimeFrame: timeframe,
+		TFMSecs:   int64(secs) * 1000,
+		Offset:    int64(offset) * 1000,
+		nightAt:   -1,
+	}, nil
+}
+
+/*
+NewSession
+create resampler using DayTimes and NightTimes of market, same as New if market has no trading sessions
+使用市场的DayTimes和NightTimes创建，市场无交易时段时同New
+*/
+func NewSession(timeframe string, market *banexg.Market) (*Resampler, *errs.Error) {
+	res, err := New(timeframe)
+	if err != nil || market == nil {
+		return res, err
+	}
+	res.sessions = append(append(res.sessions, market.DayTimes...), market.NightTimes...)
+	for _, s := range market.NightTimes {
+		if res.nightAt < 0 || s[0] < res.nightAt {
+			res.nightAt = s[0]
+		}
+	}
+	return res, nil
+}
+
+func (r *Resampler) align(ms int64) int64 {
+	val := ms - r.Offset
+	start := val / r.TFMSecs * r.TFMSecs
+	if val < 0 && start != val {
+		start -= r.TFMSecs
+	}
+	return start + r.Offset
+}
+
+// bucket return start and end of the bar containing ms
+func (r *Resampler) bucket(ms int64) (int64, int64) {
+	if len(r.sessions) == 0 {
+		start := r.align(ms)
+		return start, start + r.TFMSecs
+	}
+	day := ms - ms%msecsDay
+	if r.TFMSecs >= msecsDay {
+		if r.nightAt >= 0 && ms-day >= r.nightAt {
+			day += msecsDay
+		}
+		switch time.UnixMilli(day).UTC().Weekday() {
+		case time.Saturday:
+			day += msecsDay * 2
+		case time.Sunday:
+			day += msecsDay
+		}
+		start := r.align(day)
+		return start, start + r.TFMSecs
+	}
+	for _, s := range r.sessions {
+		// session may end in next day
+		for _, base := range []int64{day, day - msecsDay} {
+			sessStart, sessEnd := base+s[0], base+s[1]
+			if ms >= sessStart && ms < sessEnd {
+				start := sessStart + (ms-sessStart)/r.TFMSecs*r.TFMSecs
+				return start, min(start+r.TFMSecs, sessEnd)
+			}
+		}
+	}
+	start := r.align(ms)
+	return start, start + r.TFMSecs
+}
+
+func mergeKline(dst, src *banexg.Kline) {
+	dst.High = max(dst.High, src.High)
+	dst.Low = min(dst.Low, src.Low)
+	dst.Close = src.Close
+	dst.Volume += src.Volume
+	dst.Quote += src.Quote
+	dst.BuyVolume += src.BuyVolume
+	dst.TradeNum += src.TradeNum
+}
+
+// Current return a copy of the bar in progress, nil if no data
+func (r *Resampler) Current() *banexg.Kline {
+	if r.cur == nil {
+		return nil
+	}
+	res := *r.cur
+	if r.last != nil {
+		mergeKline(&res, r.last)
+	}
+	return &res
+}
+
+/*
+AddKline
+add a source bar, source bar with the same time as the previous one is treated as an update of it.
+return the finished bar if k belongs to a new bucket.
+添加源K线，与上一根时间相同时视为其更新。k属于新周期时返回已完成的K线
+*/
+func (r *Resampler) AddKline(k *banexg.Kline) *banexg.Kline {
+	if r.last != nil && k.Time == r.last.Time {
+		item := *k
+		item.Dec = nil
+		r.last = &item
+		return nil
+	}
+	if r.last != nil && k.Time < r.last.Time {
+		// out of order bar, ignore
+		return nil
+	}
+	var closed *banexg.Kline
+	if r.cur != nil && k.Time < r.curEnd {
+		mergeKline(r.cur, r.last)
+	} else {
+		closed = r.Current()
+		start, end := r.bucket(k.Time)
+		r.cur = &banexg.Kline{Time: start, Open: k.Open, High: k.Open, Low: k.Open, Close: k.Open}
+		r.curEnd = end
+	}
+	item := *k
+	item.Dec = nil
+	r.last = &item
+	return closed
+}
+
+/*
+AddTrade
+add a trade, return the finished bar if trade belongs to a new bucket. trades should be in time order.
+添加成交，成交属于新周期时返回已完成的K线。成交需按时间顺序
+*/
+func (r *Resampler) AddTrade(t *banexg.Trade) *banexg.Kline {
+	quote := t.Cost
+	if quote == 0 {
+		quote = t.Price * t.Amount
+	}
+	k := &banexg.Kline{Time: t.Timestamp, Open: t.Price, High: t.Price, Low: t.Price, Close: t.Price,
+		Volume: t.Amount, Quote: quote, TradeNum: 1}
+	if t.Side == banexg.OdSideBuy {
+		k.BuyVolume = t.Amount
+	}
+	var closed *banexg.Kline
+	if r.cur == nil || t.Timestamp >= r.curEnd {
+		closed = r.Current()
+		start, end := r.bucket(t.Timestamp)
+		r.cur = &banexg.Kline{Time: start, Open: t.Price, High: t.Price, Low: t.Price, Close: t.Price}
+		r.curEnd = end
+		r.last = nil
+	} else if t.Timestamp < r.cur.Time {
+		return nil
+	}
+	mergeKline(r.cur, k)
+	return closed
+}
+
+/*
+Klines
+aggregate source bars in time order, the last bar in progress is included
+按时间顺序聚合源K线，包含最后未完成的K线
+*/
+func (r *Resampler) Klines(bars []*banexg.Kline) []*banexg.Kline {
+	res := make([]*banexg.Kline, 0, len(bars))
+	for _, k := range bars {
+		if closed := r.AddKline(k); closed != nil {
+			res = append(res, closed)
+		}
+	}
+	if cur := r.Current(); cur != nil {
+		res = append(res, cur)
+	}
+	return res
+}
+
+// Klines aggregate bars into timeframe without trading sessions, the last bar in progress is included
+func Klines(bars []*banexg.Kline, timeframe string) ([]*banexg.Kline, *errs.Error) {
+	r, err := New(timeframe)
+	if err != nil {
+		return nil, err
+	}
+	return r.Klines(bars), nil
+}
+
+/*
+Trades
+aggregate trades of multiple symbols into bars of timeframe. finished bars are sent to the returned chan,
+bars in progress are sent after in closed, then the returned chan is closed.
+将多个品种的成交聚合为指定周期K线。已完成的K线发送到返回的通道，in关闭后发送未完成的K线并关闭返回的通道
+*/
+func Trades(in chan *banexg.Trade, timeframe string, chanCap int) (chan *banexg.PairTFKline, *errs.Error) {
+	if _, err := New(timeframe); err != nil {
+		return nil, err
+	}
+	out := make(chan *banexg.PairTFKline, chanCap)
+	go func() {
+		defer close(out)
+		items := make(map[string]*Resampler)
+		for t := range in {
+			r, ok := items[t.Symbol]
+			if !ok {
+				r, _ = New(timeframe)
+				items[t.Symbol] = r
+			}
+			if closed := r.AddTrade(t); closed != nil {
+				out <- &banexg.PairTFKline{Kline: *closed, Symbol: t.Symbol, TimeFrame: timeframe}
+			}
+		}
+		for symbol, r := range items {
+			if cur := r.Current(); cur != nil {
+				out <- &banexg.PairTFKline{Kline: *cur, Symbol: symbol, TimeFrame: timeframe}
+			}
+		}
+	}()
+	return out, nil
+}
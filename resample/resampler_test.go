@@ -0,0 +1,122 @@
+package resample
+
+import (
+	"testing"
+
+	"github.com/banbox/banexg"
+)
+
+// 2024-01-01 00:00:00 UTC, Monday
+const baseMS = int64(1704067200000)
+
+func makeBars(start, intv int64, num int) []*banexg.Kline {
+	res := make([]*banexg.Kline, 0, num)
+	for i := 0; i < num; i++ {
+		p := float64(100 + i)
+		res = append(res, &banexg.Kline{Time: start + int64(i)*intv, Open: p, High: p + 2, Low: p - 1,
+			Close: p + 1, Volume: 1, Quote: p, TradeNum: 1})
+	}
+	return res
+}
+
+func TestKlines(t *testing.T) {
+	bars := makeBars(baseMS+5*60000, 60000, 25)
+	res, err := Klines(bars, "10m")
+	if err != nil {
+		t.Fatalf("resample fail: %v", err)
+	}
+	if len(res) != 3 {
+		t.Fatalf("expect 3 bars, got %d", len(res))
+	}
+	first := res[0]
+	if first.Time != baseMS || first.Open != 100 || first.Close != 105 || first.High != 106 || first.Low != 99 ||
+		first.Volume != 5 || first.TradeNum != 5 {
+		t.Fatalf("first bar wrong: %+v", *first)
+	}
+	if res[1].Time != baseMS+600000 || res[1].Volume != 10 || res[2].Volume != 10 {
+		t.Fatalf("bars wrong: %+v %+v", *res[1], *res[2])
+	}
+	// 3d bars are aligned to 1970-01-02
+	days := makeBars(baseMS, msecsDay, 6)
+	res, err = Klines(days, "3d")
+	if err != nil {
+		t.Fatalf("resample 3d fail: %v", err)
+	}
+	if res[0].Time%(3*msecsDay) != msecsDay {
+		t.Fatalf("3d bar not aligned: %v", res[0].Time)
+	}
+}
+
+func TestUpdateKline(t *testing.T) {
+	r, _ := New("5m")
+	r.AddKline(&banexg.Kline{Time: baseMS, Open: 10, High: 11, Low: 9, Close: 10, Volume: 1})
+	// update of the same source bar replaces it
+	r.AddKline(&banexg.Kline{Time: baseMS, Open: 10, High: 12, Low: 9, Close: 12, Volume: 3})
+	r.AddKline(&banexg.Kline{Time: baseMS + 60000, Open: 12, High: 13, Low: 12, Close: 13, Volume: 2})
+	cur := r.Current()
+	if cur.Volume != 5 || cur.High != 13 || cur.Close != 13 {
+		t.Fatalf("current bar wrong: %+v", *cur)
+	}
+	closed := r.AddKline(&banexg.Kline{Time: baseMS + 300000, Open: 13, High: 13, Low: 13, Close: 13, Volume: 1})
+	if closed == nil || closed.Volume != 5 || closed.Time != baseMS {
+		t.Fatalf("closed bar wrong: %+v", closed)
+	}
+}
+
+func TestTrades(t *testing.T) {
+	in := make(chan *banexg.Trade, 10)
+	out, err := Trades(in, "10s", 10)
+	if err != nil {
+		t.Fatalf("trades fail: %v", err)
+	}
+	in <- &banexg.Trade{Symbol: "BTC/USDT", Side: banexg.OdSideBuy, Price: 10, Amount: 1, Timestamp: baseMS + 1000}
+	in <- &banexg.Trade{Symbol: "BTC/USDT", Side: banexg.OdSideSell, Price: 12, Amount: 2, Timestamp: baseMS + 9000}
+	in <- &banexg.Trade{Symbol: "BTC/USDT", Side: banexg.OdSideBuy, Price: 11, Amount: 1, Timestamp: baseMS + 10000}
+	close(in)
+	var res []*banexg.PairTFKline
+	for k := range out {
+		res = append(res, k)
+	}
+	if len(res) != 2 {
+		t.Fatalf("expect 2 bars, got %d", len(res))
+	}
+	k := res[0]
+	if k.Time != baseMS || k.Open != 10 || k.High != 12 || k.Close != 12 || k.Volume != 3 || k.BuyVolume != 1 ||
+		k.Quote != 34 || k.TradeNum != 2 {
+		t.Fatalf("trade bar wrong: %+v", *k)
+	}
+	if res[1].Time != baseMS+10000 || res[1].Volume != 1 {
+		t.Fatalf("last bar wrong: %+v", *res[1])
+	}
+}
+
+func TestSession(t *testing.T) {
+	market := &banexg.Market{
+		DayTimes:   [][2]int64{{60 * 60000, 135 * 60000}, {150 * 60000, 210 * 60000}, {330 * 60000, 420 * 60000}},
+		NightTimes: [][2]int64{{13 * 60 * 60000, 15 * 60 * 60000}},
+	}
+	r, err := NewSession("1h", market)
+	if err != nil {
+		t.Fatalf("new session fail: %v", err)
+	}
+	// 02:00-02:15 is cut by session end, next bar starts at 02:30
+	start, end := r.bucket(baseMS + 125*60000)
+	if start != baseMS+120*60000 || end != baseMS+135*60000 {
+		t.Fatalf("bucket wrong: %v %v", start-baseMS, end-baseMS)
+	}
+	start, _ = r.bucket(baseMS + 160*60000)
+	if start != baseMS+150*60000 {
+		t.Fatalf("bucket should start at session: %v", start-baseMS)
+	}
+	d, _ := NewSession("1d", market)
+	// friday night belongs to monday
+	friNight := baseMS + 4*msecsDay + 14*60*60000
+	start, _ = d.bucket(friNight)
+	if start != baseMS+7*msecsDay {
+		t.Fatalf("friday night should belong to monday, got %v", (start-baseMS)/msecsDay)
+	}
+	start, _ = d.bucket(baseMS + 2*60*60000)
+	if start != baseMS {
+		t.Fatalf("day session should belong to same day")
+	}
+}
@@ -0,0 +1,284 @@
+package banexg
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	"github.com/banbox/banexg/errs"
+	"github.com/banbox/banexg/log"
+	"github.com/banbox/banexg/utils"
+	"github.com/sasha-s/go-deadlock"
+	"go.uber.org/zap"
+)
+
+const defStreamQueueSize = 1000
+
+/*
+StreamHandlers
+callback based alternative to Watch* channels. Each On* call watches its own channel, and handlers run on a pool of
+workers. Messages of the same symbol are always handled by the same worker, so they are handled in order.
+When a worker is busy, its queue (QueueSize) fills and then the Watch chan, where ParamChanPolicy of params applies.
+When the Watch chan is closed (e.g. websocket reconnects), it's watched again with backoff until Stop.
+基于回调的Watch*替代方式。每次On*调用监听独立的通道，回调在工作池中执行。同一品种的消息总由同一工作协程按顺序处理。
+工作协程繁忙时先填满其队列（QueueSize），再填满Watch通道，此时按params中的ParamChanPolicy处理。
+Watch通道关闭时（如websocket重连），以退避方式重新订阅直到Stop
+*/
+type StreamHandlers struct {
+	Exg       BanExchange
+	Workers   int
+	QueueSize int // buffered tasks per worker
+	// OnError is called when watching again after the chan closed fails, it's retried later
+	OnError func(sub *StreamSub, err *errs.Error)
+
+	queues  []chan func()
+	subs    map[int]*StreamSub
+	lastID  int
+	readers sync.WaitGroup
+	workers sync.WaitGroup
+	lock    deadlock.Mutex
+	closed  bool
+}
+
+/*
+StreamSub
+a subscription registered by StreamHandlers.On*, call Stop to unwatch
+StreamHandlers.On*注册的订阅，调用Stop取消
+*/
+type StreamSub struct {
+	ID      int
+	h       *StreamHandlers
+	unwatch func(params map[string]interface{}) *errs.Error
+	out     interface{}
+	params  map[string]interface{}
+	stop    chan struct{}
+	once    sync.Once
+	stopped bool
+	lock    deadlock.Mutex // guard out, params and stopped, as out is replaced when watching again
+}
+
+/*
+NewStreamHandlers
+create handlers of exg with workers goroutines, 4 if workers<=0
+为exg创建回调处理器，工作协程数为workers，<=0时为4
+*/
+func NewStreamHandlers(exg BanExchange, workers int) *StreamHandlers {
+	if workers <= 0 {
+		workers = 4
+	}
+	return &StreamHandlers{
+		Exg:       exg,
+		Workers:   workers,
+		QueueSize: defStreamQueueSize,
+		subs:      make(map[int]*StreamSub),
+	}
+}
+
+// start workers on first subscription, should be called with lock held
+func (h *StreamHandlers) start() {
+	if h.queues != nil {
+		return
+	}
+	h.queues = make([]chan func(), h.Workers)
+	for i := range h.queues {
+		queue := make(chan func(), h.QueueSize)
+		h.queues[i] = queue
+		h.workers.Add(1)
+		go func() {
+			defer h.workers.Done()
+			for task := range queue {
+				task()
+			}
+		}()
+	}
+}
+
+// OnOrderBook call handler with order books of symbols 以symbols的订单簿调用handler
+func (h *StreamHandlers) OnOrderBook(symbols []string, limit int, handler func(*OrderBook), params map[string]interface{}) (*StreamSub, *errs.Error) {
+	return subscribeStream(h, params, func(p map[string]interface{}) (chan *OrderBook, *errs.Error) {
+		return h.Exg.WatchOrderBooks(symbols, limit, p)
+	}, func(p map[string]interface{}) *errs.Error {
+		return h.Exg.UnWatchOrderBooks(symbols, p)
+	}, func(b *OrderBook) string { return b.Symbol }, handler)
+}
+
+// OnKline call handler with klines of jobs, job is [symbol, timeframe] 以jobs的K线调用handler，job为[品种, 周期]
+func (h *StreamHandlers) OnKline(jobs [][2]string, handler func(*PairTFKline), params map[string]interface{}) (*StreamSub, *errs.Error) {
+	return subscribeStream(h, params, func(p map[string]interface{}) (chan *PairTFKline, *errs.Error) {
+		return h.Exg.WatchOHLCVs(jobs, p)
+	}, func(p map[string]interface{}) *errs.Error {
+		return h.Exg.UnWatchOHLCVs(jobs, p)
+	}, func(k *PairTFKline) string { return k.Symbol }, handler)
+}
+
+// OnTrade call handler with public trades of symbols 以symbols的公共成交调用handler
+func (h *StreamHandlers) OnTrade(symbols []string, handler func(*Trade), params map[string]interface{}) (*StreamSub, *errs.Error) {
+	return subscribeStream(h, params, func(p map[string]interface{}) (chan *Trade, *errs.Error) {
+		return h.Exg.WatchTrades(symbols, p)
+	}, func(p map[string]interface{}) *errs.Error {
+		return h.Exg.UnWatchTrades(symbols, p)
+	}, func(t *Trade) string { return t.Symbol }, handler)
+}
+
+// OnMarkPrices call handler with mark prices (symbol: price), all on one worker 以标记价格(品种: 价格)调用handler，均在同一工作协程
+func (h *StreamHandlers) OnMarkPrices(symbols []string, handler func(map[string]float64), params map[string]interface{}) (*StreamSub, *errs.Error) {
+	return subscribeStream(h, params, func(p map[string]interface{}) (chan map[string]float64, *errs.Error) {
+		return h.Exg.WatchMarkPrices(symbols, p)
+	}, func(p map[string]interface{}) *errs.Error {
+		return h.Exg.UnWatchMarkPrices(symbols, p)
+	}, func(map[string]float64) string { return "markPrice" }, handler)
+}
+
+func subscribeStream[T any](h *StreamHandlers, params map[string]interface{},
+	watch func(map[string]interface{}) (chan T, *errs.Error), unwatch func(map[string]interface{}) *errs.Error,
+	keyOf func(T) string, handler func(T)) (*StreamSub, *errs.Error) {
+	args := utils.SafeParams(params)
+	out, err := watch(args)
+	if err != nil {
+		return nil, err
+	}
+	h.lock.Lock()
+	if h.closed {
+		h.lock.Unlock()
+		_ = unwatchStream(unwatch, args, out)
+		return nil, errs.NewMsg(errs.CodeRunTime, "StreamHandlers closed")
+	}
+	h.start()
+	h.lastID += 1
+	sub := &StreamSub{
+		ID:      h.lastID,
+		h:       h,
+		unwatch: unwatch,
+		out:     out,
+		params:  args,
+		stop:    make(chan struct{}),
+	}
+	h.subs[sub.ID] = sub
+	h.readers.Add(1)
+	h.lock.Unlock()
+	go func() {
+		defer h.readers.Done()
+		defer h.remove(sub.ID)
+		for {
+			select {
+			case <-sub.stop:
+				return
+			case msg, ok := <-out:
+				if !ok {
+					if out = rewatchStream(sub, params, watch); out == nil {
+						return
+					}
+					continue
+				}
+				key := keyOf(msg)
+				task := func() {
+					defer func() {
+						if r := recover(); r != nil {
+							log.Error("stream handler panic", zap.String("key", key), zap.Any("err", r))
+						}
+					}()
+					handler(msg)
+				}
+				select {
+				case h.queues[workerIndex(key, len(h.queues))] <- task:
+				case <-sub.stop:
+					return
+				}
+			}
+		}
+	}()
+	return sub, nil
+}
+
+/*
+rewatchStream watch again with backoff after the chan closed, return nil if the sub is stopped
+通道关闭后以退避方式重新订阅，订阅已停止时返回nil
+*/
+func rewatchStream[T any](sub *StreamSub, params map[string]interface{}, watch func(map[string]interface{}) (chan T, *errs.Error)) chan T {
+	log.Warn("stream chan closed, rewatch", zap.Int("id", sub.ID))
+	var args map[string]interface{}
+	out := rewatch(sub.stop, fmt.Sprintf("stream/%d", sub.ID), func() (chan T, *errs.Error) {
+		args = utils.SafeParams(params)
+		res, err := watch(args)
+		if err != nil && sub.h.OnError != nil {
+			sub.h.OnError(sub, err)
+		}
+		return res, err
+	})
+	if out == nil {
+		return nil
+	}
+	sub.lock.Lock()
+	stopped := sub.stopped
+	if !stopped {
+		sub.out, sub.params = out, args
+	}
+	sub.lock.Unlock()
+	if stopped {
+		// Stop has unwatched the old chan
+		_ = unwatchStream(sub.unwatch, args, out)
+		return nil
+	}
+	return out
+}
+
+func workerIndex(key string, num int) int {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(key))
+	return int(hash.Sum32() % uint32(num))
+}
+
+func unwatchStream(unwatch func(map[string]interface{}) *errs.Error, params map[string]interface{}, out interface{}) *errs.Error {
+	args := utils.SafeParams(params)
+	args[ParamWatchChan] = out
+	return unwatch(args)
+}
+
+func (h *StreamHandlers) remove(id int) {
+	h.lock.Lock()
+	delete(h.subs, id)
+	h.lock.Unlock()
+}
+
+/*
+Stop unwatch the stream and stop calling the handler, queued messages are still handled
+取消订阅并停止调用handler，已排队的消息仍会处理
+*/
+func (s *StreamSub) Stop() *errs.Error {
+	var err *errs.Error
+	s.once.Do(func() {
+		s.lock.Lock()
+		s.stopped = true
+		out, params := s.out, s.params
+		s.lock.Unlock()
+		close(s.stop)
+		err = unwatchStream(s.unwatch, params, out)
+	})
+	return err
+}
+
+/*
+Close stop all subscriptions, wait until messages queued to workers are handled and workers exit.
+Messages still in Watch chans are dropped.
+停止所有订阅，等待已进入工作队列的消息处理完成、工作协程退出。仍在Watch通道中的消息被丢弃
+*/
+func (h *StreamHandlers) Close() {
+	h.lock.Lock()
+	if h.closed {
+		h.lock.Unlock()
+		return
+	}
+	h.closed = true
+	subs := utils.ValsOfMap(h.subs)
+	h.lock.Unlock()
+	for _, sub := range subs {
+		if err := sub.Stop(); err != nil {
+			log.Warn("unwatch stream fail", zap.Int("id", sub.ID), zap.String("err", err.Short()))
+		}
+	}
+	h.readers.Wait()
+	for _, queue := range h.queues {
+		close(queue)
+	}
+	h.workers.Wait()
+}
@@ -0,0 +1,196 @@
+package banexg
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/banbox/banexg/errs"
+)
+
+type streamExg struct {
+	*Exchange
+	fails int // number of WatchOrderBooks calls to fail
+	lock  sync.Mutex
+}
+
+func (e *streamExg) WatchOrderBooks(symbols []string, limit int, params map[string]interface{}) (chan *OrderBook, *errs.Error) {
+	e.lock.Lock()
+	if e.fails > 0 {
+		e.fails -= 1
+		e.lock.Unlock()
+		return nil, errs.NewMsg(errs.CodeNetFail, "watch fail")
+	}
+	e.lock.Unlock()
+	create := func(c int) chan *OrderBook { return make(chan *OrderBook, c) }
+	return GetWsOutChan(e.Exchange, "depth", create, params, symbols...), nil
+}
+
+func (e *streamExg) UnWatchOrderBooks(symbols []string, params map[string]interface{}) *errs.Error {
+	e.ReleaseWsRefs("depth", params, symbols...)
+	return nil
+}
+
+func newStreamExg() *streamExg {
+	return &streamExg{Exchange: &Exchange{
+		ExgInfo:    &ExgInfo{ID: "test"},
+		WsOutChans: map[string][]*WsHandle{},
+		WsChanRefs: map[string]map[string]int{},
+	}}
+}
+
+func waitUntil(t *testing.T, check func() bool) {
+	t.Helper()
+	for i := 0; i < 200; i++ {
+		if check() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("wait timeout")
+}
+
+func TestStreamHandlersOrder(t *testing.T) {
+	exg := newStreamExg()
+	h := NewStreamHandlers(exg, 3)
+	var lock sync.Mutex
+	got := map[string][]int64{}
+	symbols := []string{"BTC", "ETH", "SOL", "XRP"}
+	_, err := h.OnOrderBook(symbols, 0, func(b *OrderBook) {
+		if b.Symbol == "ETH" {
+			time.Sleep(time.Millisecond)
+		}
+		if b.Nonce == 5 {
+			panic("handler fail")
+		}
+		lock.Lock()
+		got[b.Symbol] = append(got[b.Symbol], b.Nonce)
+		lock.Unlock()
+	}, map[string]interface{}{ParamChanCap: 1000})
+	if err != nil {
+		t.Fatalf("OnOrderBook fail: %v", err)
+	}
+	for i := int64(1); i <= 20; i++ {
+		for _, sym := range symbols {
+			WriteOutChan(exg.Exchange, "depth", &OrderBook{Symbol: sym, Nonce: i}, false)
+		}
+	}
+	waitUntil(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(got["BTC"])+len(got["ETH"])+len(got["SOL"])+len(got["XRP"]) == 76
+	})
+	h.Close()
+	for _, sym := range symbols {
+		items := got[sym]
+		if len(items) != 19 {
+			t.Fatalf("%s expect 19 books, got %d", sym, len(items))
+		}
+		for i := 1; i < len(items); i++ {
+			if items[i] <= items[i-1] {
+				t.Fatalf("%s handled out of order: %v", sym, items)
+			}
+		}
+	}
+	if _, ok := exg.WsOutChans["depth"]; ok {
+		t.Fatalf("Close should unwatch streams")
+	}
+	if _, err = h.OnOrderBook(symbols, 0, func(*OrderBook) {}, nil); err == nil {
+		t.Fatalf("closed handlers should not accept subscription")
+	}
+}
+
+func TestStreamSubStop(t *testing.T) {
+	exg := newStreamExg()
+	h := NewStreamHandlers(exg, 2)
+	defer h.Close()
+	var lock sync.Mutex
+	counts := map[string]int{}
+	add := func(name string) func(*OrderBook) {
+		return func(*OrderBook) {
+			lock.Lock()
+			counts[name] += 1
+			lock.Unlock()
+		}
+	}
+	getCount := func(name string) int {
+		lock.Lock()
+		defer lock.Unlock()
+		return counts[name]
+	}
+	subA, err := h.OnOrderBook([]string{"BTC"}, 0, add("a"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = h.OnOrderBook([]string{"BTC"}, 0, add("b"), nil); err != nil {
+		t.Fatal(err)
+	}
+	WriteOutChan(exg.Exchange, "depth", &OrderBook{Symbol: "BTC"}, true)
+	waitUntil(t, func() bool { return getCount("a") == 1 && getCount("b") == 1 })
+	if err = subA.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if exg.WsChanRefs["depth"]["BTC"] != 1 {
+		t.Fatalf("stop should only release refs of its own watch")
+	}
+	WriteOutChan(exg.Exchange, "depth", &OrderBook{Symbol: "BTC"}, true)
+	waitUntil(t, func() bool { return getCount("b") == 2 })
+	if getCount("a") != 1 {
+		t.Fatalf("stopped handler should not be called")
+	}
+}
+
+func TestStreamSubRewatch(t *testing.T) {
+	oldMin := rewatchMinWait
+	rewatchMinWait = time.Millisecond * 5
+	defer func() { rewatchMinWait = oldMin }()
+	exg := newStreamExg()
+	h := NewStreamHandlers(exg, 2)
+	defer h.Close()
+	var lock sync.Mutex
+	num, errNum := 0, 0
+	h.OnError = func(sub *StreamSub, err *errs.Error) {
+		lock.Lock()
+		errNum += 1
+		lock.Unlock()
+	}
+	getNum := func() (int, int) {
+		lock.Lock()
+		defer lock.Unlock()
+		return num, errNum
+	}
+	sub, err := h.OnOrderBook([]string{"BTC"}, 0, func(*OrderBook) {
+		lock.Lock()
+		num += 1
+		lock.Unlock()
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// chan closed like a websocket reconnect, the first rewatch fails
+	exg.lock.Lock()
+	exg.fails = 1
+	exg.lock.Unlock()
+	exg.lockOutChan.Lock()
+	for _, hd := range exg.WsOutChans["depth"] {
+		hd.close()
+	}
+	delete(exg.WsOutChans, "depth")
+	exg.lockOutChan.Unlock()
+	waitUntil(t, func() bool {
+		exg.lockOutChan.Lock()
+		defer exg.lockOutChan.Unlock()
+		return len(exg.WsOutChans["depth"]) == 1
+	})
+	if _, n := getNum(); n != 1 {
+		t.Fatalf("OnError should be called once, got %d", n)
+	}
+	WriteOutChan(exg.Exchange, "depth", &OrderBook{Symbol: "BTC"}, true)
+	waitUntil(t, func() bool { n, _ := getNum(); return n == 1 })
+	if err = sub.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := exg.WsOutChans["depth"]; ok {
+		t.Fatalf("stop should unwatch the new chan")
+	}
+}
@@ -2,10 +2,12 @@ package banexg
 
 import (
 	"compress/gzip"
+	"context"
 	"encoding/gob"
 	"net/http"
 	"net/url"
 	"os"
+	"sync"
 
 	"github.com/banbox/banexg/errs"
 	"github.com/sasha-s/go-deadlock"
@@ -29,9 +31,22 @@ type FuncGetWsJob = func(client *WsClient) (*WsJobInfo, *errs.Error)
 type FuncCalcRateLimiterCost = func(api *Entry, params map[string]interface{}) float64
 type FuncMapApiError = func(api *Entry, status int, content string) *errs.Error
 
+// RoundTrip send a signed request(req.Error is set when sign fail) and return the mapped response
+type RoundTrip = func(ctx context.Context, api *Entry, req *HttpReq) *HttpRes
+
+// Interceptor wrap a RoundTrip, used for audits, custom headers, latency measurement or fault injection
+type Interceptor = func(next RoundTrip) RoundTrip
+
 // key: acc@url#marketType@method
 type FuncOnWsChan = func(key string, out interface{})
 
+type FuncAfterWsReCon = func(client *WsClient)
+
+type afterWsReCon struct {
+	id int
+	cb FuncAfterWsReCon
+}
+
 type Exchange struct {
 	*ExgInfo
 	Hosts   *ExgHosts
@@ -52,7 +67,12 @@ type Exchange struct {
 	rateM               deadlock.Mutex // 同步锁
 	CalcRateLimiterCost FuncCalcRateLimiterCost
 	MapApiError         FuncMapApiError
-	WsTimeout           int64 // websocket msg timeout in milliseconds
+	Interceptors        []Interceptor   // http middlewares for RequestApi, the first is the outermost; add by Use
+	Metrics             MetricsHook     // receive health events, DefMetrics is used if nil
+	Clock               Clock           // source of MilliSeconds, WallClock is used if nil
+	Breaker             *CircuitBreaker // fail fast for unhealthy hosts and endpoints, disabled if nil
+	DecimalMode         bool            // set Dec of Order/Position/Asset/Kline with exact values
+	WsTimeout           int64           // websocket msg timeout in milliseconds
 	WsChecking          bool
 
 	MarketsWait chan interface{} // whether is loading markets
@@ -63,30 +83,43 @@ type Exchange struct {
 	TimeFrames  map[string]string // map timeframe from common to specific
 	CurrCodeMap map[string]string // common code maps
 
-	Retries map[string]int // retry nums for methods
+	Retries    map[string]int // retry nums for methods
+	CacheStore *StatsCache    // backend for Entry.CacheSecs, nil for the default file store
 
 	TimeDelay  int64 // 系统时钟延迟的毫秒数
 	HttpClient *http.Client
 	NetDisable bool
 
-	WSClients  map[string]*WsClient           // accName@url: websocket clients
-	WsIntvs    map[string]int                 // milli secs interval for ws endpoints
-	WsOutChans map[string]interface{}         // accName@url+msgHash: chan Type
-	WsChanRefs map[string]map[string]struct{} // accName@url+msgHash: symbols use this chan
-
-	WsCache     []*WsLog // websocket cache logs waiting for replay/dump
-	WsNextMS    int64    // timestamp of next replay log
-	WsReplayTo  int64    // timestamp of latest replay log
-	WsFile      *os.File // file to replay/dump
-	WsWriter    *gzip.Writer
-	WsEncoder   *gob.Encoder
-	WsReader    *gzip.Reader
-	WsDecoder   *gob.Decoder
+	WSClients  map[string]*WsClient      // accName@url: websocket clients, guarded by lockWsClients
+	WsIntvs    map[string]int            // milli secs interval for ws endpoints
+	WsOutChans map[string][]*WsHandle    // accName@url+msgHash: handles of Watch* calls, messages fan out to all
+	WsChanRefs map[string]map[string]int // accName@url+msgHash: symbols: number of handles referencing it
+
+	WsCache     []*WsLog      // websocket cache logs waiting for replay/dump
+	WsNextMS    int64         // timestamp of next replay log
+	WsReplayTo  int64         // timestamp of latest replay log
+	WsDumper    *WsDumpWriter // set by SetDump
+	WsReplayer  *WsDumpReader // set by SetReplay
+	clockBak    Clock         // Clock before SetReplay, restored when replay stops
 	WsBatchSize int
 	WsReplayFn  map[string]func(item *WsLog) *errs.Error
 	wsCacheLock deadlock.Mutex
-	lockWsRef   deadlock.Mutex
-	lockOutChan deadlock.Mutex
+
+	ApiFile    *os.File // file to dump REST records
+	ApiWriter  *gzip.Writer
+	ApiEncoder *gob.Encoder
+	ApiReplays map[string][]*ApiLog // key: recorded REST responses waiting for replay
+	apiLock    deadlock.Mutex
+
+	lockWsRef     deadlock.Mutex
+	lockOutChan   deadlock.Mutex
+	lockOutDrop   deadlock.Mutex
+	lockStale     deadlock.Mutex
+	lockWsClients deadlock.Mutex
+	staleStop     chan struct{} // stop the loop reporting OnSubsStale, nil if not started
+
+	wsHandleID int              // last id of WsHandle
+	wsOutDrops map[string]int64 // chanKey: number of dropped messages
 
 	KeyTimeStamps map[string]int64 // key: int64 更新的时间戳
 
@@ -105,6 +138,11 @@ type Exchange struct {
 	OnWsReCon FuncOnWsReCon
 	OnWsChan  FuncOnWsChan
 
+	afterWsReCons []afterWsReCon // user callbacks after websocket reconnected
+	reConID       int
+	lockReCon     deadlock.Mutex
+	lockIntercept deadlock.Mutex // guard Interceptors
+
 	Flags map[string]string
 }
 
@@ -115,6 +153,8 @@ type ExgInfo struct {
 	NoHoliday bool     // true表示365天全年开放
 	FullDay   bool     // true表示一天24小时可交易
 	Min1mHole int      // 1分钟K线空洞的最小间隔，少于此认为正常无交易而非空洞
+	KlinePage int      // FetchOHLCVRange每次请求的最大K线数，0时为500
+	KlineBack bool     // FetchOHLCVRange是否通过ParamUntil从结束时间向前分页
 	FixedLvg  bool     // 杠杆倍率是否固定不可修改
 
 	DebugWS  bool // 是否输出WS调试信息
@@ -419,6 +459,18 @@ type Kline struct {
 	Quote     float64 // volume in quote
 	BuyVolume float64 // taker buy volume
 	TradeNum  int64
+	Dec       *KlineDec // exact values, only for OptDecimal
+}
+
+/*
+KlineRange
+result of FetchOHLCVRange, Holes are [start, end) ranges in milliseconds without klines,
+longer than ExgInfo.Min1mHole minutes
+FetchOHLCVRange的结果，Holes是超过ExgInfo.Min1mHole分钟的无K线区间[start, end)，毫秒
+*/
+type KlineRange struct {
+	Klines []*Kline
+	Holes  [][2]int64
 }
 
 type PairTFKline struct {
@@ -444,6 +496,7 @@ type Asset struct {
 	Total float64
 	Debt  float64
 	UPol  float64
+	Dec   *AssetDec // exact values, only for OptDecimal
 }
 
 type Position struct {
@@ -470,6 +523,7 @@ type Position struct {
 	MarginRatio      float64                `json:"marginRatio"`
 	Percentage       float64                `json:"percentage"` // 未实现盈亏百分比
 	Info             map[string]interface{} `json:"info"`
+	Dec              *PositionDec           `json:"dec,omitempty"` // exact values, only for OptDecimal
 }
 
 type Order struct {
@@ -500,6 +554,7 @@ type Order struct {
 	ReduceOnly          bool                   `json:"reduceOnly"`
 	Trades              []*Trade               `json:"trades"`
 	Fee                 *Fee                   `json:"fee"`
+	Dec                 *OrderDec              `json:"dec,omitempty"` // exact values, only for OptDecimal
 }
 
 type Trade struct {
@@ -535,6 +590,7 @@ type Fee struct {
 	Cost      float64 `json:"cost"`
 	QuoteCost float64 `json:"quote_cost"`
 	Rate      float64 `json:"rate,omitempty"`
+	Dec       *FeeDec `json:"dec,omitempty"`
 }
 
 type OrderBook struct {
@@ -549,15 +605,22 @@ type OrderBook struct {
 
 /*
 OdBookSide
-On one side of the order book. No need to add a lock, as only one goroutine can be modified
-订单簿一侧。不需要加锁，因为只有一个goroutine可以修改
+On one side of the order book. Levels are kept in a skiplist of pooled nodes, so a delta costs O(log n) without
+moving other levels or allocating. Read levels via Level/Levels/Prices/Sizes; JSON keeps the price/size arrays.
+Lock is a plain RWMutex, as it's taken for every delta batch and read, deadlock detection is too costly here.
+订单簿一侧。档位保存在节点池化的跳表中，每个增量为O(log n)，无需移动其他档位也不分配内存。
+通过Level/Levels/Prices/Sizes读取档位；JSON格式仍为price/size数组。
+Lock为普通读写锁：每批增量和每次读取都会加锁，死锁检测开销过高
 */
 type OdBookSide struct {
-	IsBuy bool      `json:"is_buy"`
-	Price []float64 `json:"price"` // bid: desc   ask: asc
-	Size  []float64 `json:"size"`
-	Depth int       `json:"depth"`
-	Lock  deadlock.Mutex
+	IsBuy  bool // bid: price desc   ask: price asc
+	Depth  int
+	Lock   sync.RWMutex
+	head   bookLevel // sentinel, head.next[0] is the best level
+	path   [bookMaxHeight]*bookLevel
+	count  int
+	height int
+	seed   uint64
 }
 
 type Income struct {
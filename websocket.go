@@ -8,7 +8,6 @@ import (
 	"math/rand"
 	"net/http"
 	"net/url"
-	"reflect"
 	"strconv"
 	"strings"
 	"time"
@@ -306,7 +305,7 @@ func newWsClient(reqUrl, acc string, onMsg FuncOnWsMsg, onErr FuncOnWsErr, onClo
 
 func (e *Exchange) GetClient(wsUrl string, marketType, accName string) (*WsClient, *errs.Error) {
 	clientKey := accName + "@" + wsUrl
-	client, ok := e.WSClients[clientKey]
+	client, ok := e.GetWsClientByKey(clientKey)
 	if ok {
 		conns, lock := client.LockConns()
 		connNum := len(conns)
@@ -339,134 +338,185 @@ func (e *Exchange) GetClient(wsUrl string, marketType, accName string) (*WsClien
 	client.Exg = e
 	client.MarketType = marketType
 	client.Key = clientKey
+	e.lockWsClients.Lock()
 	e.WSClients[clientKey] = client
+	e.lockWsClients.Unlock()
 	if e.CheckWsTimeout != nil && !e.WsChecking {
 		go e.CheckWsTimeout()
 	}
+	e.startSubsStale()
 	return client, nil
 }
 
+// GetWsClientByKey return ws client of accName@url 返回accName@url对应的ws客户端
+func (e *Exchange) GetWsClientByKey(clientKey string) (*WsClient, bool) {
+	e.lockWsClients.Lock()
+	defer e.lockWsClients.Unlock()
+	client, ok := e.WSClients[clientKey]
+	return client, ok
+}
+
+// GetWsClients return a copy of all ws clients, safe to iterate while clients are created
+// 返回所有ws客户端的副本，创建客户端时也可安全遍历
+func (e *Exchange) GetWsClients() []*WsClient {
+	e.lockWsClients.Lock()
+	defer e.lockWsClients.Unlock()
+	res := make([]*WsClient, 0, len(e.WSClients))
+	for _, client := range e.WSClients {
+		res = append(res, client)
+	}
+	return res
+}
+
 /*
 GetWsOutChan
-获取指定msgHash的输出通道
-如果不存在则创建新的并存储
+create a new output chan for a Watch* call and register it as a handle of chanKey, messages of chanKey fan out
+to all handles. refKeys (usually symbols) are referenced by the handle until released by ReleaseWsRefs.
+为一次Watch*调用创建新的输出通道，并注册为chanKey的句柄，chanKey的消息分发到所有句柄。
+refKeys（通常为品种）由此句柄引用，直到ReleaseWsRefs释放
 */
-func GetWsOutChan[T any](e *Exchange, chanKey string, create func(int) T, args map[string]interface{}) T {
+func GetWsOutChan[T any](e *Exchange, chanKey string, create func(int) T, args map[string]interface{}, refKeys ...string) T {
+	chanCap := utils.PopMapVal(args, ParamChanCap, 100)
+	policy := utils.PopMapVal(args, ParamChanPolicy, "")
+	timeoutMS := utils.PopMapVal(args, ParamChanTimeout, 0)
+	res := create(chanCap)
 	e.lockOutChan.Lock()
-	outRaw, oldChan := e.WsOutChans[chanKey]
+	e.wsHandleID += 1
+	handle := newWsHandle(e.wsHandleID, chanKey, res)
+	handle.setPolicy(policy, timeoutMS)
+	e.WsOutChans[chanKey] = append(e.WsOutChans[chanKey], handle)
+	e.addHandleRefs(handle, refKeys...)
 	e.lockOutChan.Unlock()
-	if oldChan {
-		res := outRaw.(T)
-		return res
-	} else {
-		chanCap := utils.PopMapVal(args, ParamChanCap, 100)
-		res := create(chanCap)
-		e.lockOutChan.Lock()
-		e.WsOutChans[chanKey] = res
-		e.lockOutChan.Unlock()
-		if e.OnWsChan != nil {
-			e.OnWsChan(chanKey, res)
-		}
-		return res
+	if e.OnWsChan != nil {
+		e.OnWsChan(chanKey, res)
 	}
+	return res
 }
 
+/*
+WriteOutChan
+write msg to the handles of chanKey referencing its symbol (see WsHandle.route).
+When a chan is full, ParamChanPolicy of the handle is applied, or drop the oldest message if popIfNeed, otherwise drop msg. Return whether msg is written to any handle.
+将msg写入chanKey中引用其品种的句柄。通道满时按句柄的ParamChanPolicy处理，未设置时popIfNeed为true丢弃最早消息，否则丢弃msg。
+返回是否写入了任一句柄
+*/
 func WriteOutChan[T any](e *Exchange, chanKey string, msg T, popIfNeed bool) bool {
-	// Keep lock held during send so DelWsChanRefs can't close the channel concurrently.
+	// Keep lock held during send so ReleaseWsRefs can't close the channel concurrently.
 	// Otherwise, we can panic with "send on closed channel" under unsubscribe races.
 	e.lockOutChan.Lock()
-	outRaw, outOk := e.WsOutChans[chanKey]
-	if !outOk {
+	handles := e.WsOutChans[chanKey]
+	if len(handles) == 0 {
 		e.lockOutChan.Unlock()
 		return false
 	}
-	out, ok := outRaw.(chan T)
-	if !ok {
-		e.lockOutChan.Unlock()
-		log.Error("out chan type error", zap.String("k", chanKey))
-		return false
+	defPolicy := ChanPolicyDropNewest
+	if popIfNeed {
+		defPolicy = ChanPolicyDropOldest
 	}
-	select {
-	case out <- msg:
-		e.lockOutChan.Unlock()
-		return true
-	default:
-		if !popIfNeed {
-			e.lockOutChan.Unlock()
-			log.Error("out chan full", zap.String("k", chanKey))
-			return false
-		}
-		// chan通道满了，弹出最早的消息，重新发送
-		<-out
-		out <- msg
-		e.lockOutChan.Unlock()
-		return true
+	written, dropNum, fullNum := false, 0, 0
+	var waits []*WsHandle
+	var waitMsgs []T
+	for _, h := range handles {
+		out, ok := h.Out.(chan T)
+		if !ok {
+			log.Error("out chan type error", zap.String("k", chanKey))
+			continue
+		}
+		val, ok := h.route(msg)
+		if !ok {
+			continue
+		}
+		hMsg := val.(T)
+		policy := h.Policy
+		if policy == "" {
+			policy = defPolicy
+		}
+		ok, drops, wait := writeOutHandle(out, hMsg, policy)
+		if wait {
+			waits = append(waits, h)
+			waitMsgs = append(waitMsgs, hMsg)
+			continue
+		}
+		written = written || ok
+		dropNum += drops
+		if policy == ChanPolicyDropNewest && drops > 0 {
+			fullNum += 1
+		}
 	}
+	// wait without the global lock, closing is guarded by the lock of handle
+	e.lockOutChan.Unlock()
+	for i, h := range waits {
+		hMsg := waitMsgs[i]
+		send := func(done <-chan struct{}) bool { return sendOutTimeout(h.Out.(chan T), hMsg, h.Timeout, done) }
+		if h.writeBlock(send) {
+			written = true
+		} else {
+			log.Warn("out chan full, wait timeout", zap.String("k", chanKey), zap.Int("handle", h.ID))
+			dropNum += 1
+		}
+	}
+	if fullNum > 0 {
+		log.Error("out chan full", zap.String("k", chanKey), zap.Int("num", fullNum))
+	}
+	e.addOutChanDrops(chanKey, dropNum)
+	return written
 }
 
+/*
+AddWsChanRefs
+add refKeys to the latest handle of chanKey. Prefer passing refKeys to GetWsOutChan.
+为chanKey最新的句柄添加引用，建议直接传给GetWsOutChan
+*/
 func (e *Exchange) AddWsChanRefs(chanKey string, keys ...string) {
-	e.lockWsRef.Lock()
-	data, ok := e.WsChanRefs[chanKey]
-	if !ok {
-		data = make(map[string]struct{})
-		e.WsChanRefs[chanKey] = data
-	}
-	e.lockWsRef.Unlock()
-	for _, k := range keys {
-		data[k] = struct{}{}
+	e.lockOutChan.Lock()
+	handles := e.WsOutChans[chanKey]
+	if len(handles) > 0 {
+		e.addHandleRefs(handles[len(handles)-1], keys...)
 	}
+	e.lockOutChan.Unlock()
 }
 
+/*
+DelWsChanRefs
+release one reference of keys from the newest handles holding them, return the number of keys still referenced,
+-1 if chanKey not exists
+从持有keys的最新句柄释放一次引用，返回仍被引用的key数量，chanKey不存在时返回-1
+*/
 func (e *Exchange) DelWsChanRefs(chanKey string, keys ...string) int {
-	e.lockWsRef.Lock()
-	data, ok := e.WsChanRefs[chanKey]
-	e.lockWsRef.Unlock()
+	e.lockOutChan.Lock()
+	_, ok := e.WsOutChans[chanKey]
+	e.lockOutChan.Unlock()
 	if !ok {
 		return -1
 	}
-	for _, k := range keys {
-		delete(data, k)
-	}
-	hasNum := len(data)
-	if hasNum == 0 {
-		e.lockOutChan.Lock()
-		if out, ok := e.WsOutChans[chanKey]; ok {
-			val := reflect.ValueOf(out)
-			if val.Kind() == reflect.Chan {
-				val.Close()
-			}
-			delete(e.WsOutChans, chanKey)
-			log.Info("remove chan", zap.String("key", chanKey))
-		}
-		e.lockOutChan.Unlock()
-	}
-	return hasNum
+	e.ReleaseWsRefs(chanKey, nil, keys...)
+	e.lockWsRef.Lock()
+	defer e.lockWsRef.Unlock()
+	return len(e.WsChanRefs[chanKey])
 }
 
 func (e *Exchange) handleWsClientClosed(client *WsClient) int {
 	prefix := client.Prefix("")
 	removeNum := 0
-	e.lockWsRef.Lock()
-	refKeys := utils.KeysOfMap(e.WsChanRefs)
-	e.lockWsRef.Unlock()
-	for _, key := range refKeys {
+	e.lockOutChan.Lock()
+	for key, handles := range e.WsOutChans {
 		if !strings.HasPrefix(key, prefix) {
 			continue
 		}
-		e.lockWsRef.Lock()
-		delete(e.WsChanRefs, key)
-		e.lockWsRef.Unlock()
-		e.lockOutChan.Lock()
-		if out, ok := e.WsOutChans[key]; ok {
-			val := reflect.ValueOf(out)
-			if val.Kind() == reflect.Chan {
-				val.Close()
-			}
-			delete(e.WsOutChans, key)
-			removeNum += 1
+		for _, h := range handles {
+			h.close()
 		}
-		e.lockOutChan.Unlock()
+		delete(e.WsOutChans, key)
+		removeNum += 1
 	}
+	e.lockWsRef.Lock()
+	for key := range e.WsChanRefs {
+		if strings.HasPrefix(key, prefix) {
+			delete(e.WsChanRefs, key)
+		}
+	}
+	e.lockWsRef.Unlock()
+	e.lockOutChan.Unlock()
 	return removeNum
 }
 
@@ -511,8 +561,16 @@ type SubStat struct {
 	Stamps   map[string]int64 // 所有key上次收到消息的时间戳
 }
 
+// milliSeconds current time from the Clock of exchange 从交易所的Clock获取当前时间
+func (c *WsClient) milliSeconds() int64 {
+	if c.Exg != nil {
+		return c.Exg.MilliSeconds()
+	}
+	return bntp.UTCStamp()
+}
+
 func (c *WsClient) GetConnSubStats(timeout int64) map[int]*SubStat {
-	curMS := bntp.UTCStamp()
+	curMS := c.milliSeconds()
 	c.subsLock.Lock()
 	var result = make(map[int]*SubStat)
 	for k, cid := range c.SubscribeKeys {
@@ -535,6 +593,18 @@ func (c *WsClient) GetConnSubStats(timeout int64) map[int]*SubStat {
 	return result
 }
 
+// reportSubsStale report milliseconds since the last message of all subscription keys to hook
+func (c *WsClient) reportSubsStale(hook MetricsHook, exgID string) {
+	curMS := c.milliSeconds()
+	c.subsLock.Lock()
+	defer c.subsLock.Unlock()
+	for k := range c.SubscribeKeys {
+		if stamp := c.SubsKeyStamps[k]; stamp > 0 {
+			hook.OnSubsStale(exgID, k, curMS-stamp)
+		}
+	}
+}
+
 func (c *WsClient) SetSubsKeyStamp(key string, stamp int64) {
 	c.subsLock.Lock()
 	if target, ok := c.subsKeyMap[key]; ok {
@@ -582,7 +652,7 @@ jobID: The task ID of this message uniquely identifies this request 此次消息
 jobInfo: The main information of this task will be used when receiving the task results 此次任务的主要信息，在收到任务结果时使用
 */
 func (c *WsClient) Write(conn *AsyncConn, msg interface{}, info *WsJobInfo) *errs.Error {
-	if conn == nil || c.Exg.WsDecoder != nil {
+	if conn == nil || c.Exg.IsReplay() {
 		// skip write ws msg in replay mode
 		return nil
 	}
@@ -608,7 +678,7 @@ func (c *WsClient) Write(conn *AsyncConn, msg interface{}, info *WsJobInfo) *err
 
 // WriteRaw sends raw bytes without JSON marshaling (e.g., for OKX ping/pong)
 func (c *WsClient) WriteRaw(conn *AsyncConn, data []byte) *errs.Error {
-	if conn == nil || c.Exg.WsDecoder != nil {
+	if conn == nil || c.Exg.IsReplay() {
 		return nil
 	}
 	if c.Debug {
@@ -716,7 +786,7 @@ func (c *WsClient) read(conn *AsyncConn) {
 			}
 		}
 		// skip ws msg in replay mode
-		if c.Exg.WsDecoder == nil {
+		if !c.Exg.IsReplay() {
 			// We cannot start a goroutine for each message here, otherwise it will result in incorrect message processing order
 			// 这里不能对每个消息启动一个goroutine，否则会导致消息处理顺序错误
 			c.Exg.DumpWS("wsMsg", []string{c.URL, c.MarketType, c.AccName, string(msgRaw)})
@@ -815,7 +885,7 @@ func (c *WsClient) UpdateSubs(connID int, isSub bool, keys []string) (string, *A
 			lock.Unlock()
 		}
 		connID = conn.GetID()
-		curMS := bntp.UTCStamp()
+		curMS := c.milliSeconds()
 		c.subsLock.Lock()
 		for _, key := range keys {
 			oldId, ok := c.SubscribeKeys[key]
@@ -870,7 +940,16 @@ func (c *WsClient) HasSubKeyPrefix(prefix string) bool {
 func (c *WsClient) newConn(add bool) (*AsyncConn, *errs.Error) {
 	connID := c.NextConnId
 	conn, err := newWebSocket(connID, c.URL, c.connArgs, func() *errs.Error {
-		return c.OnReConn(c, connID)
+		if c.Exg != nil {
+			if hook := c.Exg.metrics(); hook != nil {
+				hook.OnWsReconnect(c.Exg.ID, c.URL)
+			}
+		}
+		err := c.OnReConn(c, connID)
+		if c.Exg != nil {
+			c.Exg.fireAfterWsReCon(c)
+		}
+		return err
 	})
 	if err != nil {
 		return nil, err
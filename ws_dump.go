@@ -0,0 +1,342 @@
+package banexg
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/banbox/banexg/errs"
+	"github.com/banbox/bntp"
+)
+
+/*
+WsDumpHeader
+The first line of a versioned ws dump, in json.
+The rest of file is blocks, each is a 28 bytes big-endian head followed by gzip compressed json lines of WsLog:
+
+	magic "WSBK" | count uint32 | fromMS int64 | toMS int64 | size uint32 | gzip payload (size bytes)
+
+版本化ws录制文件的第一行，json格式。之后为若干数据块，每块为28字节大端头部+gzip压缩的WsLog json行
+*/
+type WsDumpHeader struct {
+	Format     string            `json:"format"`
+	Version    int               `json:"version"`
+	Exchange   string            `json:"exchange"`
+	MarketType string            `json:"marketType,omitempty"`
+	CreateMS   int64             `json:"createMS"`
+	Meta       map[string]string `json:"meta,omitempty"`
+}
+
+/*
+WsDumpBlock
+time index item of a block in ws dump
+ws录制文件中一个数据块的时间索引
+*/
+type WsDumpBlock struct {
+	Offset int64 // offset of payload 数据起始位置
+	Size   int
+	Count  int
+	FromMS int64
+	ToMS   int64
+}
+
+// WsDumpWriter append WsLog batches to a versioned ws dump
+type WsDumpWriter struct {
+	Header *WsDumpHeader
+	file   *os.File
+}
+
+/*
+WsDumpReader
+read WsLog batches from a ws dump between FromMS and ToMS (0 means no limit).
+Versioned dumps are sought by the time index of blocks; legacy gob dumps are read and filtered sequentially.
+读取FromMS到ToMS（0表示不限）之间的WsLog批次。版本化文件通过数据块时间索引定位；旧版gob文件顺序读取并过滤
+*/
+type WsDumpReader struct {
+	Header *WsDumpHeader // nil for legacy gob dump 旧版gob文件时为nil
+	Blocks []*WsDumpBlock
+	FromMS int64
+	ToMS   int64
+	file   *os.File
+	next   int
+	gz     *gzip.Reader
+	legacy *gob.Decoder
+}
+
+/*
+CreateWsDump
+create a versioned ws dump, or open it to append if it exists. Legacy gob dumps can't be appended.
+创建版本化ws录制文件，已存在时打开追加。旧版gob文件不可追加
+*/
+func CreateWsDump(path string, head *WsDumpHeader) (*WsDumpWriter, *errs.Error) {
+	file, err_ := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err_ != nil {
+		return nil, errs.New(errs.CodeIOWriteFail, err_)
+	}
+	stat, err_ := file.Stat()
+	if err_ != nil {
+		_ = file.Close()
+		return nil, errs.New(errs.CodeIOReadFail, err_)
+	}
+	if stat.Size() > 0 {
+		old, headLen, err := readWsDumpHeader(bufio.NewReader(file))
+		var end int64
+		if err == nil {
+			_, end, err = scanWsBlocks(file, int64(headLen))
+		}
+		if err == nil && end < stat.Size() {
+			// drop the truncated block left by crash before appending
+			if err_ = file.Truncate(end); err_ != nil {
+				err = errs.New(errs.CodeIOWriteFail, err_)
+			}
+		}
+		if err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+		return &WsDumpWriter{Header: old, file: file}, nil
+	}
+	head.Format = wsDumpFormat
+	head.Version = WsDumpVersion
+	if head.CreateMS == 0 {
+		head.CreateMS = bntp.UTCStamp()
+	}
+	data, err_ := json.Marshal(head)
+	if err_ == nil {
+		_, err_ = file.Write(append(data, '\n'))
+	}
+	if err_ != nil {
+		_ = file.Close()
+		return nil, errs.New(errs.CodeIOWriteFail, err_)
+	}
+	return &WsDumpWriter{Header: head, file: file}, nil
+}
+
+// readWsDumpHeader return header and its length in bytes
+func readWsDumpHeader(rd *bufio.Reader) (*WsDumpHeader, int, *errs.Error) {
+	magic, err_ := rd.Peek(2)
+	if err_ != nil {
+		return nil, 0, errs.New(errs.CodeIOReadFail, err_)
+	}
+	if isGzipMagic(magic) {
+		return nil, 0, errs.NewMsg(errs.CodeInvalidData, "legacy gob ws dump")
+	}
+	line, err_ := rd.ReadBytes('\n')
+	if err_ != nil {
+		return nil, 0, errs.New(errs.CodeIOReadFail, err_)
+	}
+	var head WsDumpHeader
+	if err_ = json.Unmarshal(line, &head); err_ != nil || head.Format != wsDumpFormat {
+		return nil, 0, errs.NewMsg(errs.CodeInvalidData, "invalid ws dump header")
+	}
+	if head.Version > WsDumpVersion {
+		return nil, 0, errs.NewMsg(errs.CodeInvalidData, "unsupported ws dump version: %v", head.Version)
+	}
+	return &head, len(line), nil
+}
+
+func isGzipMagic(data []byte) bool {
+	return len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b
+}
+
+// Write append rows as one block
+func (w *WsDumpWriter) Write(rows []*WsLog) *errs.Error {
+	if len(rows) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(gz)
+	fromMS, toMS := rows[0].TimeMS, rows[0].TimeMS
+	for _, row := range rows {
+		if err_ := enc.Encode(row); err_ != nil {
+			return errs.New(errs.CodeMarshalFail, err_)
+		}
+		fromMS = min(fromMS, row.TimeMS)
+		toMS = max(toMS, row.TimeMS)
+	}
+	if err_ := gz.Close(); err_ != nil {
+		return errs.New(errs.CodeIOWriteFail, err_)
+	}
+	head := make([]byte, wsBlockHeadSize, wsBlockHeadSize+buf.Len())
+	copy(head, wsBlockMagic)
+	binary.BigEndian.PutUint32(head[4:], uint32(len(rows)))
+	binary.BigEndian.PutUint64(head[8:], uint64(fromMS))
+	binary.BigEndian.PutUint64(head[16:], uint64(toMS))
+	binary.BigEndian.PutUint32(head[24:], uint32(buf.Len()))
+	// write head and payload at once, so a crash leaves at most one truncated block
+	if _, err_ := w.file.Write(append(head, buf.Bytes()...)); err_ != nil {
+		return errs.New(errs.CodeIOWriteFail, err_)
+	}
+	return nil
+}
+
+func (w *WsDumpWriter) Close() *errs.Error {
+	if err_ := w.file.Close(); err_ != nil {
+		return errs.New(errs.CodeIOWriteFail, err_)
+	}
+	return nil
+}
+
+/*
+OpenWsDump
+open a versioned or legacy ws dump to read logs between fromMS and toMS, 0 means no limit
+打开版本化或旧版ws录制文件，读取fromMS到toMS之间的记录，0表示不限
+*/
+func OpenWsDump(path string, fromMS, toMS int64) (*WsDumpReader, *errs.Error) {
+	file, err_ := os.Open(path)
+	if err_ != nil {
+		return nil, errs.New(errs.CodeIOReadFail, err_)
+	}
+	res := &WsDumpReader{FromMS: fromMS, ToMS: toMS, file: file}
+	rd := bufio.NewReader(file)
+	magic, err_ := rd.Peek(2)
+	if err_ != nil {
+		_ = file.Close()
+		return nil, errs.New(errs.CodeIOReadFail, err_)
+	}
+	if isGzipMagic(magic) {
+		if _, err_ = file.Seek(0, io.SeekStart); err_ == nil {
+			res.gz, err_ = gzip.NewReader(file)
+		}
+		if err_ != nil {
+			_ = file.Close()
+			return nil, errs.New(errs.CodeIOReadFail, err_)
+		}
+		res.legacy = gob.NewDecoder(res.gz)
+		return res, nil
+	}
+	var err *errs.Error
+	var headLen int
+	res.Header, headLen, err = readWsDumpHeader(rd)
+	if err == nil {
+		res.Blocks, _, err = scanWsBlocks(file, int64(headLen))
+	}
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return res, nil
+}
+
+// scanWsBlocks read block heads from offset, return blocks and end of the last complete block
+func scanWsBlocks(file *os.File, offset int64) ([]*WsDumpBlock, int64, *errs.Error) {
+	stat, err_ := file.Stat()
+	if err_ != nil {
+		return nil, 0, errs.New(errs.CodeIOReadFail, err_)
+	}
+	total := stat.Size()
+	head := make([]byte, wsBlockHeadSize)
+	var res []*WsDumpBlock
+	for offset+wsBlockHeadSize <= total {
+		if _, err_ = file.ReadAt(head, offset); err_ != nil {
+			return nil, 0, errs.New(errs.CodeIOReadFail, err_)
+		}
+		if string(head[:4]) != wsBlockMagic {
+			return nil, 0, errs.NewMsg(errs.CodeInvalidData, "bad ws dump block at %v", offset)
+		}
+		blk := &WsDumpBlock{
+			Offset: offset + wsBlockHeadSize,
+			Count:  int(binary.BigEndian.Uint32(head[4:])),
+			FromMS: int64(binary.BigEndian.Uint64(head[8:])),
+			ToMS:   int64(binary.BigEndian.Uint64(head[16:])),
+			Size:   int(binary.BigEndian.Uint32(head[24:])),
+		}
+		if blk.Offset+int64(blk.Size) > total {
+			// truncated by crash
+			break
+		}
+		res = append(res, blk)
+		offset = blk.Offset + int64(blk.Size)
+	}
+	return res, offset, nil
+}
+
+// inRange whether the time is between FromMS and ToMS
+func (r *WsDumpReader) inRange(timeMS int64) bool {
+	return (r.FromMS == 0 || timeMS >= r.FromMS) && (r.ToMS == 0 || timeMS <= r.ToMS)
+}
+
+/*
+Read
+return the next non-empty batch of logs in time range, nil when no more
+返回时间范围内的下一批非空记录，无更多数据时返回nil
+*/
+func (r *WsDumpReader) Read() ([]*WsLog, *errs.Error) {
+	for {
+		rows, done, err := r.readBatch()
+		if err != nil || done {
+			return nil, err
+		}
+		res := rows[:0]
+		for _, row := range rows {
+			if r.inRange(row.TimeMS) {
+				res = append(res, row)
+			}
+		}
+		if len(res) > 0 {
+			return res, nil
+		}
+	}
+}
+
+// readBatch read next raw batch, done is true if reaches the end or ToMS
+func (r *WsDumpReader) readBatch() ([]*WsLog, bool, *errs.Error) {
+	if r.legacy != nil {
+		rows := make([]*WsLog, 0, 64)
+		if err_ := r.legacy.Decode(&rows); err_ != nil {
+			return nil, true, nil
+		}
+		if r.ToMS > 0 && len(rows) > 0 && rows[0].TimeMS > r.ToMS {
+			return nil, true, nil
+		}
+		return rows, false, nil
+	}
+	// blocks are mostly in time order, but may be slightly shuffled by concurrent writes
+	var blk *WsDumpBlock
+	for r.next < len(r.Blocks) && blk == nil {
+		blk = r.Blocks[r.next]
+		r.next++
+		if r.FromMS > 0 && blk.ToMS < r.FromMS || r.ToMS > 0 && blk.FromMS > r.ToMS {
+			blk = nil
+		}
+	}
+	if blk == nil {
+		return nil, true, nil
+	}
+	gz, err_ := gzip.NewReader(io.NewSectionReader(r.file, blk.Offset, int64(blk.Size)))
+	if err_ != nil {
+		return nil, false, errs.New(errs.CodeIOReadFail, err_)
+	}
+	defer gz.Close()
+	rows := make([]*WsLog, 0, blk.Count)
+	dec := json.NewDecoder(gz)
+	for {
+		var row WsLog
+		if err_ = dec.Decode(&row); err_ == io.EOF {
+			break
+		} else if err_ != nil {
+			return nil, false, errs.New(errs.CodeUnmarshalFail, err_)
+		}
+		rows = append(rows, &row)
+	}
+	return rows, false, nil
+}
+
+func (r *WsDumpReader) Close() *errs.Error {
+	if r.gz != nil {
+		_ = r.gz.Close()
+	}
+	if r.file == nil {
+		return nil
+	}
+	if err_ := r.file.Close(); err_ != nil {
+		return errs.New(errs.CodeIOReadFail, err_)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package banexg
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/banbox/banexg/errs"
+)
+
+func makeWsLogs(start, num int64) []*WsLog {
+	res := make([]*WsLog, 0, num)
+	for i := start; i < start+num; i++ {
+		res = append(res, &WsLog{Name: "wsMsg", TimeMS: 1000 + i*10, Content: `["a"]`})
+	}
+	return res
+}
+
+func readAllWsLogs(t *testing.T, path string, fromMS, toMS int64) []*WsLog {
+	t.Helper()
+	rd, err := OpenWsDump(path, fromMS, toMS)
+	if err != nil {
+		t.Fatalf("open dump fail: %v", err)
+	}
+	defer rd.Close()
+	var res []*WsLog
+	for {
+		rows, err := rd.Read()
+		if err != nil {
+			t.Fatalf("read dump fail: %v", err)
+		}
+		if len(rows) == 0 {
+			return res
+		}
+		res = append(res, rows...)
+	}
+}
+
+func TestWsDumpSeek(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ws.dump")
+	w, err := CreateWsDump(path, &WsDumpHeader{Exchange: "binance", MarketType: MarketLinear})
+	if err != nil {
+		t.Fatalf("create dump fail: %v", err)
+	}
+	for i := int64(0); i < 5; i++ {
+		if err = w.Write(makeWsLogs(i*10, 10)); err != nil {
+			t.Fatalf("write fail: %v", err)
+		}
+	}
+	_ = w.Close()
+	// reopen to append
+	w, err = CreateWsDump(path, &WsDumpHeader{Exchange: "okx"})
+	if err != nil {
+		t.Fatalf("reopen dump fail: %v", err)
+	}
+	if w.Header.Exchange != "binance" || w.Header.Version != WsDumpVersion {
+		t.Fatalf("unexpected header: %+v", w.Header)
+	}
+	_ = w.Write(makeWsLogs(50, 10))
+	_ = w.Close()
+
+	rd, err := OpenWsDump(path, 0, 0)
+	if err != nil {
+		t.Fatalf("open fail: %v", err)
+	}
+	if len(rd.Blocks) != 6 || rd.Blocks[2].FromMS != 1200 || rd.Blocks[2].ToMS != 1290 {
+		t.Fatalf("unexpected index: %d blocks", len(rd.Blocks))
+	}
+	_ = rd.Close()
+	if rows := readAllWsLogs(t, path, 0, 0); len(rows) != 60 {
+		t.Fatalf("expect 60 rows, got %d", len(rows))
+	}
+	rows := readAllWsLogs(t, path, 1255, 1420)
+	if len(rows) != 17 || rows[0].TimeMS != 1260 || rows[16].TimeMS != 1420 {
+		t.Fatalf("unexpected range rows: %d", len(rows))
+	}
+}
+
+func TestWsDumpTruncated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ws.dump")
+	w, _ := CreateWsDump(path, &WsDumpHeader{Exchange: "binance"})
+	_ = w.Write(makeWsLogs(0, 10))
+	_ = w.Write(makeWsLogs(10, 10))
+	_ = w.Close()
+	stat, _ := os.Stat(path)
+	if err := os.Truncate(path, stat.Size()-5); err != nil {
+		t.Fatal(err)
+	}
+	if rows := readAllWsLogs(t, path, 0, 0); len(rows) != 10 {
+		t.Fatalf("truncated block should be skipped, got %d rows", len(rows))
+	}
+	w, err := CreateWsDump(path, &WsDumpHeader{})
+	if err != nil {
+		t.Fatalf("reopen fail: %v", err)
+	}
+	_ = w.Write(makeWsLogs(20, 10))
+	_ = w.Close()
+	rows := readAllWsLogs(t, path, 0, 0)
+	if len(rows) != 20 || rows[10].TimeMS != 1200 {
+		t.Fatalf("append after truncated block fail, got %d rows", len(rows))
+	}
+}
+
+func TestWsDumpLegacy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ws_legacy.gz")
+	file, _ := os.Create(path)
+	gz := gzip.NewWriter(file)
+	enc := gob.NewEncoder(gz)
+	for i := int64(0); i < 3; i++ {
+		if err := enc.Encode(makeWsLogs(i*10, 10)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = gz.Close()
+	_ = file.Close()
+	if rows := readAllWsLogs(t, path, 1050, 1150); len(rows) != 11 {
+		t.Fatalf("expect 11 legacy rows, got %d", len(rows))
+	}
+	if _, err := CreateWsDump(path, &WsDumpHeader{}); err == nil {
+		t.Fatalf("legacy dump should not be appended")
+	}
+
+	exg := &Exchange{ExgInfo: &ExgInfo{ID: "test"}}
+	count := 0
+	exg.WsReplayFn = map[string]func(item *WsLog) *errs.Error{
+		"wsMsg": func(item *WsLog) *errs.Error {
+			count++
+			return nil
+		},
+	}
+	if err := exg.SetReplay(path, 1100, 0); err != nil {
+		t.Fatalf("set replay fail: %v", err)
+	}
+	if !exg.IsReplay() {
+		t.Fatalf("should be replay mode")
+	}
+	if err := exg.ReplayAll(); err != nil {
+		t.Fatalf("replay fail: %v", err)
+	}
+	if count != 20 || exg.WsReplayTo != 1290 {
+		t.Fatalf("unexpected replay: count %d, to %d", count, exg.WsReplayTo)
+	}
+	_ = exg.SetReplay("", 0, 0)
+}
@@ -0,0 +1,512 @@
+package banexg
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/banbox/banexg/log"
+	"github.com/banbox/banexg/utils"
+	"github.com/sasha-s/go-deadlock"
+	"go.uber.org/zap"
+)
+
+/*
+Overflow policies of websocket out chans, set by ParamChanPolicy when calling Watch* methods.
+Without ParamChanPolicy, each stream keeps its default: drop oldest for market data, drop newest for account events.
+websocket输出通道满时的处理策略，调用Watch*时通过ParamChanPolicy设置。
+未设置时各数据流使用默认策略：行情数据丢弃最早的，账户事件丢弃最新的
+*/
+const (
+	// ChanPolicyBlock wait until the chan has room or ParamChanTimeout expires, then drop the message
+	// 等待通道有空位，超过ParamChanTimeout后丢弃消息
+	ChanPolicyBlock = "block"
+	// ChanPolicyDropNewest drop the message being written 丢弃正在写入的消息
+	ChanPolicyDropNewest = "dropNewest"
+	// ChanPolicyDropOldest pop the oldest message in chan and write 弹出通道中最早的消息再写入
+	ChanPolicyDropOldest = "dropOldest"
+	/*
+		ChanPolicyConflate keep only the latest message of each symbol in chan. Mark price maps are merged into one;
+		*Ticker, *OrderBook and *PairTFKline are kept by symbol (and timeframe). Other types fall back to dropOldest.
+		通道中每个品种只保留最新消息。标记价格map合并为一个；*Ticker、*OrderBook、*PairTFKline按品种（和周期）保留，其他类型退化为dropOldest
+	*/
+	ChanPolicyConflate = "conflate"
+)
+
+const (
+	ParamChanPolicy  = "ChanPolicy"
+	ParamChanTimeout = "ChanTimeout" // milliseconds to wait for ChanPolicyBlock, default 1000
+	// ParamWatchChan the chan returned by Watch*, pass it to UnWatch* to only release refs of that watch
+	// Watch*返回的通道，传给UnWatch*时只释放此次订阅的引用
+	ParamWatchChan = "WatchChan"
+	// WsRefAll refKey of a handle receiving messages of all symbols 接收所有品种消息的句柄引用key
+	WsRefAll = "*"
+)
+
+const defChanBlockTimeout = time.Second
+
+/*
+WsHandle
+an output chan created by one Watch* call. Messages of ChanKey are routed to the handles referencing their symbol,
+and the refs (usually symbols, or symbol@timeframe) of each handle are counted in Exchange.WsChanRefs,
+so independent consumers can share one subscription.
+一次Watch*调用创建的输出通道。ChanKey的消息分发到引用其品种的句柄，每个句柄的引用（通常为品种或品种@周期）
+计数于Exchange.WsChanRefs，使独立的消费者可共享同一订阅
+*/
+type WsHandle struct {
+	ID      int
+	ChanKey string
+	Out     interface{}   // chan T returned to the caller
+	Policy  string        // overflow policy, empty to use the default of stream
+	Timeout time.Duration // wait timeout for ChanPolicyBlock
+
+	refs   map[string]struct{}
+	syms   map[string]int // symbols of refs, used to route messages
+	closed bool           // guarded by Exchange.lockOutChan
+	done   chan struct{}  // closed first to wake up blocking writers
+	lock   deadlock.Mutex // held by blocking writers, so the chan isn't closed while sending
+}
+
+func newWsHandle(id int, chanKey string, out interface{}) *WsHandle {
+	return &WsHandle{
+		ID:      id,
+		ChanKey: chanKey,
+		Out:     out,
+		refs:    make(map[string]struct{}),
+		syms:    make(map[string]int),
+		done:    make(chan struct{}),
+	}
+}
+
+// refSymbol return the symbol part of refKey like BTC/USDT@1m 返回refKey的品种部分
+func refSymbol(key string) string {
+	if idx := strings.LastIndex(key, "@"); idx > 0 {
+		return key[:idx]
+	}
+	return key
+}
+
+func (h *WsHandle) addRef(key string) bool {
+	if _, ok := h.refs[key]; ok {
+		return false
+	}
+	h.refs[key] = struct{}{}
+	h.syms[refSymbol(key)] += 1
+	return true
+}
+
+func (h *WsHandle) delRef(key string) bool {
+	if _, ok := h.refs[key]; !ok {
+		return false
+	}
+	delete(h.refs, key)
+	sym := refSymbol(key)
+	if h.syms[sym] -= 1; h.syms[sym] <= 0 {
+		delete(h.syms, sym)
+	}
+	return true
+}
+
+/*
+route return the msg to write to the handle, ok is false if the handle doesn't reference the symbol of msg.
+Klines are matched by symbol@timeframe. Mark price maps are filtered to the referenced symbols. Messages without symbol, and handles without refs or
+referencing WsRefAll, receive everything. should be called with lockOutChan held
+返回写入此句柄的消息，句柄未引用msg的品种时ok为false。K线按品种@周期匹配。标记价格map过滤为引用的品种。无品种的消息，
+以及无引用或引用WsRefAll的句柄，接收全部消息。需在持有lockOutChan时调用
+*/
+func (h *WsHandle) route(msg interface{}) (interface{}, bool) {
+	if len(h.syms) == 0 {
+		return msg, true
+	}
+	if _, ok := h.syms[WsRefAll]; ok {
+		return msg, true
+	}
+	if prices, ok := msg.(map[string]float64); ok {
+		var res map[string]float64
+		for sym := range prices {
+			if _, ok := h.syms[sym]; !ok {
+				res = make(map[string]float64, len(h.syms))
+				break
+			}
+		}
+		if res == nil {
+			return msg, true
+		}
+		for sym, price := range prices {
+			if _, ok := h.syms[sym]; ok {
+				res[sym] = price
+			}
+		}
+		return res, len(res) > 0
+	}
+	if k, ok := msg.(*PairTFKline); ok {
+		// klines are routed by symbol@timeframe, a handle doesn't get other timeframes of its symbol
+		_, ok = h.refs[k.Symbol+"@"+k.TimeFrame]
+		return msg, ok
+	}
+	sym, ok := msgSymbol(msg)
+	if !ok {
+		return msg, true
+	}
+	_, ok = h.syms[sym]
+	return msg, ok
+}
+
+func msgSymbol(msg interface{}) (string, bool) {
+	switch v := msg.(type) {
+	case *Trade:
+		return v.Symbol, true
+	case *OrderBook:
+		return v.Symbol, true
+	case *Ticker:
+		return v.Symbol, true
+	}
+	return "", false
+}
+
+func isChanPolicy(policy string) bool {
+	switch policy {
+	case ChanPolicyBlock, ChanPolicyDropNewest, ChanPolicyDropOldest, ChanPolicyConflate:
+		return true
+	}
+	return false
+}
+
+func (h *WsHandle) setPolicy(policy string, timeoutMS int) {
+	if policy == "" {
+		return
+	}
+	if !isChanPolicy(policy) {
+		log.Warn("unknown out chan policy, ignored", zap.String("k", h.ChanKey), zap.String("policy", policy))
+		return
+	}
+	h.Policy = policy
+	h.Timeout = defChanBlockTimeout
+	if timeoutMS > 0 {
+		h.Timeout = time.Duration(timeoutMS) * time.Millisecond
+	}
+}
+
+/*
+close the chan of handle, should be called with lockOutChan held. done is closed before taking the lock of handle,
+so a writer blocked by ChanPolicyBlock returns at once instead of holding the lock until its timeout.
+关闭句柄通道，需在持有lockOutChan时调用。先关闭done再获取句柄锁，使ChanPolicyBlock阻塞的写入方立即返回，而非持锁到超时
+*/
+func (h *WsHandle) close() {
+	if h.closed {
+		return
+	}
+	h.closed = true
+	close(h.done)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	val := reflect.ValueOf(h.Out)
+	if val.Kind() == reflect.Chan {
+		val.Close()
+	}
+}
+
+// writeBlock call send if the handle is not closed, send should return when done is closed 句柄未关闭时调用send
+func (h *WsHandle) writeBlock(send func(done <-chan struct{}) bool) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	select {
+	case <-h.done:
+		return false
+	default:
+	}
+	return send(h.done)
+}
+
+// addHandleRefs should be called with lockOutChan held 需在持有lockOutChan时调用
+func (e *Exchange) addHandleRefs(h *WsHandle, keys ...string) {
+	e.lockWsRef.Lock()
+	defer e.lockWsRef.Unlock()
+	data, ok := e.WsChanRefs[h.ChanKey]
+	if !ok {
+		data = make(map[string]int)
+		e.WsChanRefs[h.ChanKey] = data
+	}
+	for _, k := range keys {
+		if h.addRef(k) {
+			data[k] += 1
+		}
+	}
+}
+
+/*
+ReleaseWsRefs
+release refKeys held by the handle of ParamWatchChan in params. If not given, release one reference of each key
+from the newest handle holding it, so other watchers of the same symbol are kept.
+Handles without refs are closed. Return refKeys released by this call and no longer referenced by any handle,
+which should be unsubscribed. Keys never referenced or already released are not returned.
+释放params中ParamWatchChan对应句柄持有的refKeys。未指定时，每个key只从持有它的最新句柄释放一次引用，
+不影响同品种的其他订阅者。无引用的句柄会被关闭。返回本次释放后不再被任何句柄引用、应取消订阅的refKeys，
+未被引用或已释放的key不会返回
+*/
+func (e *Exchange) ReleaseWsRefs(chanKey string, params map[string]interface{}, refKeys ...string) []string {
+	var target interface{}
+	if params != nil {
+		target = params[ParamWatchChan]
+	}
+	e.lockOutChan.Lock()
+	defer e.lockOutChan.Unlock()
+	e.lockWsRef.Lock()
+	defer e.lockWsRef.Unlock()
+	data := e.WsChanRefs[chanKey]
+	handles := e.WsOutChans[chanKey]
+	res := make([]string, 0, len(refKeys))
+	release := func(h *WsHandle, k string) {
+		if h.delRef(k) {
+			if data[k] -= 1; data[k] <= 0 {
+				delete(data, k)
+				res = append(res, k)
+			}
+		}
+	}
+	for _, k := range refKeys {
+		for i := len(handles) - 1; i >= 0; i-- {
+			h := handles[i]
+			if target != nil {
+				if h.Out == target {
+					release(h, k)
+					break
+				}
+			} else if _, ok := h.refs[k]; ok {
+				release(h, k)
+				break
+			}
+		}
+	}
+	kept := make([]*WsHandle, 0, len(handles))
+	for _, h := range handles {
+		if len(h.refs) == 0 {
+			h.close()
+			continue
+		}
+		kept = append(kept, h)
+	}
+	if len(kept) > 0 {
+		e.WsOutChans[chanKey] = kept
+	} else if len(handles) > 0 {
+		delete(e.WsOutChans, chanKey)
+		log.Info("remove chan", zap.String("key", chanKey))
+	}
+	if data != nil && len(data) == 0 {
+		delete(e.WsChanRefs, chanKey)
+	}
+	return res
+}
+
+/*
+ReleaseWsOut
+release all refs of the handle whose chan is out and close it, for streams without UnWatch* like WatchMyTrades.
+Return false if out is not a chan created by GetWsOutChan of this exchange, or was closed already.
+释放out对应句柄的所有引用并关闭，用于WatchMyTrades等无UnWatch*的流。out不是本交易所GetWsOutChan创建的通道或已关闭时返回false
+*/
+func (e *Exchange) ReleaseWsOut(out interface{}) bool {
+	var chanKey string
+	var refKeys []string
+	e.lockOutChan.Lock()
+	for key, handles := range e.WsOutChans {
+		for _, h := range handles {
+			if h.Out == out {
+				chanKey, refKeys = key, utils.KeysOfMap(h.refs)
+				break
+			}
+		}
+		if chanKey != "" {
+			break
+		}
+	}
+	e.lockOutChan.Unlock()
+	if chanKey == "" {
+		return false
+	}
+	e.ReleaseWsRefs(chanKey, map[string]interface{}{ParamWatchChan: out}, refKeys...)
+	return true
+}
+
+// addOutChanDrops count dropped messages of chanKey 记录chanKey丢弃的消息数
+func (e *Exchange) addOutChanDrops(chanKey string, num int) {
+	if num <= 0 {
+		return
+	}
+	e.lockOutDrop.Lock()
+	if e.wsOutDrops == nil {
+		e.wsOutDrops = make(map[string]int64)
+	}
+	e.wsOutDrops[chanKey] += int64(num)
+	e.lockOutDrop.Unlock()
+	if hook := e.metrics(); hook != nil {
+		for i := 0; i < num; i++ {
+			hook.OnOutChanDrop(e.ID, chanKey)
+		}
+	}
+}
+
+/*
+OutChanDrops
+return the number of dropped messages for each out chan key since start
+返回启动以来每个输出通道key丢弃的消息数
+*/
+func (e *Exchange) OutChanDrops() map[string]int64 {
+	e.lockOutDrop.Lock()
+	defer e.lockOutDrop.Unlock()
+	res := make(map[string]int64, len(e.wsOutDrops))
+	for k, v := range e.wsOutDrops {
+		res[k] = v
+	}
+	return res
+}
+
+/*
+writeOutHandle
+try to write msg to a handle without waiting. wait is true if the handle should be written by sendOutTimeout.
+drops is the number of messages dropped
+尝试不等待地写入句柄，wait为true表示需通过sendOutTimeout写入，drops为丢弃的消息数
+*/
+func writeOutHandle[T any](out chan T, msg T, policy string) (written bool, drops int, wait bool) {
+	select {
+	case out <- msg:
+		return true, 0, false
+	default:
+	}
+	switch policy {
+	case ChanPolicyBlock:
+		return false, 0, true
+	case ChanPolicyDropNewest:
+		return false, 1, false
+	case ChanPolicyConflate:
+		if dropNum, ok := conflateOut(out, msg); ok {
+			return true, dropNum, false
+		}
+	}
+	// chan通道满了，弹出最早的消息，重新发送
+	select {
+	case <-out:
+	default:
+	}
+	select {
+	case out <- msg:
+		return true, 1, false
+	default:
+		// unbuffered chan without consumer 无缓冲通道且无消费者
+		return false, 1, false
+	}
+}
+
+func sendOutTimeout[T any](out chan T, msg T, timeout time.Duration, done <-chan struct{}) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case out <- msg:
+		return true
+	case <-timer.C:
+		return false
+	case <-done:
+		return false
+	}
+}
+
+/*
+conflateOut drain the chan, keep the latest message of each symbol and write back, return the number dropped.
+ok is false if the message type can't be conflated
+清空通道，每个品种保留最新消息后写回，返回丢弃的消息数。消息类型不支持合并时ok为false
+*/
+func conflateOut[T any](out chan T, msg T) (int, bool) {
+	if !canConflate(msg) {
+		return 0, false
+	}
+	items := make([]T, 0, len(out)+1)
+drain:
+	for {
+		select {
+		case v, ok := <-out:
+			if !ok {
+				break drain
+			}
+			items = append(items, v)
+		default:
+			break drain
+		}
+	}
+	items = append(items, msg)
+	res := conflateItems(items)
+	dropNum := len(items) - len(res)
+	for _, v := range res {
+		select {
+		case out <- v:
+		default:
+			// consumer is not reading and chan has no buffer 无缓冲通道且无消费者
+			dropNum += 1
+		}
+	}
+	return dropNum, true
+}
+
+func canConflate(msg interface{}) bool {
+	if _, ok := msg.(map[string]float64); ok {
+		return true
+	}
+	_, ok := conflateKey(msg)
+	return ok
+}
+
+func conflateKey(msg interface{}) (string, bool) {
+	switch v := msg.(type) {
+	case *Ticker:
+		return v.Symbol, true
+	case *OrderBook:
+		return v.Symbol, true
+	case *PairTFKline:
+		return v.Symbol + "_" + v.TimeFrame, true
+	}
+	return "", false
+}
+
+// conflateItems keep the latest item of each key, in the order of their last update
+func conflateItems[T any](items []T) []T {
+	if _, ok := any(items[0]).(map[string]float64); ok {
+		merged := make(map[string]float64)
+		for _, it := range items {
+			for k, v := range any(it).(map[string]float64) {
+				merged[k] = v
+			}
+		}
+		return []T{any(merged).(T)}
+	}
+	visited := make(map[string]bool, len(items))
+	res := make([]T, 0, len(items))
+	for i := len(items) - 1; i >= 0; i-- {
+		key, _ := conflateKey(items[i])
+		if visited[key] {
+			continue
+		}
+		visited[key] = true
+		res = append(res, items[i])
+	}
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+	return res
+}
+
+/*
+PickFreeRefs
+return items whose refKey at the same index is in free, used to unsubscribe only refs released by ReleaseWsRefs
+返回同下标refKey在free中的items，用于只取消ReleaseWsRefs释放的订阅
+*/
+func PickFreeRefs[T any](items []T, refKeys, free []string) []T {
+	freeSet := make(map[string]struct{}, len(free))
+	for _, k := range free {
+		freeSet[k] = struct{}{}
+	}
+	res := make([]T, 0, len(free))
+	for i, k := range refKeys {
+		if _, ok := freeSet[k]; ok && i < len(items) {
+			res = append(res, items[i])
+		}
+	}
+	return res
+}
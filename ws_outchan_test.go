@@ -0,0 +1,255 @@
+package banexg
+
+import (
+	"testing"
+	"time"
+)
+
+func newOutChanExg() *Exchange {
+	return &Exchange{
+		ExgInfo:    &ExgInfo{ID: "test"},
+		WsOutChans: map[string][]*WsHandle{},
+		WsChanRefs: map[string]map[string]int{},
+	}
+}
+
+func makeOutChan[T any](e *Exchange, key string, cap int, policy string) chan T {
+	args := map[string]interface{}{ParamChanCap: cap, ParamChanPolicy: policy, ParamChanTimeout: 50}
+	return GetWsOutChan(e, key, func(c int) chan T {
+		return make(chan T, c)
+	}, args)
+}
+
+func TestWriteOutChanDrop(t *testing.T) {
+	e := newOutChanExg()
+	out := makeOutChan[int](e, "trades", 2, "")
+	for i := 1; i <= 4; i++ {
+		WriteOutChan(e, "trades", i, true)
+	}
+	if v := <-out; v != 3 {
+		t.Fatalf("dropOldest should keep 3,4, got %v", v)
+	}
+	out2 := makeOutChan[int](e, "mytrades", 2, "")
+	for i := 1; i <= 4; i++ {
+		WriteOutChan(e, "mytrades", i, false)
+	}
+	if v := <-out2; v != 1 {
+		t.Fatalf("dropNewest should keep 1,2, got %v", v)
+	}
+	out3 := makeOutChan[int](e, "kline", 2, ChanPolicyDropNewest)
+	for i := 1; i <= 3; i++ {
+		WriteOutChan(e, "kline", i, true)
+	}
+	if v := <-out3; v != 1 {
+		t.Fatalf("ChanPolicy should override popIfNeed, got %v", v)
+	}
+	drops := e.OutChanDrops()
+	if drops["trades"] != 2 || drops["mytrades"] != 2 || drops["kline"] != 1 {
+		t.Fatalf("unexpected drops: %v", drops)
+	}
+}
+
+func TestWriteOutChanBlock(t *testing.T) {
+	e := newOutChanExg()
+	out := makeOutChan[int](e, "book", 1, ChanPolicyBlock)
+	WriteOutChan(e, "book", 1, true)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		<-out
+	}()
+	if !WriteOutChan(e, "book", 2, true) {
+		t.Fatalf("block write should wait for consumer")
+	}
+	if WriteOutChan(e, "book", 3, true) {
+		t.Fatalf("block write should timeout")
+	}
+	if e.OutChanDrops()["book"] != 1 {
+		t.Fatalf("timeout should be counted as drop")
+	}
+	// close while a writer is waiting
+	e.AddWsChanRefs("book", "BTC/USDT")
+	done := make(chan bool)
+	go func() {
+		done <- WriteOutChan(e, "book", 4, true)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	e.DelWsChanRefs("book", "BTC/USDT")
+	if <-done {
+		t.Fatalf("write should fail after close")
+	}
+	// closing shouldn't wait for the timeout of a blocked writer
+	args := map[string]interface{}{ParamChanCap: 0, ParamChanPolicy: ChanPolicyBlock, ParamChanTimeout: 5000}
+	GetWsOutChan(e, "slow", func(c int) chan int { return make(chan int, c) }, args, "BTC/USDT")
+	go func() {
+		done <- WriteOutChan(e, "slow", 1, true)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	start := time.Now()
+	e.DelWsChanRefs("slow", "BTC/USDT")
+	if cost := time.Since(start); cost > time.Second {
+		t.Fatalf("close waited for blocked writer: %v", cost)
+	}
+	if <-done {
+		t.Fatalf("blocked write should fail after close")
+	}
+}
+
+func TestWriteOutChanConflate(t *testing.T) {
+	e := newOutChanExg()
+	out := makeOutChan[map[string]float64](e, "markPrice", 2, ChanPolicyConflate)
+	WriteOutChan(e, "markPrice", map[string]float64{"BTC": 1}, true)
+	WriteOutChan(e, "markPrice", map[string]float64{"ETH": 1}, true)
+	WriteOutChan(e, "markPrice", map[string]float64{"BTC": 2}, true)
+	if len(out) != 1 {
+		t.Fatalf("mark prices should be merged, got %d", len(out))
+	}
+	merged := <-out
+	if merged["BTC"] != 2 || merged["ETH"] != 1 {
+		t.Fatalf("unexpected merged: %v", merged)
+	}
+
+	books := makeOutChan[*OrderBook](e, "depth", 2, ChanPolicyConflate)
+	WriteOutChan(e, "depth", &OrderBook{Symbol: "BTC", Nonce: 1}, true)
+	WriteOutChan(e, "depth", &OrderBook{Symbol: "ETH", Nonce: 2}, true)
+	WriteOutChan(e, "depth", &OrderBook{Symbol: "BTC", Nonce: 3}, true)
+	if len(books) != 2 {
+		t.Fatalf("expect one book per symbol, got %d", len(books))
+	}
+	if b := <-books; b.Symbol != "ETH" {
+		t.Fatalf("books should keep order of last update, got %v", b.Symbol)
+	}
+	if b := <-books; b.Nonce != 3 {
+		t.Fatalf("latest BTC book should be kept, got %v", b.Nonce)
+	}
+	if drops := e.OutChanDrops(); drops["markPrice"] != 2 || drops["depth"] != 1 {
+		t.Fatalf("unexpected drops: %v", drops)
+	}
+
+	// not conflatable, fall back to dropOldest
+	ints := makeOutChan[int](e, "ints", 1, ChanPolicyConflate)
+	WriteOutChan(e, "ints", 1, false)
+	WriteOutChan(e, "ints", 2, false)
+	if v := <-ints; v != 2 {
+		t.Fatalf("should fall back to dropOldest, got %v", v)
+	}
+}
+
+func TestWsHandleRefs(t *testing.T) {
+	e := newOutChanExg()
+	create := func(c int) chan int { return make(chan int, c) }
+	a := GetWsOutChan(e, "trades", create, map[string]interface{}{}, "BTC", "ETH")
+	b := GetWsOutChan(e, "trades", create, map[string]interface{}{}, "BTC")
+	WriteOutChan(e, "trades", 1, true)
+	if len(a) != 1 || len(b) != 1 {
+		t.Fatalf("message should fan out to all handles")
+	}
+	if e.WsChanRefs["trades"]["BTC"] != 2 {
+		t.Fatalf("BTC should be referenced by 2 handles")
+	}
+	free := e.ReleaseWsRefs("trades", map[string]interface{}{ParamWatchChan: a}, "BTC")
+	if len(free) != 0 {
+		t.Fatalf("BTC is still used by b, got free %v", free)
+	}
+	free = e.ReleaseWsRefs("trades", map[string]interface{}{ParamWatchChan: a}, "ETH")
+	if len(free) != 1 || free[0] != "ETH" {
+		t.Fatalf("ETH should be free, got %v", free)
+	}
+	<-a
+	if _, ok := <-a; ok {
+		t.Fatalf("handle without refs should be closed")
+	}
+	if len(e.WsOutChans["trades"]) != 1 {
+		t.Fatalf("b should be kept")
+	}
+	// release from all handles without ParamWatchChan
+	if num := e.DelWsChanRefs("trades", "BTC"); num != 0 {
+		t.Fatalf("expect no refs left, got %d", num)
+	}
+	if _, ok := e.WsOutChans["trades"]; ok {
+		t.Fatalf("chanKey should be removed")
+	}
+	if PickFreeRefs([]int{1, 2, 3}, []string{"a", "b", "c"}, []string{"c", "a"})[1] != 3 {
+		t.Fatalf("PickFreeRefs should keep order of items")
+	}
+}
+
+func TestWsHandleRoute(t *testing.T) {
+	e := newOutChanExg()
+	create := func(c int) chan *OrderBook { return make(chan *OrderBook, c) }
+	btc := GetWsOutChan(e, "depth", create, map[string]interface{}{}, "BTC")
+	// calling Watch again to add a symbol returns a new chan only for that symbol
+	eth := GetWsOutChan(e, "depth", create, map[string]interface{}{}, "ETH")
+	WriteOutChan(e, "depth", &OrderBook{Symbol: "BTC"}, true)
+	WriteOutChan(e, "depth", &OrderBook{Symbol: "ETH"}, true)
+	WriteOutChan(e, "depth", &OrderBook{Symbol: "SOL"}, true)
+	if len(btc) != 1 || (<-btc).Symbol != "BTC" {
+		t.Fatalf("btc chan should only get BTC")
+	}
+	if len(eth) != 1 || (<-eth).Symbol != "ETH" {
+		t.Fatalf("eth chan should only get ETH")
+	}
+	if drops := e.OutChanDrops()["depth"]; drops != 0 {
+		t.Fatalf("unrouted messages shouldn't be dropped, got %d", drops)
+	}
+
+	klines := GetWsOutChan(e, "kline", func(c int) chan *PairTFKline {
+		return make(chan *PairTFKline, c)
+	}, map[string]interface{}{}, "BTC@1m")
+	klines5m := GetWsOutChan(e, "kline", func(c int) chan *PairTFKline {
+		return make(chan *PairTFKline, c)
+	}, map[string]interface{}{}, "BTC@5m")
+	WriteOutChan(e, "kline", &PairTFKline{Symbol: "BTC", TimeFrame: "1m"}, true)
+	WriteOutChan(e, "kline", &PairTFKline{Symbol: "ETH", TimeFrame: "1m"}, true)
+	WriteOutChan(e, "kline", &PairTFKline{Symbol: "BTC", TimeFrame: "5m"}, true)
+	if len(klines) != 1 || (<-klines).TimeFrame != "1m" {
+		t.Fatalf("1m handle should only get BTC 1m klines")
+	}
+	if len(klines5m) != 1 || (<-klines5m).TimeFrame != "5m" {
+		t.Fatalf("5m handle should only get BTC 5m klines")
+	}
+
+	createMap := func(c int) chan map[string]float64 { return make(chan map[string]float64, c) }
+	prices := GetWsOutChan(e, "markPrice", createMap, map[string]interface{}{}, "BTC")
+	all := GetWsOutChan(e, "markPrice", createMap, map[string]interface{}{}, WsRefAll)
+	WriteOutChan(e, "markPrice", map[string]float64{"BTC": 1, "ETH": 2}, true)
+	if v := <-prices; len(v) != 1 || v["BTC"] != 1 {
+		t.Fatalf("mark prices should be filtered, got %v", v)
+	}
+	if v := <-all; len(v) != 2 {
+		t.Fatalf("WsRefAll should get all prices, got %v", v)
+	}
+	WriteOutChan(e, "markPrice", map[string]float64{"ETH": 3}, true)
+	if len(prices) != 0 || len(all) != 1 {
+		t.Fatalf("unreferenced prices should be skipped")
+	}
+}
+
+func TestReleaseWsRefsShared(t *testing.T) {
+	e := newOutChanExg()
+	create := func(c int) chan *Trade { return make(chan *Trade, c) }
+	a := GetWsOutChan(e, "trades", create, map[string]interface{}{}, "BTC")
+	b := GetWsOutChan(e, "trades", create, map[string]interface{}{}, "BTC", "ETH")
+	// one of the independent watchers unwatches BTC without ParamWatchChan
+	free := e.ReleaseWsRefs("trades", nil, "BTC")
+	if len(free) != 0 {
+		t.Fatalf("BTC is still watched by a, got free %v", free)
+	}
+	if e.WsChanRefs["trades"]["BTC"] != 1 {
+		t.Fatalf("only one BTC ref should be released")
+	}
+	WriteOutChan(e, "trades", &Trade{Symbol: "BTC"}, true)
+	if len(a) != 1 || len(b) != 0 {
+		t.Fatalf("BTC should only go to a, got %d %d", len(a), len(b))
+	}
+	free = e.ReleaseWsRefs("trades", nil, "BTC", "ETH")
+	if len(free) != 2 {
+		t.Fatalf("BTC and ETH should be free, got %v", free)
+	}
+	if _, ok := e.WsOutChans["trades"]; ok {
+		t.Fatalf("all handles should be closed")
+	}
+	// released or never referenced keys must not be unsubscribed again
+	if free = e.ReleaseWsRefs("trades", nil, "BTC", "SOL"); len(free) != 0 {
+		t.Fatalf("released or unknown keys shouldn't be free, got %v", free)
+	}
+}